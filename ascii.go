@@ -0,0 +1,172 @@
+package matlab
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ASCIIOptions controls how WriteASCII writes a matrix, like the options of matlab's save -ascii. The zero value
+// writes values with 8 significant digits separated by spaces.
+type ASCIIOptions struct {
+	Double bool // writes 16 significant digits, like -double
+	Tabs   bool // separates values with tabs, like -tabs
+}
+
+// WriteASCII writes a 2-D numeric, logical, char or real sparse matrix as text with a line per row, the way matlab's
+// save -ascii does. Characters are written as their codes.
+func (m *Matrix) WriteASCII(w io.Writer, opts *ASCIIOptions) error {
+	var o ASCIIOptions
+	if opts != nil {
+		o = *opts
+	}
+	if len(m.Dimension) != 2 {
+		return fmt.Errorf("can only write 2-D matrices as ASCII, %s has %d dimensions", m.Name, len(m.Dimension))
+	}
+	if _, ok := m.Raw(); ok || !m.Class.isNumeric() && m.Class != mxCHAR && m.Class != mxSPARSE {
+		return fmt.Errorf("cannot write matrix %s of class %s as ASCII", m.Name, m.Class)
+	}
+	if m.flags.isComplex {
+		return fmt.Errorf("cannot write complex matrix %s as ASCII", m.Name)
+	}
+	rows, cols := int(m.Dimension[0]), int(m.Dimension[1])
+	values := m.value
+	if m.Class == mxSPARSE {
+		if len(m.jc) != cols+1 || len(m.ir) != len(m.value) {
+			return fmt.Errorf("invalid sparse matrix %s", m.Name)
+		}
+		values = make([]interface{}, rows*cols)
+		for i := range values {
+			values[i] = 0.0
+		}
+		for j := 0; j < cols; j++ {
+			for k := m.jc[j]; k < m.jc[j+1] && k < len(m.ir); k++ {
+				values[m.ir[k]+rows*j] = m.value[k]
+			}
+		}
+	} else if len(values) != rows*cols {
+		return fmt.Errorf("matrix %s has %d values but its dimensions need %d", m.Name, len(values), rows*cols)
+	}
+
+	// matlab right aligns values in columns of 16 or 24 characters unless they are separated by tabs
+	width, precision := 16, 7
+	if o.Double {
+		width, precision = 24, 15
+	}
+	if o.Tabs {
+		width = 0
+	}
+	bw := bufio.NewWriter(w)
+	for i := 0; i < rows; i++ {
+		for j := 0; j < cols; j++ {
+			if o.Tabs && j > 0 {
+				bw.WriteByte('\t')
+			}
+			f := toFloat64(values[i+rows*j])
+			if s, ok := nonFinite(f); ok {
+				fmt.Fprintf(bw, "%*s", width, s)
+			} else {
+				fmt.Fprintf(bw, "%*.*e", width, precision, f)
+			}
+		}
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// ReadASCII reads numeric text like the files matlab's save -ascii writes into a double matrix with the given name.
+// Values are separated by spaces, tabs or commas, text after % is a comment and every line has to hold as many
+// values.
+func ReadASCII(r io.Reader, name string) (*Matrix, error) {
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, math.MaxInt32)
+	var rows [][]float64
+	for line := 1; s.Scan(); line++ {
+		text := s.Text()
+		if i := strings.IndexByte(text, '%'); i >= 0 {
+			text = text[:i]
+		}
+		fields := strings.FieldsFunc(text, func(c rune) bool {
+			return c == ' ' || c == '\t' || c == ',' || c == '\r'
+		})
+		if len(fields) == 0 {
+			continue
+		}
+		if len(rows) > 0 && len(fields) != len(rows[0]) {
+			return nil, fmt.Errorf("line %d has %d values, expects %d like the lines before", line, len(fields), len(rows[0]))
+		}
+		row := make([]float64, len(fields))
+		for j, f := range fields {
+			v, err := strconv.ParseFloat(f, 64)
+			if err != nil && !isRangeError(err) {
+				return nil, fmt.Errorf("line %d: invalid number %q", line, f)
+			}
+			row[j] = v
+		}
+		rows = append(rows, row)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	m := &Matrix{Name: name, Class: mxDOUBLE, Dimension: []int32{0, 0}, value: []interface{}{}}
+	if len(rows) == 0 {
+		return m, nil
+	}
+	cols := len(rows[0])
+	if len(rows) > math.MaxInt32 || cols > math.MaxInt32 {
+		return nil, fmt.Errorf("too many values")
+	}
+	m.Dimension = []int32{int32(len(rows)), int32(cols)}
+	m.value = make([]interface{}, len(rows)*cols)
+	for i, row := range rows {
+		for j, v := range row {
+			m.value[i+len(rows)*j] = v
+		}
+	}
+	return m, nil
+}
+
+// isRangeError tells whether ParseFloat failed only because the value overflowed, in which case it returns ±Inf
+func isRangeError(err error) bool {
+	e, ok := err.(*strconv.NumError)
+	return ok && e.Err == strconv.ErrRange
+}
+
+// ReadASCIIFile reads a numeric text file with ReadASCII. Like matlab's load, the matrix is named after the file name
+// without its extension, with characters that aren't valid in names replaced by underscores.
+func ReadASCIIFile(path string) (*Matrix, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadASCII(file, asciiVarName(path))
+}
+
+// asciiVarName returns the variable name matlab's load gives the contents of a text file, e.g. X2020_data for
+// 2020-data.txt
+func asciiVarName(path string) string {
+	base := filepath.Base(path)
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+	var b strings.Builder
+	for _, c := range base {
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' {
+			b.WriteRune(c)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	name := b.String()
+	if name == "" || !(name[0] >= 'a' && name[0] <= 'z' || name[0] >= 'A' && name[0] <= 'Z') {
+		name = "X" + name
+	}
+	if len(name) > 63 {
+		name = name[:63]
+	}
+	return name
+}
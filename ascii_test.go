@@ -0,0 +1,81 @@
+package matlab
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteASCII(t *testing.T) {
+	m := &Matrix{Name: "a", Class: mxDOUBLE, Dimension: []int32{2, 2}, value: []interface{}{1.0, -0.5, math.NaN(), 1e10}}
+	var buf bytes.Buffer
+	assert.NoError(t, m.WriteASCII(&buf, nil))
+	assert.Equal(t, "   1.0000000e+00             NaN\n  -5.0000000e-01   1.0000000e+10\n", buf.String())
+
+	buf.Reset()
+	assert.NoError(t, m.WriteASCII(&buf, &ASCIIOptions{Double: true}))
+	assert.Equal(t, "   1.000000000000000e+00                     NaN\n  -5.000000000000000e-01   1.000000000000000e+10\n", buf.String())
+
+	buf.Reset()
+	assert.NoError(t, m.WriteASCII(&buf, &ASCIIOptions{Tabs: true}))
+	assert.Equal(t, "1.0000000e+00\tNaN\n-5.0000000e-01\t1.0000000e+10\n", buf.String())
+
+	buf.Reset()
+	c := &Matrix{Name: "c", Class: mxCHAR, Dimension: []int32{1, 2}, value: []interface{}{uint16('h'), uint16('i')}}
+	assert.NoError(t, c.WriteASCII(&buf, nil))
+	assert.Equal(t, "   1.0400000e+02   1.0500000e+02\n", buf.String())
+
+	sp := &Matrix{Name: "sp", Class: mxSPARSE, Dimension: []int32{2, 2}, value: []interface{}{5.0}, ir: []int{1}, jc: []int{0, 1, 1}}
+	buf.Reset()
+	assert.NoError(t, sp.WriteASCII(&buf, &ASCIIOptions{Tabs: true}))
+	assert.Equal(t, "0.0000000e+00\t0.0000000e+00\n5.0000000e+00\t0.0000000e+00\n", buf.String())
+
+	assert.Error(t, (&Matrix{Name: "z", Class: mxDOUBLE, Dimension: []int32{1, 1}, flags: Flags{isComplex: true},
+		value: []interface{}{1.0}, imag: []interface{}{1.0}}).WriteASCII(&buf, nil))
+	assert.Error(t, (&Matrix{Name: "x", Class: mxCELL, Dimension: []int32{0, 0}, value: []interface{}{}}).WriteASCII(&buf, nil))
+}
+
+func TestReadASCII(t *testing.T) {
+	m, err := ReadASCII(strings.NewReader("% sensor data\n 1 2 3\n\n4,NaN,-Inf % last row\n"), "data")
+	assert.NoError(t, err)
+	assert.Equal(t, "data", m.Name)
+	assert.Equal(t, []int32{2, 3}, m.Dimension)
+	values := m.DoubleArray()
+	assert.Equal(t, []float64{1, 4, 2}, values[:3])
+	assert.True(t, math.IsNaN(values[3]))
+	assert.Equal(t, []float64{3, math.Inf(-1)}, values[4:])
+
+	_, err = ReadASCII(strings.NewReader("1 2\n3\n"), "x")
+	assert.Error(t, err)
+	_, err = ReadASCII(strings.NewReader("1 a\n"), "x")
+	assert.Error(t, err)
+
+	// written values read back exactly with 16 digits
+	var buf bytes.Buffer
+	a := &Matrix{Name: "a", Class: mxDOUBLE, Dimension: []int32{1, 2}, value: []interface{}{math.Pi, -1.0 / 3}}
+	assert.NoError(t, a.WriteASCII(&buf, &ASCIIOptions{Double: true}))
+	a2, err := ReadASCII(&buf, "a")
+	assert.NoError(t, err)
+	assert.InDeltaSlice(t, a.DoubleArray(), a2.DoubleArray(), 1e-15)
+}
+
+func TestReadASCIIFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ascii")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "2020-data.txt")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("1 2\n"), 0644))
+	m, err := ReadASCIIFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "X2020_data", m.Name)
+	assert.Equal(t, []float64{1, 2}, m.DoubleArray())
+	assert.Equal(t, "results", asciiVarName("/tmp/results.dat"))
+}
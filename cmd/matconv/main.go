@@ -0,0 +1,104 @@
+// Command matconv converts .mat files to JSON and back. A .json input is converted to a .mat file, anything else is
+// read as a .mat file and converted to JSON. The JSON is an array of the variables in the mapping of
+// matlab.Matrix.MarshalJSON, sorted by name.
+//
+// Usage:
+//
+//	matconv [-level 5.0|7.3|4.0] input output
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/daniellowtw/matlab"
+)
+
+func main() {
+	level := flag.String("level", "5.0", "level of the .mat files written: 5.0, 7.3 or 4.0")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: matconv [flags] input output\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := convert(flag.Arg(0), flag.Arg(1), *level); err != nil {
+		fmt.Fprintf(os.Stderr, "matconv: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// convert converts the file at input into output, in the direction given by the extension of input
+func convert(input, output, level string) error {
+	in, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(filepath.Ext(input), ".json") {
+		err = jsonToMat(out, in, level)
+	} else {
+		err = matToJSON(out, in)
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", input, err)
+	}
+	return nil
+}
+
+func matToJSON(w io.Writer, r io.Reader) error {
+	f, err := matlab.NewFileFromReader(r)
+	if err != nil {
+		return err
+	}
+	names := f.GetVarsNames()
+	if err := f.Err(); err != nil {
+		return err
+	}
+	sort.Strings(names)
+	vars := make([]*matlab.Matrix, len(names))
+	for i, name := range names {
+		vars[i], _ = f.GetVar(name)
+	}
+	return json.NewEncoder(w).Encode(vars)
+}
+
+// jsonToMat writes the variables of the JSON in r to a .mat file of the given level. v7.3 files need w to be an
+// io.WriteSeeker.
+func jsonToMat(w io.Writer, r io.Reader, level string) error {
+	var vars []*matlab.Matrix
+	if err := json.NewDecoder(r).Decode(&vars); err != nil {
+		return err
+	}
+	f, err := matlab.NewFileFromWriter(w, &matlab.Header{Level: level, Platform: runtime.GOOS, Created: time.Now()})
+	if err != nil {
+		return err
+	}
+	for _, m := range vars {
+		if m == nil {
+			return fmt.Errorf("null variable")
+		}
+		if err := f.WriteElement(m); err != nil {
+			return err
+		}
+	}
+	return f.Close()
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConvert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "matconv")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	jsonPath := filepath.Join(dir, "vars.json")
+	assert.NoError(t, convert("../../testdata/varTypes.mat", jsonPath, ""))
+	data, err := ioutil.ReadFile(jsonPath)
+	assert.NoError(t, err)
+	var vars []map[string]interface{}
+	assert.NoError(t, json.Unmarshal(data, &vars))
+	assert.Len(t, vars, 4)
+	assert.Equal(t, "sample", vars[0]["name"])
+
+	for _, level := range []string{"5.0", "7.3"} {
+		matPath := filepath.Join(dir, "vars.mat")
+		assert.NoError(t, convert(jsonPath, matPath, level))
+		var buf bytes.Buffer
+		f, err := os.Open(matPath)
+		assert.NoError(t, err)
+		assert.NoError(t, matToJSON(&buf, f))
+		f.Close()
+		assert.Equal(t, string(data), buf.String(), level)
+	}
+
+	assert.Error(t, jsonToMat(&bytes.Buffer{}, bytes.NewBufferString(`[{"class":"double"}]`), "5.0"))
+	assert.Error(t, convert("../../testdata/missing.mat", jsonPath, ""))
+}
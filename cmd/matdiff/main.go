@@ -0,0 +1,79 @@
+// Command matdiff compares two .mat files variable by variable and prints added and removed variables and fields,
+// class and size changes, and the first differing elements of numbers, within a tolerance. Like diff, it exits with
+// status 0 if the files are the same, 1 if they differ and 2 if they cannot be read.
+//
+// Usage:
+//
+//	matdiff [-abs tol] [-rel tol] [-n count] a.mat b.mat
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/daniellowtw/matlab"
+)
+
+func main() {
+	var opts matlab.DiffOptions
+	flag.Float64Var(&opts.AbsTol, "abs", 0, "absolute tolerance of numbers")
+	flag.Float64Var(&opts.RelTol, "rel", 0, "relative tolerance of numbers")
+	flag.IntVar(&opts.MaxElements, "n", 10, "differing elements shown per variable, all when negative")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: matdiff [flags] a.mat b.mat\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	same, err := diff(os.Stdout, flag.Arg(0), flag.Arg(1), &opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "matdiff: %v\n", err)
+		os.Exit(2)
+	}
+	if !same {
+		os.Exit(1)
+	}
+}
+
+// diff prints the differences between the files at paths a and b and tells whether there were none
+func diff(w io.Writer, a, b string, opts *matlab.DiffOptions) (bool, error) {
+	fa, err := load(a)
+	if err != nil {
+		return false, err
+	}
+	fb, err := load(b)
+	if err != nil {
+		return false, err
+	}
+	diffs, err := matlab.Diff(fa, fb, opts)
+	if err != nil {
+		return false, err
+	}
+	for _, d := range diffs {
+		fmt.Fprintln(w, d)
+	}
+	return len(diffs) == 0, nil
+}
+
+// load reads all variables of the file at path
+func load(path string) (*matlab.File, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	f, err := matlab.NewFileFromReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	f.GetVarsNames()
+	if err := f.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return f, nil
+}
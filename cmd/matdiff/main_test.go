@@ -0,0 +1,25 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/daniellowtw/matlab"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	var buf bytes.Buffer
+	same, err := diff(&buf, "../../testdata/varTypes.mat", "../../testdata/varTypes.mat", &matlab.DiffOptions{})
+	assert.NoError(t, err)
+	assert.True(t, same)
+	assert.Empty(t, buf.String())
+
+	same, err = diff(&buf, "../../testdata/simpleStruct.mat", "../../testdata/varTypes.mat", &matlab.DiffOptions{})
+	assert.NoError(t, err)
+	assert.False(t, same)
+	assert.Contains(t, buf.String(), "X: removed\nsample: added\n")
+
+	_, err = diff(&buf, "../../testdata/varTypes.mat", "../../testdata/missing.mat", &matlab.DiffOptions{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,70 @@
+// Command matdump prints the variables of a .mat file the way matlab's command window displays them.
+//
+// Usage:
+//
+//	matdump [-width n] [-rows n] [-cols n] [-pages n] file.mat [name...]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/daniellowtw/matlab"
+)
+
+func main() {
+	var opts matlab.FormatOptions
+	flag.IntVar(&opts.Width, "width", 80, "line width that columns are split to fit into")
+	flag.IntVar(&opts.MaxRows, "rows", 20, "rows shown of each page, all when 0")
+	flag.IntVar(&opts.MaxColumns, "cols", 20, "columns shown of each page, all when 0")
+	flag.IntVar(&opts.MaxPages, "pages", 5, "pages shown of arrays with more than 2 dimensions, all when 0")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: matdump [flags] file.mat [name...]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := dump(os.Stdout, flag.Arg(0), flag.Args()[1:], &opts); err != nil {
+		fmt.Fprintf(os.Stderr, "matdump: %s: %v\n", flag.Arg(0), err)
+		os.Exit(1)
+	}
+}
+
+// dump prints the named variables of the file at path, or all of them in alphabetical order when no names are given
+func dump(w io.Writer, path string, names []string, opts *matlab.FormatOptions) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	f, err := matlab.NewFileFromReader(file)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		names = f.GetVarsNames()
+		if err := f.Err(); err != nil {
+			return err
+		}
+		sort.Strings(names)
+	}
+	for _, name := range names {
+		m, ok := f.GetVar(name)
+		if !ok {
+			if err := f.Err(); err != nil {
+				return err
+			}
+			return fmt.Errorf("variable %s not found", name)
+		}
+		if err := m.Format(w, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
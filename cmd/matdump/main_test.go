@@ -0,0 +1,23 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/daniellowtw/matlab"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDump(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, dump(&buf, "../../testdata/varTypes.mat", []string{"sample"}, nil))
+	assert.Contains(t, buf.String(), "sample =\n\n  1x2 cell array\n\n")
+
+	buf.Reset()
+	opts := &matlab.FormatOptions{MaxRows: 2, MaxColumns: 2}
+	assert.NoError(t, dump(&buf, "../../testdata/v73.mat", []string{"chunked"}, opts))
+	assert.Equal(t, "chunked =\n\n     0     6\n     1     0\n  ... 998 more rows\n\n  ... 198 more columns\n\n", buf.String())
+
+	assert.Error(t, dump(&buf, "../../testdata/varTypes.mat", []string{"missing"}, nil))
+	assert.Error(t, dump(&buf, "../../testdata/missing.mat", nil, nil))
+}
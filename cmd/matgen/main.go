@@ -0,0 +1,837 @@
+// Command matgen generates Go types and decode functions for the variables of a representative .mat file, so that
+// files of the same layout can be read into checked types instead of maps of matrices. It is meant to be run by
+// go generate:
+//
+//	//go:generate go run github.com/daniellowtw/matlab/cmd/matgen -o results_mat.go results.mat
+//
+// Struct variables become struct types with a field per matlab field, tagged with the matlab name like `mat:"trials"`.
+// Nested structs and cells get types of their own. Cells whose elements share a type become slices, other cells
+// become structs with a field per cell. Numeric and logical scalars become Go values of the class, other numeric
+// arrays slices of their values in column major order, char row vectors strings and char matrices slices of their
+// rows. Values that fit none of those, like sparse matrices or fields whose type differs between elements, are kept as
+// *matlab.Matrix.
+//
+// For each variable matgen writes Decode<Name>, which converts a matrix, and Read<Name>, which reads the variable from
+// a file, where Name is the exported name of the variable, e.g. TrialData for trial_data. Variables whose exported
+// names are taken by variables generated before them get a number, e.g. ReadX2 for x after X. Empty matrices decode
+// into zero values. By default all struct and cell variables are generated, in the order of their names.
+//
+// The generated code holds the helper functions it needs, so only one file can be generated into a package that way.
+// With -helpers the helper functions are written to a file of their own instead, the same for every run, which the
+// files generated into a package share. matgen doesn't overwrite files that it didn't generate.
+//
+// Usage:
+//
+//	matgen [-o output.go] [-helpers helpers.go] [-package name] [-vars a,b] file.mat
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/daniellowtw/matlab"
+)
+
+func main() {
+	output := flag.String("o", "", "output file, standard output by default")
+	helpers := flag.String("helpers", "", "file for the helper functions shared by the files generated into a package, within the output by default")
+	pkg := flag.String("package", os.Getenv("GOPACKAGE"), "package of the generated code, $GOPACKAGE or main by default")
+	vars := flag.String("vars", "", "comma separated variables to generate, all struct and cell variables by default")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: matgen [flags] file.mat\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *pkg == "" {
+		*pkg = "main"
+	}
+	var names []string
+	if *vars != "" {
+		names = strings.Split(*vars, ",")
+	}
+	var buf bytes.Buffer
+	err := generate(&buf, flag.Arg(0), *pkg, names, *helpers == "")
+	if err == nil && *output != "" {
+		err = writeGenerated(*output, buf.Bytes())
+	} else if err == nil {
+		_, err = os.Stdout.Write(buf.Bytes())
+	}
+	if err == nil && *helpers != "" {
+		buf.Reset()
+		if err = generateHelpers(&buf, *pkg); err == nil {
+			err = writeGenerated(*helpers, buf.Bytes())
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "matgen: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// generatedHeader starts every file matgen writes
+const generatedHeader = "// Code generated by matgen"
+
+// writeGenerated writes generated code to path unless it holds a file that matgen didn't generate
+func writeGenerated(path string, src []byte) error {
+	old, err := ioutil.ReadFile(path)
+	if err == nil && !bytes.HasPrefix(old, []byte(generatedHeader)) {
+		return fmt.Errorf("%s was not generated by matgen, refusing to overwrite it", path)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return ioutil.WriteFile(path, src, 0644)
+}
+
+// generate writes the code for the variables with the given names, or all struct and cell variables, of the file at
+// path. The helper functions the code uses are only written if helpers is set, otherwise they come from
+// generateHelpers.
+func generate(w io.Writer, path, pkg string, names []string, helpers bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	f, err := matlab.NewFileFromReader(file)
+	if err != nil {
+		return err
+	}
+	var vars []*matlab.Matrix
+	if names == nil {
+		all := f.GetVarsNames()
+		if err := f.Err(); err != nil {
+			return err
+		}
+		sort.Strings(all)
+		for _, name := range all {
+			m, _ := f.GetVar(name)
+			if c := m.ClassName(); c == "struct" || c == "cell" {
+				vars = append(vars, m)
+			}
+		}
+		if len(vars) == 0 {
+			return fmt.Errorf("%s has no struct or cell variables, choose variables with -vars", path)
+		}
+	}
+	for _, name := range names {
+		m, ok := f.GetVar(strings.TrimSpace(name))
+		if !ok {
+			if err := f.Err(); err != nil {
+				return err
+			}
+			return fmt.Errorf("variable %s not found", name)
+		}
+		vars = append(vars, m)
+	}
+
+	g := &generator{names: map[string]bool{}, helpers: map[string]bool{}}
+	for _, m := range vars {
+		g.variable(m)
+	}
+	if !helpers {
+		g.helpers = map[string]bool{}
+	}
+	return writeSource(w, " from "+filepath.Base(path), pkg, g.helpers["matStrings"], g.code.String()+g.helperCode())
+}
+
+// generateHelpers writes all helper functions, which the code of every file generated into package pkg shares
+func generateHelpers(w io.Writer, pkg string) error {
+	g := &generator{helpers: map[string]bool{"matString": true, "matStrings": true, "matStructs": true, "matCells": true, "matMatrix": true}}
+	for _, prim := range goPrims {
+		name := "mat" + strings.ToUpper(prim[:1]) + prim[1:]
+		g.helpers[name], g.helpers[name+"s"] = true, true
+	}
+	g.helpers["matComplex128"], g.helpers["matComplex128s"] = true, true
+	return writeSource(w, "", pkg, true, g.helperCode())
+}
+
+// writeSource writes formatted generated code with its header and imports
+func writeSource(w io.Writer, origin, pkg string, utf16 bool, code string) error {
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "%s%s. DO NOT EDIT.\n\npackage %s\n\nimport (\n\t\"fmt\"\n", generatedHeader, origin, pkg)
+	if utf16 {
+		src.WriteString("\t\"unicode/utf16\"\n")
+	}
+	src.WriteString("\n\t\"github.com/daniellowtw/matlab\"\n)\n")
+	src.WriteString(code)
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		return fmt.Errorf("formatting generated code: %v", err)
+	}
+	_, err = w.Write(formatted)
+	return err
+}
+
+type kind int
+
+const (
+	kindEmpty   kind = iota // empty matrix, whose type is decided by other values
+	kindMatrix              // kept as *matlab.Matrix
+	kindScalar              // numeric or logical scalar
+	kindSlice               // numeric or logical array
+	kindString              // char row vector
+	kindStrings             // char matrix
+	kindStruct              // scalar struct
+	kindStructs             // struct array
+	kindCell                // cell whose elements share a type
+	kindTuple               // cell of elements of different types
+)
+
+// goType is the Go type of a matlab value
+type goType struct {
+	kind   kind
+	prim   string     // Go type of scalars and slice elements, e.g. float64
+	fields []*goField // structs
+	elem   *goType    // cells
+	elems  []*goType  // tuples
+	name   string     // type name of structs, cells and tuples
+}
+
+type goField struct {
+	name   string // matlab name
+	goName string
+	typ    *goType
+}
+
+var goPrims = map[string]string{
+	"double":  "float64",
+	"single":  "float32",
+	"int8":    "int8",
+	"uint8":   "uint8",
+	"int16":   "int16",
+	"uint16":  "uint16",
+	"int32":   "int32",
+	"uint32":  "uint32",
+	"int64":   "int64",
+	"uint64":  "uint64",
+	"logical": "bool",
+}
+
+// infer returns the type of a value
+func infer(m *matlab.Matrix) *goType {
+	if m == nil {
+		return &goType{kind: kindEmpty}
+	}
+	if _, ok := m.Raw(); ok || m.IsSparse() {
+		return &goType{kind: kindMatrix}
+	}
+	n := 1
+	for _, d := range m.Dimension {
+		n *= int(d)
+	}
+	class := m.ClassName()
+	switch class {
+	case "struct":
+		t := &goType{kind: kindStruct}
+		if n != 1 {
+			t.kind = kindStructs
+		}
+		for _, name := range m.FieldNames() {
+			t.fields = append(t.fields, &goField{name: name, typ: &goType{kind: kindEmpty}})
+		}
+		for i := 0; i < n; i++ {
+			keys, _ := m.GetAtLocation(i).(map[string]*matlab.Matrix)
+			for _, f := range t.fields {
+				f.typ = unifyOrMatrix(f.typ, infer(keys[f.name]))
+			}
+		}
+		return t
+	case "cell":
+		elems := make([]*goType, n)
+		for i := range elems {
+			c, _ := m.GetAtLocation(i).(*matlab.Matrix)
+			elems[i] = infer(c)
+		}
+		elem := &goType{kind: kindEmpty}
+		for _, e := range elems {
+			var ok bool
+			if elem, ok = unify(elem, e); !ok {
+				return &goType{kind: kindTuple, elems: elems}
+			}
+		}
+		return &goType{kind: kindCell, elem: elem}
+	case "char":
+		if len(m.Dimension) != 2 {
+			return &goType{kind: kindMatrix}
+		}
+		if n == 0 || m.Dimension[0] == 1 {
+			return &goType{kind: kindString}
+		}
+		return &goType{kind: kindStrings}
+	}
+	prim, ok := goPrims[class]
+	switch {
+	case !ok:
+		return &goType{kind: kindMatrix}
+	case n == 0 && class == "double":
+		// [] often stands for a missing value of any type
+		return &goType{kind: kindEmpty}
+	case m.IsComplex():
+		prim = "complex128"
+	}
+	if n == 1 {
+		return &goType{kind: kindScalar, prim: prim}
+	}
+	return &goType{kind: kindSlice, prim: prim}
+}
+
+// unify returns a type that can hold values of both types, e.g. a slice for a scalar and a slice of the same class
+func unify(a, b *goType) (*goType, bool) {
+	switch {
+	case a.kind == kindEmpty:
+		return b, true
+	case b.kind == kindEmpty:
+		return a, true
+	case a.kind == kindMatrix && b.kind == kindMatrix:
+		return a, true
+	case (a.kind == kindScalar || a.kind == kindSlice) && (b.kind == kindScalar || b.kind == kindSlice) && a.prim == b.prim:
+		if a.kind == kindSlice {
+			return a, true
+		}
+		return b, true
+	case (a.kind == kindString || a.kind == kindStrings) && (b.kind == kindString || b.kind == kindStrings):
+		if a.kind == kindStrings {
+			return a, true
+		}
+		return b, true
+	case (a.kind == kindStruct || a.kind == kindStructs) && (b.kind == kindStruct || b.kind == kindStructs):
+		t := &goType{kind: kindStruct}
+		if a.kind == kindStructs || b.kind == kindStructs {
+			t.kind = kindStructs
+		}
+		for _, f := range a.fields {
+			t.fields = append(t.fields, &goField{name: f.name, typ: f.typ})
+		}
+		for _, f := range b.fields {
+			found := false
+			for _, tf := range t.fields {
+				if tf.name == f.name {
+					tf.typ, found = unifyOrMatrix(tf.typ, f.typ), true
+				}
+			}
+			if !found {
+				t.fields = append(t.fields, &goField{name: f.name, typ: f.typ})
+			}
+		}
+		return t, true
+	case a.kind == kindCell && b.kind == kindCell:
+		elem, ok := unify(a.elem, b.elem)
+		return &goType{kind: kindCell, elem: elem}, ok
+	case a.kind == kindTuple && b.kind == kindTuple && len(a.elems) == len(b.elems):
+		t := &goType{kind: kindTuple}
+		for i := range a.elems {
+			e, ok := unify(a.elems[i], b.elems[i])
+			if !ok {
+				return nil, false
+			}
+			t.elems = append(t.elems, e)
+		}
+		return t, true
+	}
+	return nil, false
+}
+
+func unifyOrMatrix(a, b *goType) *goType {
+	if t, ok := unify(a, b); ok {
+		return t
+	}
+	return &goType{kind: kindMatrix}
+}
+
+// exported turns a matlab name into an exported Go name, e.g. trial_data into TrialData
+func exported(name string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(name, "_") {
+		if part != "" {
+			b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+		}
+	}
+	if b.Len() == 0 {
+		return "X"
+	}
+	return b.String()
+}
+
+// generator collects the generated declarations
+type generator struct {
+	code    bytes.Buffer
+	names   map[string]bool // type and function names in use
+	helpers map[string]bool // helper functions the code uses
+}
+
+// unique returns name, or name followed by a number if it is in use
+func unique(used map[string]bool, name string) string {
+	res := name
+	for i := 2; used[res]; i++ {
+		res = fmt.Sprintf("%s%d", name, i)
+	}
+	used[res] = true
+	return res
+}
+
+// variable generates the types of a variable and its exported decode and read functions. Variables whose names only
+// differ in case, like x and X, get functions of their own.
+func (g *generator) variable(m *matlab.Matrix) {
+	t := infer(m)
+	base := exported(m.Name)
+	name := base
+	for i := 2; g.names["Decode"+name] || g.names["Read"+name]; i++ {
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+	g.names["Decode"+name], g.names["Read"+name] = true, true
+	g.name(t, base)
+	g.declare(t)
+	expr, decoder := g.expr(t), g.decoder(t)
+	fmt.Fprintf(&g.code, `
+// Decode%[1]s decodes variable %[2]s
+func Decode%[1]s(m *matlab.Matrix) (%[3]s, error) {
+	return %[4]s(m)
+}
+
+// Read%[1]s reads variable %[2]s from f
+func Read%[1]s(f *matlab.File) (res %[3]s, err error) {
+	m, ok := f.GetVar(%[5]q)
+	if !ok {
+		if err = f.Err(); err == nil {
+			err = fmt.Errorf("variable %[2]s not found")
+		}
+		return res, err
+	}
+	return Decode%[1]s(m)
+}
+`, name, m.Name, expr, decoder, m.Name)
+}
+
+// name names the struct, cell and tuple types within t, starting with prefix. Empty values that no other value gave
+// a type are kept as matrices.
+func (g *generator) name(t *goType, prefix string) {
+	if t.name != "" {
+		return
+	}
+	switch t.kind {
+	case kindEmpty:
+		t.kind = kindMatrix
+	case kindStruct, kindStructs:
+		t.name = unique(g.names, prefix)
+		used := map[string]bool{}
+		for _, f := range t.fields {
+			f.goName = unique(used, exported(f.name))
+			g.name(f.typ, t.name+f.goName)
+		}
+	case kindCell:
+		t.name = unique(g.names, prefix)
+		g.name(t.elem, t.name+"Elem")
+	case kindTuple:
+		t.name = unique(g.names, prefix)
+		for i, e := range t.elems {
+			g.name(e, fmt.Sprintf("%s%d", t.name, i+1))
+		}
+	}
+}
+
+// expr returns the Go type expression of t
+func (g *generator) expr(t *goType) string {
+	switch t.kind {
+	case kindScalar:
+		return t.prim
+	case kindSlice:
+		return "[]" + t.prim
+	case kindString:
+		return "string"
+	case kindStrings:
+		return "[]string"
+	case kindStruct, kindCell, kindTuple:
+		return t.name
+	case kindStructs:
+		return "[]" + t.name
+	}
+	return "*matlab.Matrix"
+}
+
+// decoder returns the name of the function decoding a matrix into t
+func (g *generator) decoder(t *goType) string {
+	var name string
+	switch t.kind {
+	case kindScalar:
+		name = "mat" + strings.ToUpper(t.prim[:1]) + t.prim[1:]
+	case kindSlice:
+		name = "mat" + strings.ToUpper(t.prim[:1]) + t.prim[1:] + "s"
+	case kindString:
+		name = "matString"
+	case kindStrings:
+		name = "matStrings"
+	case kindStruct, kindCell, kindTuple:
+		return "decode" + t.name
+	case kindStructs:
+		return "decode" + t.name + "Array"
+	default:
+		name = "matMatrix"
+	}
+	g.helpers[name] = true
+	return name
+}
+
+// declare writes the declarations and decode functions of the named types within t
+func (g *generator) declare(t *goType) {
+	switch t.kind {
+	case kindStruct, kindStructs:
+		g.declareStruct(t)
+		for _, f := range t.fields {
+			g.declare(f.typ)
+		}
+	case kindCell:
+		g.helpers["matCells"] = true
+		fmt.Fprintf(&g.code, `
+type %[1]s []%[2]s
+
+func decode%[1]s(m *matlab.Matrix) (%[1]s, error) {
+	cells, err := matCells(m)
+	if err != nil {
+		return nil, err
+	}
+	res := make(%[1]s, len(cells))
+	for i, c := range cells {
+		if res[i], err = %[3]s(c); err != nil {
+			return nil, fmt.Errorf("cell %%d: %%v", i+1, err)
+		}
+	}
+	return res, nil
+}
+`, t.name, g.expr(t.elem), g.decoder(t.elem))
+		g.declare(t.elem)
+	case kindTuple:
+		g.helpers["matCells"] = true
+		fmt.Fprintf(&g.code, "\ntype %s struct {\n", t.name)
+		for i, e := range t.elems {
+			fmt.Fprintf(&g.code, "\tC%d %s `mat:\"{%d}\"`\n", i+1, g.expr(e), i+1)
+		}
+		fmt.Fprintf(&g.code, `}
+
+func decode%[1]s(m *matlab.Matrix) (res %[1]s, err error) {
+	cells, err := matCells(m)
+	if err != nil || len(cells) == 0 {
+		return res, err
+	}
+	if len(cells) != %[2]d {
+		return res, fmt.Errorf("expects %[2]d cells, got %%d", len(cells))
+	}
+`, t.name, len(t.elems))
+		for i, e := range t.elems {
+			fmt.Fprintf(&g.code, `	if res.C%[1]d, err = %[2]s(cells[%[3]d]); err != nil {
+		return res, fmt.Errorf("cell %[1]d: %%v", err)
+	}
+`, i+1, g.decoder(e), i)
+		}
+		g.code.WriteString("\treturn res, nil\n}\n")
+		for _, e := range t.elems {
+			g.declare(e)
+		}
+	}
+}
+
+func (g *generator) declareStruct(t *goType) {
+	g.helpers["matStructs"] = true
+	fmt.Fprintf(&g.code, "\ntype %s struct {\n", t.name)
+	for _, f := range t.fields {
+		fmt.Fprintf(&g.code, "\t%s %s `mat:%q`\n", f.goName, g.expr(f.typ), f.name)
+	}
+	fmt.Fprintf(&g.code, "}\n\nfunc decode%sElement(fields map[string]*matlab.Matrix) (res %s, err error) {\n", t.name, t.name)
+	for _, f := range t.fields {
+		fmt.Fprintf(&g.code, `	if v, ok := fields[%[1]q]; ok {
+		if res.%[2]s, err = %[3]s(v); err != nil {
+			return res, fmt.Errorf("%[1]s: %%v", err)
+		}
+	}
+`, f.name, f.goName, g.decoder(f.typ))
+	}
+	g.code.WriteString("\treturn res, nil\n}\n")
+	if t.kind == kindStruct {
+		fmt.Fprintf(&g.code, `
+func decode%[1]s(m *matlab.Matrix) (%[1]s, error) {
+	elements, err := matStructs(m)
+	if err != nil || len(elements) == 0 {
+		return %[1]s{}, err
+	}
+	if len(elements) != 1 {
+		return %[1]s{}, fmt.Errorf("expects a scalar struct, got a %%s", matDescribe(m))
+	}
+	return decode%[1]sElement(elements[0])
+}
+`, t.name)
+		return
+	}
+	fmt.Fprintf(&g.code, `
+func decode%[1]sArray(m *matlab.Matrix) ([]%[1]s, error) {
+	elements, err := matStructs(m)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]%[1]s, len(elements))
+	for i, e := range elements {
+		if res[i], err = decode%[1]sElement(e); err != nil {
+			return nil, fmt.Errorf("element %%d: %%v", i+1, err)
+		}
+	}
+	return res, nil
+}
+`, t.name)
+}
+
+// helperCode returns the helper functions the generated code uses
+func (g *generator) helperCode() string {
+	if len(g.helpers) == 0 {
+		return ""
+	}
+	var names []string
+	for name := range g.helpers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	b.WriteString(helperDescribe)
+	values := false
+	for _, name := range names {
+		switch name {
+		case "matString":
+			b.WriteString(helperString)
+		case "matStrings":
+			b.WriteString(helperStrings)
+		case "matStructs":
+			b.WriteString(helperStructs)
+		case "matCells":
+			b.WriteString(helperCells)
+		case "matMatrix":
+			b.WriteString(helperMatrix)
+		default:
+			b.WriteString(primHelper(name))
+			values = values || !strings.HasPrefix(name, "matComplex")
+		}
+	}
+	if values {
+		b.WriteString(helperValues)
+	}
+	if g.helpers["matComplex128"] || g.helpers["matComplex128s"] {
+		b.WriteString(helperComplexValues)
+	}
+	return b.String()
+}
+
+// primHelper returns the helper decoding scalars or slices, e.g. matFloat64 or matFloat64s
+func primHelper(name string) string {
+	prim := strings.ToLower(strings.TrimPrefix(name, "mat")[:1]) + strings.TrimPrefix(name, "mat")[1:]
+	slice := strings.HasSuffix(prim, "s")
+	prim = strings.TrimSuffix(prim, "s")
+	class, conv := "", "v.("+prim+")"
+	for c, p := range goPrims {
+		if p == prim {
+			class = c
+		}
+	}
+	if prim == "bool" {
+		conv = "v.(uint8) != 0"
+	}
+	values := fmt.Sprintf("matValues(m, %q)", class)
+	if prim == "complex128" {
+		values, conv = "matComplexValues(m)", "v"
+	}
+	r := strings.NewReplacer("NAME", name, "TYPE", prim, "VALUES", values, "CONV", conv)
+	if slice {
+		return r.Replace(helperSlice)
+	}
+	return r.Replace(helperScalar)
+}
+
+const helperDescribe = `
+// matDescribe describes the size and class of a matrix for error messages, e.g. 1x3 char
+func matDescribe(m *matlab.Matrix) string {
+	s := ""
+	for i, d := range m.Dimension {
+		if i > 0 {
+			s += "x"
+		}
+		s += fmt.Sprint(d)
+	}
+	if m.IsSparse() {
+		s += " sparse"
+	}
+	if m.IsComplex() {
+		s += " complex"
+	}
+	return s + " " + m.ClassName()
+}
+
+// matEmpty tells whether a matrix has no elements
+func matEmpty(m *matlab.Matrix) bool {
+	for _, d := range m.Dimension {
+		if d == 0 {
+			return true
+		}
+	}
+	return false
+}
+`
+
+const helperValues = `
+// matValues returns the values of a real full matrix of the given class. Empty matrices of any class have no values.
+func matValues(m *matlab.Matrix, class string) ([]interface{}, error) {
+	if m == nil {
+		return nil, fmt.Errorf("missing value")
+	}
+	if matEmpty(m) {
+		return nil, nil
+	}
+	if m.ClassName() != class || m.IsComplex() || m.IsSparse() {
+		return nil, fmt.Errorf("expects %s values, got a %s", class, matDescribe(m))
+	}
+	return m.Value(), nil
+}
+`
+
+const helperComplexValues = `
+// matComplexValues returns the values of a full double or single matrix, which may be real
+func matComplexValues(m *matlab.Matrix) ([]complex128, error) {
+	if m == nil {
+		return nil, fmt.Errorf("missing value")
+	}
+	if matEmpty(m) {
+		return nil, nil
+	}
+	if m.IsSparse() || m.ClassName() != "double" && m.ClassName() != "single" {
+		return nil, fmt.Errorf("expects complex values, got a %s", matDescribe(m))
+	}
+	return m.ComplexArray(), nil
+}
+`
+
+const helperScalar = `
+// NAME returns the value of a scalar, or the zero value for empty matrices
+func NAME(m *matlab.Matrix) (res TYPE, err error) {
+	values, err := VALUES
+	if err != nil || len(values) == 0 {
+		return res, err
+	}
+	if len(values) != 1 {
+		return res, fmt.Errorf("expects a scalar, got a %s", matDescribe(m))
+	}
+	v := values[0]
+	return CONV, nil
+}
+`
+
+const helperSlice = `
+// NAME returns the values of an array in column major order
+func NAME(m *matlab.Matrix) ([]TYPE, error) {
+	values, err := VALUES
+	if err != nil {
+		return nil, err
+	}
+	res := make([]TYPE, len(values))
+	for i, v := range values {
+		res[i] = CONV
+	}
+	return res, nil
+}
+`
+
+const helperString = `
+// matString returns the text of a char row vector, or "" for empty matrices
+func matString(m *matlab.Matrix) (string, error) {
+	if m == nil {
+		return "", fmt.Errorf("missing value")
+	}
+	if matEmpty(m) {
+		return "", nil
+	}
+	if m.ClassName() != "char" || len(m.Dimension) != 2 || m.Dimension[0] != 1 {
+		return "", fmt.Errorf("expects a char row vector, got a %s", matDescribe(m))
+	}
+	return string(m.String()), nil
+}
+`
+
+const helperStrings = `
+// matStrings returns the rows of a char matrix
+func matStrings(m *matlab.Matrix) ([]string, error) {
+	if m == nil {
+		return nil, fmt.Errorf("missing value")
+	}
+	if matEmpty(m) {
+		return nil, nil
+	}
+	if m.ClassName() != "char" || len(m.Dimension) != 2 {
+		return nil, fmt.Errorf("expects a char matrix, got a %s", matDescribe(m))
+	}
+	rows, cols := int(m.Dimension[0]), int(m.Dimension[1])
+	res := make([]string, rows)
+	for i := range res {
+		units := make([]uint16, cols)
+		for j := range units {
+			units[j], _ = m.Value()[i+rows*j].(uint16)
+		}
+		res[i] = string(utf16.Decode(units))
+	}
+	return res, nil
+}
+`
+
+const helperStructs = `
+// matStructs returns the elements of a struct array
+func matStructs(m *matlab.Matrix) ([]map[string]*matlab.Matrix, error) {
+	if m == nil {
+		return nil, fmt.Errorf("missing value")
+	}
+	if matEmpty(m) {
+		return nil, nil
+	}
+	if m.ClassName() != "struct" {
+		return nil, fmt.Errorf("expects a struct, got a %s", matDescribe(m))
+	}
+	res := make([]map[string]*matlab.Matrix, len(m.Value()))
+	for i, v := range m.Value() {
+		res[i], _ = v.(map[string]*matlab.Matrix)
+	}
+	return res, nil
+}
+`
+
+const helperCells = `
+// matCells returns the elements of a cell array
+func matCells(m *matlab.Matrix) ([]*matlab.Matrix, error) {
+	if m == nil {
+		return nil, fmt.Errorf("missing value")
+	}
+	if matEmpty(m) {
+		return nil, nil
+	}
+	if m.ClassName() != "cell" {
+		return nil, fmt.Errorf("expects a cell, got a %s", matDescribe(m))
+	}
+	res := make([]*matlab.Matrix, len(m.Value()))
+	for i, v := range m.Value() {
+		res[i], _ = v.(*matlab.Matrix)
+	}
+	return res, nil
+}
+`
+
+const helperMatrix = `
+// matMatrix returns values without a Go type as they are
+func matMatrix(m *matlab.Matrix) (*matlab.Matrix, error) {
+	if m == nil {
+		return nil, fmt.Errorf("missing value")
+	}
+	return m, nil
+}
+`
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/daniellowtw/matlab"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerate(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, generate(&buf, "../../testdata/varTypes.mat", "results", nil, true))
+	src := buf.String()
+	_, err := parser.ParseFile(token.NewFileSet(), "vars.go", src, 0)
+	assert.NoError(t, err)
+	assert.Contains(t, src, "// Code generated by matgen from varTypes.mat. DO NOT EDIT.\n\npackage results\n")
+	assert.Contains(t, src, "\tInt8row   []int8    `mat:\"int8row\"`\n")
+	assert.Contains(t, src, "\tChars     string    `mat:\"chars\"`\n")
+	assert.Contains(t, src, "\tBools     []bool    `mat:\"bools\"`\n")
+	assert.Contains(t, src, "\tStrcell   XStrcell  `mat:\"strcell\"`\n")
+	assert.Contains(t, src, "type XStrcell []string\n")
+	assert.Contains(t, src, "\tScalar float64   `mat:\"scalar\"`\n")
+	// a cell holding a struct and a sparse matrix
+	assert.Contains(t, src, "\tC1 Sample1        `mat:\"{1}\"`\n\tC2 *matlab.Matrix `mat:\"{2}\"`\n")
+	assert.Contains(t, src, "func ReadX(f *matlab.File) (res X, err error) {\n")
+	assert.Contains(t, src, "func DecodeSample(m *matlab.Matrix) (Sample, error) {\n")
+
+	buf.Reset()
+	assert.NoError(t, generate(&buf, "../../testdata/simpleStruct.mat", "main", []string{"X"}, true))
+	assert.Contains(t, buf.String(), "type X struct {\n\tW float64 `mat:\"w\"`\n\tY float64 `mat:\"y\"`\n\tZ string  `mat:\"z\"`\n}\n")
+	assert.NotContains(t, buf.String(), "type Z")
+	assert.Contains(t, buf.String(), "func matFloat64(m *matlab.Matrix) (res float64, err error) {\n")
+	buf.Reset()
+	assert.NoError(t, generate(&buf, "../../testdata/simpleStruct.mat", "main", []string{"X"}, false))
+	assert.NotContains(t, buf.String(), "func matFloat64")
+
+	assert.Error(t, generate(&buf, "../../testdata/simpleStruct.mat", "main", []string{"missing"}, true))
+	assert.Error(t, generate(&buf, "../../testdata/missing.mat", "main", nil, true))
+}
+
+const generatedMain = `package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/daniellowtw/matlab"
+)
+
+func main() {
+	var files []*matlab.File
+	for _, path := range os.Args[1:] {
+		r, err := os.Open(path)
+		if err != nil {
+			panic(err)
+		}
+		f, err := matlab.NewFileFromReader(r)
+		if err != nil {
+			panic(err)
+		}
+		files = append(files, f)
+	}
+	x, err := ReadX(files[0])
+	fmt.Printf("%+v %v\n", x, err)
+	x2, err := ReadX2(files[0])
+	fmt.Printf("%v %q %q %v\n", x2.Int8row, x2.Chars, x2.Strcell, err)
+	z, err := ReadZ(files[0])
+	fmt.Printf("%+v %v\n", z, err)
+	trials, err := ReadTrialData(files[1])
+	fmt.Printf("%+v %v\n", trials, err)
+	m, _ := files[1].GetVar("trial_data")
+	_, err = DecodeX(m)
+	fmt.Println(err)
+}
+`
+
+// TestGeneratedCode builds the code generated for two files into one package and decodes the files with it
+func TestGeneratedCode(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil || testing.Short() {
+		t.Skip("needs the go command")
+	}
+	// the package has to be within the module to import the matlab package
+	dir, err := ioutil.TempDir(".", "_generated")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	var trials matlab.Matrix
+	assert.NoError(t, json.Unmarshal([]byte(`{"name":"trial_data","class":"struct","dims":[1,2],"fields":["id","label"],"data":[
+		{"id":{"class":"int32","dims":[1,1],"data":[1]},"label":{"class":"char","dims":[1,1],"data":"a"}},
+		{"id":{"class":"int32","dims":[1,1],"data":[2]},"label":{"class":"char","dims":[1,2],"data":"bc"}}
+	]}`), &trials))
+	other := filepath.Join(dir, "trials.mat")
+	out, err := os.Create(other)
+	assert.NoError(t, err)
+	w, err := matlab.NewFileFromWriter(out, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, w.WriteElement(&trials))
+	assert.NoError(t, out.Close())
+
+	// v73.mat has variables x and X, and z and Z
+	var buf bytes.Buffer
+	assert.NoError(t, generate(&buf, "../../testdata/v73.mat", "main", nil, false))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "v73_mat.go"), buf.Bytes(), 0644))
+	buf.Reset()
+	assert.NoError(t, generate(&buf, other, "main", nil, false))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "trials_mat.go"), buf.Bytes(), 0644))
+	buf.Reset()
+	assert.NoError(t, generateHelpers(&buf, "main"))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "matgen_helpers.go"), buf.Bytes(), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte(generatedMain), 0644))
+
+	res, err := exec.Command("go", "run", "./"+dir, "../../testdata/v73.mat", other).CombinedOutput()
+	if !assert.NoError(t, err, string(res)) {
+		return
+	}
+	assert.Equal(t, `{W:1 Y:2 Z:abc} <nil>
+[127 0 -128] "test string" ["test" "string"] <nil>
+{C1:someString C2:123} <nil>
+[{Id:1 Label:a} {Id:2 Label:bc}] <nil>
+expects a scalar struct, got a 1x2 struct
+`, string(res))
+}
+
+// TestFunctionNames checks that functions are named after variables even when their types are named differently
+func TestFunctionNames(t *testing.T) {
+	var a, ab matlab.Matrix
+	assert.NoError(t, json.Unmarshal([]byte(`{"name":"a","class":"struct","dims":[1,1],"fields":["b"],"data":[
+		{"b":{"class":"struct","dims":[1,1],"fields":["c"],"data":[{"c":{"class":"double","dims":[1,1],"data":[1]}}]}}]}`), &a))
+	assert.NoError(t, json.Unmarshal([]byte(`{"name":"a_b","class":"cell","dims":[1,1],"data":[
+		{"class":"double","dims":[1,1],"data":[2]}]}`), &ab))
+	g := &generator{names: map[string]bool{}, helpers: map[string]bool{}}
+	g.variable(&a)
+	g.variable(&ab)
+	src := g.code.String()
+	assert.Contains(t, src, "type AB struct {\n")
+	assert.Contains(t, src, "type AB2 []float64\n")
+	assert.Contains(t, src, "func DecodeAB(m *matlab.Matrix) (AB2, error) {\n")
+	assert.Contains(t, src, "func ReadA(f *matlab.File) (res A, err error) {\n")
+}
+
+func TestWriteGenerated(t *testing.T) {
+	dir, err := ioutil.TempDir("", "matgen")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+	var buf bytes.Buffer
+	assert.NoError(t, generateHelpers(&buf, "main"))
+
+	path := filepath.Join(dir, "helpers.go")
+	assert.NoError(t, writeGenerated(path, buf.Bytes()))
+	assert.NoError(t, writeGenerated(path, buf.Bytes()))
+
+	mine := []byte("package main\n\nfunc matString() {}\n")
+	assert.NoError(t, ioutil.WriteFile(path, mine, 0644))
+	assert.EqualError(t, writeGenerated(path, buf.Bytes()), path+" was not generated by matgen, refusing to overwrite it")
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, mine, data)
+	assert.Error(t, writeGenerated(dir, buf.Bytes()))
+}
+
+func TestInfer(t *testing.T) {
+	var m matlab.Matrix
+	assert.NoError(t, json.Unmarshal([]byte(`{"name":"trials","class":"struct","dims":[1,2],"fields":["id","data","label"],"data":[
+		{"id":{"class":"double","dims":[1,1],"data":[1]},"data":{"class":"double","dims":[1,3],"data":[1,2,3]},"label":{"class":"double","dims":[0,0],"data":[]}},
+		{"id":{"class":"int32","dims":[1,1],"data":[2]},"data":{"class":"double","dims":[1,1],"data":[4]},"label":{"class":"char","dims":[1,1],"data":"a"}}
+	]}`), &m))
+	typ := infer(&m)
+	assert.Equal(t, kindStructs, typ.kind)
+	// double and int32 ids don't fit a Go type, scalars and arrays fit a slice and [] fits any type
+	assert.Equal(t, kindMatrix, typ.fields[0].typ.kind)
+	assert.Equal(t, &goType{kind: kindSlice, prim: "float64"}, typ.fields[1].typ)
+	assert.Equal(t, kindString, typ.fields[2].typ.kind)
+
+	g := &generator{names: map[string]bool{}, helpers: map[string]bool{}}
+	g.name(typ, exported("trial_data"))
+	assert.Equal(t, "TrialData", typ.name)
+	assert.Equal(t, "[]TrialData", g.expr(typ))
+	assert.Equal(t, "decodeTrialDataArray", g.decoder(typ))
+}
@@ -0,0 +1,128 @@
+// Command matinfo prints the header of .mat files and a table of their variables like matlab's whos.
+//
+// Usage:
+//
+//	matinfo file.mat...
+package main
+
+import (
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/daniellowtw/matlab"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: matinfo file.mat...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	failed := false
+	for i, path := range flag.Args() {
+		if i > 0 {
+			fmt.Println()
+		}
+		if err := info(os.Stdout, path); err != nil {
+			fmt.Fprintf(os.Stderr, "matinfo: %s: %v\n", path, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// info prints the header and variables of the file at path
+func info(w io.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	f, err := matlab.NewFileFromReader(file)
+	if err != nil {
+		return err
+	}
+	names := f.GetVarsNames()
+	if err := f.Err(); err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	h := f.Header
+	created := "-"
+	if !h.Created.IsZero() {
+		created = h.Created.Format("Mon Jan _2 15:04:05 2006")
+	}
+	endianness := "little endian"
+	if h.Endianess == binary.BigEndian {
+		endianness = "big endian"
+	}
+	fmt.Fprintf(w, "%s\n", path)
+	fmt.Fprintf(w, "  Level:            %s\n", h.Level)
+	fmt.Fprintf(w, "  Platform:         %s\n", orDash(h.Platform))
+	fmt.Fprintf(w, "  Created:          %s\n", created)
+	fmt.Fprintf(w, "  Endianness:       %s\n", endianness)
+	fmt.Fprintf(w, "  Subsystem offset: %d\n\n", h.SubsystemOffset)
+
+	rows := [][]string{{"Name", "Size", "Bytes", "Class", "Attributes"}}
+	for _, name := range names {
+		m, _ := f.GetVar(name)
+		rows = append(rows, []string{m.Name, size(m.Dimension), fmt.Sprint(m.Bytes()), m.ClassName(), attributes(m)})
+	}
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, cell := range row {
+			if len(cell) > widths[i] {
+				widths[i] = len(cell)
+			}
+		}
+	}
+	for _, row := range rows {
+		// bytes are right aligned like in whos
+		line := fmt.Sprintf("  %-*s    %-*s    %*s    %-*s    %s", widths[0], row[0], widths[1], row[1], widths[2], row[2],
+			widths[3], row[3], row[4])
+		fmt.Fprintln(w, strings.TrimRight(line, " "))
+	}
+	return nil
+}
+
+// size formats dimensions like whos, e.g. 7165x23x3
+func size(dims []int32) string {
+	parts := make([]string, len(dims))
+	for i, d := range dims {
+		parts[i] = fmt.Sprint(d)
+	}
+	return strings.Join(parts, "x")
+}
+
+func attributes(m *matlab.Matrix) string {
+	var res []string
+	if m.IsComplex() {
+		res = append(res, "complex")
+	}
+	if m.IsGlobal() {
+		res = append(res, "global")
+	}
+	if m.IsSparse() {
+		res = append(res, "sparse")
+	}
+	return strings.Join(res, ", ")
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInfo(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, info(&buf, "../../testdata/varTypes.mat"))
+	assert.Contains(t, buf.String(), "  Level:            5.0\n")
+	assert.Contains(t, buf.String(), "  Platform:         PCWIN\n")
+	assert.Contains(t, buf.String(), "  Created:          Fri Aug 29 17:52:07 2014\n")
+	assert.Contains(t, buf.String(), "  Endianness:       little endian\n")
+	assert.Regexp(t, `\n  sample +1x2 +\d+ +cell\n`, buf.String())
+
+	buf.Reset()
+	assert.NoError(t, info(&buf, "../../testdata/v73.mat"))
+	assert.Contains(t, buf.String(), "  Level:            7.3\n")
+	assert.Regexp(t, `\n  chunked +1000x200 +1600000 +double\n`, buf.String())
+	assert.Regexp(t, `\n  g +2x2 +4 +logical +global\n`, buf.String())
+
+	assert.Error(t, info(&buf, "../../testdata/missing.mat"))
+}
@@ -0,0 +1,131 @@
+package matlab
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"math"
+)
+
+// scanCompressed reads a compressed element of n bytes, which holds a single element compressed with zlib. The tag of
+// that element tells the size of the decompressed data, which is checked against the limits of the reader options
+// before decompressing the rest. The element within counts towards the total size rather than the compressed one.
+func (d *decoder) scanCompressed(n int, r io.Reader) (func() (Element, error), error) {
+	if err := d.checkSize(n); err != nil {
+		return nil, err
+	}
+	buf, err := d.readNamed(n, r, compressedName)
+	if err != nil {
+		return nil, err
+	}
+	cr, err := zlib.NewReader(bytes.NewReader(buf))
+	if err != nil {
+		return nil, fmt.Errorf("invalid compressed element: %v", err)
+	}
+	lr := &limitReader{r: cr, n: math.MaxInt64}
+	tag := make([]byte, 8)
+	_, err = io.ReadFull(lr, tag)
+	cr.Close()
+	if err != nil {
+		return nil, compressedError(err, lr)
+	}
+	word := d.bo.Uint32(tag)
+	dt, size, p := DataType(uint16(word)), int64(8), 0
+	if word>>16 == 0 {
+		p = int(d.bo.Uint32(tag[4:]))
+		size += int64(p)
+		if dt != DTmiMATRIX && dt != DTmiCOMPRESSED {
+			size += int64(padTo64Bit(p) - p)
+		}
+	}
+	if ratio := d.opts.MaxCompressionRatio; ratio > 0 && float64(size) > ratio*float64(n) {
+		return nil, fmt.Errorf("compressed element expands to more than %g times its size", ratio)
+	}
+	if max := d.opts.MaxDecompressedSize; max > 0 && size > max {
+		return nil, fmt.Errorf("compressed element expands to more than the limit of %d bytes", max)
+	}
+	d.decompressed += size
+	if max := d.opts.MaxDecompressed; max > 0 && d.decompressed > max {
+		return nil, fmt.Errorf("compressed elements expand to more than the limit of %d bytes", max)
+	}
+	if err := d.reserve(p); err != nil {
+		return nil, err
+	}
+	w := d.fork()
+	return func() (Element, error) { return w.inflate(buf, size, dt) }, nil
+}
+
+// inflate decodes the element compressed in buf, whose tag declared size bytes of type dt. The decompressed data has
+// to be that element exactly.
+func (d *decoder) inflate(buf []byte, size int64, dt DataType) (Element, error) {
+	br := bytes.NewReader(buf)
+	cr, err := zlib.NewReader(br)
+	if err != nil {
+		return nil, fmt.Errorf("invalid compressed element: %v", err)
+	}
+	defer cr.Close()
+	lr := &limitReader{r: cr, n: size, err: fmt.Errorf("compressed element holds more data after its %s element", dt)}
+	el, err := d.readElement(lr)
+	if err != nil {
+		return nil, compressedError(err, lr)
+	}
+	// reading up to the end of the stream also verifies its checksum
+	var b [1]byte
+	if _, err := io.ReadFull(lr, b[:]); err != io.EOF {
+		return nil, compressedError(err, lr)
+	}
+	if br.Len() > 0 {
+		return nil, fmt.Errorf("compressed element has %d bytes after the end of its zlib stream", br.Len())
+	}
+	return el, nil
+}
+
+// compressedError tells errors of the decompressor apart from errors in the decompressed data
+func compressedError(err error, lr *limitReader) error {
+	switch {
+	case err == io.EOF:
+		return fmt.Errorf("compressed element is empty")
+	case err == lr.err:
+		return err
+	case lr.srcErr == io.ErrUnexpectedEOF:
+		return fmt.Errorf("compressed element is truncated")
+	case lr.srcErr != nil:
+		return fmt.Errorf("invalid compressed element: %v", lr.srcErr)
+	case lr.eof:
+		return fmt.Errorf("compressed element ends within its %d bytes of data: %v", lr.read, err)
+	}
+	return err
+}
+
+// limitReader fails with err once more than n bytes have been read from r, where io.LimitReader would end early. It
+// remembers how r ended, so that errors of the decompressor can be told apart from errors in the decompressed data.
+type limitReader struct {
+	r      io.Reader
+	n      int64
+	err    error
+	read   int64 // bytes read so far
+	eof    bool  // whether r ended
+	srcErr error // the error r failed with, if any
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, l.err
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	l.read += int64(n)
+	if err == io.EOF {
+		l.eof = true
+	} else if err != nil {
+		l.srcErr = err
+	}
+	if l.n < 0 {
+		return 0, l.err
+	}
+	return n, err
+}
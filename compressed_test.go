@@ -0,0 +1,76 @@
+package matlab
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadCompressed(t *testing.T) {
+	bo := binary.LittleEndian
+	var header bytes.Buffer
+	_, err := NewFileFromWriter(&header, nil)
+	assert.NoError(t, err)
+	// zeros compress well
+	x := &Matrix{Name: "x", Class: mxDOUBLE, Dimension: []int32{1, 100}}
+	for i := 0; i < 100; i++ {
+		x.value = append(x.value, 0.0)
+	}
+	data, err := encodeMatrix(bo, x)
+	assert.NoError(t, err)
+	inner := packElement(bo, DTmiMATRIX, data)
+	deflate := func(data []byte) []byte {
+		var buf bytes.Buffer
+		w := zlib.NewWriter(&buf)
+		w.Write(data)
+		w.Close()
+		return buf.Bytes()
+	}
+	// compressed elements are not padded
+	compressed := func(data []byte) []byte {
+		tag := make([]byte, 8)
+		bo.PutUint32(tag, uint32(DTmiCOMPRESSED))
+		bo.PutUint32(tag[4:], uint32(len(data)))
+		return append(tag, data...)
+	}
+	valid := compressed(deflate(inner))
+	longer := append([]byte{}, inner...)
+	bo.PutUint32(longer[4:], uint32(len(data)+8))
+	corrupt := deflate(inner)
+	corrupt[len(corrupt)-1] ^= 1
+
+	for _, test := range []struct {
+		name string
+		file []byte
+		opts *ReaderOptions
+		err  string
+	}{
+		{"valid", append(append([]byte{}, valid...), valid...), nil, ""},
+		{"within limits", valid, &ReaderOptions{MaxDecompressedSize: int64(len(inner)), MaxDecompressed: int64(len(inner))}, ""},
+		{"element limit", valid, &ReaderOptions{MaxDecompressedSize: 100}, "expands to more than the limit of 100 bytes"},
+		{"file limit", append(append([]byte{}, valid...), valid...), &ReaderOptions{MaxDecompressed: int64(len(inner)) + 100},
+			"compressed elements expand to more than the limit of"},
+		{"empty", compressed(deflate(nil)), nil, "compressed element is empty"},
+		{"truncated", compressed(deflate(inner)[:20]), nil, "compressed element is truncated"},
+		{"corrupt", compressed(corrupt), nil, "invalid compressed element: zlib: invalid checksum"},
+		{"longer content", compressed(deflate(longer)), nil, "compressed element ends within its"},
+		{"data after the element", compressed(deflate(append(append([]byte{}, inner...), inner...))), nil,
+			"compressed element holds more data after its miMATRIX element"},
+		{"data after the stream", compressed(append(deflate(inner), 1, 2, 3)), nil,
+			"compressed element has 3 bytes after the end of its zlib stream"},
+	} {
+		f, err := NewFileFromReaderWithOptions(bytes.NewReader(append(header.Bytes(), test.file...)), test.opts)
+		assert.NoError(t, err)
+		f.GetVarsNames()
+		if test.err == "" {
+			assert.NoError(t, f.Err(), test.name)
+			x, _ := f.GetVar("x")
+			assert.Equal(t, []int32{1, 100}, x.Dimension, test.name)
+		} else if assert.Error(t, f.Err(), test.name) {
+			assert.Contains(t, f.Err().Error(), test.err, test.name)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package matlab
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"unicode/utf16"
+)
+
+// CSVOptions controls how WriteCSV writes a matrix. The zero value writes comma separated values without a header,
+// except for struct arrays which get a header of their field names.
+type CSVOptions struct {
+	Comma       rune     // field delimiter, ',' by default. Use '\t' for TSV
+	FloatFormat string   // fmt verb for floating point values, e.g. "%.3f". The shortest exact representation by default
+	NaN         string   // written for NaN values, e.g. "NaN" or "NA". Empty by default
+	Header      []string // header row written before the values
+	NoHeader    bool     // leaves out the field names of struct arrays
+}
+
+// WriteCSV writes a 2-D matrix as CSV with a line per row. Numeric and logical matrices have a column per column of
+// the matrix, and so do cell arrays of strings and scalars. Char matrices have a single column with a row in each
+// line. Struct arrays with a single row or column have a line per element and a column per field, whose values have
+// to be strings or scalars as well.
+func (m *Matrix) WriteCSV(w io.Writer, opts *CSVOptions) error {
+	var o CSVOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.Comma == 0 {
+		o.Comma = ','
+	}
+	if len(m.Dimension) != 2 {
+		return fmt.Errorf("can only write 2-D matrices as CSV, %s has %d dimensions", m.Name, len(m.Dimension))
+	}
+	if _, ok := m.Raw(); ok {
+		return fmt.Errorf("cannot write matrix %s of class %s as CSV", m.Name, m.Class)
+	}
+	if len(m.value) != m.numel() || m.flags.isComplex && len(m.imag) != m.numel() {
+		return fmt.Errorf("matrix %s has %d values but its dimensions need %d", m.Name, len(m.value), m.numel())
+	}
+	rows, cols := int(m.Dimension[0]), int(m.Dimension[1])
+	header := o.Header
+	var records [][]string
+	var err error
+	switch {
+	case m.Class.isNumeric():
+		records = make([][]string, rows)
+		for i := range records {
+			records[i] = make([]string, cols)
+			for j := range records[i] {
+				var im interface{}
+				if m.flags.isComplex {
+					im = m.imag[i+rows*j]
+				}
+				records[i][j] = o.number(m, m.value[i+rows*j], im)
+			}
+		}
+	case m.Class == mxCHAR:
+		records = make([][]string, rows)
+		for i := range records {
+			units := make([]uint16, cols)
+			for j := range units {
+				units[j] = toUint16(m.value[i+rows*j])
+			}
+			records[i] = []string{string(utf16.Decode(units))}
+		}
+	case m.Class == mxCELL:
+		records = make([][]string, rows)
+		for i := range records {
+			records[i] = make([]string, cols)
+			for j := range records[i] {
+				c, _ := m.value[i+rows*j].(*Matrix)
+				if records[i][j], err = o.scalar(c); err != nil {
+					return fmt.Errorf("cell (%d,%d) of %s: %v", i+1, j+1, m.Name, err)
+				}
+			}
+		}
+	case m.Class == mxSTRUCT:
+		if rows != 1 && cols != 1 {
+			return fmt.Errorf("can only write struct arrays with a single row or column as CSV, %s is %s", m.Name, dimString(m.Dimension))
+		}
+		if header == nil && !o.NoHeader {
+			header = m.fields
+		}
+		for i, v := range m.value {
+			keys, _ := v.(map[string]*Matrix)
+			record := make([]string, len(m.fields))
+			for j, f := range m.fields {
+				if record[j], err = o.scalar(keys[f]); err != nil {
+					return fmt.Errorf("field %s of element %d of %s: %v", f, i+1, m.Name, err)
+				}
+			}
+			records = append(records, record)
+		}
+	default:
+		return fmt.Errorf("cannot write matrix %s of class %s as CSV", m.Name, m.Class)
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Comma = o.Comma
+	if header != nil {
+		if err := cw.Write(header); err != nil {
+			return err
+		}
+	}
+	if err := cw.WriteAll(records); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+// scalar formats a string or a numeric scalar within a cell or struct. Missing and empty matrices give an empty value.
+func (o *CSVOptions) scalar(m *Matrix) (string, error) {
+	if m == nil || m.numel() == 0 {
+		return "", nil
+	}
+	if _, ok := m.Raw(); !ok {
+		switch {
+		case m.Class == mxCHAR && len(m.Dimension) == 2 && m.Dimension[0] == 1:
+			units := make([]uint16, len(m.value))
+			for i, v := range m.value {
+				units[i] = toUint16(v)
+			}
+			return string(utf16.Decode(units)), nil
+		case m.Class.isNumeric() && m.numel() == 1 && len(m.value) == 1:
+			var im interface{}
+			if m.flags.isComplex {
+				im = m.imag[0]
+			}
+			return o.number(m, m.value[0], im), nil
+		}
+	}
+	return "", fmt.Errorf("expects a string or a scalar, got a %s %s", dimString(m.Dimension), m.ClassName())
+}
+
+// number formats a value of a numeric matrix, with the imaginary part im of complex matrices, e.g. 1.5-2i
+func (o *CSVOptions) number(m *Matrix, re, im interface{}) string {
+	s := o.real(m, re)
+	if im == nil {
+		return s
+	}
+	imag := o.real(m, im)
+	if imag == "" || imag[0] != '-' && imag[0] != '+' {
+		imag = "+" + imag
+	}
+	return s + imag + "i"
+}
+
+func (o *CSVOptions) real(m *Matrix, v interface{}) string {
+	if m.Class != mxDOUBLE && m.Class != mxSINGLE {
+		return fmt.Sprint(v)
+	}
+	f := toFloat64(v)
+	switch {
+	case math.IsNaN(f):
+		return o.NaN
+	case math.IsInf(f, 1):
+		return "Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case o.FloatFormat != "":
+		return fmt.Sprintf(o.FloatFormat, f)
+	case m.Class == mxSINGLE:
+		return strconv.FormatFloat(f, 'g', -1, 32)
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
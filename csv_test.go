@@ -0,0 +1,43 @@
+package matlab
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeCSV(t *testing.T, m *Matrix, opts *CSVOptions) string {
+	var buf bytes.Buffer
+	assert.NoError(t, m.WriteCSV(&buf, opts))
+	return buf.String()
+}
+
+func TestWriteCSV(t *testing.T) {
+	m := &Matrix{Class: mxDOUBLE, Dimension: []int32{2, 2}, value: doubles(1.5, math.NaN(), math.Inf(-1), 1e6)}
+	assert.Equal(t, "1.5,-Inf\n,1e+06\n", writeCSV(t, m, nil))
+	assert.Equal(t, "a\tb\n1.50\t-Inf\nNA\t1000000.00\n", writeCSV(t, m, &CSVOptions{Comma: '\t', FloatFormat: "%.2f", NaN: "NA", Header: []string{"a", "b"}}))
+
+	c := &Matrix{Class: mxINT16, Dimension: []int32{1, 2}, flags: Flags{isComplex: true},
+		value: []interface{}{int16(1), int16(-3)}, imag: []interface{}{int16(-2), int16(4)}}
+	assert.Equal(t, "1-2i,-3+4i\n", writeCSV(t, c, nil))
+
+	text := &Matrix{Class: mxCHAR, Dimension: []int32{1, 4}, value: castValues(mxCHAR, []interface{}{'a', ',', ' ', 'b'})}
+	one := &Matrix{Class: mxDOUBLE, Dimension: []int32{1, 1}, value: doubles(1)}
+	empty := &Matrix{Class: mxDOUBLE, Dimension: []int32{0, 0}}
+	cell := &Matrix{Class: mxCELL, Dimension: []int32{1, 3}, value: []interface{}{text, one, empty}}
+	assert.Equal(t, "\"a, b\",1,\n", writeCSV(t, cell, nil))
+
+	s := &Matrix{Class: mxSTRUCT, Dimension: []int32{2, 1}, fields: []string{"name", "value"}, value: []interface{}{
+		map[string]*Matrix{"name": text, "value": one},
+		map[string]*Matrix{"value": one},
+	}}
+	assert.Equal(t, "name,value\n\"a, b\",1\n,1\n", writeCSV(t, s, nil))
+	assert.Equal(t, "\"a, b\",1\n,1\n", writeCSV(t, s, &CSVOptions{NoHeader: true}))
+
+	var buf bytes.Buffer
+	assert.Error(t, (&Matrix{Class: mxDOUBLE, Dimension: []int32{1, 1, 2}, value: doubles(1, 2)}).WriteCSV(&buf, nil))
+	assert.Error(t, (&Matrix{Class: mxCELL, Dimension: []int32{1, 1}, value: []interface{}{m}}).WriteCSV(&buf, nil))
+	assert.Error(t, (&Matrix{Class: mxSTRUCT, Dimension: []int32{2, 2}, value: make([]interface{}, 4)}).WriteCSV(&buf, nil))
+}
@@ -0,0 +1,315 @@
+package matlab
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// DiffOptions controls how Diff compares values. The zero value compares values exactly and reports the first 10
+// differing elements of each matrix.
+type DiffOptions struct {
+	// numbers x and y are equal when |x-y| <= AbsTol + RelTol*max(|x|,|y|). NaN is always equal to NaN, like matlab's
+	// isequaln.
+	AbsTol, RelTol float64
+	MaxElements    int // differing elements reported per matrix, all of them if negative
+}
+
+// DiffKind is the kind of a Difference
+type DiffKind int
+
+const (
+	DiffAdded   DiffKind = iota // a variable or field is only in the second file
+	DiffRemoved                 // a variable or field is only in the first file
+	DiffClass                   // the class, complexity or sparsity changed
+	DiffSize                    // the dimensions changed
+	DiffValues                  // values differ
+)
+
+// Difference is a change between two files. Path locates it like the expressions of Query, e.g. results.trials(3).
+type Difference struct {
+	Path     string
+	Kind     DiffKind
+	Message  string        // describes class, size and contents changes, e.g. "class double != single"
+	Count    int           // number of differing elements of a DiffValues difference
+	Elements []DiffElement // the first differing elements
+}
+
+// DiffElement is an element that differs between two matrices
+type DiffElement struct {
+	Index []int       // subscripts starting at 1
+	A, B  interface{} // the values in both matrices, complex128 for complex matrices
+}
+
+func (d Difference) String() string {
+	switch d.Kind {
+	case DiffAdded:
+		return d.Path + ": added"
+	case DiffRemoved:
+		return d.Path + ": removed"
+	case DiffValues:
+		var b strings.Builder
+		fmt.Fprintf(&b, "%s: %s", d.Path, d.Message)
+		for i, e := range d.Elements {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			subs := make([]string, len(e.Index))
+			for j, s := range e.Index {
+				subs[j] = fmt.Sprint(s)
+			}
+			fmt.Fprintf(&b, " (%s) %v != %v", strings.Join(subs, ","), e.A, e.B)
+		}
+		if d.Count > len(d.Elements) {
+			b.WriteString(", ...")
+		}
+		return b.String()
+	}
+	return fmt.Sprintf("%s: %s", d.Path, d.Message)
+}
+
+// Diff compares the variables of two files and returns their differences, sorted by variable name. Variables only
+// in b are DiffAdded and variables only in a are DiffRemoved. opts may be nil.
+func Diff(a, b *File, opts *DiffOptions) ([]Difference, error) {
+	namesA := a.GetVarsNames()
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	namesB := b.GetVarsNames()
+	if err := b.Err(); err != nil {
+		return nil, err
+	}
+	names := append([]string{}, namesA...)
+	for _, name := range namesB {
+		if !containsString(namesA, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	d := newDiffer(opts)
+	for _, name := range names {
+		ma, okA := a.GetVar(name)
+		mb, okB := b.GetVar(name)
+		switch {
+		case !okA:
+			d.add(name, DiffAdded, "")
+		case !okB:
+			d.add(name, DiffRemoved, "")
+		default:
+			d.compare(name, ma, mb)
+		}
+	}
+	return d.res, nil
+}
+
+// DiffMatrices compares two matrices the way Diff compares variables, with paths starting at the name of a
+func DiffMatrices(a, b *Matrix, opts *DiffOptions) []Difference {
+	d := newDiffer(opts)
+	d.compare(a.Name, a, b)
+	return d.res
+}
+
+type differ struct {
+	opts DiffOptions
+	res  []Difference
+}
+
+func newDiffer(opts *DiffOptions) *differ {
+	d := &differ{opts: DiffOptions{MaxElements: 10}}
+	if opts != nil {
+		d.opts = *opts
+		if d.opts.MaxElements == 0 {
+			d.opts.MaxElements = 10
+		}
+	}
+	return d
+}
+
+func (d *differ) add(path string, kind DiffKind, format string, args ...interface{}) {
+	d.res = append(d.res, Difference{Path: path, Kind: kind, Message: fmt.Sprintf(format, args...)})
+}
+
+func (d *differ) compare(path string, a, b *Matrix) {
+	if a.ClassName() != b.ClassName() {
+		d.add(path, DiffClass, "class %s != %s", a.ClassName(), b.ClassName())
+		return
+	}
+	if a.IsSparse() != b.IsSparse() {
+		d.add(path, DiffClass, "%s != %s", sparsity(a), sparsity(b))
+		return
+	}
+	if a.IsComplex() != b.IsComplex() {
+		d.add(path, DiffClass, "%s != %s", complexity(a), complexity(b))
+		return
+	}
+	if dimString(trimDims(a.Dimension)) != dimString(trimDims(b.Dimension)) {
+		d.add(path, DiffSize, "size %s != %s", dimString(a.Dimension), dimString(b.Dimension))
+		return
+	}
+	if rawA, ok := a.Raw(); ok {
+		rawB, _ := b.Raw()
+		if rawB == nil || !bytes.Equal(rawA.Data, rawB.Data) {
+			d.add(path, DiffValues, "contents differ")
+		}
+		return
+	}
+	switch a.Class {
+	case mxSTRUCT:
+		d.structs(path, a, b)
+	case mxCELL:
+		for i := range a.value {
+			ca, _ := a.value[i].(*Matrix)
+			cb, _ := b.value[i].(*Matrix)
+			if ca != nil && cb != nil {
+				d.compare(fmt.Sprintf("%s{%d}", path, i+1), ca, cb)
+			}
+		}
+	default:
+		d.values(path, a, b)
+	}
+}
+
+// structs compares the fields of every element, ignoring the order of the fields
+func (d *differ) structs(path string, a, b *Matrix) {
+	for _, f := range a.fields {
+		if !containsString(b.fields, f) {
+			d.add(path+"."+f, DiffRemoved, "")
+		}
+	}
+	for _, f := range b.fields {
+		if !containsString(a.fields, f) {
+			d.add(path+"."+f, DiffAdded, "")
+		}
+	}
+	for i := range a.value {
+		element := path
+		if len(a.value) != 1 {
+			element = fmt.Sprintf("%s(%d)", path, i+1)
+		}
+		fa, _ := a.value[i].(map[string]*Matrix)
+		fb, _ := b.value[i].(map[string]*Matrix)
+		for _, f := range a.fields {
+			if fa[f] != nil && fb[f] != nil {
+				d.compare(element+"."+f, fa[f], fb[f])
+			}
+		}
+	}
+}
+
+// values compares numeric, logical, char and sparse matrices element by element
+func (d *differ) values(path string, a, b *Matrix) {
+	reA, imA := fullValues(a)
+	reB, imB := fullValues(b)
+	if len(reA) != len(reB) || len(imA) != len(imB) {
+		d.add(path, DiffValues, "contents differ")
+		return
+	}
+	diff := Difference{Path: path, Kind: DiffValues}
+	for i := range reA {
+		if d.equal(reA[i], reB[i]) && (imA == nil || d.equal(imA[i], imB[i])) {
+			continue
+		}
+		diff.Count++
+		if d.opts.MaxElements >= 0 && len(diff.Elements) >= d.opts.MaxElements {
+			continue
+		}
+		e := DiffElement{Index: subscripts(trimDims(a.Dimension), i), A: reA[i], B: reB[i]}
+		if imA != nil {
+			e.A = complex(toFloat64(reA[i]), toFloat64(imA[i]))
+			e.B = complex(toFloat64(reB[i]), toFloat64(imB[i]))
+		} else if a.Class == mxCHAR {
+			e.A, e.B = string(rune(toUint16(reA[i]))), string(rune(toUint16(reB[i])))
+		}
+		diff.Elements = append(diff.Elements, e)
+	}
+	if diff.Count > 0 {
+		diff.Message = fmt.Sprintf("%d of %d elements differ", diff.Count, len(reA))
+		d.res = append(d.res, diff)
+	}
+}
+
+func (d *differ) equal(x, y interface{}) bool {
+	if x == y {
+		return true
+	}
+	fx, fy := toFloat64(x), toFloat64(y)
+	if math.IsNaN(fx) && math.IsNaN(fy) {
+		return true
+	}
+	if d.opts.AbsTol == 0 && d.opts.RelTol == 0 {
+		// comparing as float64 would lose the precision of large 64 bit integers
+		return false
+	}
+	return math.Abs(fx-fy) <= d.opts.AbsTol+d.opts.RelTol*math.Max(math.Abs(fx), math.Abs(fy))
+}
+
+// fullValues returns the values of a matrix in column major order, with the zeros of sparse matrices filled in
+func fullValues(m *Matrix) (re, im []interface{}) {
+	if m.Class != mxSPARSE {
+		return m.value, m.imag
+	}
+	var zero interface{} = 0.0
+	if m.flags.isLogical {
+		zero = uint8(0)
+	}
+	n := m.numel()
+	rows := 0
+	if len(m.Dimension) > 0 {
+		rows = int(m.Dimension[0])
+	}
+	fill := func(values []interface{}) []interface{} {
+		res := make([]interface{}, n)
+		for i := range res {
+			res[i] = zero
+		}
+		for j := 0; j+1 < len(m.jc); j++ {
+			for k := m.jc[j]; k < m.jc[j+1] && k < len(m.ir) && k < len(values); k++ {
+				if i := m.ir[k] + rows*j; i >= 0 && i < n {
+					res[i] = values[k]
+				}
+			}
+		}
+		return res
+	}
+	re = fill(m.value)
+	if m.flags.isComplex {
+		im = fill(m.imag)
+	}
+	return re, im
+}
+
+// subscripts converts a linear index starting at 0 into subscripts starting at 1
+func subscripts(dims []int32, i int) []int {
+	res := make([]int, len(dims))
+	for j, d := range dims {
+		if d > 0 {
+			res[j] = i%int(d) + 1
+			i /= int(d)
+		}
+	}
+	return res
+}
+
+// trimDims drops trailing singleton dimensions after the second, which matlab ignores
+func trimDims(dims []int32) []int32 {
+	for len(dims) > 2 && dims[len(dims)-1] == 1 {
+		dims = dims[:len(dims)-1]
+	}
+	return dims
+}
+
+func sparsity(m *Matrix) string {
+	if m.IsSparse() {
+		return "sparse"
+	}
+	return "full"
+}
+
+func complexity(m *Matrix) string {
+	if m.IsComplex() {
+		return "complex"
+	}
+	return "real"
+}
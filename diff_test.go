@@ -0,0 +1,85 @@
+package matlab
+
+import (
+	"math"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffMatrices(t *testing.T) {
+	a := queryDoubles([]int32{2, 3}, 1, 2, 3, math.NaN(), 5, 6)
+	a.Name = "a"
+	b := queryDoubles([]int32{2, 3}, 1, 2.001, 3, math.NaN(), 7, 6.5)
+	assert.Equal(t, []Difference{{Path: "a", Kind: DiffValues, Message: "3 of 6 elements differ", Count: 3, Elements: []DiffElement{
+		{Index: []int{2, 1}, A: 2.0, B: 2.001},
+		{Index: []int{1, 3}, A: 5.0, B: 7.0},
+	}}}, DiffMatrices(a, b, &DiffOptions{MaxElements: 2}))
+	assert.Equal(t, []string{"a: 2 of 6 elements differ (1,3) 5 != 7, (2,3) 6 != 6.5"},
+		diffStrings(DiffMatrices(a, b, &DiffOptions{AbsTol: 0.01})))
+	assert.Empty(t, DiffMatrices(a, b, &DiffOptions{AbsTol: 0.01, RelTol: 0.4}))
+	assert.Empty(t, DiffMatrices(a, a, nil))
+
+	for expected, m := range map[string]*Matrix{
+		"a: class double != single": {Class: mxSINGLE, Dimension: []int32{2, 3}, value: make([]interface{}, 6)},
+		"a: size 2x3 != 3x2":        queryDoubles([]int32{3, 2}, 1, 2, 3, 4, 5, 6),
+		"a: full != sparse":         {Class: mxSPARSE, Dimension: []int32{2, 3}, jc: []int{0, 0, 0, 0}},
+	} {
+		assert.Equal(t, []string{expected}, diffStrings(DiffMatrices(a, m, nil)))
+	}
+
+	// trailing singleton dimensions are ignored and sparse zeros are filled in
+	sp := &Matrix{Name: "sp", Class: mxSPARSE, Dimension: []int32{2, 2, 1}, value: []interface{}{5.0}, ir: []int{1}, jc: []int{0, 1, 1}}
+	sp2 := &Matrix{Class: mxSPARSE, Dimension: []int32{2, 2}, value: []interface{}{5.0, 1.0}, ir: []int{1, 0}, jc: []int{0, 1, 2}}
+	assert.Equal(t, []string{"sp: 1 of 4 elements differ (1,2) 0 != 1"}, diffStrings(DiffMatrices(sp, sp2, nil)))
+
+	// large integers are compared exactly
+	i := &Matrix{Name: "i", Class: mxINT64, Dimension: []int32{1, 1}, value: []interface{}{int64(1) << 60}}
+	i2 := &Matrix{Class: mxINT64, Dimension: []int32{1, 1}, value: []interface{}{int64(1)<<60 + 1}}
+	assert.Len(t, DiffMatrices(i, i2, nil), 1)
+
+	s := &Matrix{Name: "s", Class: mxSTRUCT, Dimension: []int32{1, 2}, fields: []string{"x", "y"}, value: []interface{}{
+		map[string]*Matrix{"x": queryDoubles([]int32{1, 1}, 1), "y": {Class: mxCELL, Dimension: []int32{1, 1}, value: []interface{}{queryDoubles([]int32{1, 1}, 2)}}},
+		map[string]*Matrix{"x": queryDoubles([]int32{1, 1}, 1), "y": {Class: mxCHAR, Dimension: []int32{1, 2}, value: []interface{}{uint16('a'), uint16('b')}}},
+	}}
+	s2 := &Matrix{Class: mxSTRUCT, Dimension: []int32{1, 2}, fields: []string{"y", "z"}, value: []interface{}{
+		map[string]*Matrix{"z": queryDoubles([]int32{1, 1}, 1), "y": {Class: mxCELL, Dimension: []int32{1, 1}, value: []interface{}{queryDoubles([]int32{1, 1}, 3)}}},
+		map[string]*Matrix{"z": queryDoubles([]int32{1, 1}, 1), "y": {Class: mxCHAR, Dimension: []int32{1, 2}, value: []interface{}{uint16('a'), uint16('c')}}},
+	}}
+	assert.Equal(t, []string{
+		"s.x: removed",
+		"s.z: added",
+		"s(1).y{1}: 1 of 1 elements differ (1,1) 2 != 3",
+		"s(2).y: 1 of 2 elements differ (1,2) b != c",
+	}, diffStrings(DiffMatrices(s, s2, nil)))
+}
+
+func TestDiff(t *testing.T) {
+	open := func(name string) *File {
+		file, err := os.Open("testdata/" + name + ".mat")
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		defer file.Close()
+		f, err := NewFileFromReader(file)
+		assert.NoError(t, err)
+		f.GetVarsNames()
+		return f
+	}
+	diffs, err := Diff(open("varTypes"), open("varTypes"), nil)
+	assert.NoError(t, err)
+	assert.Empty(t, diffs)
+
+	diffs, err = Diff(open("varTypes"), open("simpleStruct"), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"X: added", "sample: removed", "x: removed", "y: removed", "z: removed"}, diffStrings(diffs))
+}
+
+func diffStrings(diffs []Difference) []string {
+	var res []string
+	for _, d := range diffs {
+		res = append(res, d.String())
+	}
+	return res
+}
@@ -0,0 +1,240 @@
+package matlab
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// Editor removes and renames the top level variables of a .mat file. Variables that are not touched are kept as the
+// raw bytes they were read as, so they are never decoded or re-encoded. This makes editing large files cheap.
+type Editor struct {
+	Header *Header
+
+	header []byte // the raw 128 byte header, written back verbatim
+	vars   []*rawVar
+}
+
+// rawVar is a top level element kept as it appears in the file
+type rawVar struct {
+	name string
+	typ  DataType // either miMATRIX or miCOMPRESSED
+	data []byte   // the element's data, without the tag
+}
+
+// NewEditor reads the header and all top level elements of a .mat file from r. Only the array name of each variable
+// is decoded.
+func NewEditor(r io.Reader) (*Editor, error) {
+	header, err := readAllBytes(headerLen, r)
+	if err != nil {
+		return nil, err
+	}
+	f := &File{r: bytes.NewReader(header)}
+	if err := f.readHeader(); err != nil {
+		return nil, err
+	}
+	e := &Editor{Header: f.Header, header: header}
+	bo := f.Header.Endianess
+	for {
+		tag, err := readAllBytes(8, r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		v := &rawVar{typ: DataType(bo.Uint32(tag[:4]))}
+		if v.typ != DTmiMATRIX && v.typ != DTmiCOMPRESSED {
+			return nil, fmt.Errorf("expects top level elements to be of type %s or %s, got %s instead", DTmiMATRIX, DTmiCOMPRESSED, v.typ)
+		}
+		if v.data, err = readAllBytes(int(bo.Uint32(tag[4:])), r); err != nil {
+			return nil, err
+		}
+		if v.name, err = v.readName(e.Header); err != nil {
+			return nil, err
+		}
+		e.vars = append(e.vars, v)
+	}
+	return e, nil
+}
+
+// readName decodes the array name sub element. For compressed variables only the start of the stream is inflated.
+func (v *rawVar) readName(h *Header) (string, error) {
+	var r io.Reader = bytes.NewReader(v.data)
+	if v.typ == DTmiCOMPRESSED {
+		cr, err := zlib.NewReader(r)
+		if err != nil {
+			return "", err
+		}
+		defer cr.Close()
+		if _, dt, _, err := readTag(h.Endianess, cr); err != nil {
+			return "", err
+		} else if dt != DTmiMATRIX {
+			return "", fmt.Errorf("expects compressed variable to hold a %s, got %s instead", DTmiMATRIX, dt)
+		}
+		r = cr
+	}
+	return readMatrixName(h.Endianess, r)
+}
+
+// readMatrixName reads the sub elements of a miMATRIX element up to and including the array name
+func readMatrixName(bo binary.ByteOrder, r io.Reader) (string, error) {
+	if _, _, err := arrayFlags(bo, r); err != nil {
+		return "", err
+	}
+	if _, err := dimensionsArray(bo, r); err != nil {
+		return "", err
+	}
+	return arrayName(bo, r)
+}
+
+// VarNames returns the names of the variables in the order they appear in the file
+func (e *Editor) VarNames() []string {
+	res := make([]string, len(e.vars))
+	for i, v := range e.vars {
+		res[i] = v.name
+	}
+	return res
+}
+
+func (e *Editor) find(name string) int {
+	for i, v := range e.vars {
+		if v.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Delete removes the variable with the given name
+func (e *Editor) Delete(name string) error {
+	i := e.find(name)
+	if i < 0 {
+		return fmt.Errorf("variable %s not found", name)
+	}
+	e.vars = append(e.vars[:i], e.vars[i+1:]...)
+	return nil
+}
+
+// Rename changes the name of a variable. Compressed variables are inflated and deflated again, everything else about
+// the variable is left untouched.
+func (e *Editor) Rename(oldName, newName string) error {
+	i := e.find(oldName)
+	if i < 0 {
+		return fmt.Errorf("variable %s not found", oldName)
+	}
+	if !isValidName(newName) {
+		return fmt.Errorf("%q is not a valid variable name", newName)
+	}
+	if oldName == newName {
+		return nil
+	}
+	if e.find(newName) >= 0 {
+		return fmt.Errorf("variable %s already exists", newName)
+	}
+	v := e.vars[i]
+	bo := e.Header.Endianess
+	switch v.typ {
+	case DTmiMATRIX:
+		data, err := renameMatrix(bo, v.data, newName)
+		if err != nil {
+			return err
+		}
+		v.data = data
+	case DTmiCOMPRESSED:
+		cr, err := zlib.NewReader(bytes.NewReader(v.data))
+		if err != nil {
+			return err
+		}
+		inflated, err := ioutil.ReadAll(cr)
+		cr.Close()
+		if err != nil {
+			return err
+		}
+		if len(inflated) < 8 || DataType(bo.Uint32(inflated)) != DTmiMATRIX {
+			return fmt.Errorf("expects compressed variable %s to hold a %s", oldName, DTmiMATRIX)
+		}
+		data, err := renameMatrix(bo, inflated[8:], newName)
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		cw := zlib.NewWriter(&buf)
+		if _, err := cw.Write(packElement(bo, DTmiMATRIX, data)); err != nil {
+			return err
+		}
+		if err := cw.Close(); err != nil {
+			return err
+		}
+		v.data = buf.Bytes()
+	}
+	v.name = newName
+	return nil
+}
+
+// renameMatrix replaces the array name sub element in the data of a miMATRIX element. The array flags and dimensions
+// sub elements come first, and the name may be stored as a small data element, so the size of the data can change.
+func renameMatrix(bo binary.ByteOrder, data []byte, name string) ([]byte, error) {
+	// array flags are always a tag followed by 8 bytes
+	off := 16
+	if len(data) < off+8 {
+		return nil, fmt.Errorf("invalid matrix, too short to hold dimensions")
+	}
+	off += 8 + padTo64Bit(int(bo.Uint32(data[off+4:])))
+	if len(data) < off+8 {
+		return nil, fmt.Errorf("invalid matrix, too short to hold an array name")
+	}
+	nameLen := 8
+	if bo.Uint32(data[off:])>>16 == 0 {
+		nameLen += padTo64Bit(int(bo.Uint32(data[off+4:])))
+	}
+	if len(data) < off+nameLen {
+		return nil, fmt.Errorf("invalid matrix, array name exceeds the matrix")
+	}
+	res := append([]byte{}, data[:off]...)
+	res = append(res, packElement(bo, DTmiINT8, []byte(name))...)
+	return append(res, data[off+nameLen:]...), nil
+}
+
+// isValidName reports whether s is a valid matlab variable name: a letter followed by letters, digits or underscores.
+func isValidName(s string) bool {
+	if len(s) == 0 || len(s) > 63 {
+		return false
+	}
+	for i, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case i > 0 && (c == '_' || c >= '0' && c <= '9'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// WriteTo writes the edited file to w
+func (e *Editor) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	n, err := w.Write(e.header)
+	total += int64(n)
+	if err != nil {
+		return total, err
+	}
+	bo := e.Header.Endianess
+	for _, v := range e.vars {
+		tag := make([]byte, 8)
+		bo.PutUint32(tag, uint32(v.typ))
+		bo.PutUint32(tag[4:], uint32(len(v.data)))
+		for _, b := range [][]byte{tag, v.data} {
+			n, err := w.Write(b)
+			total += int64(n)
+			if err != nil {
+				return total, err
+			}
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,56 @@
+package matlab
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEditorRename(t *testing.T) {
+	file, err := os.Open("testdata/mixedCells.mat")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer file.Close()
+	e, err := NewEditor(file)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Z"}, e.VarNames())
+	assert.Error(t, e.Rename("missing", "a"))
+	assert.Error(t, e.Rename("Z", "1abc"))
+	// the new name no longer fits in a small data element
+	assert.NoError(t, e.Rename("Z", "renamedCells"))
+
+	var buf bytes.Buffer
+	_, err = e.WriteTo(&buf)
+	assert.NoError(t, err)
+	f, err := NewFileFromReader(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"renamedCells"}, f.GetVarsNames())
+	r, hasVar := f.GetVar("renamedCells")
+	assert.True(t, hasVar)
+	assert.Equal(t, []int32{1, 2}, r.Dimension)
+	assert.Equal(t, []rune("someString"), r.GetAtLocation(0).(*Matrix).String())
+	assert.Equal(t, []float64{123.0}, r.GetAtLocation(1).(*Matrix).DoubleArray())
+}
+
+func TestEditorDelete(t *testing.T) {
+	file, err := os.Open("testdata/simpleStruct.mat")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer file.Close()
+	e, err := NewEditor(file)
+	assert.NoError(t, err)
+	assert.Error(t, e.Delete("Y"))
+	assert.NoError(t, e.Delete("X"))
+
+	var buf bytes.Buffer
+	n, err := e.WriteTo(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(headerLen), n)
+	f, err := NewFileFromReader(&buf)
+	assert.NoError(t, err)
+	assert.Empty(t, f.GetVarsNames())
+}
@@ -1,5 +1,7 @@
 package matlab
 
+import "encoding/binary"
+
 // Element is a parsed matlab data element
 type Element interface {
 	Type() DataType
@@ -37,3 +39,57 @@ func (e *subElement) Type() DataType {
 func (e *subElement) Value() []interface{} {
 	return e.value
 }
+
+// RawElement is an element this package cannot interpret, e.g. one with an unknown data type or a matrix of a class
+// like function handles or objects. It keeps the undecoded bytes so that it can be listed, skipped or written back
+// unchanged.
+type RawElement struct {
+	typ   DataType
+	small bool // whether it was stored as a small data element
+	bo    binary.ByteOrder
+	// Data is the content of the element without the tag and padding
+	Data []byte
+}
+
+var _ Element = &RawElement{}
+
+func (e *RawElement) Type() DataType {
+	return e.typ
+}
+
+// Value returns the undecoded bytes as the only value
+func (e *RawElement) Value() []interface{} {
+	return []interface{}{e.Data}
+}
+
+// bytes returns the element as it was stored, including the tag
+func (e *RawElement) bytes() []byte {
+	if e.small {
+		return packSmallElement(e.bo, e.typ, e.Data)
+	}
+	return packNormalElement(e.bo, e.typ, e.Data)
+}
+
+// packElement lays out a data element of type dt holding data, using the small data element format when the data fits
+// into 4 bytes and padding normal elements to 64 bits otherwise.
+func packElement(bo binary.ByteOrder, dt DataType, data []byte) []byte {
+	if len(data) > 0 && len(data) <= 4 {
+		return packSmallElement(bo, dt, data)
+	}
+	return packNormalElement(bo, dt, data)
+}
+
+func packSmallElement(bo binary.ByteOrder, dt DataType, data []byte) []byte {
+	buf := make([]byte, 8)
+	bo.PutUint32(buf, uint32(len(data))<<16|uint32(dt))
+	copy(buf[4:], data)
+	return buf
+}
+
+func packNormalElement(bo binary.ByteOrder, dt DataType, data []byte) []byte {
+	buf := make([]byte, 8+padTo64Bit(len(data)))
+	bo.PutUint32(buf, uint32(dt))
+	bo.PutUint32(buf[4:], uint32(len(data)))
+	copy(buf[8:], data)
+	return buf
+}
@@ -0,0 +1,443 @@
+package matlab
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// FormatOptions controls how Format displays a matrix. Zero values use the defaults.
+type FormatOptions struct {
+	Width      int // line width that columns are split to fit into, 80 by default
+	MaxRows    int // rows shown of each page, all when 0
+	MaxColumns int // columns shown of each page, all when 0
+	MaxPages   int // pages shown of arrays with more than 2 dimensions, all when 0
+}
+
+// Format writes the matrix the way matlab's command window displays it, e.g.
+//
+//	x =
+//
+//	     1     2
+//	     3     4
+//
+// Matrices without a name are displayed as ans.
+func (m *Matrix) Format(w io.Writer, opts *FormatOptions) error {
+	o := FormatOptions{Width: 80}
+	if opts != nil {
+		o = *opts
+		if o.Width <= 0 {
+			o.Width = 80
+		}
+	}
+	name := m.Name
+	if name == "" {
+		name = "ans"
+	}
+	p := &printer{w: w, opts: o}
+	p.matrix(name, m)
+	return p.err
+}
+
+// printer writes lines and keeps the first error
+type printer struct {
+	w    io.Writer
+	opts FormatOptions
+	err  error
+}
+
+func (p *printer) printf(format string, args ...interface{}) {
+	if p.err == nil {
+		_, p.err = fmt.Fprintf(p.w, format, args...)
+	}
+}
+
+func (p *printer) matrix(name string, m *Matrix) {
+	if (m.Class == mxCHAR || m.Class == mxCELL || m.Class.isNumeric()) && m.numel() > 0 {
+		p.pages(name, m)
+		return
+	}
+	p.printf("%s =\n\n", name)
+	switch {
+	case m.Class == mxSTRUCT:
+		p.structure(m)
+	case m.Class == mxSPARSE:
+		p.sparse(m)
+	case m.Class == mxDOUBLE && isEmpty2D(m):
+		p.printf("     []\n\n")
+	case m.numel() == 0:
+		p.printf("  %s empty %s array\n\n", dimString(m.Dimension), m.ClassName())
+	default:
+		p.printf("  %s %s\n\n", dimString(m.Dimension), m.ClassName())
+	}
+}
+
+func isEmpty2D(m *Matrix) bool {
+	return len(m.Dimension) == 2 && m.Dimension[0] == 0 && m.Dimension[1] == 0
+}
+
+// pages displays the 2-D pages of a numeric, char or cell array, each under a heading like x(:,:,2) for arrays with
+// more than 2 dimensions
+func (p *printer) pages(name string, m *Matrix) {
+	rows, cols := int(m.Dimension[0]), 1
+	if len(m.Dimension) > 1 {
+		cols = int(m.Dimension[1])
+	}
+	pageSize := rows * cols
+	numPages := m.numel() / pageSize
+	shown := numPages
+	if p.opts.MaxPages > 0 && shown > p.opts.MaxPages {
+		shown = p.opts.MaxPages
+	}
+	for k := 0; k < shown; k++ {
+		if len(m.Dimension) <= 2 {
+			p.printf("%s =\n\n", name)
+		} else {
+			// the index of the page along each dimension after the second
+			index := []string{":", ":"}
+			rest := k
+			for _, d := range m.Dimension[2:] {
+				index = append(index, strconv.Itoa(rest%int(d)+1))
+				rest /= int(d)
+			}
+			p.printf("%s(%s) =\n\n", name, strings.Join(index, ","))
+		}
+		page := m.value[k*pageSize : (k+1)*pageSize]
+		var imag []interface{}
+		if m.flags.isComplex {
+			imag = m.imag[k*pageSize : (k+1)*pageSize]
+		}
+		switch {
+		case m.Class == mxCHAR:
+			p.chars(page, rows, cols)
+		case m.Class == mxCELL:
+			p.printf("  %s cell array\n\n", dimString(m.Dimension))
+			p.columns(cellSummaries(page), rows, cols, 0)
+		default:
+			if m.flags.isLogical {
+				p.printf("  %s logical array\n\n", dimString(m.Dimension))
+			}
+			cells, width := formatNumbers(m, page, imag)
+			p.columns(cells, rows, cols, width)
+		}
+	}
+	if shown < numPages {
+		p.printf("  ... %d more pages\n\n", numPages-shown)
+	}
+}
+
+// chars displays each row of a char page as a quoted string
+func (p *printer) chars(page []interface{}, rows, cols int) {
+	if rows > 1 {
+		p.printf("  %dx%d char array\n\n", rows, cols)
+	}
+	shown := p.limit(rows, p.opts.MaxRows)
+	for i := 0; i < shown; i++ {
+		units := make([]uint16, cols)
+		for j := range units {
+			units[j] = toUint16(page[j*rows+i])
+		}
+		p.printf("    %s\n", quote(string(utf16.Decode(units))))
+	}
+	if shown < rows {
+		p.printf("    ... %d more rows\n", rows-shown)
+	}
+	p.printf("\n")
+}
+
+func toUint16(v interface{}) uint16 {
+	if u, ok := v.(uint16); ok {
+		return u
+	}
+	return uint16(toInt64(v))
+}
+
+// quote quotes a string with single quotes, doubling the quotes within like matlab
+func quote(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+func (p *printer) limit(n, max int) int {
+	if max > 0 && n > max {
+		return max
+	}
+	return n
+}
+
+// columns displays a column major page of formatted cells. Numbers are right aligned in columns of the given width.
+// Cell summaries, for which width is 0, are left aligned in columns as wide as their contents. Columns that don't fit
+// into the line width are split into blocks headed by "Columns 1 through 8".
+func (p *printer) columns(cells []string, rows, cols, width int) {
+	const pad = 4
+	right := width > 0
+	shownRows, shownCols := p.limit(rows, p.opts.MaxRows), p.limit(cols, p.opts.MaxColumns)
+	widths := make([]int, shownCols)
+	for j := range widths {
+		widths[j] = width
+		for i := 0; i < shownRows && !right; i++ {
+			if c := cells[j*rows+i]; len(c)+pad > widths[j] {
+				widths[j] = len(c) + pad
+			}
+		}
+	}
+
+	for start := 0; start < shownCols; {
+		end, lineWidth := start, 0
+		for end < shownCols && (end == start || lineWidth+widths[end] <= p.opts.Width) {
+			lineWidth += widths[end]
+			end++
+		}
+		if start > 0 || end < shownCols {
+			if end-start == 1 {
+				p.printf("  Column %d\n\n", start+1)
+			} else {
+				p.printf("  Columns %d through %d\n\n", start+1, end)
+			}
+		}
+		for i := 0; i < shownRows; i++ {
+			var line strings.Builder
+			for j := start; j < end; j++ {
+				c := cells[j*rows+i]
+				if right {
+					line.WriteString(fmt.Sprintf("%*s", widths[j], c))
+				} else {
+					line.WriteString(fmt.Sprintf("%s%-*s", strings.Repeat(" ", pad), widths[j]-pad, c))
+				}
+			}
+			p.printf("%s\n", strings.TrimRight(line.String(), " "))
+		}
+		if shownRows < rows {
+			p.printf("  ... %d more rows\n", rows-shownRows)
+		}
+		p.printf("\n")
+		start = end
+	}
+	if shownCols < cols {
+		p.printf("  ... %d more columns\n\n", cols-shownCols)
+	}
+}
+
+// formatNumbers formats the values of a numeric page like format short and returns the width of the columns
+func formatNumbers(m *Matrix, re, im []interface{}) ([]string, int) {
+	res := make([]string, len(re))
+	var format func(interface{}) string
+	pad, signed := 2, true
+	if m.Class == mxDOUBLE || m.Class == mxSINGLE {
+		values := append(m.doubleArray(re), m.doubleArray(im)...)
+		f, integers := numberFormat(values)
+		format = func(v interface{}) string { return f(toFloat64(v)) }
+		// a minus sign takes up some of the padding
+		pad, signed = 4, false
+		if integers {
+			pad = 3
+		}
+	} else {
+		format = func(v interface{}) string { return fmt.Sprint(v) }
+		if m.flags.isLogical {
+			pad = 3
+		}
+	}
+	width := 0
+	for i := range re {
+		res[i] = format(re[i])
+		if im != nil {
+			res[i] += formatImag(format(im[i]))
+		}
+		n := len(res[i])
+		if !signed && strings.HasPrefix(res[i], "-") {
+			n--
+		}
+		if n+pad > width {
+			width = n + pad
+		}
+	}
+	if m.Class == mxDOUBLE && im == nil && width < 6 {
+		width = 6
+	}
+	return res, width
+}
+
+// formatImag formats the imaginary part of a complex number, like " + 2i"
+func formatImag(s string) string {
+	if strings.HasPrefix(s, "-") {
+		return " - " + s[1:] + "i"
+	}
+	return " + " + s + "i"
+}
+
+// numberFormat chooses how to format floating point values. Integers are shown without decimals, other values with
+// 4 decimals, or in exponent notation when they are very large or small.
+func numberFormat(values []float64) (format func(float64) string, integers bool) {
+	integers = true
+	maxAbs := 0.0
+	for _, v := range values {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+		if v != math.Trunc(v) || math.Abs(v) >= 1e9 {
+			integers = false
+		}
+		if math.Abs(v) > maxAbs {
+			maxAbs = math.Abs(v)
+		}
+	}
+	special := func(v float64) (string, bool) {
+		switch {
+		case math.IsNaN(v):
+			return "NaN", true
+		case math.IsInf(v, 1):
+			return "Inf", true
+		case math.IsInf(v, -1):
+			return "-Inf", true
+		}
+		return "", false
+	}
+	verb := byte('f')
+	precision := 4
+	if integers {
+		precision = 0
+	} else if maxAbs >= 1e5 || maxAbs < 1e-3 && maxAbs > 0 {
+		verb = 'e'
+	}
+	return func(v float64) string {
+		if s, ok := special(v); ok {
+			return s
+		}
+		return strconv.FormatFloat(v, verb, precision, 64)
+	}, integers
+}
+
+// cellSummaries describes the contents of each cell the way matlab lists them, e.g. {[1]}, {'abc'} or {2x2 double}
+func cellSummaries(values []interface{}) []string {
+	res := make([]string, len(values))
+	for i, v := range values {
+		c, ok := v.(*Matrix)
+		if !ok {
+			res[i] = "{?}"
+			continue
+		}
+		text, _ := describe(c)
+		if c.Class.isNumeric() && c.numel() == 1 {
+			text = "[" + text + "]"
+		}
+		res[i] = "{" + text + "}"
+	}
+	return res
+}
+
+// describe returns a matrix on a single line. Scalars, row strings and short numeric rows are shown in full, anything
+// else by its size and class, in which case sized is true.
+func describe(m *Matrix) (text string, sized bool) {
+	isRow := len(m.Dimension) == 2 && m.Dimension[0] == 1
+	switch {
+	case m.Class == mxCHAR && isRow:
+		units := make([]uint16, len(m.value))
+		for i, v := range m.value {
+			units[i] = toUint16(v)
+		}
+		return quote(string(utf16.Decode(units))), false
+	case m.Class == mxDOUBLE && isEmpty2D(m):
+		return "[]", false
+	case m.Class.isNumeric() && len(m.value) == m.numel() && m.numel() == 1:
+		cells, _ := formatNumbers(m, m.value, m.imag)
+		return cells[0], false
+	case m.Class.isNumeric() && len(m.value) == m.numel() && isRow && !m.flags.isComplex && m.numel() <= 10:
+		cells, _ := formatNumbers(m, m.value, nil)
+		return "[" + strings.Join(cells, " ") + "]", false
+	case m.Class == mxSPARSE:
+		return fmt.Sprintf("%s sparse %s", dimString(m.Dimension), m.ClassName()), true
+	}
+	return fmt.Sprintf("%s %s", dimString(m.Dimension), m.ClassName()), true
+}
+
+// structure lists the fields of a scalar struct with their values, or the field names of a struct array
+func (p *printer) structure(m *Matrix) {
+	fields := m.FieldNames()
+	if m.numel() != 1 || len(m.value) != 1 {
+		if len(fields) == 0 {
+			p.printf("  %s struct array with no fields.\n\n", dimString(m.Dimension))
+			return
+		}
+		p.printf("  %s struct array with fields:\n\n", dimString(m.Dimension))
+		for _, f := range fields {
+			p.printf("    %s\n", f)
+		}
+		p.printf("\n")
+		return
+	}
+	if len(fields) == 0 {
+		p.printf("  struct with no fields.\n\n")
+		return
+	}
+	p.printf("  struct with fields:\n\n")
+	keys, _ := m.value[0].(map[string]*Matrix)
+	width := 0
+	for _, f := range fields {
+		if len(f) > width {
+			width = len(f)
+		}
+	}
+	for _, f := range fields {
+		value := "[]"
+		if c := keys[f]; c != nil {
+			value = fieldSummary(c)
+		}
+		p.printf("    %*s: %s\n", width, f, value)
+	}
+	p.printf("\n")
+}
+
+// fieldSummary describes the value of a struct field, e.g. 1, 'abc', [2x2 double] or {1x2 cell}
+func fieldSummary(m *Matrix) string {
+	text, sized := describe(m)
+	switch {
+	case !sized:
+		return text
+	case m.Class == mxCELL:
+		return "{" + text + "}"
+	}
+	return "[" + text + "]"
+}
+
+// sparse lists the nonzero values of a sparse matrix with their positions
+func (p *printer) sparse(m *Matrix) {
+	if len(m.ir) == 0 {
+		p.printf("   All zero sparse: %s\n\n", dimString(m.Dimension))
+		return
+	}
+	values := &Matrix{Class: mxDOUBLE, flags: m.flags}
+	if m.flags.isLogical {
+		values.Class = mxUINT8
+	}
+	cells, _ := formatNumbers(values, m.value, m.imag)
+	positions := make([]string, len(m.ir))
+	width := 0
+	for col := 0; col+1 < len(m.jc); col++ {
+		for i := m.jc[col]; i < m.jc[col+1] && i < len(m.ir); i++ {
+			positions[i] = fmt.Sprintf("(%d,%d)", m.ir[i]+1, col+1)
+			if len(positions[i]) > width {
+				width = len(positions[i])
+			}
+		}
+	}
+	shown := p.limit(len(m.ir), p.opts.MaxRows)
+	for i := 0; i < shown && i < len(cells); i++ {
+		p.printf("   %-*s    %s\n", width, positions[i], cells[i])
+	}
+	if shown < len(m.ir) {
+		p.printf("   ... %d more nonzero values\n", len(m.ir)-shown)
+	}
+	p.printf("\n")
+}
+
+// dimString formats dimensions like 2x3x4
+func dimString(dims []int32) string {
+	parts := make([]string, len(dims))
+	for i, d := range dims {
+		parts[i] = strconv.Itoa(int(d))
+	}
+	return strings.Join(parts, "x")
+}
@@ -0,0 +1,92 @@
+package matlab
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func format(t *testing.T, m *Matrix, opts *FormatOptions) string {
+	var buf bytes.Buffer
+	assert.NoError(t, m.Format(&buf, opts))
+	return buf.String()
+}
+
+func doubles(values ...float64) []interface{} {
+	res := make([]interface{}, len(values))
+	for i, v := range values {
+		res[i] = v
+	}
+	return res
+}
+
+func TestFormatNumeric(t *testing.T) {
+	m := &Matrix{Name: "x", Class: mxDOUBLE, Dimension: []int32{2, 2}, value: doubles(1, 3, 2, 4)}
+	assert.Equal(t, "x =\n\n     1     2\n     3     4\n\n", format(t, m, nil))
+
+	m = &Matrix{Name: "y", Class: mxDOUBLE, Dimension: []int32{1, 2}, value: doubles(1.5, -0.25)}
+	assert.Equal(t, "y =\n\n    1.5000   -0.2500\n\n", format(t, m, nil))
+
+	m = &Matrix{Name: "z", Class: mxINT8, Dimension: []int32{1, 2}, value: []interface{}{int8(-1), int8(20)}}
+	assert.Equal(t, "z =\n\n  -1  20\n\n", format(t, m, nil))
+	m.value = []interface{}{int8(-128), int8(127)}
+	assert.Equal(t, "z =\n\n  -128   127\n\n", format(t, m, nil))
+
+	m = &Matrix{Name: "c", Class: mxDOUBLE, Dimension: []int32{1, 1}, value: doubles(1), imag: doubles(-2), flags: Flags{isComplex: true}}
+	assert.Equal(t, "c =\n\n   1 - 2i\n\n", format(t, m, nil))
+
+	m = &Matrix{Name: "e", Class: mxDOUBLE, Dimension: []int32{0, 0}}
+	assert.Equal(t, "e =\n\n     []\n\n", format(t, m, nil))
+}
+
+func TestFormatPagesAndColumns(t *testing.T) {
+	m := &Matrix{Name: "a", Class: mxDOUBLE, Dimension: []int32{1, 2, 2}, value: doubles(1, 2, 3, 4)}
+	assert.Equal(t, "a(:,:,1) =\n\n     1     2\n\na(:,:,2) =\n\n     3     4\n\n", format(t, m, nil))
+	assert.Equal(t, "a(:,:,1) =\n\n     1     2\n\n  ... 1 more pages\n\n", format(t, m, &FormatOptions{MaxPages: 1}))
+
+	m = &Matrix{Name: "b", Class: mxDOUBLE, Dimension: []int32{1, 3}, value: doubles(1, 2, 3)}
+	assert.Equal(t, "b =\n\n  Columns 1 through 2\n\n     1     2\n\n  Column 3\n\n     3\n\n", format(t, m, &FormatOptions{Width: 12}))
+	assert.Equal(t, "b =\n\n     1\n\n  ... 2 more columns\n\n", format(t, m, &FormatOptions{MaxColumns: 1}))
+}
+
+func TestFormatCharCellStruct(t *testing.T) {
+	s := &Matrix{Name: "s", Class: mxCHAR, Dimension: []int32{1, 5}, value: castValues(mxCHAR, []interface{}{'i', 't', '\'', 's', '!'})}
+	assert.Equal(t, "s =\n\n    'it''s!'\n\n", format(t, s, nil))
+
+	rows := &Matrix{Name: "r", Class: mxCHAR, Dimension: []int32{2, 2}, value: castValues(mxCHAR, []interface{}{'a', 'c', 'b', 'd'})}
+	assert.Equal(t, "r =\n\n  2x2 char array\n\n    'ab'\n    'cd'\n\n", format(t, rows, nil))
+
+	one := &Matrix{Class: mxDOUBLE, Dimension: []int32{1, 1}, value: doubles(1)}
+	block := &Matrix{Class: mxDOUBLE, Dimension: []int32{2, 2}, value: doubles(1, 2, 3, 4)}
+	c := &Matrix{Name: "c", Class: mxCELL, Dimension: []int32{1, 3}, value: []interface{}{one, s, block}}
+	assert.Equal(t, "c =\n\n  1x3 cell array\n\n    {[1]}    {'it''s!'}    {2x2 double}\n\n", format(t, c, nil))
+
+	st := &Matrix{Name: "st", Class: mxSTRUCT, Dimension: []int32{1, 1}, fields: []string{"a", "name", "cells"},
+		value: []interface{}{map[string]*Matrix{"a": one, "name": s, "cells": c}}}
+	assert.Equal(t, "st =\n\n  struct with fields:\n\n        a: 1\n     name: 'it''s!'\n    cells: {1x3 cell}\n\n", format(t, st, nil))
+
+	arr := &Matrix{Name: "arr", Class: mxSTRUCT, Dimension: []int32{1, 2}, fields: []string{"a"},
+		value: []interface{}{map[string]*Matrix{"a": one}, map[string]*Matrix{"a": one}}}
+	assert.Equal(t, "arr =\n\n  1x2 struct array with fields:\n\n    a\n\n", format(t, arr, nil))
+}
+
+func TestFormatSparse(t *testing.T) {
+	m := &Matrix{Name: "sp", Class: mxSPARSE, Dimension: []int32{3, 2}, value: doubles(1, 2.5), ir: []int{0, 2}, jc: []int{0, 1, 2}}
+	assert.Equal(t, "sp =\n\n   (1,1)    1.0000\n   (3,2)    2.5000\n\n", format(t, m, nil))
+}
+
+func TestFormatFile(t *testing.T) {
+	file, err := os.Open("testdata/varTypes.mat")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer file.Close()
+	f, err := NewFileFromReader(file)
+	assert.NoError(t, err)
+	for _, name := range f.GetVarsNames() {
+		m, _ := f.GetVar(name)
+		assert.NotEmpty(t, format(t, m, nil))
+	}
+}
@@ -0,0 +1,64 @@
+package matlab
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fuzzOptions keeps the fuzzer from spending its time on files that are only slow because they are large. Every input
+// is read without options as well.
+var fuzzOptions = &ReaderOptions{MaxElementSize: 1 << 20, MaxTotalBytes: 1 << 22, MaxDepth: 20, MaxCompressionRatio: 100,
+	MaxDecompressedSize: 1 << 20, MaxDecompressed: 1 << 22}
+
+func FuzzNewFileFromReader(f *testing.F) {
+	paths, _ := filepath.Glob("testdata/*.mat")
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	f.Add([]byte(octaveText))
+	var v4 bytes.Buffer
+	w, err := NewFileFromWriter(&v4, &Header{Level: "4.0"})
+	if err != nil {
+		f.Fatal(err)
+	}
+	w.WriteElement(&Matrix{Name: "a", Class: mxDOUBLE, Dimension: []int32{2, 1}, flags: Flags{isComplex: true},
+		value: []interface{}{1.0, 2.0}, imag: []interface{}{3.0, 4.0}})
+	w.WriteElement(&Matrix{Name: "s", Class: mxCHAR, Dimension: []int32{1, 2}, value: []interface{}{uint16('h'), uint16('i')}})
+	f.Add(v4.Bytes())
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// the defaults have to hold up too, as most files are read without options
+		for _, opts := range []*ReaderOptions{nil, fuzzOptions} {
+			fuzzRead(t, data, opts)
+		}
+	})
+}
+
+func fuzzRead(t *testing.T, data []byte, opts *ReaderOptions) {
+	file, err := NewFileFromReaderWithOptions(bytes.NewReader(data), opts)
+	if err != nil {
+		return
+	}
+	for _, name := range file.GetVarsNames() {
+		m, _ := file.GetVar(name)
+		m.Format(io.Discard, &FormatOptions{MaxRows: 10, MaxColumns: 10, MaxPages: 2})
+		m.MarshalJSON()
+	}
+	file.RawElements()
+
+	// decoding concurrently gives the same variables and error
+	concurrent, _ := NewFileFromReaderWithOptions(bytes.NewReader(data), opts)
+	err = concurrent.ReadAll(context.Background(), &ReadAllOptions{Concurrency: 4})
+	if fmt.Sprint(err) != fmt.Sprint(file.Err()) || len(concurrent.vars) != len(file.vars) {
+		t.Fatalf("concurrent read gives %v and %d variables, expects %v and %d", err, len(concurrent.vars),
+			file.Err(), len(file.vars))
+	}
+}
@@ -0,0 +1,1430 @@
+package matlab
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/bits"
+	"os"
+	"strings"
+)
+
+// This file implements a reader for the subset of HDF5 that matlab uses for v7.3 files. It follows the HDF5 file format
+// specification version 3.0. All metadata in HDF5 is little endian.
+
+const maxInt = int(^uint(0) >> 1)
+
+var h5Signature = []byte("\x89HDF\r\n\x1a\n")
+
+// HDF5 object header message types
+const (
+	h5MsgNil          = 0x0000
+	h5MsgDataspace    = 0x0001
+	h5MsgLinkInfo     = 0x0002
+	h5MsgDatatype     = 0x0003
+	h5MsgFillValue    = 0x0005
+	h5MsgLink         = 0x0006
+	h5MsgLayout       = 0x0008
+	h5MsgFilters      = 0x000B
+	h5MsgAttribute    = 0x000C
+	h5MsgContinuation = 0x0010
+	h5MsgSymbolTable  = 0x0011
+)
+
+// HDF5 datatype classes
+const (
+	h5FixedPoint = 0
+	h5Float      = 1
+	h5String     = 3
+	h5Compound   = 6
+	h5Reference  = 7
+	h5VarLength  = 9
+)
+
+// HDF5 filters
+const (
+	h5FilterDeflate    = 1
+	h5FilterShuffle    = 2
+	h5FilterFletcher32 = 3
+)
+
+// maxDeflateRatio is the most deflate can compress data, which a run of equal bytes reaches
+const maxDeflateRatio = 1032
+
+// h5File reads objects from an HDF5 file
+type h5File struct {
+	r          io.ReaderAt
+	base       int64 // absolute position of the superblock, which all addresses are relative to
+	offsetSize int
+	lengthSize int
+	root       uint64 // address of the root group object header
+	maxDepth   int    // nesting of cells and structs
+	size       int64  // size of the file, -1 if the reader doesn't tell
+	opts       *ReaderOptions
+	total      int64 // bytes of the datasets read so far
+}
+
+// openH5 searches for the superblock at 0, 512, 1024, 2048... as the specification requires and reads it
+func openH5(r io.ReaderAt) (*h5File, error) {
+	sig := make([]byte, len(h5Signature))
+	for base := int64(0); base < 1<<30; base = max64(512, base*2) {
+		if _, err := r.ReadAt(sig, base); err != nil {
+			return nil, fmt.Errorf("cannot find HDF5 superblock: %v", err)
+		}
+		if bytes.Equal(sig, h5Signature) {
+			return readSuperblock(r, base)
+		}
+	}
+	return nil, fmt.Errorf("cannot find HDF5 superblock")
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func readSuperblock(r io.ReaderAt, base int64) (*h5File, error) {
+	buf := make([]byte, 128)
+	if n, err := r.ReadAt(buf, base); err != nil && !(err == io.EOF && n > 8) {
+		return nil, err
+	}
+	f := &h5File{r: r, base: base, size: readerSize(r)}
+	version := buf[8]
+	switch version {
+	case 0, 1:
+		f.offsetSize, f.lengthSize = int(buf[13]), int(buf[14])
+		if err := f.checkSizes(); err != nil {
+			return nil, err
+		}
+		off := 24
+		if version == 1 {
+			off += 4
+		}
+		// base address, free space, end of file and driver information addresses come before the root group symbol
+		// table entry, which starts with the link name offset
+		c := &h5Cursor{b: buf, off: off + 4*f.offsetSize + f.offsetSize, f: f}
+		f.root = c.addr()
+		return f, c.err
+	case 2, 3:
+		f.offsetSize, f.lengthSize = int(buf[9]), int(buf[10])
+		if err := f.checkSizes(); err != nil {
+			return nil, err
+		}
+		// base address, superblock extension and end of file addresses come before the root group object header
+		c := &h5Cursor{b: buf, off: 12 + 3*f.offsetSize, f: f}
+		f.root = c.addr()
+		return f, c.err
+	default:
+		return nil, fmt.Errorf("unsupported HDF5 superblock version %d", version)
+	}
+}
+
+// readerSize returns the size of the data behind r, or -1 if it cannot tell
+func readerSize(r io.ReaderAt) int64 {
+	switch s := r.(type) {
+	case interface{ Size() int64 }:
+		return s.Size()
+	case interface{ Stat() (os.FileInfo, error) }:
+		if info, err := s.Stat(); err == nil && info.Mode().IsRegular() {
+			return info.Size()
+		}
+	}
+	return -1
+}
+
+func (f *h5File) checkSizes() error {
+	for _, s := range []int{f.offsetSize, f.lengthSize} {
+		if s != 2 && s != 4 && s != 8 {
+			return fmt.Errorf("unsupported HDF5 offset or length size %d", s)
+		}
+	}
+	return nil
+}
+
+// undefinedAddress marks an address that is not set
+func (f *h5File) undefined(addr uint64) bool {
+	return addr == 1<<(8*uint(f.offsetSize))-1 || f.offsetSize == 8 && addr == ^uint64(0)
+}
+
+// readAt reads n bytes at the address relative to the base
+func (f *h5File) readAt(addr uint64, n int) ([]byte, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("invalid HDF5 read of %d bytes", n)
+	}
+	// the size is checked up front, so that a corrupt length cannot make it allocate more than the file holds
+	if end := uint64(f.size - f.base); f.size >= 0 && (addr > end || uint64(n) > end-addr) {
+		return nil, fmt.Errorf("unexpected end of HDF5 file reading %d bytes at %d", n, addr)
+	}
+	buf := make([]byte, n)
+	read, err := f.r.ReadAt(buf, f.base+int64(addr))
+	if read == n {
+		return buf, nil
+	}
+	if err == nil || err == io.EOF {
+		err = fmt.Errorf("unexpected end of HDF5 file reading %d bytes at %d", n, addr)
+	}
+	return nil, err
+}
+
+// readSignature reads n bytes at addr and checks that they start with the 4 byte signature
+func (f *h5File) readSignature(addr uint64, n int, sig string) (*h5Cursor, error) {
+	buf, err := f.readAt(addr, n)
+	if err != nil {
+		return nil, err
+	}
+	if string(buf[:4]) != sig {
+		return nil, fmt.Errorf("expects HDF5 %s signature at address %d", sig, addr)
+	}
+	return &h5Cursor{b: buf, off: 4, f: f}, nil
+}
+
+// h5Cursor decodes little endian values from a buffer. Reading past the end sets err and returns zeros.
+type h5Cursor struct {
+	b   []byte
+	off int
+	f   *h5File
+	err error
+}
+
+func (c *h5Cursor) bytes(n int) []byte {
+	if c.err != nil || n < 0 || c.off+n > len(c.b) {
+		if c.err == nil {
+			c.err = fmt.Errorf("truncated HDF5 structure")
+		}
+		if n < 0 {
+			n = 0
+		}
+		return make([]byte, n)
+	}
+	res := c.b[c.off : c.off+n]
+	c.off += n
+	return res
+}
+
+func (c *h5Cursor) skip(n int) {
+	c.bytes(n)
+}
+
+func (c *h5Cursor) uint(n int) uint64 {
+	var v uint64
+	for i, b := range c.bytes(n) {
+		v |= uint64(b) << (8 * uint(i))
+	}
+	return v
+}
+
+func (c *h5Cursor) u8() uint8 {
+	return uint8(c.uint(1))
+}
+
+func (c *h5Cursor) u16() uint16 {
+	return uint16(c.uint(2))
+}
+
+func (c *h5Cursor) u32() uint32 {
+	return uint32(c.uint(4))
+}
+
+func (c *h5Cursor) addr() uint64 {
+	return c.uint(c.f.offsetSize)
+}
+
+func (c *h5Cursor) length() uint64 {
+	return c.uint(c.f.lengthSize)
+}
+
+// cstring reads a NUL terminated string
+func (c *h5Cursor) cstring() string {
+	if c.err != nil {
+		return ""
+	}
+	end := bytes.IndexByte(c.b[c.off:], 0)
+	if end < 0 {
+		c.err = fmt.Errorf("unterminated HDF5 string")
+		return ""
+	}
+	s := string(c.b[c.off : c.off+end])
+	c.off += end + 1
+	return s
+}
+
+// align moves the cursor to the next multiple of n relative to start
+func (c *h5Cursor) align(start, n int) {
+	if rem := (c.off - start) % n; rem != 0 {
+		c.skip(n - rem)
+	}
+}
+
+func (c *h5Cursor) remaining() int {
+	return len(c.b) - c.off
+}
+
+// h5Message is a raw object header message
+type h5Message struct {
+	typ  uint16
+	data []byte
+}
+
+// h5Object is a parsed object header. An object is a group if it has link or symbol table messages and a dataset if
+// it has a layout message.
+type h5Object struct {
+	addr  uint64
+	msgs  []h5Message
+	attrs map[string]*h5Attribute
+}
+
+func (o *h5Object) message(typ uint16) []byte {
+	for _, m := range o.msgs {
+		if m.typ == typ {
+			return m.data
+		}
+	}
+	return nil
+}
+
+func (o *h5Object) isGroup() bool {
+	return o.message(h5MsgSymbolTable) != nil || o.message(h5MsgLinkInfo) != nil || o.message(h5MsgLink) != nil
+}
+
+func (o *h5Object) isDataset() bool {
+	return o.message(h5MsgLayout) != nil
+}
+
+// readObject reads the object header at addr along with its attributes
+func (f *h5File) readObject(addr uint64) (*h5Object, error) {
+	prefix, err := f.readAt(addr, 16)
+	if err != nil {
+		return nil, err
+	}
+	o := &h5Object{addr: addr, attrs: map[string]*h5Attribute{}}
+	if string(prefix[:4]) == "OHDR" {
+		err = f.readObjectV2(o)
+	} else if prefix[0] == 1 {
+		err = f.readObjectV1(o, prefix)
+	} else {
+		err = fmt.Errorf("unsupported HDF5 object header version %d at address %d", prefix[0], addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range o.msgs {
+		if m.typ != h5MsgAttribute {
+			continue
+		}
+		a, err := f.parseAttribute(m.data)
+		if err != nil {
+			return nil, err
+		}
+		o.attrs[a.name] = a
+	}
+	return o, nil
+}
+
+func (f *h5File) readObjectV1(o *h5Object, prefix []byte) error {
+	c := &h5Cursor{b: prefix, f: f}
+	c.skip(2)
+	numMessages := int(c.u16())
+	c.skip(4)
+	size := int(c.u32())
+	// the messages are aligned to 8 bytes, so the 12 byte prefix is followed by 4 bytes of padding
+	blocks := [][2]uint64{{o.addr + 16, uint64(size)}}
+	for len(blocks) > 0 && len(o.msgs) < numMessages {
+		buf, err := f.readAt(blocks[0][0], int(blocks[0][1]))
+		if err != nil {
+			return err
+		}
+		blocks = blocks[1:]
+		c := &h5Cursor{b: buf, f: f}
+		for c.remaining() >= 8 && len(o.msgs) < numMessages {
+			typ := c.u16()
+			n := int(c.u16())
+			c.skip(4) // flags and reserved
+			data := c.bytes(n)
+			if c.err != nil {
+				return c.err
+			}
+			if flags := buf[c.off-n-4]; flags&0x02 != 0 {
+				return fmt.Errorf("shared HDF5 messages are not supported")
+			}
+			o.msgs = append(o.msgs, h5Message{typ: typ, data: data})
+			if typ == h5MsgContinuation {
+				mc := &h5Cursor{b: data, f: f}
+				blocks = append(blocks, [2]uint64{mc.addr(), mc.length()})
+				if mc.err != nil {
+					return mc.err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (f *h5File) readObjectV2(o *h5Object) error {
+	head, err := f.readAt(o.addr, 6)
+	if err != nil {
+		return err
+	}
+	flags := head[5]
+	off := 6
+	if flags&0x20 != 0 {
+		off += 16 // access, modification, change and birth times
+	}
+	if flags&0x10 != 0 {
+		off += 4 // attribute phase change values
+	}
+	sizeLen := 1 << (flags & 0x03)
+	sizeBuf, err := f.readAt(o.addr+uint64(off), sizeLen)
+	if err != nil {
+		return err
+	}
+	size := (&h5Cursor{b: sizeBuf, f: f}).uint(sizeLen)
+	// the first chunk is followed by a checksum, continuation chunks start with OCHK
+	blocks := [][2]uint64{{o.addr + uint64(off+sizeLen), size}}
+	first := true
+	for len(blocks) > 0 {
+		buf, err := f.readAt(blocks[0][0], int(blocks[0][1]))
+		if err != nil {
+			return err
+		}
+		blocks = blocks[1:]
+		c := &h5Cursor{b: buf, f: f}
+		end := len(buf)
+		if !first {
+			if len(buf) < 8 || string(buf[:4]) != "OCHK" {
+				return fmt.Errorf("expects HDF5 OCHK signature")
+			}
+			c.skip(4)
+		}
+		first = false
+		headerLen := 4
+		if flags&0x04 != 0 {
+			headerLen += 2 // creation order
+		}
+		for end-c.off >= headerLen {
+			typ := uint16(c.u8())
+			n := int(c.u16())
+			msgFlags := c.u8()
+			if flags&0x04 != 0 {
+				c.skip(2)
+			}
+			if c.off+n > end {
+				return fmt.Errorf("HDF5 message exceeds its object header chunk")
+			}
+			data := c.bytes(n)
+			if msgFlags&0x02 != 0 {
+				return fmt.Errorf("shared HDF5 messages are not supported")
+			}
+			o.msgs = append(o.msgs, h5Message{typ: typ, data: data})
+			if typ == h5MsgContinuation {
+				mc := &h5Cursor{b: data, f: f}
+				blocks = append(blocks, [2]uint64{mc.addr(), mc.length() - 4})
+				if mc.err != nil {
+					return mc.err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// h5Link is a named link from a group to an object
+type h5Link struct {
+	name string
+	addr uint64
+}
+
+// links returns the hard links of a group
+func (f *h5File) links(o *h5Object) ([]h5Link, error) {
+	if st := o.message(h5MsgSymbolTable); st != nil {
+		c := &h5Cursor{b: st, f: f}
+		btree, heap := c.addr(), c.addr()
+		if c.err != nil {
+			return nil, c.err
+		}
+		return f.symbolTableLinks(btree, heap)
+	}
+	var res []h5Link
+	for _, m := range o.msgs {
+		if m.typ != h5MsgLink {
+			continue
+		}
+		l, ok, err := f.parseLink(m.data)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			res = append(res, l)
+		}
+	}
+	if info := o.message(h5MsgLinkInfo); info != nil {
+		c := &h5Cursor{b: info, f: f}
+		c.skip(1)
+		if c.u8()&0x01 != 0 {
+			c.skip(8) // maximum creation index
+		}
+		heap, nameIndex := c.addr(), c.addr()
+		if c.err != nil {
+			return nil, c.err
+		}
+		if !f.undefined(heap) {
+			dense, err := f.denseLinks(heap, nameIndex)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, dense...)
+		}
+	}
+	return res, nil
+}
+
+// parseLink decodes a link message. Only hard links are returned, soft and external links are skipped.
+func (f *h5File) parseLink(data []byte) (l h5Link, ok bool, err error) {
+	c := &h5Cursor{b: data, f: f}
+	if v := c.u8(); v != 1 {
+		return l, false, fmt.Errorf("unsupported HDF5 link message version %d", v)
+	}
+	flags := c.u8()
+	linkType := uint8(0)
+	if flags&0x08 != 0 {
+		linkType = c.u8()
+	}
+	if flags&0x04 != 0 {
+		c.skip(8) // creation order
+	}
+	if flags&0x10 != 0 {
+		c.skip(1) // character set
+	}
+	nameLen := int(c.uint(1 << (flags & 0x03)))
+	l.name = string(c.bytes(nameLen))
+	if linkType == 0 {
+		l.addr = c.addr()
+		ok = true
+	}
+	return l, ok, c.err
+}
+
+// symbolTableLinks walks the group B-tree of an old style group. Link names are stored in the local heap.
+func (f *h5File) symbolTableLinks(btree, heapAddr uint64) ([]h5Link, error) {
+	c, err := f.readSignature(heapAddr, 8+2*f.lengthSize+f.offsetSize, "HEAP")
+	if err != nil {
+		return nil, err
+	}
+	c.skip(4)
+	heapSize := c.length()
+	c.length() // free list
+	heapData := c.addr()
+	if c.err != nil {
+		return nil, c.err
+	}
+	heap, err := f.readAt(heapData, int(heapSize))
+	if err != nil {
+		return nil, err
+	}
+	var res []h5Link
+	err = f.walkBTreeV1(btree, 0, func(child uint64, _ []byte) error {
+		c, err := f.readSignature(child, 8, "SNOD")
+		if err != nil {
+			return err
+		}
+		c.skip(2)
+		n := int(c.u16())
+		entryLen := 2*f.offsetSize + 24
+		buf, err := f.readAt(child+8, n*entryLen)
+		if err != nil {
+			return err
+		}
+		ec := &h5Cursor{b: buf, f: f}
+		for i := 0; i < n; i++ {
+			nameOff := ec.addr()
+			addr := ec.addr()
+			ec.skip(24) // cache type, reserved and scratch pad
+			if nameOff >= uint64(len(heap)) {
+				return fmt.Errorf("HDF5 link name offset %d outside of local heap", nameOff)
+			}
+			name := heap[nameOff:]
+			if end := bytes.IndexByte(name, 0); end >= 0 {
+				name = name[:end]
+			}
+			res = append(res, h5Link{name: string(name), addr: addr})
+		}
+		return ec.err
+	})
+	return res, err
+}
+
+// walkBTreeV1 calls fn for every child of the leaves of a version 1 B-tree along with the key preceding the child.
+// Group nodes (type 0) have length sized keys; chunk nodes (type 1) have keys of the given size.
+func (f *h5File) walkBTreeV1(addr uint64, keySize int, fn func(child uint64, key []byte) error) error {
+	c, err := f.readSignature(addr, 8+2*f.offsetSize, "TREE")
+	if err != nil {
+		return err
+	}
+	nodeType := c.u8()
+	level := c.u8()
+	entries := int(c.u16())
+	if nodeType == 0 {
+		keySize = f.lengthSize
+	}
+	buf, err := f.readAt(addr+uint64(8+2*f.offsetSize), entries*(keySize+f.offsetSize)+keySize)
+	if err != nil {
+		return err
+	}
+	nc := &h5Cursor{b: buf, f: f}
+	for i := 0; i < entries; i++ {
+		key := nc.bytes(keySize)
+		child := nc.addr()
+		if nc.err != nil {
+			return nc.err
+		}
+		if level > 0 {
+			err = f.walkBTreeV1(child, keySize, fn)
+		} else {
+			err = fn(child, key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// h5FractalHeap holds what is needed to look up managed objects in a fractal heap
+type h5FractalHeap struct {
+	f               *h5File
+	idLen           int
+	filtered        bool
+	checksummed     bool
+	tableWidth      int
+	startBlockSize  uint64
+	maxDirectSize   uint64
+	maxHeapBits     int
+	rootAddr        uint64
+	rootRows        int
+	maxManagedSize  uint64
+	directBlocks    []h5HeapBlock
+	directBlocksErr error
+}
+
+type h5HeapBlock struct {
+	offset, size, addr uint64
+}
+
+func (f *h5File) readFractalHeap(addr uint64) (*h5FractalHeap, error) {
+	c, err := f.readSignature(addr, 4+1+2+2+1+4+12*f.lengthSize+3*f.offsetSize+2+2+2+2+4, "FRHP")
+	if err != nil {
+		return nil, err
+	}
+	h := &h5FractalHeap{f: f}
+	c.skip(1)
+	h.idLen = int(c.u16())
+	h.filtered = c.u16() > 0
+	h.checksummed = c.u8()&0x02 != 0
+	h.maxManagedSize = uint64(c.u32())
+	c.length() // next huge object id
+	c.addr()   // huge object B-tree
+	c.length() // free space
+	c.addr()   // free space manager
+	c.length() // managed space
+	c.length() // allocated managed space
+	c.length() // direct block allocation iterator offset
+	c.length() // number of managed objects
+	c.length() // size of huge objects
+	c.length() // number of huge objects
+	c.length() // size of tiny objects
+	c.length() // number of tiny objects
+	h.tableWidth = int(c.u16())
+	h.startBlockSize = c.length()
+	h.maxDirectSize = c.length()
+	h.maxHeapBits = int(c.u16())
+	c.u16() // starting number of rows in root indirect block
+	h.rootAddr = c.addr()
+	h.rootRows = int(c.u16())
+	if c.err != nil {
+		return nil, c.err
+	}
+	if h.filtered {
+		return nil, fmt.Errorf("filtered HDF5 fractal heaps are not supported")
+	}
+	if h.tableWidth == 0 || h.startBlockSize == 0 {
+		return nil, fmt.Errorf("invalid HDF5 fractal heap")
+	}
+	return h, nil
+}
+
+// blockSize returns the size of the blocks in the given row of the doubling table
+func (h *h5FractalHeap) blockSize(row int) uint64 {
+	if row == 0 {
+		return h.startBlockSize
+	}
+	return h.startBlockSize << uint(row-1)
+}
+
+// blocks lists all direct blocks with their offset in the heap's address space
+func (h *h5FractalHeap) blocks() ([]h5HeapBlock, error) {
+	if h.directBlocks != nil || h.directBlocksErr != nil {
+		return h.directBlocks, h.directBlocksErr
+	}
+	if h.f.undefined(h.rootAddr) {
+		return nil, nil
+	}
+	if h.rootRows == 0 {
+		h.directBlocks = []h5HeapBlock{{0, h.startBlockSize, h.rootAddr}}
+	} else {
+		h.directBlocksErr = h.indirectBlocks(h.rootAddr, 0, h.rootRows)
+	}
+	return h.directBlocks, h.directBlocksErr
+}
+
+func (h *h5FractalHeap) indirectBlocks(addr, offset uint64, rows int) error {
+	maxDirectRows := bits.Len64(h.maxDirectSize) - bits.Len64(h.startBlockSize) + 2
+	offsetBytes := (h.maxHeapBits + 7) / 8
+	entries := rows * h.tableWidth
+	c, err := h.f.readSignature(addr, 5+h.f.offsetSize+offsetBytes+entries*h.f.offsetSize, "FHIB")
+	if err != nil {
+		return err
+	}
+	c.skip(1 + h.f.offsetSize + offsetBytes)
+	for row := 0; row < rows; row++ {
+		size := h.blockSize(row)
+		for col := 0; col < h.tableWidth; col++ {
+			child := c.addr()
+			if c.err != nil {
+				return c.err
+			}
+			if !h.f.undefined(child) {
+				if row < maxDirectRows {
+					h.directBlocks = append(h.directBlocks, h5HeapBlock{offset, size, child})
+				} else {
+					// an indirect block covering size bytes has as many rows as it takes for the rows to add up to it
+					childRows := bits.Len64(size / (h.startBlockSize * uint64(h.tableWidth)))
+					if err := h.indirectBlocks(child, offset, childRows); err != nil {
+						return err
+					}
+				}
+			}
+			offset += size
+		}
+	}
+	return nil
+}
+
+// object returns the managed object with the given heap id
+func (h *h5FractalHeap) object(id []byte) ([]byte, error) {
+	if len(id) == 0 || id[0]>>4&0x03 != 0 {
+		return nil, fmt.Errorf("only managed HDF5 fractal heap objects are supported")
+	}
+	offsetBytes := (h.maxHeapBits + 7) / 8
+	// the length takes as many bytes as an offset into the largest direct block, or as the largest managed object needs
+	lengthBytes := (bits.Len64(h.maxDirectSize) - 1 + 7) / 8
+	if n := (bits.Len64(h.maxManagedSize)-1)/8 + 1; n < lengthBytes {
+		lengthBytes = n
+	}
+	c := &h5Cursor{b: id, off: 1, f: h.f}
+	offset := c.uint(offsetBytes)
+	length := c.uint(lengthBytes)
+	if c.err != nil {
+		return nil, c.err
+	}
+	blocks, err := h.blocks()
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range blocks {
+		if offset >= b.offset && offset+length <= b.offset+b.size {
+			// offsets within a direct block include its header
+			return h.f.readAt(b.addr+offset-b.offset, int(length))
+		}
+	}
+	return nil, fmt.Errorf("HDF5 fractal heap object at offset %d not found", offset)
+}
+
+// denseLinks reads the links of a group stored in a fractal heap, indexed by the name B-tree
+func (f *h5File) denseLinks(heapAddr, nameIndex uint64) ([]h5Link, error) {
+	heap, err := f.readFractalHeap(heapAddr)
+	if err != nil {
+		return nil, err
+	}
+	var res []h5Link
+	err = f.walkBTreeV2(nameIndex, func(record []byte) error {
+		// name index records hold a hash of the name followed by the heap id
+		if len(record) < 4+heap.idLen {
+			return fmt.Errorf("invalid HDF5 link name index record")
+		}
+		obj, err := heap.object(record[4 : 4+heap.idLen])
+		if err != nil {
+			return err
+		}
+		l, ok, err := f.parseLink(obj)
+		if err != nil {
+			return err
+		}
+		if ok {
+			res = append(res, l)
+		}
+		return nil
+	})
+	return res, err
+}
+
+// walkBTreeV2 calls fn for every record of a version 2 B-tree
+func (f *h5File) walkBTreeV2(addr uint64, fn func(record []byte) error) error {
+	c, err := f.readSignature(addr, 4+1+1+4+2+2+1+1+f.offsetSize+2+f.lengthSize+4, "BTHD")
+	if err != nil {
+		return err
+	}
+	c.skip(2)
+	nodeSize := int(c.u32())
+	recordSize := int(c.u16())
+	depth := int(c.u16())
+	c.skip(2)
+	root := c.addr()
+	rootRecords := int(c.u16())
+	if c.err != nil {
+		return c.err
+	}
+	if f.undefined(root) || rootRecords == 0 {
+		return nil
+	}
+	if recordSize == 0 || nodeSize <= 10 {
+		return fmt.Errorf("invalid HDF5 v2 B-tree")
+	}
+
+	// The child pointers of internal nodes store record counts in as few bytes as the maximum counts need, which
+	// depend on the depth of the child.
+	maxRecords := make([]int, depth+1)   // maximum number of records in a node at each depth
+	totalRecords := make([]int, depth+1) // maximum number of records below a node at each depth
+	countBytes := func(n int) int {
+		return (bits.Len64(uint64(n)) + 7) / 8
+	}
+	maxRecords[0] = (nodeSize - 10) / recordSize
+	totalRecords[0] = maxRecords[0]
+	pointerSizes := make([]int, depth+1)
+	for d := 1; d <= depth; d++ {
+		pointerSizes[d] = f.offsetSize + countBytes(maxRecords[d-1])
+		if d > 1 {
+			pointerSizes[d] += countBytes(totalRecords[d-1])
+		}
+		maxRecords[d] = (nodeSize - 10 - pointerSizes[d]) / (recordSize + pointerSizes[d])
+		totalRecords[d] = (maxRecords[d]+1)*totalRecords[d-1] + maxRecords[d]
+	}
+
+	var walk func(addr uint64, records, depth int) error
+	walk = func(addr uint64, records, depth int) error {
+		sig := "BTLF"
+		if depth > 0 {
+			sig = "BTIN"
+		}
+		c, err := f.readSignature(addr, nodeSize, sig)
+		if err != nil {
+			return err
+		}
+		c.skip(2)
+		recs := make([][]byte, records)
+		for i := range recs {
+			recs[i] = c.bytes(recordSize)
+		}
+		if c.err != nil {
+			return c.err
+		}
+		if depth == 0 {
+			for _, r := range recs {
+				if err := fn(r); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		for i := 0; i <= records; i++ {
+			child := c.addr()
+			n := int(c.uint(countBytes(maxRecords[depth-1])))
+			if depth > 1 {
+				c.uint(countBytes(totalRecords[depth-1]))
+			}
+			if c.err != nil {
+				return c.err
+			}
+			if err := walk(child, n, depth-1); err != nil {
+				return err
+			}
+			if i < records {
+				if err := fn(recs[i]); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return walk(root, rootRecords, depth)
+}
+
+// h5Type is a parsed datatype message
+type h5Type struct {
+	class     uint8
+	size      int
+	signed    bool
+	bigEndian bool
+	members   []h5Member // compound members
+	base      *h5Type    // base type of variable length types
+}
+
+type h5Member struct {
+	name   string
+	offset int
+	typ    *h5Type
+}
+
+func (f *h5File) parseType(c *h5Cursor) (*h5Type, error) {
+	classAndVersion := c.u8()
+	bitField := c.bytes(3)
+	t := &h5Type{class: classAndVersion & 0x0f, size: int(c.u32())}
+	version := classAndVersion >> 4
+	switch t.class {
+	case h5FixedPoint:
+		t.bigEndian = bitField[0]&0x01 != 0
+		t.signed = bitField[0]&0x08 != 0
+		c.skip(4) // bit offset and precision
+	case h5Float:
+		t.bigEndian = bitField[0]&0x01 != 0
+		if bitField[0]&0x40 != 0 {
+			return nil, fmt.Errorf("VAX ordered HDF5 floats are not supported")
+		}
+		c.skip(12)
+	case h5String, h5Reference:
+	case h5Compound:
+		n := int(bitField[0]) | int(bitField[1])<<8
+		for i := 0; i < n; i++ {
+			start := c.off
+			m := h5Member{name: c.cstring()}
+			switch version {
+			case 1, 2:
+				c.align(start, 8)
+				m.offset = int(c.u32())
+				if version == 1 {
+					c.skip(28) // dimensionality, reserved, permutation and dimension sizes
+				}
+			case 3:
+				m.offset = int(c.uint((bits.Len(uint(t.size)) + 7) / 8))
+			default:
+				return nil, fmt.Errorf("unsupported HDF5 compound datatype version %d", version)
+			}
+			mt, err := f.parseType(c)
+			if err != nil {
+				return nil, err
+			}
+			m.typ = mt
+			t.members = append(t.members, m)
+		}
+	case h5VarLength:
+		base, err := f.parseType(c)
+		if err != nil {
+			return nil, err
+		}
+		t.base = base
+	default:
+		return nil, fmt.Errorf("unsupported HDF5 datatype class %d", t.class)
+	}
+	return t, c.err
+}
+
+// parseDataspace returns the dimensions of a dataspace message. Scalar dataspaces have no dimensions, null
+// dataspaces return nil with null set.
+func (f *h5File) parseDataspace(c *h5Cursor) (dims []uint64, null bool, err error) {
+	version := c.u8()
+	rank := int(c.u8())
+	flags := c.u8()
+	switch version {
+	case 1:
+		c.skip(5)
+	case 2:
+		if c.u8() == 2 {
+			return nil, true, c.err
+		}
+	default:
+		return nil, false, fmt.Errorf("unsupported HDF5 dataspace version %d", version)
+	}
+	dims = make([]uint64, rank)
+	for i := range dims {
+		dims[i] = c.length()
+	}
+	if flags&0x01 != 0 {
+		for i := 0; i < rank; i++ {
+			c.length()
+		}
+	}
+	return dims, false, c.err
+}
+
+// h5Attribute is a decoded attribute
+type h5Attribute struct {
+	name string
+	typ  *h5Type
+	dims []uint64
+	data []byte
+}
+
+func (f *h5File) parseAttribute(data []byte) (*h5Attribute, error) {
+	c := &h5Cursor{b: data, f: f}
+	version := c.u8()
+	c.skip(1)
+	nameLen := int(c.u16())
+	typeLen := int(c.u16())
+	spaceLen := int(c.u16())
+	if version == 3 {
+		c.skip(1) // name character set
+	}
+	if version < 1 || version > 3 {
+		return nil, fmt.Errorf("unsupported HDF5 attribute version %d", version)
+	}
+	pad := func(n int) int {
+		if version == 1 {
+			return (n + 7) / 8 * 8
+		}
+		return n
+	}
+	a := &h5Attribute{name: strings.TrimRight(string(c.bytes(pad(nameLen))), "\x00")}
+	typ, err := f.parseType(&h5Cursor{b: c.bytes(pad(typeLen)), f: f})
+	if err != nil {
+		return nil, err
+	}
+	a.typ = typ
+	dims, _, err := f.parseDataspace(&h5Cursor{b: c.bytes(pad(spaceLen)), f: f})
+	if err != nil {
+		return nil, err
+	}
+	a.dims = dims
+	if c.err != nil {
+		return nil, c.err
+	}
+	a.data = c.b[c.off:]
+	return a, nil
+}
+
+// numel returns the number of elements of the given dimensions
+func h5Numel(dims []uint64) uint64 {
+	n := uint64(1)
+	for _, d := range dims {
+		n *= d
+	}
+	return n
+}
+
+// String returns the value of a string attribute
+func (a *h5Attribute) String() string {
+	return strings.TrimRight(string(a.data), "\x00 ")
+}
+
+// Uint returns the first value of an integer attribute
+func (a *h5Attribute) Uint() uint64 {
+	if a.typ.class != h5FixedPoint || len(a.data) < a.typ.size {
+		return 0
+	}
+	return decodeUint(a.data[:a.typ.size], a.typ.bigEndian)
+}
+
+func decodeUint(b []byte, bigEndian bool) uint64 {
+	var v uint64
+	for i := range b {
+		if bigEndian {
+			v = v<<8 | uint64(b[i])
+		} else {
+			v |= uint64(b[i]) << (8 * uint(i))
+		}
+	}
+	return v
+}
+
+// strings returns the values of a variable length string or character sequence attribute, which live in the global
+// heap
+func (f *h5File) attributeStrings(a *h5Attribute) ([]string, error) {
+	if a.typ.class != h5VarLength {
+		return nil, fmt.Errorf("expects attribute %s to be of variable length", a.name)
+	}
+	c := &h5Cursor{b: a.data, f: f}
+	var res []string
+	collections := map[uint64]map[uint16][]byte{}
+	for i := uint64(0); i < h5Numel(a.dims); i++ {
+		c.u32() // length
+		addr := c.addr()
+		index := uint16(c.u32())
+		if c.err != nil {
+			return nil, c.err
+		}
+		objects, ok := collections[addr]
+		if !ok {
+			var err error
+			if objects, err = f.readGlobalHeap(addr); err != nil {
+				return nil, err
+			}
+			collections[addr] = objects
+		}
+		res = append(res, string(objects[index]))
+	}
+	return res, nil
+}
+
+// readGlobalHeap returns the objects of a global heap collection by index
+func (f *h5File) readGlobalHeap(addr uint64) (map[uint16][]byte, error) {
+	c, err := f.readSignature(addr, 8+f.lengthSize, "GCOL")
+	if err != nil {
+		return nil, err
+	}
+	c.skip(4)
+	size := c.length()
+	buf, err := f.readAt(addr, int(size))
+	if err != nil {
+		return nil, err
+	}
+	c = &h5Cursor{b: buf, off: 8 + f.lengthSize, f: f}
+	res := map[uint16][]byte{}
+	for c.remaining() >= 8+f.lengthSize {
+		index := c.u16()
+		c.skip(6) // reference count and reserved
+		n := c.length()
+		if index == 0 {
+			// free space takes up the rest of the collection
+			break
+		}
+		res[index] = c.bytes(int(n))
+		c.align(0, 8)
+		if c.err != nil {
+			return nil, c.err
+		}
+	}
+	return res, nil
+}
+
+// h5Dataset is a dataset that has been read into memory
+type h5Dataset struct {
+	typ  *h5Type
+	dims []uint64 // nil for null dataspaces, empty for scalars
+	data []byte   // elements in row major order
+}
+
+// readDataset reads the full data of a dataset object
+func (f *h5File) readDataset(o *h5Object) (*h5Dataset, error) {
+	typeMsg, spaceMsg, layout := o.message(h5MsgDatatype), o.message(h5MsgDataspace), o.message(h5MsgLayout)
+	if typeMsg == nil || spaceMsg == nil || layout == nil {
+		return nil, fmt.Errorf("HDF5 object at %d is not a dataset", o.addr)
+	}
+	typ, err := f.parseType(&h5Cursor{b: typeMsg, f: f})
+	if err != nil {
+		return nil, err
+	}
+	dims, null, err := f.parseDataspace(&h5Cursor{b: spaceMsg, f: f})
+	if err != nil {
+		return nil, err
+	}
+	ds := &h5Dataset{typ: typ, dims: dims}
+	if null {
+		ds.dims = nil
+		return ds, nil
+	}
+	numel := uint64(1)
+	for _, d := range dims {
+		hi, lo := bits.Mul64(numel, d)
+		if hi != 0 || d > math.MaxInt32 {
+			return nil, fmt.Errorf("HDF5 dataset of dimensions %v is too large", dims)
+		}
+		numel = lo
+	}
+	if typ.size > 0 && numel > uint64(maxInt/typ.size) {
+		return nil, fmt.Errorf("HDF5 dataset of %d elements is too large", numel)
+	}
+	size := numel * uint64(typ.size)
+	filters, err := f.parseFilters(o.message(h5MsgFilters))
+	if err != nil {
+		return nil, err
+	}
+
+	c := &h5Cursor{b: layout, f: f}
+	version := c.u8()
+	var class uint8
+	var chunkDims []uint64
+	var addr uint64
+	var compact []byte
+	switch version {
+	case 1, 2:
+		rank := int(c.u8())
+		class = c.u8()
+		c.skip(5)
+		if class != 0 {
+			addr = c.addr()
+		}
+		for i := 0; i < rank; i++ {
+			chunkDims = append(chunkDims, uint64(c.u32()))
+		}
+		if class == 2 {
+			c.u32() // element size
+		} else if class == 0 {
+			compact = c.bytes(int(c.u32()))
+		}
+	case 3, 4:
+		class = c.u8()
+		switch class {
+		case 0:
+			compact = c.bytes(int(c.u16()))
+		case 1:
+			addr = c.addr()
+		case 2:
+			if version == 4 {
+				return nil, fmt.Errorf("version 4 chunked HDF5 layouts are not supported")
+			}
+			rank := int(c.u8())
+			addr = c.addr()
+			for i := 0; i < rank; i++ {
+				chunkDims = append(chunkDims, uint64(c.u32()))
+			}
+		default:
+			return nil, fmt.Errorf("unsupported HDF5 layout class %d", class)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported HDF5 layout version %d", version)
+	}
+	if c.err != nil {
+		return nil, c.err
+	}
+	if err := f.reserve(size); err != nil {
+		return nil, err
+	}
+	// the data has to be in the file, unless the dataset only holds its fill value
+	if class != 0 && !f.undefined(addr) && f.size >= 0 {
+		ratio := uint64(1)
+		for _, flt := range filters {
+			if class == 2 && flt.id == h5FilterDeflate {
+				ratio = maxDeflateRatio
+			}
+		}
+		if size/ratio > uint64(f.size) {
+			return nil, fmt.Errorf("HDF5 dataset of %d bytes is larger than the file can hold", size)
+		}
+	}
+
+	switch class {
+	case 0:
+		ds.data = compact
+	case 1:
+		if f.undefined(addr) {
+			ds.data = make([]byte, size)
+		} else if ds.data, err = f.readAt(addr, int(size)); err != nil {
+			return nil, err
+		}
+	case 2:
+		// the chunk dimensions have an extra entry for the element size
+		if len(chunkDims) != len(dims)+1 {
+			return nil, fmt.Errorf("HDF5 chunk rank does not match its dataspace")
+		}
+		ds.data = make([]byte, size)
+		if !f.undefined(addr) {
+			if err := f.readChunks(ds, addr, chunkDims[:len(dims)], filters); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if uint64(len(ds.data)) < size {
+		return nil, fmt.Errorf("HDF5 dataset holds %d bytes, expects %d", len(ds.data), size)
+	}
+	ds.data = ds.data[:size]
+	return ds, nil
+}
+
+// reserve checks a dataset of n bytes against the limits of the reader options and counts it towards the total
+func (f *h5File) reserve(n uint64) error {
+	if f.opts == nil {
+		return nil
+	}
+	if max := f.opts.MaxElementSize; max > 0 && n > uint64(max) {
+		return fmt.Errorf("HDF5 dataset of %d bytes exceeds the limit of %d bytes", n, max)
+	}
+	f.total += int64(n)
+	if max := f.opts.MaxTotalBytes; max > 0 && f.total > max {
+		return fmt.Errorf("file holds more than the limit of %d bytes", max)
+	}
+	return nil
+}
+
+type h5Filter struct {
+	id     uint16
+	params []uint32
+}
+
+func (f *h5File) parseFilters(data []byte) ([]h5Filter, error) {
+	if data == nil {
+		return nil, nil
+	}
+	c := &h5Cursor{b: data, f: f}
+	version := c.u8()
+	n := int(c.u8())
+	if version == 1 {
+		c.skip(6)
+	}
+	var res []h5Filter
+	for i := 0; i < n; i++ {
+		flt := h5Filter{id: c.u16()}
+		nameLen := 0
+		if version == 1 || flt.id >= 256 {
+			nameLen = int(c.u16())
+		}
+		c.skip(2) // flags
+		numValues := int(c.u16())
+		if version == 1 {
+			nameLen = (nameLen + 7) / 8 * 8
+		}
+		c.skip(nameLen)
+		for j := 0; j < numValues; j++ {
+			flt.params = append(flt.params, c.u32())
+		}
+		if version == 1 && numValues%2 == 1 {
+			c.skip(4)
+		}
+		switch flt.id {
+		case h5FilterDeflate, h5FilterShuffle, h5FilterFletcher32:
+		default:
+			return nil, fmt.Errorf("unsupported HDF5 filter %d", flt.id)
+		}
+		res = append(res, flt)
+	}
+	return res, c.err
+}
+
+// unfilter reverses the filters applied to a chunk, skipping those whose bit is set in the mask
+func unfilter(data []byte, filters []h5Filter, mask uint32, elementSize int) ([]byte, error) {
+	for i := len(filters) - 1; i >= 0; i-- {
+		if mask&(1<<uint(i)) != 0 {
+			continue
+		}
+		switch filters[i].id {
+		case h5FilterDeflate:
+			r, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+			data, err = ioutil.ReadAll(r)
+			r.Close()
+			if err != nil {
+				return nil, err
+			}
+		case h5FilterShuffle:
+			data = unshuffle(data, elementSize)
+		case h5FilterFletcher32:
+			if len(data) < 4 {
+				return nil, fmt.Errorf("HDF5 chunk too short for its checksum")
+			}
+			data = data[:len(data)-4]
+		}
+	}
+	return data, nil
+}
+
+// unshuffle reverses the byte shuffle filter, which stores the first byte of all elements, then the second and so on
+func unshuffle(data []byte, size int) []byte {
+	if size <= 1 {
+		return data
+	}
+	n := len(data) / size
+	res := make([]byte, len(data))
+	for b := 0; b < size; b++ {
+		for i := 0; i < n; i++ {
+			res[i*size+b] = data[b*n+i]
+		}
+	}
+	// trailing bytes that don't make up a whole element are left as they are
+	copy(res[n*size:], data[n*size:])
+	return res
+}
+
+// readChunks reads all chunks of a chunked dataset and copies them into place
+func (f *h5File) readChunks(ds *h5Dataset, btree uint64, chunkDims []uint64, filters []h5Filter) error {
+	rank := len(ds.dims)
+	keySize := 8 + 8*(rank+1)
+	chunkElements := h5Numel(chunkDims)
+	elementSize := ds.typ.size
+	return f.walkBTreeV1(btree, keySize, func(child uint64, key []byte) error {
+		kc := &h5Cursor{b: key, f: f}
+		size := int(kc.u32())
+		mask := kc.u32()
+		offsets := make([]uint64, rank)
+		for i := range offsets {
+			offsets[i] = kc.uint(8)
+		}
+		raw, err := f.readAt(child, size)
+		if err != nil {
+			return err
+		}
+		chunk, err := unfilter(raw, filters, mask, elementSize)
+		if err != nil {
+			return err
+		}
+		if uint64(len(chunk)) < chunkElements*uint64(elementSize) {
+			return fmt.Errorf("HDF5 chunk holds %d bytes, expects %d", len(chunk), chunkElements*uint64(elementSize))
+		}
+		copyChunk(ds.data, ds.dims, chunk, chunkDims, offsets, elementSize)
+		return nil
+	})
+}
+
+// copyChunk copies the part of a row major chunk that lies within the dataset into the row major dataset
+func copyChunk(dst []byte, dims []uint64, chunk []byte, chunkDims, offsets []uint64, size int) {
+	if len(dims) == 0 {
+		copy(dst, chunk[:size])
+		return
+	}
+	s := uint64(size)
+	forChunkRows(dims, chunkDims, offsets, func(out, src, n uint64) {
+		copy(dst[out*s:(out+n)*s], chunk[src*s:(src+n)*s])
+	})
+}
+
+// forChunkRows calls fn for every row along the last dimension of the chunk at offsets that lies within the dataset.
+// It is given the index of the first element of the row in the dataset and in the chunk along with its length.
+func forChunkRows(dims, chunkDims, offsets []uint64, fn func(out, src, n uint64)) {
+	rank := len(dims)
+	idx := make([]uint64, rank-1)
+	for {
+		inside := true
+		var src, out uint64
+		for d := 0; d < rank-1; d++ {
+			if offsets[d]+idx[d] >= dims[d] {
+				inside = false
+			}
+			src = src*chunkDims[d] + idx[d]
+			out = out*dims[d] + offsets[d] + idx[d]
+		}
+		if inside && offsets[rank-1] < dims[rank-1] {
+			n := chunkDims[rank-1]
+			if offsets[rank-1]+n > dims[rank-1] {
+				n = dims[rank-1] - offsets[rank-1]
+			}
+			fn(out*dims[rank-1]+offsets[rank-1], src*chunkDims[rank-1], n)
+		}
+		d := rank - 2
+		for ; d >= 0; d-- {
+			idx[d]++
+			if idx[d] < chunkDims[d] {
+				break
+			}
+			idx[d] = 0
+		}
+		if d < 0 {
+			return
+		}
+	}
+}
+
+// element returns the bytes of the i-th element
+func (ds *h5Dataset) element(i int) []byte {
+	return ds.data[i*ds.typ.size : (i+1)*ds.typ.size]
+}
+
+// byteOrder returns the byte order of a numeric type
+func (t *h5Type) byteOrder() binary.ByteOrder {
+	if t.bigEndian {
+		return binary.BigEndian
+	}
+	return binary.LittleEndian
+}
@@ -0,0 +1,506 @@
+package matlab
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+	"sort"
+)
+
+// This file implements a writer for the same subset of HDF5 that hdf5.go reads. Files use a version 0 superblock with
+// 8 byte offsets and lengths, version 1 object headers and symbol table groups, which is what matlab writes too.
+
+const (
+	h5GroupLeafK     = 4  // a symbol table node holds up to 2K links
+	h5GroupInternalK = 16 // a group B-tree node holds up to 2K children
+	h5ChunkK         = 32 // a chunk B-tree node holds up to 2K children
+	h5SuperblockLen  = 96
+	h5ChunkBytes     = 1 << 20 // chunks are at most this large before compression
+	h5ContiguousMax  = 4096    // smaller datasets are not chunked
+	h5DeflateLevel   = 3
+	h5Undefined      = ^uint64(0)
+)
+
+// h5Writer writes HDF5 objects sequentially. The superblock is written when the file is closed, as it points to the
+// root group which is written last.
+type h5Writer struct {
+	w    io.WriteSeeker
+	base int64  // absolute position of the superblock
+	pos  uint64 // address of the next object
+	err  error
+}
+
+func newH5Writer(w io.WriteSeeker, base int64) *h5Writer {
+	hw := &h5Writer{w: w, base: base}
+	// reserve space for the superblock
+	hw.write(make([]byte, h5SuperblockLen))
+	return hw
+}
+
+// write writes b at the next 8 byte aligned address and returns that address
+func (w *h5Writer) write(b []byte) uint64 {
+	if w.err != nil {
+		return h5Undefined
+	}
+	addr := w.pos
+	if pad := (8 - len(b)%8) % 8; pad > 0 {
+		b = append(b, make([]byte, pad)...)
+	}
+	_, w.err = w.w.Write(b)
+	w.pos += uint64(len(b))
+	return addr
+}
+
+// close writes the superblock, with the root group at the given address
+func (w *h5Writer) close(root, rootBTree, rootHeap uint64) error {
+	if w.err != nil {
+		return w.err
+	}
+	e := &h5Encoder{}
+	e.Write(h5Signature)
+	e.Write([]byte{0, 0, 0, 0, 0, 8, 8, 0}) // versions, offset and length sizes
+	e.u16(h5GroupLeafK)
+	e.u16(h5GroupInternalK)
+	e.u32(0) // file consistency flags
+	e.u64(uint64(w.base))
+	e.u64(h5Undefined) // free space
+	e.u64(w.pos)       // end of file
+	e.u64(h5Undefined) // driver information
+	// root group symbol table entry, which caches the addresses of the root group B-tree and heap
+	e.u64(0)
+	e.u64(root)
+	e.u32(1)
+	e.u32(0)
+	e.u64(rootBTree)
+	e.u64(rootHeap)
+	if _, err := w.w.Seek(w.base, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(e.Bytes()); err != nil {
+		return err
+	}
+	_, err := w.w.Seek(w.base+int64(w.pos), io.SeekStart)
+	return err
+}
+
+// h5Encoder appends little endian values to a buffer
+type h5Encoder struct {
+	bytes.Buffer
+}
+
+func (e *h5Encoder) u8(v uint8) {
+	e.WriteByte(v)
+}
+
+func (e *h5Encoder) u16(v uint16) {
+	b := make([]byte, 2)
+	binary.LittleEndian.PutUint16(b, v)
+	e.Write(b)
+}
+
+func (e *h5Encoder) u32(v uint32) {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, v)
+	e.Write(b)
+}
+
+func (e *h5Encoder) u64(v uint64) {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, v)
+	e.Write(b)
+}
+
+// pad pads the buffer with zeros to a multiple of 8 bytes
+func (e *h5Encoder) pad() {
+	for e.Len()%8 != 0 {
+		e.WriteByte(0)
+	}
+}
+
+// padded returns b padded with zeros to a multiple of 8 bytes
+func padded(b []byte) []byte {
+	if rem := len(b) % 8; rem != 0 {
+		b = append(b, make([]byte, 8-rem)...)
+	}
+	return b
+}
+
+// writeObject writes a version 1 object header holding the messages
+func (w *h5Writer) writeObject(msgs []h5Message) uint64 {
+	body := &h5Encoder{}
+	for _, m := range msgs {
+		data := padded(append([]byte(nil), m.data...))
+		body.u16(m.typ)
+		body.u16(uint16(len(data)))
+		body.u32(0) // flags and reserved
+		body.Write(data)
+	}
+	e := &h5Encoder{}
+	e.u8(1)
+	e.u8(0)
+	e.u16(uint16(len(msgs)))
+	e.u32(1) // reference count
+	e.u32(uint32(body.Len()))
+	e.u32(0)
+	e.Write(body.Bytes())
+	return w.write(e.Bytes())
+}
+
+// h5Float64, h5Float32 and friends are the datatypes of matlab values
+var (
+	h5Float64   = &h5Type{class: h5Float, size: 8}
+	h5Float32   = &h5Type{class: h5Float, size: 4}
+	h5Uint8     = &h5Type{class: h5FixedPoint, size: 1}
+	h5Uint64    = &h5Type{class: h5FixedPoint, size: 8}
+	h5Int32     = &h5Type{class: h5FixedPoint, size: 4, signed: true}
+	h5ObjectRef = &h5Type{class: h5Reference, size: 8}
+	h5VarString = &h5Type{class: h5VarLength, size: 16, base: &h5Type{class: h5String, size: 1}}
+)
+
+// encodeType encodes a version 1 datatype message
+func encodeType(t *h5Type) []byte {
+	e := &h5Encoder{}
+	e.u8(1<<4 | t.class)
+	var bitField [3]byte
+	props := &h5Encoder{}
+	switch t.class {
+	case h5FixedPoint:
+		if t.signed {
+			bitField[0] = 0x08
+		}
+		props.u16(0) // bit offset
+		props.u16(uint16(8 * t.size))
+	case h5Float:
+		// IEEE floats with an implied leading mantissa bit and the sign in the highest bit
+		bitField[0] = 0x20
+		bitField[1] = byte(8*t.size - 1)
+		props.u16(0)
+		props.u16(uint16(8 * t.size))
+		if t.size == 4 {
+			props.Write([]byte{23, 8, 0, 23})
+			props.u32(127)
+		} else {
+			props.Write([]byte{52, 11, 0, 52})
+			props.u32(1023)
+		}
+	case h5Compound:
+		bitField[0], bitField[1] = byte(len(t.members)), byte(len(t.members)>>8)
+		for _, m := range t.members {
+			props.Write(padded(append([]byte(m.name), 0)))
+			props.u32(uint32(m.offset))
+			props.Write(make([]byte, 28)) // dimensionality, permutation and dimension sizes
+			props.Write(encodeType(m.typ))
+		}
+	case h5VarLength:
+		props.Write(encodeType(t.base))
+	}
+	e.Write(bitField[:])
+	e.u32(uint32(t.size))
+	e.Write(props.Bytes())
+	return e.Bytes()
+}
+
+// complexType returns the compound type matlab stores complex numbers as
+func complexType(t *h5Type) *h5Type {
+	return &h5Type{class: h5Compound, size: 2 * t.size, members: []h5Member{
+		{name: "real", offset: 0, typ: t},
+		{name: "imag", offset: t.size, typ: t},
+	}}
+}
+
+// encodeDataspace encodes a version 1 dataspace message. No dimensions make a scalar dataspace.
+func encodeDataspace(dims []uint64) []byte {
+	e := &h5Encoder{}
+	e.u8(1)
+	e.u8(uint8(len(dims)))
+	e.Write(make([]byte, 6)) // flags and reserved
+	for _, d := range dims {
+		e.u64(d)
+	}
+	return e.Bytes()
+}
+
+// attributeMessage encodes a version 1 attribute message
+func attributeMessage(name string, typ *h5Type, dims []uint64, data []byte) h5Message {
+	t, space := encodeType(typ), encodeDataspace(dims)
+	e := &h5Encoder{}
+	e.u8(1)
+	e.u8(0)
+	e.u16(uint16(len(name) + 1))
+	e.u16(uint16(len(t)))
+	e.u16(uint16(len(space)))
+	e.Write(padded(append([]byte(name), 0)))
+	e.Write(padded(t))
+	e.Write(padded(space))
+	e.Write(data)
+	return h5Message{typ: h5MsgAttribute, data: e.Bytes()}
+}
+
+// stringAttribute returns a scalar string attribute
+func stringAttribute(name, value string) h5Message {
+	return attributeMessage(name, &h5Type{class: h5String, size: len(value)}, nil, []byte(value))
+}
+
+// uintAttribute returns a scalar unsigned integer attribute of the given type
+func uintAttribute(name string, typ *h5Type, v uint64) h5Message {
+	data := make([]byte, 8)
+	binary.LittleEndian.PutUint64(data, v)
+	return attributeMessage(name, typ, nil, data[:typ.size])
+}
+
+// varStringsAttribute returns an attribute holding variable length strings, which are stored in a new global heap
+// collection
+func (w *h5Writer) varStringsAttribute(name string, values []string) h5Message {
+	heap := w.writeGlobalHeap(values)
+	e := &h5Encoder{}
+	for i, v := range values {
+		e.u32(uint32(len(v)))
+		e.u64(heap)
+		e.u32(uint32(i + 1))
+	}
+	return attributeMessage(name, h5VarString, []uint64{uint64(len(values))}, e.Bytes())
+}
+
+// writeGlobalHeap writes a global heap collection holding the strings as objects 1, 2...
+func (w *h5Writer) writeGlobalHeap(objects []string) uint64 {
+	e := &h5Encoder{}
+	e.WriteString("GCOL")
+	e.u8(1)
+	e.Write(make([]byte, 3))
+	e.u64(0) // collection size, set below
+	for i, o := range objects {
+		e.u16(uint16(i + 1))
+		e.u16(1) // reference count
+		e.u32(0)
+		e.u64(uint64(len(o)))
+		e.WriteString(o)
+		e.pad()
+	}
+	// the library expects collections of at least 4096 bytes, the rest is free space
+	size := e.Len() + 16
+	if size < 4096 {
+		size = 4096
+	}
+	// the free space object's size includes its own header
+	e.u16(0)
+	e.u16(0)
+	e.u32(0)
+	e.u64(uint64(size - e.Len() + 8))
+	b := append(e.Bytes(), make([]byte, size-e.Len())...)
+	binary.LittleEndian.PutUint64(b[8:], uint64(len(b)))
+	return w.write(b)
+}
+
+// writeBTreeV1 writes a version 1 B-tree over the children and returns the address of its root. There is a key
+// before every child and one after the last child. Nodes have room for width children.
+func (w *h5Writer) writeBTreeV1(nodeType uint8, keys [][]byte, children []uint64, width int) uint64 {
+	keySize := len(keys[0])
+	for level := 0; ; level++ {
+		var nextKeys [][]byte
+		var nextChildren []uint64
+		for i := 0; i < len(children) || i == 0; i += width {
+			j := i + width
+			if j > len(children) {
+				j = len(children)
+			}
+			e := &h5Encoder{}
+			e.WriteString("TREE")
+			e.u8(nodeType)
+			e.u8(uint8(level))
+			e.u16(uint16(j - i))
+			e.u64(h5Undefined) // siblings
+			e.u64(h5Undefined)
+			for k := i; k < j; k++ {
+				e.Write(keys[k])
+				e.u64(children[k])
+			}
+			e.Write(keys[j])
+			// nodes are always read at their full size
+			full := 24 + (width+1)*keySize + width*8
+			e.Write(make([]byte, full-e.Len()))
+			nextKeys = append(nextKeys, keys[i])
+			nextChildren = append(nextChildren, w.write(e.Bytes()))
+		}
+		if len(nextChildren) == 1 {
+			return nextChildren[0]
+		}
+		keys, children = append(nextKeys, keys[len(keys)-1]), nextChildren
+	}
+}
+
+// writeGroup writes a symbol table group holding the links and returns the address of its object header, along with
+// the addresses of its B-tree and local heap
+func (w *h5Writer) writeGroup(links []h5Link, attrs []h5Message) (addr, btree, heapAddr uint64) {
+	links = append([]h5Link(nil), links...)
+	sort.Slice(links, func(i, j int) bool { return links[i].name < links[j].name })
+
+	// the local heap holds the names, starting with the empty string
+	heap := &h5Encoder{}
+	heap.Write(make([]byte, 8))
+	nameOffsets := make([]uint64, len(links))
+	for i, l := range links {
+		nameOffsets[i] = uint64(heap.Len())
+		heap.WriteString(l.name)
+		heap.u8(0)
+		heap.pad()
+	}
+
+	// symbol table nodes, the key after each node is the last name in it
+	keys := [][]byte{make([]byte, 8)}
+	var nodes []uint64
+	for i := 0; i < len(links); i += 2 * h5GroupLeafK {
+		j := i + 2*h5GroupLeafK
+		if j > len(links) {
+			j = len(links)
+		}
+		e := &h5Encoder{}
+		e.WriteString("SNOD")
+		e.u8(1)
+		e.u8(0)
+		e.u16(uint16(j - i))
+		for k := i; k < j; k++ {
+			e.u64(nameOffsets[k])
+			e.u64(links[k].addr)
+			e.Write(make([]byte, 24)) // cache type, reserved and scratch pad
+		}
+		e.Write(make([]byte, 8+2*h5GroupLeafK*40-e.Len()))
+		nodes = append(nodes, w.write(e.Bytes()))
+		key := make([]byte, 8)
+		binary.LittleEndian.PutUint64(key, nameOffsets[j-1])
+		keys = append(keys, key)
+	}
+	btree = w.writeBTreeV1(0, keys, nodes, 2*h5GroupInternalK)
+
+	data := w.write(heap.Bytes())
+	e := &h5Encoder{}
+	e.WriteString("HEAP")
+	e.u8(0)
+	e.Write(make([]byte, 3))
+	e.u64(uint64(heap.Len()))
+	e.u64(1) // the library marks an empty free list with 1
+	e.u64(data)
+	heapAddr = w.write(e.Bytes())
+
+	st := &h5Encoder{}
+	st.u64(btree)
+	st.u64(heapAddr)
+	msgs := append([]h5Message{{typ: h5MsgSymbolTable, data: st.Bytes()}}, attrs...)
+	return w.writeObject(msgs), btree, heapAddr
+}
+
+// writeDataset writes a dataset with the given row major data. Large datasets are split into deflated chunks.
+func (w *h5Writer) writeDataset(typ *h5Type, dims []uint64, data []byte, attrs []h5Message) uint64 {
+	msgs := []h5Message{
+		{typ: h5MsgDataspace, data: encodeDataspace(dims)},
+		{typ: h5MsgDatatype, data: encodeType(typ)},
+		// late allocation, fill values written if set and no fill value defined
+		{typ: h5MsgFillValue, data: []byte{2, 2, 2, 0}},
+	}
+	layout := &h5Encoder{}
+	layout.u8(3)
+	if len(data) <= h5ContiguousMax || len(dims) == 0 {
+		layout.u8(1)
+		if len(data) == 0 {
+			layout.u64(h5Undefined)
+		} else {
+			layout.u64(w.write(data))
+		}
+		layout.u64(uint64(len(data)))
+	} else {
+		chunkDims := h5ChunkDims(dims, typ.size)
+		btree := w.writeChunks(dims, chunkDims, typ.size, data)
+		layout.u8(2)
+		layout.u8(uint8(len(dims) + 1))
+		layout.u64(btree)
+		for _, d := range chunkDims {
+			layout.u32(uint32(d))
+		}
+		layout.u32(uint32(typ.size))
+		filters := &h5Encoder{}
+		filters.u8(1)
+		filters.u8(1)
+		filters.Write(make([]byte, 6))
+		filters.u16(h5FilterDeflate)
+		filters.u16(0) // name length
+		filters.u16(0) // flags
+		filters.u16(1) // number of parameters
+		filters.u32(h5DeflateLevel)
+		filters.u32(0)
+		msgs = append(msgs, h5Message{typ: h5MsgFilters, data: filters.Bytes()})
+	}
+	msgs = append(msgs, h5Message{typ: h5MsgLayout, data: layout.Bytes()})
+	return w.writeObject(append(msgs, attrs...))
+}
+
+// h5ChunkDims chooses the chunk dimensions of a dataset. Starting with the slowest varying dimension, dimensions are
+// shrunk until a chunk fits into h5ChunkBytes.
+func h5ChunkDims(dims []uint64, size int) []uint64 {
+	chunk := append([]uint64(nil), dims...)
+	for d := range chunk {
+		rest := uint64(size)
+		for _, c := range chunk[d+1:] {
+			rest *= c
+		}
+		if rest*chunk[d] <= h5ChunkBytes {
+			break
+		}
+		chunk[d] = h5ChunkBytes / rest
+		if chunk[d] == 0 {
+			chunk[d] = 1
+		}
+	}
+	return chunk
+}
+
+// writeChunks deflates and writes the chunks of a dataset in row major order and returns the address of the B-tree
+// indexing them
+func (w *h5Writer) writeChunks(dims, chunkDims []uint64, size int, data []byte) uint64 {
+	rank := len(dims)
+	s := uint64(size)
+	chunk := make([]byte, h5Numel(chunkDims)*s)
+	offsets := make([]uint64, rank)
+	var keys [][]byte
+	var children []uint64
+	key := func(n int, offsets []uint64) []byte {
+		e := &h5Encoder{}
+		e.u32(uint32(n))
+		e.u32(0) // filter mask
+		for _, o := range offsets {
+			e.u64(o)
+		}
+		e.u64(0)
+		return e.Bytes()
+	}
+	for {
+		for i := range chunk {
+			chunk[i] = 0
+		}
+		forChunkRows(dims, chunkDims, offsets, func(out, src, n uint64) {
+			copy(chunk[src*s:(src+n)*s], data[out*s:(out+n)*s])
+		})
+		var buf bytes.Buffer
+		zw, _ := zlib.NewWriterLevel(&buf, h5DeflateLevel)
+		zw.Write(chunk)
+		zw.Close()
+		keys = append(keys, key(buf.Len(), offsets))
+		children = append(children, w.write(buf.Bytes()))
+
+		d := rank - 1
+		for ; d >= 0; d-- {
+			offsets[d] += chunkDims[d]
+			if offsets[d] < dims[d] {
+				break
+			}
+			offsets[d] = 0
+		}
+		if d < 0 {
+			break
+		}
+	}
+	// the last key lies past all chunks
+	end := make([]uint64, rank)
+	end[0] = (dims[0] + chunkDims[0] - 1) / chunkDims[0] * chunkDims[0]
+	keys = append(keys, key(0, end))
+	return w.writeBTreeV1(1, keys, children, 2*h5ChunkK)
+}
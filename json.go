@@ -0,0 +1,359 @@
+package matlab
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"unicode/utf16"
+)
+
+// jsonMatrix is the JSON representation of a matrix. Data holds the values in column major order: numbers for numeric
+// and sparse matrices, where NaN and infinities are the strings "NaN", "Inf" and "-Inf", a string for char matrices,
+// matrices for cells and objects of field names to matrices for structs. Matrices this package cannot interpret keep
+// their undecoded bytes in Raw.
+type jsonMatrix struct {
+	Name      string          `json:"name,omitempty"`
+	Class     string          `json:"class"`
+	Dims      []int32         `json:"dims,omitempty"`
+	Logical   bool            `json:"logical,omitempty"`
+	Complex   bool            `json:"complex,omitempty"`
+	Global    bool            `json:"global,omitempty"`
+	Fields    []string        `json:"fields,omitempty"`
+	Ir        []int           `json:"ir,omitempty"`
+	Jc        []int           `json:"jc,omitempty"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	Imag      json.RawMessage `json:"imag,omitempty"`
+	Raw       []byte          `json:"raw,omitempty"`
+	BigEndian bool            `json:"bigEndian,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler. The mapping is lossless, e.g.
+//
+//	{"name":"x","class":"double","dims":[1,3],"complex":true,"data":[1,"NaN",3],"imag":[0,2,"-Inf"]}
+//
+// Logical matrices are uint8 or sparse matrices with "logical" set. Sparse matrices have the row index of each
+// nonzero value in "ir" and the index of the first nonzero value of each column in "jc", like SparseIndices.
+func (m *Matrix) MarshalJSON() ([]byte, error) {
+	j := jsonMatrix{
+		Name:    m.Name,
+		Class:   jsonClassName(m.Class),
+		Dims:    m.Dimension,
+		Logical: m.flags.isLogical,
+		Complex: m.flags.isComplex,
+		Global:  m.flags.isGlobal,
+	}
+	if raw, ok := m.Raw(); ok {
+		j.Raw = raw.Data
+		j.BigEndian = raw.bo == binary.BigEndian
+		return json.Marshal(j)
+	}
+	var err error
+	switch m.Class {
+	case mxCELL, mxSTRUCT:
+		j.Fields = m.fields
+		values := m.value
+		if values == nil {
+			values = []interface{}{}
+		}
+		j.Data, err = json.Marshal(values)
+	case mxCHAR:
+		j.Data, err = jsonText(m.value)
+	case mxSPARSE, mxDOUBLE, mxSINGLE, mxINT8, mxUINT8, mxINT16, mxUINT16, mxINT32, mxUINT32, mxINT64, mxUINT64:
+		if m.Class == mxSPARSE {
+			j.Ir, j.Jc = m.ir, m.jc
+		}
+		if j.Data, err = jsonNumbers(m.value); err == nil && m.flags.isComplex {
+			j.Imag, err = jsonNumbers(m.imag)
+		}
+	default:
+		return nil, fmt.Errorf("cannot convert matrix %s of class %s to JSON", m.Name, m.Class)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON implements json.Unmarshaler for the mapping of MarshalJSON
+func (m *Matrix) UnmarshalJSON(data []byte) error {
+	var j jsonMatrix
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	class, ok := parseJSONClassName(j.Class)
+	if !ok && j.Raw == nil {
+		return fmt.Errorf("unknown matrix class %q", j.Class)
+	}
+	res := Matrix{
+		Name:      j.Name,
+		Dimension: j.Dims,
+		Class:     class,
+		flags:     Flags{isLogical: j.Logical, isComplex: j.Complex, isGlobal: j.Global},
+	}
+	if j.Raw != nil {
+		var bo binary.ByteOrder = binary.LittleEndian
+		if j.BigEndian {
+			bo = binary.BigEndian
+		}
+		if !ok {
+			// the class is stored in the raw bytes
+			_, c, err := arrayFlags(bo, bytes.NewReader(j.Raw))
+			if err != nil {
+				return err
+			}
+			res.Class = c
+		}
+		res.value = []interface{}{&RawElement{typ: DTmiMATRIX, Data: j.Raw, bo: bo}}
+		*m = res
+		return nil
+	}
+	if len(j.Dims) < 2 {
+		return fmt.Errorf("matrix %s needs at least 2 dimensions", j.Name)
+	}
+	for _, d := range j.Dims {
+		if d < 0 {
+			return fmt.Errorf("matrix %s has negative dimensions", j.Name)
+		}
+	}
+	if j.Logical && class != mxUINT8 && class != mxSPARSE {
+		return fmt.Errorf("logical matrix %s must be of class uint8 or sparse", j.Name)
+	}
+	if j.Complex && !class.isNumeric() && class != mxSPARSE {
+		return fmt.Errorf("complex matrix %s must be numeric", j.Name)
+	}
+
+	var err error
+	switch class {
+	case mxCELL:
+		var cells []*Matrix
+		if err := json.Unmarshal(j.Data, &cells); err != nil {
+			return err
+		}
+		for i, c := range cells {
+			if c == nil {
+				return fmt.Errorf("cell %d of %s is null", i, j.Name)
+			}
+			res.value = append(res.value, c)
+		}
+	case mxSTRUCT:
+		var elements []map[string]*Matrix
+		if err := json.Unmarshal(j.Data, &elements); err != nil {
+			return err
+		}
+		res.fields = j.Fields
+		for _, keys := range elements {
+			for k := range keys {
+				if !containsString(j.Fields, k) {
+					return fmt.Errorf("struct %s has a value for unknown field %s", j.Name, k)
+				}
+			}
+			res.value = append(res.value, keys)
+		}
+	case mxCHAR:
+		res.value, err = parseJSONText(j.Data)
+	case mxSPARSE:
+		valueClass := mxDOUBLE
+		if j.Logical {
+			valueClass = mxUINT8
+		}
+		res.ir, res.jc = j.Ir, j.Jc
+		if res.value, err = parseJSONNumbers(valueClass, j.Data); err != nil {
+			return err
+		}
+		if j.Complex {
+			if res.imag, err = parseJSONNumbers(valueClass, j.Imag); err != nil {
+				return err
+			}
+		}
+		if err := checkSparse(&res); err != nil {
+			return err
+		}
+		*m = res
+		return nil
+	case mxDOUBLE, mxSINGLE, mxINT8, mxUINT8, mxINT16, mxUINT16, mxINT32, mxUINT32, mxINT64, mxUINT64:
+		if res.value, err = parseJSONNumbers(class, j.Data); err == nil && j.Complex {
+			res.imag, err = parseJSONNumbers(class, j.Imag)
+		}
+	default:
+		return fmt.Errorf("matrix %s of class %s has no raw data", j.Name, j.Class)
+	}
+	if err != nil {
+		return fmt.Errorf("matrix %s: %v", j.Name, err)
+	}
+	if len(res.value) != res.numel() || j.Complex && len(res.imag) != res.numel() {
+		return fmt.Errorf("matrix %s has %d values but its dimensions need %d", j.Name, len(res.value), res.numel())
+	}
+	*m = res
+	return nil
+}
+
+// checkSparse checks that the indices of a sparse matrix match its dimensions and values
+func checkSparse(m *Matrix) error {
+	if len(m.Dimension) != 2 || len(m.jc) != int(m.Dimension[1])+1 || m.jc[0] != 0 {
+		return fmt.Errorf("invalid sparse matrix %s, expects %d column indices", m.Name, len(m.jc))
+	}
+	nnz := m.jc[len(m.jc)-1]
+	if len(m.ir) != nnz || len(m.value) != nnz || m.flags.isComplex && len(m.imag) != nnz {
+		return fmt.Errorf("invalid sparse matrix %s, expects %d row indices and values", m.Name, nnz)
+	}
+	for i := 1; i < len(m.jc); i++ {
+		if m.jc[i] < m.jc[i-1] {
+			return fmt.Errorf("invalid sparse matrix %s, column indices must not decrease", m.Name)
+		}
+	}
+	for _, r := range m.ir {
+		if r < 0 || r >= int(m.Dimension[0]) {
+			return fmt.Errorf("invalid sparse matrix %s, row index %d out of range", m.Name, r)
+		}
+	}
+	return nil
+}
+
+// jsonClassName returns the class name used in JSON, which is the name in matlab except for opaque objects
+func jsonClassName(c mxClass) string {
+	if c == mxOPAQUE {
+		return "opaque"
+	}
+	return c.matlabName()
+}
+
+func parseJSONClassName(s string) (mxClass, bool) {
+	for c := mxCELL; c <= mxOPAQUE; c++ {
+		if jsonClassName(c) == s {
+			return c, true
+		}
+	}
+	return mxUNKNOWN, false
+}
+
+// jsonNumbers encodes numbers as a JSON array, with NaN and infinities as strings
+func jsonNumbers(values []interface{}) ([]byte, error) {
+	res := make([]interface{}, len(values))
+	for i, v := range values {
+		res[i] = v
+		switch x := v.(type) {
+		case float64:
+			if s, ok := nonFinite(x); ok {
+				res[i] = s
+			}
+		case float32:
+			if s, ok := nonFinite(float64(x)); ok {
+				res[i] = s
+			}
+		}
+	}
+	return json.Marshal(res)
+}
+
+func nonFinite(v float64) (string, bool) {
+	switch {
+	case math.IsNaN(v):
+		return "NaN", true
+	case math.IsInf(v, 1):
+		return "Inf", true
+	case math.IsInf(v, -1):
+		return "-Inf", true
+	}
+	return "", false
+}
+
+// parseJSONNumbers decodes a JSON array of numbers into values of class c. Integers have to fit into the class.
+func parseJSONNumbers(c mxClass, data []byte) ([]interface{}, error) {
+	var items []interface{}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(&items); err != nil {
+		return nil, err
+	}
+	res := make([]interface{}, len(items))
+	for i, item := range items {
+		v, err := parseJSONNumber(c, item)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = v
+	}
+	return res, nil
+}
+
+func parseJSONNumber(c mxClass, item interface{}) (interface{}, error) {
+	bits := c.dataType().NumBytes() * 8
+	switch x := item.(type) {
+	case string:
+		if c != mxDOUBLE && c != mxSINGLE {
+			break
+		}
+		switch x {
+		case "NaN":
+			return castValue(c, math.NaN()), nil
+		case "Inf":
+			return castValue(c, math.Inf(1)), nil
+		case "-Inf":
+			return castValue(c, math.Inf(-1)), nil
+		}
+	case json.Number:
+		switch c {
+		case mxDOUBLE, mxSINGLE:
+			if v, err := strconv.ParseFloat(string(x), bits); err == nil {
+				return castValue(c, v), nil
+			}
+		case mxINT8, mxINT16, mxINT32, mxINT64:
+			if v, err := strconv.ParseInt(string(x), 10, bits); err == nil {
+				return castValue(c, v), nil
+			}
+		default:
+			if v, err := strconv.ParseUint(string(x), 10, bits); err == nil {
+				return castValue(c, v), nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("invalid %s value %v", c.matlabName(), item)
+}
+
+// jsonText encodes the utf16 code units of a char matrix as a string, or as an array of numbers if they are not
+// valid utf16
+func jsonText(values []interface{}) ([]byte, error) {
+	units := make([]uint16, len(values))
+	for i, v := range values {
+		units[i] = toUint16(v)
+	}
+	runes := utf16.Decode(units)
+	if encoded := utf16.Encode(runes); len(encoded) == len(units) {
+		valid := true
+		for i := range units {
+			if encoded[i] != units[i] {
+				valid = false
+				break
+			}
+		}
+		if valid {
+			return json.Marshal(string(runes))
+		}
+	}
+	return jsonNumbers(values)
+}
+
+func parseJSONText(data []byte) ([]interface{}, error) {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return parseJSONNumbers(mxCHAR, data)
+	}
+	units := utf16.Encode([]rune(s))
+	res := make([]interface{}, len(units))
+	for i, u := range units {
+		res[i] = u
+	}
+	return res, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package matlab
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	for _, name := range []string{"varTypes", "mixedCells", "simpleStruct", "matrices", "simpleTypes"} {
+		file, err := os.Open("testdata/" + name + ".mat")
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		defer file.Close()
+		f, err := NewFileFromReader(file)
+		assert.NoError(t, err)
+		for _, v := range f.GetVarsNames() {
+			m, _ := f.GetVar(v)
+			data, err := json.Marshal(m)
+			assert.NoError(t, err, name+": "+v)
+			var m2 Matrix
+			assert.NoError(t, json.Unmarshal(data, &m2), name+": "+v)
+			assert.Equal(t, m, &m2, name+": "+v)
+		}
+	}
+}
+
+func TestJSONMapping(t *testing.T) {
+	m := &Matrix{Name: "x", Class: mxDOUBLE, Dimension: []int32{1, 3}, flags: Flags{isComplex: true},
+		value: doubles(1, math.NaN(), 3), imag: doubles(0, 2, math.Inf(-1))}
+	data, err := json.Marshal(m)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"name":"x","class":"double","dims":[1,3],"complex":true,"data":[1,"NaN",3],"imag":[0,2,"-Inf"]}`, string(data))
+
+	s := &Matrix{Class: mxCHAR, Dimension: []int32{1, 2}, value: []interface{}{uint16(0xd83d), uint16('a')}}
+	data, err = json.Marshal(s)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"class":"char","dims":[1,2],"data":[55357,97]}`, string(data))
+
+	var text Matrix
+	assert.NoError(t, json.Unmarshal([]byte(`{"class":"char","dims":[2,1],"data":"hé"}`), &text))
+	assert.Equal(t, "hé", string(text.String()))
+
+	var big Matrix
+	assert.NoError(t, json.Unmarshal([]byte(`{"class":"uint64","dims":[1,1],"data":[18446744073709551615]}`), &big))
+	assert.Equal(t, []interface{}{uint64(math.MaxUint64)}, big.value)
+
+	var sparse Matrix
+	assert.NoError(t, json.Unmarshal([]byte(`{"class":"sparse","logical":true,"dims":[2,2],"ir":[1],"jc":[0,0,1],"data":[1]}`), &sparse))
+	rows, cols := sparse.SparseIndices()
+	assert.Equal(t, []int{1}, rows)
+	assert.Equal(t, []int{0, 0, 1}, cols)
+	assert.Equal(t, []interface{}{uint8(1)}, sparse.value)
+
+	// matrices this package cannot interpret keep their bytes
+	fn, err := encodeMatrix(binary.LittleEndian, &Matrix{Name: "fn", Class: mxUINT8, Dimension: []int32{1, 1}, value: []interface{}{uint8(1)}})
+	assert.NoError(t, err)
+	fn[8] = byte(mxFUNCTION)
+	raw := &Matrix{Name: "fn", Class: mxFUNCTION, Dimension: []int32{1, 1}, value: []interface{}{&RawElement{typ: DTmiMATRIX, Data: fn, bo: binary.LittleEndian}}}
+	data, err = json.Marshal(raw)
+	assert.NoError(t, err)
+	var raw2 Matrix
+	assert.NoError(t, json.Unmarshal(data, &raw2))
+	assert.Equal(t, raw, &raw2)
+}
+
+func TestJSONErrors(t *testing.T) {
+	for _, data := range []string{
+		`{"class":"double","dims":[2,1],"data":[1]}`,
+		`{"class":"double","dims":[1],"data":[1]}`,
+		`{"class":"int8","dims":[1,1],"data":[128]}`,
+		`{"class":"int8","dims":[1,1],"data":["NaN"]}`,
+		`{"class":"uint8","dims":[1,1],"data":[-1]}`,
+		`{"class":"double","dims":[1,1],"complex":true,"data":[1]}`,
+		`{"class":"char","dims":[1,1],"logical":true,"data":"a"}`,
+		`{"class":"struct","dims":[1,1],"fields":["a"],"data":[{"b":null}]}`,
+		`{"class":"cell","dims":[1,1],"data":[null]}`,
+		`{"class":"sparse","dims":[2,2],"ir":[2],"jc":[0,0,1],"data":[1]}`,
+		`{"class":"sparse","dims":[2,2],"ir":[0],"jc":[0,1],"data":[1]}`,
+		`{"class":"function_handle","dims":[1,1]}`,
+		`{"class":"matrix","dims":[1,1],"data":[1]}`,
+	} {
+		var m Matrix
+		assert.Error(t, json.Unmarshal([]byte(data), &m), data)
+	}
+}
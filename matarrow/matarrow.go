@@ -0,0 +1,312 @@
+// Package matarrow converts struct arrays into Apache Arrow record batches, which can be written as Arrow IPC or
+// Parquet files. It is a package of its own so that the matlab package doesn't depend on arrow.
+//
+// Two layouts are columnar: a scalar struct whose fields are vectors of the same length, and a struct array with a
+// single row or column whose fields hold scalars or strings. Either way each field becomes a column. Numeric classes
+// map to the arrow types of the same width, logical to boolean, char to utf8 strings and complex numbers to a struct
+// of real and imag float64 values. Empty values in struct arrays and cells become nulls.
+package matarrow
+
+import (
+	"fmt"
+	"io"
+	"unicode/utf16"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+	"github.com/daniellowtw/matlab"
+)
+
+var arrowTypes = map[string]arrow.DataType{
+	"double":  arrow.PrimitiveTypes.Float64,
+	"single":  arrow.PrimitiveTypes.Float32,
+	"int8":    arrow.PrimitiveTypes.Int8,
+	"uint8":   arrow.PrimitiveTypes.Uint8,
+	"int16":   arrow.PrimitiveTypes.Int16,
+	"uint16":  arrow.PrimitiveTypes.Uint16,
+	"int32":   arrow.PrimitiveTypes.Int32,
+	"uint32":  arrow.PrimitiveTypes.Uint32,
+	"int64":   arrow.PrimitiveTypes.Int64,
+	"uint64":  arrow.PrimitiveTypes.Uint64,
+	"logical": arrow.FixedWidthTypes.Boolean,
+	"char":    arrow.BinaryTypes.String,
+}
+
+var complexType = arrow.StructOf(
+	arrow.Field{Name: "real", Type: arrow.PrimitiveTypes.Float64},
+	arrow.Field{Name: "imag", Type: arrow.PrimitiveTypes.Float64},
+)
+
+// column holds the values of a field: go values of the matlab class, strings for char, complex128 for complex numbers
+// and nil for missing values
+type column struct {
+	name    string
+	class   string
+	complex bool
+	values  []interface{}
+}
+
+func (c *column) dataType() arrow.DataType {
+	if c.complex {
+		return complexType
+	}
+	return arrowTypes[c.class]
+}
+
+// NewRecord converts a struct into a record batch with a column per field. The caller has to release the record.
+func NewRecord(mem memory.Allocator, m *matlab.Matrix) (arrow.Record, error) {
+	columns, err := structColumns(m)
+	if err != nil {
+		return nil, err
+	}
+	fields := make([]arrow.Field, len(columns))
+	for i, c := range columns {
+		nullable := false
+		for _, v := range c.values {
+			nullable = nullable || v == nil
+		}
+		fields[i] = arrow.Field{Name: c.name, Type: c.dataType(), Nullable: nullable}
+	}
+	b := array.NewRecordBuilder(mem, arrow.NewSchema(fields, nil))
+	defer b.Release()
+	for i, c := range columns {
+		appendValues(b.Field(i), c.values)
+	}
+	return b.NewRecord(), nil
+}
+
+// WriteFile writes a struct as an arrow IPC file holding a single record batch
+func WriteFile(w io.Writer, m *matlab.Matrix) error {
+	mem := memory.NewGoAllocator()
+	rec, err := NewRecord(mem, m)
+	if err != nil {
+		return err
+	}
+	defer rec.Release()
+	fw, err := ipc.NewFileWriter(w, ipc.WithSchema(rec.Schema()), ipc.WithAllocator(mem))
+	if err != nil {
+		return err
+	}
+	if err := fw.Write(rec); err != nil {
+		fw.Close()
+		return err
+	}
+	return fw.Close()
+}
+
+// WriteParquet writes a struct as a parquet file holding a single row group. The arrow schema is stored along with
+// the file, so that arrow readers get back the same types. Unlike parquet's own writer, it doesn't close w.
+func WriteParquet(w io.Writer, m *matlab.Matrix) error {
+	mem := memory.NewGoAllocator()
+	rec, err := NewRecord(mem, m)
+	if err != nil {
+		return err
+	}
+	defer rec.Release()
+	fw, err := pqarrow.NewFileWriter(rec.Schema(), struct{ io.Writer }{w},
+		parquet.NewWriterProperties(parquet.WithAllocator(mem)),
+		pqarrow.NewArrowWriterProperties(pqarrow.WithAllocator(mem), pqarrow.WithStoreSchema()))
+	if err != nil {
+		return err
+	}
+	if err := fw.Write(rec); err != nil {
+		fw.Close()
+		return err
+	}
+	return fw.Close()
+}
+
+func appendValues(b array.Builder, values []interface{}) {
+	for _, v := range values {
+		if v == nil {
+			b.AppendNull()
+			if sb, ok := b.(*array.StructBuilder); ok {
+				for i := 0; i < sb.NumField(); i++ {
+					if f := sb.FieldBuilder(i); f.Len() < sb.Len() {
+						f.AppendNull()
+					}
+				}
+			}
+			continue
+		}
+		switch b := b.(type) {
+		case *array.Float64Builder:
+			b.Append(v.(float64))
+		case *array.Float32Builder:
+			b.Append(v.(float32))
+		case *array.Int8Builder:
+			b.Append(v.(int8))
+		case *array.Uint8Builder:
+			b.Append(v.(uint8))
+		case *array.Int16Builder:
+			b.Append(v.(int16))
+		case *array.Uint16Builder:
+			b.Append(v.(uint16))
+		case *array.Int32Builder:
+			b.Append(v.(int32))
+		case *array.Uint32Builder:
+			b.Append(v.(uint32))
+		case *array.Int64Builder:
+			b.Append(v.(int64))
+		case *array.Uint64Builder:
+			b.Append(v.(uint64))
+		case *array.BooleanBuilder:
+			b.Append(v.(uint8) != 0)
+		case *array.StringBuilder:
+			b.Append(v.(string))
+		case *array.StructBuilder:
+			c := v.(complex128)
+			b.Append(true)
+			b.FieldBuilder(0).(*array.Float64Builder).Append(real(c))
+			b.FieldBuilder(1).(*array.Float64Builder).Append(imag(c))
+		}
+	}
+}
+
+// structColumns returns the columns of a scalar struct of vectors or of a struct array of scalars
+func structColumns(m *matlab.Matrix) ([]*column, error) {
+	if m.ClassName() != "struct" {
+		return nil, fmt.Errorf("can only convert structs to arrow, %s is a %s", m.Name, m.ClassName())
+	}
+	n := numel(m.Dimension)
+	if n != 1 && !isVector(m.Dimension) {
+		return nil, fmt.Errorf("can only convert struct arrays with a single row or column to arrow, %s is %s", m.Name, size(m.Dimension))
+	}
+	var columns []*column
+	for _, f := range m.FieldNames() {
+		var c *column
+		var err error
+		if n == 1 {
+			keys, _ := m.GetAtLocation(0).(map[string]*matlab.Matrix)
+			c, err = vectorColumn(f, keys[f])
+		} else {
+			elements := make([]*matlab.Matrix, n)
+			for i := range elements {
+				keys, _ := m.GetAtLocation(i).(map[string]*matlab.Matrix)
+				elements[i] = keys[f]
+			}
+			c, err = elementsColumn(f, elements)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("field %s of %s: %v", f, m.Name, err)
+		}
+		if len(columns) > 0 && len(c.values) != len(columns[0].values) {
+			return nil, fmt.Errorf("field %s of %s has %d values but field %s has %d", f, m.Name, len(c.values),
+				columns[0].name, len(columns[0].values))
+		}
+		columns = append(columns, c)
+	}
+	return columns, nil
+}
+
+// vectorColumn returns the values of a vector, the rows of a char matrix or the strings and scalars of a cell vector
+func vectorColumn(name string, m *matlab.Matrix) (*column, error) {
+	if m == nil {
+		return nil, fmt.Errorf("missing value")
+	}
+	class := m.ClassName()
+	switch {
+	case class == "cell":
+		if !isVector(m.Dimension) {
+			return nil, fmt.Errorf("expects a vector, got a %s cell", size(m.Dimension))
+		}
+		elements := make([]*matlab.Matrix, len(m.Value()))
+		for i, v := range m.Value() {
+			elements[i], _ = v.(*matlab.Matrix)
+		}
+		return elementsColumn(name, elements)
+	case class == "char" && len(m.Dimension) == 2:
+		rows, cols := int(m.Dimension[0]), int(m.Dimension[1])
+		c := &column{name: name, class: class, values: make([]interface{}, rows)}
+		for i := range c.values {
+			units := make([]uint16, cols)
+			for j := range units {
+				units[j], _ = m.Value()[i+rows*j].(uint16)
+			}
+			c.values[i] = string(utf16.Decode(units))
+		}
+		return c, nil
+	case arrowTypes[class] != nil && class != "char" && !m.IsSparse():
+		if !isVector(m.Dimension) {
+			return nil, fmt.Errorf("expects a vector, got a %s %s matrix", size(m.Dimension), class)
+		}
+		if _, ok := m.Raw(); ok {
+			break
+		}
+		c := &column{name: name, class: class, complex: m.IsComplex(), values: m.Value()}
+		if c.complex {
+			if class != "double" && class != "single" {
+				return nil, fmt.Errorf("cannot convert complex %s values", class)
+			}
+			c.values = make([]interface{}, len(m.Value()))
+			for i, v := range m.ComplexArray() {
+				c.values[i] = v
+			}
+		}
+		return c, nil
+	}
+	return nil, fmt.Errorf("cannot convert a %s %s to a column", size(m.Dimension), class)
+}
+
+// elementsColumn returns the values of a column of scalars and strings. Empty matrices are missing values.
+func elementsColumn(name string, elements []*matlab.Matrix) (*column, error) {
+	c := &column{name: name, values: make([]interface{}, len(elements))}
+	for i, e := range elements {
+		if e == nil || numel(e.Dimension) == 0 {
+			continue
+		}
+		var v *column
+		var err error
+		if e.ClassName() != "cell" {
+			v, err = vectorColumn(name, e)
+		}
+		if v == nil || err != nil || len(v.values) != 1 {
+			return nil, fmt.Errorf("expects element %d to be a string or a scalar, got a %s %s", i+1, size(e.Dimension), e.ClassName())
+		}
+		if c.class == "" {
+			c.class, c.complex = v.class, v.complex
+		} else if c.class != v.class || c.complex != v.complex {
+			return nil, fmt.Errorf("element %d is a %s value, expects %s values like the elements before", i+1, v.class, c.class)
+		}
+		c.values[i] = v.values[0]
+	}
+	if c.class == "" {
+		// all values are missing
+		c.class = "double"
+	}
+	return c, nil
+}
+
+func numel(dims []int32) int {
+	n := 1
+	for _, d := range dims {
+		n *= int(d)
+	}
+	return n
+}
+
+// isVector tells whether all dimensions but one are 1
+func isVector(dims []int32) bool {
+	other := 0
+	for _, d := range dims {
+		if d != 1 {
+			other++
+		}
+	}
+	return other <= 1
+}
+
+func size(dims []int32) string {
+	s := ""
+	for i, d := range dims {
+		if i > 0 {
+			s += "x"
+		}
+		s += fmt.Sprint(d)
+	}
+	return s
+}
@@ -0,0 +1,143 @@
+package matarrow
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+	"github.com/daniellowtw/matlab"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRecordFromVectors(t *testing.T) {
+	file, err := os.Open("../testdata/simpleStruct.mat")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer file.Close()
+	f, err := matlab.NewFileFromReader(file)
+	assert.NoError(t, err)
+	m, _ := f.GetVar("X")
+
+	rec, err := NewRecord(memory.NewGoAllocator(), m)
+	assert.NoError(t, err)
+	defer rec.Release()
+	assert.Equal(t, int64(1), rec.NumRows())
+	assert.Equal(t, "w", rec.ColumnName(0))
+	assert.Equal(t, []float64{1}, rec.Column(0).(*array.Float64).Float64Values())
+	assert.Equal(t, "abc", rec.Column(2).(*array.String).Value(0))
+}
+
+// structArray returns a 3x1 struct array of int32 ids, logical flags, labels with a missing one and complex values
+// with a missing one
+func structArray(t *testing.T) *matlab.Matrix {
+	var m matlab.Matrix
+	assert.NoError(t, json.Unmarshal([]byte(`{"name":"s","class":"struct","dims":[3,1],"fields":["id","ok","label","z"],"data":[
+		{"id":{"class":"int32","dims":[1,1],"data":[7]},"ok":{"class":"uint8","logical":true,"dims":[1,1],"data":[1]},
+		 "label":{"class":"char","dims":[1,2],"data":"ab"},"z":{"class":"double","complex":true,"dims":[1,1],"data":[1],"imag":[-1]}},
+		{"id":{"class":"int32","dims":[1,1],"data":[8]},"ok":{"class":"uint8","logical":true,"dims":[1,1],"data":[0]},
+		 "label":{"class":"double","dims":[0,0],"data":[]},"z":{"class":"double","complex":true,"dims":[1,1],"data":[2],"imag":[0]}},
+		{"id":{"class":"int32","dims":[1,1],"data":[9]},"ok":{"class":"uint8","logical":true,"dims":[1,1],"data":[1]},
+		 "label":{"class":"char","dims":[1,1],"data":"c"},"z":null}
+	]}`), &m))
+	return &m
+}
+
+func TestWriteFileFromStructArray(t *testing.T) {
+	m := structArray(t)
+
+	out, err := ioutil.TempFile("", "matarrow")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+	assert.NoError(t, WriteFile(out, m))
+
+	data, err := ioutil.ReadFile(out.Name())
+	assert.NoError(t, err)
+	r, err := ipc.NewFileReader(bytes.NewReader(data))
+	assert.NoError(t, err)
+	defer r.Close()
+	assert.Equal(t, 1, r.NumRecords())
+	rec, err := r.Record(0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), rec.NumRows())
+	assert.Equal(t, []int32{7, 8, 9}, rec.Column(0).(*array.Int32).Int32Values())
+	assert.True(t, rec.Column(1).(*array.Boolean).Value(0))
+	assert.False(t, rec.Column(1).(*array.Boolean).Value(1))
+	labels := rec.Column(2).(*array.String)
+	assert.Equal(t, "ab", labels.Value(0))
+	assert.True(t, labels.IsNull(1))
+	assert.Equal(t, "c", labels.Value(2))
+	z := rec.Column(3).(*array.Struct)
+	assert.Equal(t, []float64{1, 2, 0}, z.Field(0).(*array.Float64).Float64Values())
+	assert.Equal(t, -1.0, z.Field(1).(*array.Float64).Value(0))
+	assert.True(t, z.IsNull(2))
+	assert.True(t, r.Schema().Field(2).Nullable)
+	assert.False(t, r.Schema().Field(0).Nullable)
+}
+
+// closeRecorder tells whether it was closed
+type closeRecorder struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestWriteParquet(t *testing.T) {
+	var out closeRecorder
+	assert.NoError(t, WriteParquet(&out, structArray(t)))
+	assert.False(t, out.closed)
+
+	table, err := pqarrow.ReadTable(context.Background(), bytes.NewReader(out.Bytes()), nil,
+		pqarrow.ArrowReadProperties{}, memory.NewGoAllocator())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer table.Release()
+	assert.Equal(t, int64(3), table.NumRows())
+	assert.Equal(t, "id", table.Schema().Field(0).Name)
+	assert.Equal(t, []int32{7, 8, 9}, table.Column(0).Data().Chunk(0).(*array.Int32).Int32Values())
+	ok := table.Column(1).Data().Chunk(0).(*array.Boolean)
+	assert.True(t, ok.Value(0))
+	assert.False(t, ok.Value(1))
+	labels := table.Column(2).Data().Chunk(0).(*array.String)
+	assert.Equal(t, "ab", labels.Value(0))
+	assert.True(t, labels.IsNull(1))
+	assert.Equal(t, "c", labels.Value(2))
+	z := table.Column(3).Data().Chunk(0).(*array.Struct)
+	assert.Equal(t, 2.0, z.Field(0).(*array.Float64).Value(1))
+	assert.Equal(t, -1.0, z.Field(1).(*array.Float64).Value(0))
+	assert.True(t, z.IsNull(2))
+
+	var m matlab.Matrix
+	assert.NoError(t, json.Unmarshal([]byte(`{"class":"double","dims":[1,1],"data":[1]}`), &m))
+	assert.Error(t, WriteParquet(&out, &m))
+}
+
+func TestNewRecordErrors(t *testing.T) {
+	for _, data := range []string{
+		`{"class":"double","dims":[1,1],"data":[1]}`,
+		`{"class":"struct","dims":[2,2],"fields":[],"data":[{},{},{},{}]}`,
+		`{"class":"struct","dims":[1,1],"fields":["a","b"],"data":[{"a":{"class":"double","dims":[2,1],"data":[1,2]},"b":{"class":"double","dims":[3,1],"data":[1,2,3]}}]}`,
+		`{"class":"struct","dims":[1,1],"fields":["a"],"data":[{"a":{"class":"double","dims":[2,2],"data":[1,2,3,4]}}]}`,
+		`{"class":"struct","dims":[1,2],"fields":["a"],"data":[{"a":{"class":"double","dims":[1,1],"data":[1]}},{"a":{"class":"char","dims":[1,1],"data":"x"}}]}`,
+	} {
+		var m matlab.Matrix
+		assert.NoError(t, json.Unmarshal([]byte(data), &m))
+		_, err := NewRecord(memory.NewGoAllocator(), &m)
+		assert.Error(t, err, data)
+	}
+}
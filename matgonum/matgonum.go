@@ -0,0 +1,221 @@
+// Package matgonum converts matrices to and from the matrices of gonum's mat package. It is a package of its own so
+// that the matlab package doesn't depend on gonum.
+package matgonum
+
+import (
+	"fmt"
+
+	"github.com/daniellowtw/matlab"
+	"gonum.org/v1/gonum/mat"
+)
+
+// CSC is a sparse matrix in compressed sparse column format, the layout of sparse matrices in matlab. It implements
+// mat.Matrix, so it can be used with the functions of gonum's mat package.
+type CSC struct {
+	rows, cols int
+	RowIndex   []int     // row of each nonzero value
+	ColIndex   []int     // index of the first nonzero value of each column, followed by the number of nonzero values
+	Values     []float64 // nonzero values in column major order
+}
+
+var _ mat.Matrix = &CSC{}
+
+// NewCSC returns a rows x cols sparse matrix holding values at the rows in rowIndex, where colIndex gives the index of
+// the first value of each column followed by the number of values. The column indices start at 0 and never decrease.
+func NewCSC(rows, cols int, rowIndex, colIndex []int, values []float64) (*CSC, error) {
+	if rows < 0 || cols < 0 || len(colIndex) != cols+1 || colIndex[0] != 0 {
+		return nil, fmt.Errorf("invalid sparse matrix, expects %d column indices starting at 0", cols+1)
+	}
+	if len(rowIndex) != len(values) || colIndex[cols] != len(values) {
+		return nil, fmt.Errorf("invalid sparse matrix, expects %d row indices and values", colIndex[cols])
+	}
+	for j := 1; j <= cols; j++ {
+		if colIndex[j] < colIndex[j-1] {
+			return nil, fmt.Errorf("invalid sparse matrix, column indices must not decrease")
+		}
+	}
+	for _, r := range rowIndex {
+		if r < 0 || r >= rows {
+			return nil, fmt.Errorf("invalid sparse matrix, row index %d out of range", r)
+		}
+	}
+	return &CSC{rows: rows, cols: cols, RowIndex: rowIndex, ColIndex: colIndex, Values: values}, nil
+}
+
+// Dims returns the number of rows and columns
+func (s *CSC) Dims() (int, int) {
+	return s.rows, s.cols
+}
+
+// At returns the value at row i and column j
+func (s *CSC) At(i, j int) float64 {
+	if i < 0 || i >= s.rows {
+		panic(mat.ErrRowAccess)
+	}
+	if j < 0 || j >= s.cols {
+		panic(mat.ErrColAccess)
+	}
+	for k := s.ColIndex[j]; k < s.ColIndex[j+1]; k++ {
+		if s.RowIndex[k] == i {
+			return s.Values[k]
+		}
+	}
+	return 0
+}
+
+// T returns the transpose of the matrix
+func (s *CSC) T() mat.Matrix {
+	return mat.Transpose{Matrix: s}
+}
+
+// AsDense copies a 2-D numeric, logical or real sparse matrix into a gonum dense matrix, converting the values to
+// float64 and the column major layout of matlab to the row major layout of gonum
+func AsDense(m *matlab.Matrix) (*mat.Dense, error) {
+	rows, cols, err := dims(m)
+	if err != nil {
+		return nil, err
+	}
+	if m.IsComplex() {
+		return nil, fmt.Errorf("matrix %s is complex, use AsCDense", m.Name)
+	}
+	if m.IsSparse() {
+		csc, err := AsCSC(m)
+		if err != nil {
+			return nil, err
+		}
+		return mat.DenseCopyOf(csc), nil
+	}
+	values := m.Value()
+	if !isNumeric(m) || len(values) != rows*cols {
+		return nil, fmt.Errorf("cannot convert matrix %s of class %s to a dense matrix", m.Name, m.ClassName())
+	}
+	data := make([]float64, rows*cols)
+	for j := 0; j < cols; j++ {
+		for i := 0; i < rows; i++ {
+			data[i*cols+j] = toFloat64(values[i+rows*j])
+		}
+	}
+	return mat.NewDense(rows, cols, data), nil
+}
+
+// AsCDense copies a 2-D numeric matrix into a gonum complex dense matrix. The imaginary parts are zero if the matrix is
+// not complex.
+func AsCDense(m *matlab.Matrix) (*mat.CDense, error) {
+	rows, cols, err := dims(m)
+	if err != nil {
+		return nil, err
+	}
+	re, im := m.Value(), m.ImagValue()
+	if !isNumeric(m) || len(re) != rows*cols || m.IsComplex() && len(im) != rows*cols {
+		return nil, fmt.Errorf("cannot convert matrix %s of class %s to a complex dense matrix", m.Name, m.ClassName())
+	}
+	data := make([]complex128, rows*cols)
+	for j := 0; j < cols; j++ {
+		for i := 0; i < rows; i++ {
+			var y float64
+			if m.IsComplex() {
+				y = toFloat64(im[i+rows*j])
+			}
+			data[i*cols+j] = complex(toFloat64(re[i+rows*j]), y)
+		}
+	}
+	return mat.NewCDense(rows, cols, data), nil
+}
+
+// AsCSC returns a real sparse matrix in compressed sparse column format. The indices are shared with the matrix.
+func AsCSC(m *matlab.Matrix) (*CSC, error) {
+	if !m.IsSparse() {
+		return nil, fmt.Errorf("matrix %s is not sparse", m.Name)
+	}
+	if m.IsComplex() {
+		return nil, fmt.Errorf("matrix %s is complex", m.Name)
+	}
+	if len(m.Dimension) != 2 {
+		return nil, fmt.Errorf("matrix %s has %d dimensions, gonum matrices have 2", m.Name, len(m.Dimension))
+	}
+	values := make([]float64, len(m.Value()))
+	for i, v := range m.Value() {
+		values[i] = toFloat64(v)
+	}
+	ir, jc := m.SparseIndices()
+	csc, err := NewCSC(int(m.Dimension[0]), int(m.Dimension[1]), ir, jc, values)
+	if err != nil {
+		return nil, fmt.Errorf("matrix %s: %v", m.Name, err)
+	}
+	return csc, nil
+}
+
+// NewMatrix creates a double matrix that can be written with WriteElement from a gonum matrix. A *CSC gives a sparse
+// matrix.
+func NewMatrix(name string, a mat.Matrix) (*matlab.Matrix, error) {
+	rows, cols := a.Dims()
+	if c, ok := a.(*CSC); ok {
+		return matlab.NewSparseMatrix(name, rows, cols, c.RowIndex, c.ColIndex, c.Values, nil)
+	}
+	values := make([]float64, rows*cols)
+	for j := 0; j < cols; j++ {
+		for i := 0; i < rows; i++ {
+			values[i+rows*j] = a.At(i, j)
+		}
+	}
+	return matlab.NewMatrix(name, "double", []int32{int32(rows), int32(cols)}, values, nil)
+}
+
+// NewCMatrix creates a complex double matrix that can be written with WriteElement from a gonum complex matrix
+func NewCMatrix(name string, a mat.CMatrix) (*matlab.Matrix, error) {
+	rows, cols := a.Dims()
+	re, im := make([]float64, rows*cols), make([]float64, rows*cols)
+	for j := 0; j < cols; j++ {
+		for i := 0; i < rows; i++ {
+			v := a.At(i, j)
+			re[i+rows*j], im[i+rows*j] = real(v), imag(v)
+		}
+	}
+	return matlab.NewMatrix(name, "double", []int32{int32(rows), int32(cols)}, re, im)
+}
+
+// dims returns the dimensions of a 2-D matrix, which gonum needs to be non empty for dense matrices
+func dims(m *matlab.Matrix) (rows, cols int, err error) {
+	if len(m.Dimension) != 2 {
+		return 0, 0, fmt.Errorf("matrix %s has %d dimensions, gonum matrices have 2", m.Name, len(m.Dimension))
+	}
+	rows, cols = int(m.Dimension[0]), int(m.Dimension[1])
+	if rows == 0 || cols == 0 {
+		return 0, 0, fmt.Errorf("matrix %s is empty", m.Name)
+	}
+	return rows, cols, nil
+}
+
+func isNumeric(m *matlab.Matrix) bool {
+	switch m.ClassName() {
+	case "double", "single", "int8", "uint8", "int16", "uint16", "int32", "uint32", "int64", "uint64", "logical":
+		return true
+	}
+	return false
+}
+
+func toFloat64(v interface{}) float64 {
+	switch x := v.(type) {
+	case float64:
+		return x
+	case float32:
+		return float64(x)
+	case int8:
+		return float64(x)
+	case uint8:
+		return float64(x)
+	case int16:
+		return float64(x)
+	case uint16:
+		return float64(x)
+	case int32:
+		return float64(x)
+	case uint32:
+		return float64(x)
+	case int64:
+		return float64(x)
+	case uint64:
+		return float64(x)
+	}
+	return 0
+}
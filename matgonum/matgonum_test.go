@@ -0,0 +1,103 @@
+package matgonum
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/daniellowtw/matlab"
+	"github.com/stretchr/testify/assert"
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestAsDense(t *testing.T) {
+	m, err := matlab.NewMatrix("a", "int8", []int32{2, 3}, []float64{1, 4, 2, 5, 3, 6}, nil)
+	assert.NoError(t, err)
+	d, err := AsDense(m)
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{1, 2, 3, 4, 5, 6}, d.RawMatrix().Data)
+
+	m, err = matlab.NewMatrix("c", "single", []int32{1, 2}, []float64{1, 2}, []float64{-1, 0})
+	assert.NoError(t, err)
+	_, err = AsDense(m)
+	assert.Error(t, err)
+	c, err := AsCDense(m)
+	assert.NoError(t, err)
+	assert.Equal(t, 1-1i, c.At(0, 0))
+	assert.Equal(t, 2+0i, c.At(0, 1))
+
+	m, _ = matlab.NewMatrix("e", "double", []int32{0, 0}, nil, nil)
+	_, err = AsDense(m)
+	assert.EqualError(t, err, "matrix e is empty")
+	m, _ = matlab.NewMatrix("n", "double", []int32{1, 1, 2}, []float64{1, 2}, nil)
+	_, err = AsDense(m)
+	assert.Error(t, err)
+	var ch matlab.Matrix
+	assert.NoError(t, json.Unmarshal([]byte(`{"name":"s","class":"char","dims":[1,1],"data":"a"}`), &ch))
+	_, err = AsDense(&ch)
+	assert.Error(t, err)
+}
+
+func TestAsCSC(t *testing.T) {
+	m, err := matlab.NewSparseMatrix("s", 3, 2, []int{2, 0}, []int{0, 1, 2}, []float64{5, 7}, nil)
+	assert.NoError(t, err)
+	s, err := AsCSC(m)
+	assert.NoError(t, err)
+	assert.Equal(t, 5.0, s.At(2, 0))
+	assert.Equal(t, 0.0, s.At(1, 1))
+	d, err := AsDense(m)
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{0, 7, 0, 0, 5, 0}, d.RawMatrix().Data)
+	assert.Equal(t, 7.0, s.T().At(1, 0))
+
+	m, err = matlab.NewSparseMatrix("e", 0, 3, nil, []int{0, 0, 0, 0}, nil, nil)
+	assert.NoError(t, err)
+	s, err = AsCSC(m)
+	assert.NoError(t, err)
+	r, c := s.Dims()
+	assert.Equal(t, []int{0, 3}, []int{r, c})
+
+	_, err = NewCSC(0, 2, nil, []int{0, 0, 0}, nil)
+	assert.NoError(t, err)
+	_, err = NewCSC(2, 2, []int{2}, []int{0, 1, 1}, []float64{1})
+	assert.Error(t, err)
+	_, err = NewCSC(2, 2, []int{0}, []int{1, 1, 1}, []float64{1})
+	assert.Error(t, err)
+	_, err = NewCSC(2, 3, []int{0, 1}, []int{0, 2, 0, 2}, []float64{1, 2})
+	assert.EqualError(t, err, "invalid sparse matrix, column indices must not decrease")
+}
+
+func TestNewMatrix(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := matlab.NewFileFromWriter(&buf, nil)
+	assert.NoError(t, err)
+	dense := mat.NewDense(2, 2, []float64{1, 2, 3, 4})
+	d, err := NewMatrix("d", dense)
+	assert.NoError(t, err)
+	assert.NoError(t, w.WriteElement(d))
+	s, err := NewCSC(3, 2, []int{2, 0}, []int{0, 1, 2}, []float64{5, 7})
+	assert.NoError(t, err)
+	sm, err := NewMatrix("s", s)
+	assert.NoError(t, err)
+	assert.NoError(t, w.WriteElement(sm))
+	cm, err := NewCMatrix("c", mat.NewCDense(1, 2, []complex128{1 + 2i, 3}))
+	assert.NoError(t, err)
+	assert.NoError(t, w.WriteElement(cm))
+
+	f, err := matlab.NewFileFromReader(&buf)
+	assert.NoError(t, err)
+	m, _ := f.GetVar("d")
+	assert.Equal(t, []float64{1, 3, 2, 4}, m.DoubleArray())
+	back, err := AsDense(m)
+	assert.NoError(t, err)
+	assert.True(t, mat.Equal(dense, back))
+
+	m, _ = f.GetVar("s")
+	assert.True(t, m.IsSparse())
+	back, err = AsDense(m)
+	assert.NoError(t, err)
+	assert.True(t, mat.Equal(s, back))
+
+	m, _ = f.GetVar("c")
+	assert.Equal(t, []complex128{1 + 2i, 3}, m.ComplexArray())
+}
@@ -4,14 +4,14 @@ package matlab
 import (
 	"bufio"
 	"bytes"
-	"compress/zlib"
+	"context"
 	"encoding/binary"
 	"fmt"
 	"io"
 	"math"
 	"strings"
+	"sync"
 	"time"
-	"unicode/utf16"
 	"unicode/utf8"
 )
 
@@ -91,6 +91,16 @@ func (d DataType) NumBytes() int {
 	panic("Cannot get NumBytes of variable length type: " + d.String())
 }
 
+// isNumeric reports whether the data type holds fixed size values that parseContent can decode
+func (d DataType) isNumeric() bool {
+	switch d {
+	case DTmiINT8, DTmiUINT8, DTmiINT16, DTmiUINT16, DTmiINT32, DTmiUINT32, DTmiSINGLE, DTmiDOUBLE, DTmiINT64,
+		DTmiUINT64, DTmiUTF8, DTmiUTF16, DTmiUTF32:
+		return true
+	}
+	return false
+}
+
 // Data Types as specified according to byte indicators
 const (
 	DataTypeUnknown DataType = iota // errored data type
@@ -114,22 +124,32 @@ const (
 	DTmiUTF32      // Unicode UTF-32 Encoded Character Data
 )
 
-// File represents a .mat matlab file
+// File represents a .mat matlab file. The variables of a file being read can be accessed from several goroutines at
+// once, writing has to happen from one goroutine at a time.
 type File struct {
 	Header *Header
 	r      io.Reader
 	w      io.Writer
 
+	opts       ReaderOptions
+	mu         sync.Mutex // guards reading the variables
 	hasReadAll bool
+	readErr    error
 	vars       map[string]*Matrix
+	raw        []*RawElement // top level elements that are not variables
+	h5         *h5File       // the HDF5 part of v7.3 files
+	h5w        *v73Writer
+	stream     *VarWriter // the variable being written by CreateVar
+	writeErr   error      // a variable of CreateVar failed, so the file ends within an element
 }
 
 // Header is a matlab .mat file header
 type Header struct {
-	Level     string
-	Platform  string
-	Created   time.Time
-	Endianess binary.ByteOrder
+	Level           string
+	Platform        string
+	Created         time.Time
+	Endianess       binary.ByteOrder
+	SubsystemOffset uint64 // position of the subsystem data in level 5 files, 0 if there is none
 }
 
 // String implements the stringer interface for Header
@@ -141,7 +161,55 @@ func (h *Header) String() string {
 // NewFileFromReader creates a file from a reader and attempts to read
 // the header
 func NewFileFromReader(r io.Reader) (f *File, err error) {
+	return NewFileFromReaderWithOptions(r, nil)
+}
+
+// ReaderOptions limits the memory and work reading the variables of a file may take, so that files from untrusted
+// sources can be read safely. Zero fields mean no limit, except for MaxDepth. The element sizes apply to the matrices of
+// level 4 files and the datasets of v7.3 files as well.
+type ReaderOptions struct {
+	MaxElementSize      int64   // bytes of an element of a level 5 file as its tag declares them
+	MaxTotalBytes       int64   // bytes of all elements of a file, counting compressed ones decompressed
+	MaxDepth            int     // nesting of cells and structs, 100 if 0
+	MaxCompressionRatio float64 // decompressed bytes per byte of a compressed element
+	MaxDecompressedSize int64   // decompressed bytes of a compressed element
+	MaxDecompressed     int64   // decompressed bytes of all compressed elements of a file
+
+	// Progress is called while the variables are read, every megabyte and after every variable. It is called from
+	// the goroutine reading the file, one call at a time.
+	Progress func(Progress)
+}
+
+func (o *ReaderOptions) maxDepth() int {
+	if o.MaxDepth > 0 {
+		return o.MaxDepth
+	}
+	return defaultMaxDepth
+}
+
+// defaultMaxDepth limits the nesting of cells and structs, which could otherwise exhaust the stack
+const defaultMaxDepth = 100
+
+// maxExpansion limits what is allocated for the parts of a matrix that are not stored in the file, the elements of
+// structs without fields and the column indices of level 4 sparse matrices, to this many times the bytes of the
+// matrix. Without it a matrix of a few bytes could claim gigabytes, whatever the options.
+const maxExpansion = 1024
+
+// checkExpansion checks n bytes allocated for a matrix of size bytes against maxExpansion
+func checkExpansion(n, size int64) error {
+	if n > maxExpansion*size {
+		return fmt.Errorf("matrix of %d bytes would take up %d bytes in memory", size, n)
+	}
+	return nil
+}
+
+// NewFileFromReaderWithOptions creates a file like NewFileFromReader whose variables are read within the limits of
+// opts, which may be nil
+func NewFileFromReaderWithOptions(r io.Reader, opts *ReaderOptions) (f *File, err error) {
 	f = &File{r: r, vars: map[string]*Matrix{}}
+	if opts != nil {
+		f.opts = *opts
+	}
 	err = f.readHeader()
 	return
 }
@@ -158,10 +226,26 @@ func (f *File) readHeader() (err error) {
 	h := &Header{}
 	f.Header = h
 
+	// level 4 files have no header, they start with the header of the first matrix
+	if buf, err = readAllBytes(4, f.r); err != nil {
+		return
+	}
+	if mopt, ok := parseMOPT(buf); ok {
+		f.r = io.MultiReader(bytes.NewReader(buf), f.r)
+		return f.readV4Header(mopt)
+	}
+	// Octave text files start with comments
+	if bytes.HasPrefix(buf, []byte("# ")) {
+		f.r = io.MultiReader(bytes.NewReader(buf), f.r)
+		return f.readTextHeader()
+	}
+
 	// read description
-	if buf, err = readAllBytes(headerTextLen, f.r); err != nil {
+	rest, err := readAllBytes(headerTextLen-len(buf), f.r)
+	if err != nil {
 		return
 	}
+	buf = append(buf, rest...)
 
 	r := bufio.NewReader(bytes.NewBuffer(buf))
 
@@ -176,8 +260,8 @@ func (f *File) readHeader() (err error) {
 	}
 
 	h.Level = strings.TrimSpace(h.Level)
-	if h.Level != "5.0" {
-		return fmt.Errorf("can only read matlab level 5 files")
+	if h.Level != "5.0" && h.Level != "7.3" {
+		return fmt.Errorf("can only read matlab level 5 or 7.3 files")
 	}
 
 	if _, err = r.Discard(len("MAT-file Platform: ")); err != nil {
@@ -187,7 +271,7 @@ func (f *File) readHeader() (err error) {
 	if h.Platform, err = r.ReadString(','); err != nil {
 		return
 	}
-	h.Platform = strings.TrimRight(h.Platform, ",")
+	h.Platform = strings.TrimSpace(strings.TrimRight(h.Platform, ","))
 
 	if _, err = r.Discard(len(" Created on: ")); err != nil {
 		return
@@ -202,7 +286,8 @@ func (f *File) readHeader() (err error) {
 		// Tolerate bad parsing. .mat files created by Octave doesn't seem to conform to the format
 	}
 
-	if _, err = readAllBytes(headerSubsystemOffsetLen, f.r); err != nil {
+	subsystem, err := readAllBytes(headerSubsystemOffsetLen, f.r)
+	if err != nil {
 		return
 	}
 
@@ -218,76 +303,153 @@ func (f *File) readHeader() (err error) {
 	} else {
 		return fmt.Errorf("invalid byte order setting: %s", byteOrder)
 	}
+	// files without subsystem data have all zeros or all spaces
+	if !bytes.Equal(subsystem, []byte("        ")) {
+		h.SubsystemOffset = h.Endianess.Uint64(subsystem)
+	}
 
 	return nil
 }
 
-func readAllBytes(p int, rdr io.Reader) (buf []byte, err error) {
-	var (
-		n int
-		r []byte
-	)
-	remaining := p
-	for remaining > 0 {
-		r = make([]byte, p)
-		n, err = rdr.Read(r)
+// readAllBytes reads p bytes
+func readAllBytes(p int, rdr io.Reader) ([]byte, error) {
+	return appendBytes(nil, p, rdr)
+}
+
+// appendBytes reads bytes after the ones in buf until it holds p bytes. The buffer grows as the data arrives rather
+// than being allocated up front, so that a length read from a corrupt file cannot make it allocate more memory than
+// the file holds. Large data is read in chunks, between which a reader can report progress or check for cancellation.
+func appendBytes(buf []byte, p int, rdr io.Reader) ([]byte, error) {
+	if p < 0 {
+		return nil, fmt.Errorf("invalid length %d", p)
+	}
+	n := len(buf)
+	if b, ok := rdr.(interface{ Len() int }); ok && b.Len() < p-n {
+		// in memory data like the content of a matrix can tell straight away
+		if b.Len() == 0 && n == 0 {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("EOF reached but we're supposed to read %d more bytes", p-n-b.Len())
+	}
+	const chunk = 1 << 20
+	if buf == nil {
+		buf = make([]byte, 0, minInt(p, chunk))
+	}
+	if m := minInt(p, chunk); m > n {
+		buf = append(buf, make([]byte, m-n)...)
+	}
+	for n < p {
+		if n == len(buf) {
+			buf = append(buf, make([]byte, minInt(p-n, len(buf)))...)
+		}
+		m, err := io.ReadFull(rdr, buf[n:minInt(len(buf), n+chunk)])
+		n += m
+		if err == io.ErrUnexpectedEOF || err == io.EOF && n > 0 {
+			// Bad unpacking
+			return buf[:n], fmt.Errorf("EOF reached but we're supposed to read %d more bytes", p-n)
+		}
+		// io.EOF is returned as is when nothing could be read
 		if err != nil {
-			if err.Error() == "EOF" {
-				if remaining-n == 0 {
-					// Finish reading
-					return append(buf, r[:n]...), nil
-				} else if p == remaining {
-					// Didn't read anything
-					return r, err
-				} else {
-					// Bad unpacking
-					return r, fmt.Errorf("EOF reached but we're supposed to read %d more bytes", remaining)
-				}
-			}
-			return
+			return buf[:n], err
 		}
-		buf = append(buf, r[:n]...)
-		remaining -= n
 	}
-	return
+	return buf, nil
+}
+
+// readData reads the p bytes of an element whose tag has been read, where the end of the data is an error
+func readData(p int, r io.Reader) ([]byte, error) {
+	buf, err := readAllBytes(p, r)
+	if err == io.EOF {
+		err = fmt.Errorf("EOF reached but we're supposed to read %d more bytes", p)
+	}
+	return buf, err
 }
 
+// readAll reads the variables on the first call. Concurrent calls wait for it and all calls share its result. The
+// variables are not changed afterwards, so they can be used without holding the lock once readAll returned.
 func (f *File) readAll() error {
-	if f.hasReadAll == true {
-		return nil
+	return f.readAllContext(context.Background(), 0)
+}
+
+// readAllContext is readAll reading until ctx is done, which fails the file as the reader cannot go back
+func (f *File) readAllContext(ctx context.Context, workers int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.hasReadAll {
+		return f.readErr
 	}
 	f.hasReadAll = true
-	elements, err := readAllElements(f.Header.Endianess, f.r)
+	if f.readErr = ctx.Err(); f.readErr == nil {
+		f.readErr = f.readElements(ctx, workers)
+	}
+	return f.readErr
+}
+
+// readElements reads the variables, decoding the elements of level 5 files on the given number of goroutines. With
+// no workers they are decoded one by one.
+func (f *File) readElements(ctx context.Context, workers int) error {
+	var elements []Element
+	var err error
+	r := &progressReader{r: f.r, ctx: ctx, report: f.opts.Progress, next: progressInterval}
+	if f.Header.Level == "4.0" {
+		elements, err = readAllV4Matrices(r, &f.opts)
+	} else if f.Header.Level == "7.3" {
+		elements, err = f.readAllV73(r)
+	} else if f.Header.Level == "text" {
+		elements, err = readAllTextMatrices(r, f.opts.maxDepth())
+	} else {
+		d := newDecoder(f.Header.Endianess, &f.opts)
+		d.ctx, d.progress = ctx, r
+		if workers > 0 {
+			elements, err = d.readAllConcurrently(r, workers)
+		} else {
+			elements, err = d.readAllElements(r)
+		}
+	}
 	if err != nil {
 		return err
 	}
 	for _, v := range elements {
-		if v.Type() != DTmiMATRIX {
-			panic("This library assumes top level elements are either Matrix or Compressed. Please file an issue")
+		switch e := v.(type) {
+		case *Matrix:
+			f.vars[e.Name] = e
+		case *RawElement:
+			f.raw = append(f.raw, e)
+		default:
+			return fmt.Errorf("unexpected top level element of type %s", v.Type())
 		}
-		m := v.(*Matrix)
-		f.vars[m.Name] = m
 	}
 	return nil
 }
 
+// Err returns the error that happened while reading the variables, if any. GetVar and GetVarsNames report a failed
+// read as missing variables.
+func (f *File) Err() error {
+	return f.readAll()
+}
+
 // GetVar returns the variable in the mat file
 func (f *File) GetVar(name string) (*Matrix, bool) {
-	if !f.hasReadAll {
-		if err := f.readAll(); err != nil {
-			return nil, false
-		}
+	if err := f.readAll(); err != nil {
+		return nil, false
 	}
 	vars, found := f.vars[name]
 	return vars, found
 }
 
+// RawElements returns the top level elements that this package cannot interpret, in the order they appear in the
+// file. They can be written back unchanged with WriteElement.
+func (f *File) RawElements() []*RawElement {
+	if err := f.readAll(); err != nil {
+		return nil
+	}
+	return f.raw
+}
+
 // GetVarsNames returns the list of variables in the given mat file
 func (f *File) GetVarsNames() []string {
-	if !f.hasReadAll {
-		if err := f.readAll(); err != nil {
-			return nil
-		}
+	if err := f.readAll(); err != nil {
+		return nil
 	}
 	var res []string
 	for n := range f.vars {
@@ -296,86 +458,155 @@ func (f *File) GetVarsNames() []string {
 	return res
 }
 
-func readElement(bo binary.ByteOrder, r io.Reader) (el Element, err error) {
-	sde, dt, p, err := readTag(bo, r)
+// decoder reads the elements of level 5 files within the limits of ReaderOptions
+type decoder struct {
+	bo           binary.ByteOrder
+	opts         *ReaderOptions
+	total        int64 // bytes of the top level elements read so far
+	decompressed int64 // bytes of compressed elements after decompression read so far
+	depth        int   // nesting of the matrix being read
+	ctx          context.Context
+	progress     *progressReader // the file being read, if this decodes its top level elements
+}
+
+func newDecoder(bo binary.ByteOrder, opts *ReaderOptions) *decoder {
+	if opts == nil {
+		opts = &ReaderOptions{}
+	}
+	return &decoder{bo: bo, opts: opts, ctx: context.Background()}
+}
+
+// checkSize checks the size of an element against the limit
+func (d *decoder) checkSize(n int) error {
+	if max := d.opts.MaxElementSize; max > 0 && int64(n) > max {
+		return fmt.Errorf("element of %d bytes exceeds the limit of %d bytes", n, max)
+	}
+	return nil
+}
+
+// reserve checks an element of n bytes against the limits. Only top level elements count towards the total, as the
+// elements within them have been counted already.
+func (d *decoder) reserve(n int) error {
+	if err := d.checkSize(n); err != nil {
+		return err
+	}
+	if d.depth == 0 {
+		return d.count(int64(n))
+	}
+	return nil
+}
+
+// count adds n bytes to the total
+func (d *decoder) count(n int64) error {
+	d.total += n
+	if max := d.opts.MaxTotalBytes; max > 0 && d.total > max {
+		return fmt.Errorf("file holds more than the limit of %d bytes", max)
+	}
+	return nil
+}
+
+// readElement reads and decodes the next element
+func (d *decoder) readElement(r io.Reader) (Element, error) {
+	decode, err := d.scanElement(r)
+	if err != nil {
+		return nil, err
+	}
+	return decode()
+}
+
+// scanElement reads the next element and checks it against the limits, and returns a function that decodes it. The
+// function only uses the data read and a decoder of its own, so the elements of a file can be decoded concurrently
+// while the next ones are read.
+func (d *decoder) scanElement(r io.Reader) (func() (Element, error), error) {
+	sde, dt, p, err := readTag(d.bo, r)
 	if err != nil {
 		return nil, err
 	}
 	// if small element, p will be 0, bail early
 	if sde != nil {
-		return sde, nil
+		return func() (Element, error) { return sde, nil }, nil
 	}
-	switch dt {
-	case DTmiCOMPRESSED:
-		// data is compressed, use zlib reader
-		buf, err := readAllBytes(p, r)
-		if err != nil {
-			return nil, err
-		}
-		cr, err := zlib.NewReader(bytes.NewBuffer(buf))
-		if err != nil {
-			return nil, err
-		}
-		defer cr.Close()
-		allElements, err := readAllElements(bo, cr)
-		if err != nil {
-			return nil, err
-		}
-		if len(allElements) != 1 {
-			panic("This library assumes compressed elements have exactly one sub element")
-		}
-		return allElements[0], nil
-	case DTmiMATRIX:
-		data, err := readAllBytes(p, r)
+	if dt == DTmiCOMPRESSED {
+		return d.scanCompressed(p, r)
+	}
+	if err := d.reserve(p); err != nil {
+		return nil, err
+	}
+	w := d.fork()
+	if dt == DTmiMATRIX {
+		data, err := d.readNamed(p, r, matrixName)
 		if err != nil {
 			return nil, err
 		}
-		return miMatrix(bo, data)
-	default:
-		numElement := p / dt.NumBytes()
-		p = padTo64Bit(p)
-		buf, err := readAllBytes(p, r)
-		if err != nil {
-			return nil, err
+		return func() (Element, error) { return w.miMatrix(data) }, nil
+	}
+	buf, err := readData(padTo64Bit(p), r)
+	if err != nil {
+		return nil, err
+	}
+	return func() (Element, error) {
+		if !dt.isNumeric() {
+			return &RawElement{typ: dt, Data: buf[:p], bo: w.bo}, nil
 		}
-		content, err := parseMulti(dt, bo, buf, numElement)
+		content, err := w.parseMulti(dt, buf, p/dt.NumBytes())
 		if err != nil {
 			return nil, err
 		}
-		return &subElement{typ: dt, value: content}, err
+		return &subElement{typ: dt, value: content}, nil
+	}, nil
+}
+
+// scanned reports the end of a top level element
+func (d *decoder) scanned() {
+	if d.progress != nil && d.depth == 0 {
+		variableRead(d.progress, d.progress.name)
 	}
 }
 
-func readAllElements(bo binary.ByteOrder, r io.Reader) ([]Element, error) {
+// fork returns a decoder at the same depth for decoding a scanned element. Its totals start at zero, as the elements
+// within have been counted by the scan.
+func (d *decoder) fork() *decoder {
+	return &decoder{bo: d.bo, opts: d.opts, depth: d.depth, ctx: d.ctx}
+}
+
+func (d *decoder) readAllElements(r io.Reader) ([]Element, error) {
 	var res []Element
 	for {
-		el, err := readElement(bo, r)
+		if err := d.ctx.Err(); err != nil {
+			return nil, err
+		}
+		el, err := d.readElement(r)
 		if err != nil {
 			if err.Error() == "EOF" {
 				break
 			}
 			return nil, err
 		}
+		d.scanned()
 		res = append(res, el)
 	}
 	return res, nil
-
 }
 
 // Reads the first 8 bytes. The 8 bytes can be one of two formats: Normal and small data element (sde) format.
 // Note that contrary to what the specs says, you have to consider endianness before parsing the first type bytes.
-func readTag(bo binary.ByteOrder, r io.Reader) (sde *smallDataElement, typ DataType, len int, err error) {
+func readTag(bo binary.ByteOrder, r io.Reader) (sde Element, typ DataType, len int, err error) {
 	buf, err := readAllBytes(8, r)
 	if err != nil {
 		return
 	}
-	sdeLen, sdeType := binary.LittleEndian.Uint16(buf[2:4]), binary.LittleEndian.Uint16(buf[0:2])
-	if bo == binary.BigEndian {
-		sdeLen, sdeType = sdeType, sdeLen
-	}
+	// The small data element packs the number of bytes in the upper and the type in the lower half of a 32 bit word
+	word := bo.Uint32(buf[:4])
+	sdeLen, sdeType := uint16(word>>16), uint16(word)
 	if sdeLen != 0 {
 		// handle small data element
 		dt := DataType(sdeType)
+		if sdeLen > 4 {
+			return nil, DataTypeUnknown, 0, fmt.Errorf("invalid small data element, it cannot hold %d bytes", sdeLen)
+		}
+		if !dt.isNumeric() {
+			return &RawElement{typ: dt, Data: buf[4 : 4+sdeLen], small: true, bo: bo}, dt, 0, nil
+		}
 		numEl := int(sdeLen) / dt.NumBytes()
 		sdeContent, err := parseMulti(dt, bo, buf[4:], numEl)
 		if err != nil {
@@ -389,7 +620,37 @@ func readTag(bo binary.ByteOrder, r io.Reader) (sde *smallDataElement, typ DataT
 	return nil, dataType, len, nil
 }
 
+// parseBlock is the number of values parsed between checks for cancellation
+const parseBlock = 1 << 16
+
+// parseMulti parses values like parseMulti, checking for cancellation between blocks of values
+func (d *decoder) parseMulti(t DataType, data []byte, n int) ([]interface{}, error) {
+	if n <= parseBlock || d.ctx.Done() == nil || t == DTmiUTF8 {
+		return parseMulti(t, d.bo, data, n)
+	}
+	res := make([]interface{}, 0, n)
+	for i := 0; i < n; i += parseBlock {
+		if err := d.ctx.Err(); err != nil {
+			return nil, err
+		}
+		values, err := parseMulti(t, d.bo, data[i*t.NumBytes():], minInt(parseBlock, n-i))
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, values...)
+	}
+	return res, nil
+}
+
 func parseMulti(t DataType, bo binary.ByteOrder, data []byte, len int) ([]interface{}, error) {
+	if t == DTmiUTF8 {
+		// characters can take up more than one byte, so decode the string as a whole
+		var res []interface{}
+		for _, c := range string(data[:len]) {
+			res = append(res, c)
+		}
+		return res, nil
+	}
 	res := make([]interface{}, len)
 	for i := 0; i < len; i++ {
 		i2, err := parseContent(t, bo, data[i*t.NumBytes():(i+1)*t.NumBytes()])
@@ -429,10 +690,10 @@ func parseContent(t DataType, bo binary.ByteOrder, data []byte) (interface{}, er
 		r, _ := utf8.DecodeRune(data)
 		return r, nil
 	case DTmiUTF16:
-		decode := utf16.Decode([]uint16{bo.Uint16(data)})
-		return decode[0], nil
+		// keep the code unit, surrogate pairs are decoded together with the rest of the string
+		return bo.Uint16(data), nil
 	case DTmiUTF32:
-		panic("Not supported")
+		return rune(bo.Uint32(data)), nil
 	case DTmiCOMPRESSED:
 		panic("should not be parsing compressed data type here")
 	default:
@@ -440,12 +701,27 @@ func parseContent(t DataType, bo binary.ByteOrder, data []byte) (interface{}, er
 	}
 }
 
-func miMatrix(bo binary.ByteOrder, data []byte) (*Matrix, error) {
+func (d *decoder) miMatrix(data []byte) (*Matrix, error) {
+	if d.depth >= d.opts.maxDepth() {
+		return nil, fmt.Errorf("cells and structs are nested more than %d levels deep", d.opts.maxDepth())
+	}
+	d.depth++
+	defer func() { d.depth-- }()
+	bo := d.bo
 	r := bytes.NewBuffer(data)
 	flags, class, err := arrayFlags(bo, r)
 	if err != nil {
 		return nil, err
 	}
+	raw := []interface{}{&RawElement{typ: DTmiMATRIX, Data: data, bo: bo}}
+	if class == mxOPAQUE {
+		// opaque matrices have no dimensions sub element. Keep them as they are.
+		name, err := arrayName(bo, r)
+		if err != nil {
+			return nil, err
+		}
+		return &Matrix{Name: name, flags: flags, Class: class, value: raw}, nil
+	}
 	dim, err := dimensionsArray(bo, r)
 	if err != nil {
 		return nil, err
@@ -454,35 +730,56 @@ func miMatrix(bo binary.ByteOrder, data []byte) (*Matrix, error) {
 	if err != nil && err.Error() != "EOF" {
 		return nil, err
 	}
+	m := &Matrix{
+		Name:      name,
+		flags:     flags,
+		Class:     class,
+		Dimension: dim,
+	}
+	numel, ok := checkedNumel(dim)
+	if !ok || len(dim) < 2 {
+		return nil, fmt.Errorf("invalid dimensions %v of matrix %s", dim, name)
+	}
 
-	var res []interface{}
 	switch class {
-	case mxSPARSE:
-		panic("Sparse matrix unsupported") // has 6 sub elements
 	case mxCELL: // has 4 sub elements. Each cell is also a miMatrix
-		elements, err := readAllElements(bo, r)
+		elements, err := d.readAllElements(r)
 		if err != nil {
 			return nil, err
 		}
 		for _, e := range elements {
-			// we know they are matrices
-			res = append(res, e.(*Matrix))
+			c, ok := e.(*Matrix)
+			if !ok {
+				return nil, fmt.Errorf("expects the cells of a cell array to be of type %s. Got %s instead", DTmiMATRIX, e.Type())
+			}
+			m.value = append(m.value, c)
+		}
+		if len(m.value) != numel {
+			return nil, fmt.Errorf("cell %s has %d elements but its dimensions need %d", name, len(m.value), numel)
 		}
 	case mxSTRUCT: // has 6 sub elements
-		fieldLengthElement, err := readElement(bo, r)
+		fieldLengthElement, err := d.readElement(r)
 		if err != nil {
 			return nil, err
 		}
 		if fieldLengthElement.Type() != DTmiINT32 {
-			panic(fmt.Sprintf("Expects the max field name length element of a struct matrix to be of type %s. Got %s instead", DTmiINT32, fieldLengthElement.Type()))
+			return nil, fmt.Errorf("expects the max field name length element of a struct matrix to be of type %s. Got %s instead", DTmiINT32, fieldLengthElement.Type())
+		}
+		if len(fieldLengthElement.Value()) != 1 {
+			return nil, fmt.Errorf("expects the max field name length element of a struct matrix to hold a single value")
 		}
 		maxLength := int(fieldLengthElement.Value()[0].(int32))
-		fieldNamesElement, err := readElement(bo, r)
+		fieldNamesElement, err := d.readElement(r)
 		if err != nil {
 			return nil, err
 		}
-		numFields := len(fieldNamesElement.Value()) / maxLength
-		keys := map[string]*Matrix{}
+		if fieldNamesElement.Type() != DTmiINT8 {
+			return nil, fmt.Errorf("expects the field names element of a struct matrix to be of type %s. Got %s instead", DTmiINT8, fieldNamesElement.Type())
+		}
+		numFields := 0
+		if maxLength > 0 {
+			numFields = len(fieldNamesElement.Value()) / maxLength
+		}
 		for i := 0; i < numFields; i++ {
 			var fieldName []byte
 			for s := i * maxLength; s < (i+1)*maxLength; s++ {
@@ -492,35 +789,108 @@ func miMatrix(bo binary.ByteOrder, data []byte) (*Matrix, error) {
 				}
 				fieldName = append(fieldName, byte(c))
 			}
-			cellsElement, err := readElement(bo, r)
-			if err != nil {
+			m.fields = append(m.fields, string(fieldName))
+		}
+		if len(m.fields) == 0 {
+			// the elements take no space in the file, but a map each in memory
+			if err := checkExpansion(int64(numel)*8, int64(len(data))); err != nil {
+				return nil, fmt.Errorf("struct %s: %v", name, err)
+			}
+			if err := d.count(int64(numel) * 8); err != nil {
 				return nil, err
 			}
-			keys[string(fieldName)] = cellsElement.(*Matrix)
 		}
-		res = []interface{}{keys}
-	case mxOBJECT:
-		panic("Object matrix unsupported") // has 7 sub elements
-	default: // 4 elements: Numeric and character array. Pass through
-		pr, err := readNumericalData(bo, r)
+		// struct arrays store the fields of each element one after another
+		for i := 0; i < numel; i++ {
+			keys := map[string]*Matrix{}
+			for _, field := range m.fields {
+				cellsElement, err := d.readElement(r)
+				if err != nil {
+					return nil, err
+				}
+				c, ok := cellsElement.(*Matrix)
+				if !ok {
+					return nil, fmt.Errorf("expects the fields of a struct matrix to be of type %s. Got %s instead", DTmiMATRIX, cellsElement.Type())
+				}
+				keys[field] = c
+			}
+			m.value = append(m.value, keys)
+		}
+	case mxCHAR, mxDOUBLE, mxSINGLE, mxINT8, mxUINT8, mxINT16, mxUINT16, mxINT32, mxUINT32, mxINT64, mxUINT64:
+		// 4 elements: Numeric and character array
+		pr, err := d.readNumericalData(r)
 		if err != nil {
 			return nil, err
 		}
+		if _, ok := pr.(*RawElement); ok {
+			m.value = raw
+			return m, nil
+		}
+		m.value = castValues(class, pr.Value())
 		if flags.isComplex {
-			if _, err := readNumericalData(bo, r); err != nil && err.Error() != "EOF" {
+			pi, err := d.readNumericalData(r)
+			if err != nil {
 				return nil, err
 			}
-			// TODO: Handle returning of complex numbers
+			if _, ok := pi.(*RawElement); ok {
+				m.value = raw
+				return m, nil
+			}
+			m.imag = castValues(class, pi.Value())
+		}
+		if len(m.value) != numel || flags.isComplex && len(m.imag) != numel {
+			return nil, fmt.Errorf("matrix %s has %d values but its dimensions need %d", name, len(m.value), numel)
 		}
-		res = pr.Value()
+	case mxSPARSE: // has 6 sub elements: row indices, column indices, real and imaginary parts
+		var indices [2][]int
+		for i := range indices {
+			el, err := d.readNumericalData(r)
+			if err != nil {
+				return nil, err
+			}
+			if el.Type() != DTmiINT32 {
+				return nil, fmt.Errorf("expects the indices of a sparse matrix to be of type %s. Got %s instead", DTmiINT32, el.Type())
+			}
+			for _, v := range el.Value() {
+				indices[i] = append(indices[i], int(v.(int32)))
+			}
+		}
+		m.ir, m.jc = indices[0], indices[1]
+		if len(m.Dimension) != 2 || len(m.jc) != int(m.Dimension[1])+1 {
+			return nil, fmt.Errorf("invalid sparse matrix, expects %d column indices", len(m.jc))
+		}
+		nnz := m.jc[len(m.jc)-1]
+		if nnz < 0 || nnz > len(m.ir) {
+			return nil, fmt.Errorf("invalid sparse matrix, %d nonzero elements but %d row indices", nnz, len(m.ir))
+		}
+		// the row indices are allocated for the maximum number of nonzero elements, which may be more than are used
+		m.ir = m.ir[:nnz]
+		valueClass := mxDOUBLE
+		if flags.isLogical {
+			valueClass = mxUINT8
+		}
+		parts := []*[]interface{}{&m.value}
+		if flags.isComplex {
+			parts = append(parts, &m.imag)
+		}
+		for _, part := range parts {
+			el, err := d.readNumericalData(r)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := el.(*RawElement); ok || len(el.Value()) < nnz {
+				return nil, fmt.Errorf("invalid sparse matrix, expects %d numeric values", nnz)
+			}
+			*part = castValues(valueClass, el.Value()[:nnz])
+		}
+		if err := checkSparse(m); err != nil {
+			return nil, err
+		}
+	default:
+		// object and function handle classes, or a class we don't know about. Keep them as they are.
+		m.value = raw
 	}
-	return &Matrix{
-		Name:      name,
-		flags:     flags,
-		Class:     class,
-		Dimension: dim,
-		value:     res,
-	}, nil
+	return m, nil
 }
 
 // flags indicating whether the numeric data is complex, global or logical. See 1-16 of specs.
@@ -530,8 +900,13 @@ type Flags struct {
 	isGlobal  bool
 }
 
-// Docs is wrong about this. This is packed as two blocks of uint16. The first u16 in the data is for flags and class
-// and the second is for sparse matrix.
+// Bit masks of the flags within the first word of the array flags sub element
+const (
+	flagLogical = 1 << 9
+	flagGlobal  = 1 << 10
+	flagComplex = 1 << 11
+)
+
 func arrayFlags(bo binary.ByteOrder, r io.Reader) (flags Flags, class mxClass, err error) {
 	_, dt, p, err := readTag(bo, r)
 	if err != nil {
@@ -549,15 +924,13 @@ func arrayFlags(bo binary.ByteOrder, r io.Reader) (flags Flags, class mxClass, e
 	if err != nil {
 		return
 	}
-	// NonZeroMax is used to indicate the maximum number of nonzero array elements in the sparse array
-	flagsAndClass, nonZeroMax := binary.LittleEndian.Uint16(buf[:4]), binary.LittleEndian.Uint16(buf[4:])
-	if bo == binary.BigEndian {
-		flagsAndClass, nonZeroMax = nonZeroMax, flagsAndClass
-	}
+	// The class sits in the lowest byte and the flags in the byte above it. The second word holds the maximum number
+	// of nonzero elements of a sparse array.
+	flagsAndClass := bo.Uint32(buf[:4])
 	flags = Flags{
-		isLogical: flagsAndClass>>9 == 1,
-		isGlobal:  flagsAndClass>>10 == 1,
-		isComplex: flagsAndClass>>11 == 1,
+		isLogical: flagsAndClass&flagLogical != 0,
+		isGlobal:  flagsAndClass&flagGlobal != 0,
+		isComplex: flagsAndClass&flagComplex != 0,
 	}
 	class = mxClass(uint8(flagsAndClass & 0xFF))
 	return
@@ -582,7 +955,7 @@ func dimensionsArray(bo binary.ByteOrder, r io.Reader) ([]int32, error) {
 	if dt != DTmiINT32 {
 		return nil, fmt.Errorf("invalid data type. Expects dimension sub element to have type int32, got %s instead", dt)
 	}
-	buf, err := readAllBytes(padTo64Bit(p), r)
+	buf, err := readData(padTo64Bit(p), r)
 	if err != nil {
 		return nil, err
 	}
@@ -606,6 +979,9 @@ func arrayName(bo binary.ByteOrder, r io.Reader) (string, error) {
 		return "", err
 	}
 	if sde != nil {
+		if sde.Type() != DTmiINT8 {
+			return "", fmt.Errorf("invalid data type. Expects array name sub element to have type int8, got %s instead", sde.Type())
+		}
 		t := sde.Value()
 		n := make([]byte, len(t))
 		for i, v := range t {
@@ -616,26 +992,33 @@ func arrayName(bo binary.ByteOrder, r io.Reader) (string, error) {
 	if dt != DTmiINT8 {
 		return "", fmt.Errorf("invalid data type. Expects array name sub element to have type int8, got %s instead", dt)
 	}
-	data, err := readAllBytes(padTo64Bit(p), r)
-	return string(data[:p]), err
+	data, err := readData(padTo64Bit(p), r)
+	if err != nil {
+		return "", err
+	}
+	return string(data[:p]), nil
 }
 
 // This can read the real part of imaginary part sub elements of a matrix
-func readNumericalData(bo binary.ByteOrder, r io.Reader) (Element, error) {
+func (d *decoder) readNumericalData(r io.Reader) (Element, error) {
+	bo := d.bo
 	sde, dt, numBytes, err := readTag(bo, r)
 	if err != nil {
 		return nil, err
 	}
 	// SDE
-	if numBytes == 0 {
+	if sde != nil {
 		return sde, nil
 	}
-	data, err := readAllBytes(numBytes, r)
+	data, err := readData(padTo64Bit(numBytes), r)
 	if err != nil {
 		return nil, err
 	}
+	if !dt.isNumeric() {
+		return &RawElement{typ: dt, Data: data[:numBytes], bo: bo}, nil
+	}
 	numElements := numBytes / dt.NumBytes()
-	multi, err := parseMulti(dt, bo, data, numElements)
+	multi, err := d.parseMulti(dt, data, numElements)
 	if err != nil {
 		return nil, err
 	}
@@ -679,36 +1062,78 @@ func (c mxClass) String() string {
 		return "64-bit, signed integer"
 	case mxUINT64:
 		return "64-bit, unsigned integer"
+	case mxFUNCTION:
+		return "Function handle"
+	case mxOPAQUE:
+		return "Opaque object"
 	default:
 		return "unknown"
 	}
 }
 
-// MATLAB Array Types (Classes)
-const (
-	mxUNKNOWN mxClass = iota
-	mxCELL            // Cell array
-	mxSTRUCT          // Structure
-	mxOBJECT          // Object
-	mxCHAR            // Character array
-	mxSPARSE          // Sparse array *NB: don't use*
-	mxDOUBLE          // Double precision array
-	mxSINGLE          // Single precision array
-	mxINT8            // 8-bit, signed integer
-	mxUINT8           // 8-bit, unsigned integer
-	mxINT16           // 16-bit, signed integer
-	mxUINT16          // 16-bit, unsigned integer
-	mxINT32           // 32-bit, signed integer
-	mxUINT32          // 32-bit, unsigned integer
-	mxINT64           // 64-bit, signed integer
-	mxUINT64          // 64-bit, unsigned integer
-)
-
-func writeHeader(w io.Writer, h *Header) error {
-	return fmt.Errorf("not finished")
+// isNumeric tells whether values of the class are numbers, which includes logical values
+func (c mxClass) isNumeric() bool {
+	return c >= mxDOUBLE && c <= mxUINT64
 }
 
-// WriteElement writes a single element to a file's writer
-func (f *File) WriteElement(e *Element) error {
-	return fmt.Errorf("not finished")
+// matlabName returns the name of the class in matlab
+func (c mxClass) matlabName() string {
+	switch c {
+	case mxCELL:
+		return "cell"
+	case mxSTRUCT:
+		return "struct"
+	case mxOBJECT, mxOPAQUE:
+		return "object"
+	case mxCHAR:
+		return "char"
+	case mxSPARSE:
+		return "sparse"
+	case mxDOUBLE:
+		return "double"
+	case mxSINGLE:
+		return "single"
+	case mxINT8:
+		return "int8"
+	case mxUINT8:
+		return "uint8"
+	case mxINT16:
+		return "int16"
+	case mxUINT16:
+		return "uint16"
+	case mxINT32:
+		return "int32"
+	case mxUINT32:
+		return "uint32"
+	case mxINT64:
+		return "int64"
+	case mxUINT64:
+		return "uint64"
+	case mxFUNCTION:
+		return "function_handle"
+	default:
+		return "unknown"
+	}
 }
+
+// MATLAB Array Types (Classes)
+const (
+	mxUNKNOWN  mxClass = iota
+	mxCELL             // Cell array
+	mxSTRUCT           // Structure
+	mxOBJECT           // Object
+	mxCHAR             // Character array
+	mxSPARSE           // Sparse array *NB: don't use*
+	mxDOUBLE           // Double precision array
+	mxSINGLE           // Single precision array
+	mxINT8             // 8-bit, signed integer
+	mxUINT8            // 8-bit, unsigned integer
+	mxINT16            // 16-bit, signed integer
+	mxUINT16           // 16-bit, unsigned integer
+	mxINT32            // 32-bit, signed integer
+	mxUINT32           // 32-bit, unsigned integer
+	mxINT64            // 64-bit, signed integer
+	mxUINT64           // 64-bit, unsigned integer
+	mxFUNCTION         // Function handle
+	mxOPAQUE           // Opaque object, e.g. classdef objects. Has no dimensions sub element
+)
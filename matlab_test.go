@@ -1,8 +1,14 @@
 package matlab
 
 import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
 	"os"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -88,3 +94,159 @@ func TestStruct(t *testing.T) {
 	assert.Equal(t, 2.0, s["y"].GetAtLocation(0))
 	assert.Equal(t, []rune("abc"), s["z"].String())
 }
+
+func TestBigEndian(t *testing.T) {
+	bo := binary.BigEndian
+	header := []byte(fmt.Sprintf("%-116s", "MATLAB 5.0 MAT-file, Platform: sol2, Created on: Mon Feb 18 17:12:08 2013"))
+	header = append(header, make([]byte, 12)...)
+	bo.PutUint16(header[124:], 0x0100)
+	copy(header[126:], "MI")
+	flags, dims := make([]byte, 8), make([]byte, 8)
+	bo.PutUint32(flags, flagGlobal|flagLogical|uint32(mxUINT8))
+	bo.PutUint32(dims, 1)
+	bo.PutUint32(dims[4:], 3)
+	// the name and the values are small data elements
+	var m []byte
+	m = append(m, packElement(bo, DTmiUINT32, flags)...)
+	m = append(m, packElement(bo, DTmiINT32, dims)...)
+	m = append(m, packElement(bo, DTmiINT8, []byte("a"))...)
+	m = append(m, packElement(bo, DTmiUINT8, []byte{1, 0, 1})...)
+
+	f, err := NewFileFromReader(bytes.NewReader(append(header, packElement(bo, DTmiMATRIX, m)...)))
+	assert.NoError(t, err)
+	assert.Equal(t, bo, f.Header.Endianess)
+	assert.Equal(t, []string{"a"}, f.GetVarsNames())
+	r, hasVar := f.GetVar("a")
+	if assert.True(t, hasVar) {
+		assert.Equal(t, mxUINT8, r.Class)
+		assert.Equal(t, Flags{isLogical: true, isGlobal: true}, r.flags)
+		assert.Equal(t, []int32{1, 3}, r.Dimension)
+		assert.Equal(t, []interface{}{uint8(1), uint8(0), uint8(1)}, r.Value())
+	}
+}
+
+func TestReaderOptions(t *testing.T) {
+	data, err := os.ReadFile("testdata/compressedTypes.mat")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	for _, test := range []struct {
+		opts *ReaderOptions
+		err  string
+	}{
+		{nil, ""},
+		{&ReaderOptions{MaxElementSize: 1 << 20, MaxTotalBytes: 1 << 20, MaxCompressionRatio: 1000}, ""},
+		{&ReaderOptions{MaxElementSize: 16}, "exceeds the limit of 16 bytes"},
+		{&ReaderOptions{MaxTotalBytes: 64}, "more than the limit of 64 bytes"},
+		{&ReaderOptions{MaxCompressionRatio: 1}, "expands to more than 1 times its size"},
+	} {
+		f, err := NewFileFromReaderWithOptions(bytes.NewReader(data), test.opts)
+		assert.NoError(t, err)
+		f.GetVarsNames()
+		if test.err == "" {
+			assert.NoError(t, f.Err())
+		} else if assert.Error(t, f.Err()) {
+			assert.Contains(t, f.Err().Error(), test.err)
+		}
+	}
+
+	// cells nested 5 levels deep
+	m := &Matrix{Name: "c", Class: mxDOUBLE, Dimension: []int32{1, 1}, value: []interface{}{1.0}}
+	for i := 0; i < 5; i++ {
+		m = &Matrix{Name: "c", Class: mxCELL, Dimension: []int32{1, 1}, value: []interface{}{m}}
+	}
+	var buf bytes.Buffer
+	w, err := NewFileFromWriter(&buf, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, w.WriteElement(m))
+	for depth, ok := range map[int]bool{0: true, 6: true, 5: false} {
+		f, err := NewFileFromReaderWithOptions(bytes.NewReader(buf.Bytes()), &ReaderOptions{MaxDepth: depth})
+		assert.NoError(t, err)
+		f.GetVarsNames()
+		assert.Equal(t, ok, f.Err() == nil, depth)
+	}
+}
+
+func TestReadInvalidElements(t *testing.T) {
+	bo := binary.LittleEndian
+	var header bytes.Buffer
+	_, err := NewFileFromWriter(&header, nil)
+	assert.NoError(t, err)
+	tag := func(dt DataType, n uint32) []byte {
+		buf := make([]byte, 8)
+		bo.PutUint32(buf, uint32(dt))
+		bo.PutUint32(buf[4:], n)
+		return buf
+	}
+	matrix := func(m *Matrix) []byte {
+		data, err := encodeMatrix(bo, m)
+		assert.NoError(t, err)
+		return packElement(bo, DTmiMATRIX, data)
+	}
+	// a struct array without fields whose elements take no space in the file
+	fieldless := matrix(&Matrix{Class: mxSTRUCT, Dimension: []int32{1, 1}, value: []interface{}{map[string]*Matrix{}}})
+	dims := func(d ...int32) []byte {
+		buf := tag(DTmiINT32, 8)
+		for _, x := range d {
+			buf = bo.AppendUint32(buf, uint32(x))
+		}
+		return buf
+	}
+	fieldless = bytes.Replace(fieldless, dims(1, 1), dims(1, 2e9), 1)
+	for name, element := range map[string][]byte{
+		"fieldless struct": fieldless,
+		"huge matrix":      tag(DTmiMATRIX, 0xfffffff8),
+		"huge compressed":  tag(DTmiCOMPRESSED, 0xfffffff8),
+		"huge numbers":     tag(DTmiDOUBLE, 0xfffffff8),
+		"too few values":   matrix(&Matrix{Class: mxDOUBLE, Dimension: []int32{2, 2}, value: []interface{}{1.0, 2.0, 3.0}}),
+		"too many cells":   matrix(&Matrix{Class: mxCELL, Dimension: []int32{1, 0}, value: []interface{}{&Matrix{Class: mxDOUBLE, Dimension: []int32{0, 0}}}}),
+		"negative size":    matrix(&Matrix{Class: mxDOUBLE, Dimension: []int32{-1, 0}, value: []interface{}{}}),
+		"row out of range": matrix(&Matrix{Class: mxSPARSE, Dimension: []int32{2, 1}, value: []interface{}{1.0},
+			ir: []int{5}, jc: []int{0, 1}}),
+	} {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		f, err := NewFileFromReader(bytes.NewReader(append(header.Bytes(), element...)))
+		assert.NoError(t, err)
+		f.GetVarsNames()
+		assert.Error(t, f.Err(), name)
+		runtime.ReadMemStats(&after)
+		// the declared sizes must not be allocated up front
+		assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(1<<24), name)
+	}
+}
+
+func TestConcurrentRead(t *testing.T) {
+	for _, name := range []string{"varTypes", "compressedTypes", "v73"} {
+		file, err := os.Open("testdata/" + name + ".mat")
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		defer file.Close()
+		f, err := NewFileFromReader(file)
+		assert.NoError(t, err)
+
+		var wg sync.WaitGroup
+		names := make([][]string, 32)
+		for i := range names {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				names[i] = f.GetVarsNames()
+				sort.Strings(names[i])
+				for _, v := range names[i] {
+					m, ok := f.GetVar(v)
+					assert.True(t, ok)
+					assert.Equal(t, v, m.Name)
+				}
+				assert.NoError(t, f.Err())
+				f.RawElements()
+			}(i)
+		}
+		wg.Wait()
+		assert.NotEmpty(t, names[0], name)
+		for _, n := range names {
+			assert.Equal(t, names[0], n, name)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package matlab
 
 import (
+	"fmt"
+	"math"
 	"unicode/utf16"
 )
 
@@ -10,6 +12,10 @@ type Matrix struct {
 	flags     Flags
 	Class     mxClass
 	value     []interface{}
+	imag      []interface{} // imaginary part of complex numeric matrices
+	fields    []string      // field names of structs, in the order they are stored
+	ir        []int         // row index of each nonzero element of sparse matrices
+	jc        []int         // index into ir of the first nonzero element of each column of sparse matrices
 }
 
 // hint to the compiler
@@ -23,16 +29,211 @@ func (m *Matrix) Value() []interface{} {
 	return m.value
 }
 
+// ImagValue returns the imaginary parts of a complex numeric or sparse matrix, in the same order as Value
+func (m *Matrix) ImagValue() []interface{} {
+	return m.imag
+}
+
+// NewMatrix creates a matrix of a numeric class like "double" or "logical" that can be written with WriteElement. The
+// values are given in column major order and converted to the class like castValue does. imag may be nil, otherwise
+// the matrix is complex.
+func NewMatrix(name, class string, dims []int32, real, imag []float64) (*Matrix, error) {
+	c, logical, ok := classByName(class)
+	if !ok {
+		return nil, fmt.Errorf("cannot create a matrix of class %s, expects a numeric class or logical", class)
+	}
+	numel, ok := checkedNumel(dims)
+	if !ok || len(dims) < 2 {
+		return nil, fmt.Errorf("invalid dimensions %v of matrix %s", dims, name)
+	}
+	if len(real) != numel || imag != nil && len(imag) != numel {
+		return nil, fmt.Errorf("matrix %s of dimensions %v expects %d values", name, dims, numel)
+	}
+	if logical && imag != nil {
+		return nil, fmt.Errorf("logical matrix %s cannot be complex", name)
+	}
+	m := &Matrix{Name: name, Class: c, Dimension: dims, flags: Flags{isLogical: logical, isComplex: imag != nil}}
+	m.value = make([]interface{}, numel)
+	for i, x := range real {
+		if logical {
+			m.value[i] = uint8(0)
+			if x != 0 {
+				m.value[i] = uint8(1)
+			}
+			continue
+		}
+		m.value[i] = castValue(c, x)
+	}
+	if imag != nil {
+		m.imag = make([]interface{}, numel)
+		for i, x := range imag {
+			m.imag[i] = castValue(c, x)
+		}
+	}
+	return m, nil
+}
+
+// NewSparseMatrix creates a rows x cols sparse double matrix that can be written with WriteElement. rowIndex gives the
+// row of each nonzero value and colIndex the index of the first nonzero value of each column, followed by the number
+// of nonzero values, like SparseIndices returns them. imag may be nil, otherwise the matrix is complex.
+func NewSparseMatrix(name string, rows, cols int, rowIndex, colIndex []int, real, imag []float64) (*Matrix, error) {
+	if rows < 0 || cols < 0 || rows > math.MaxInt32 || cols > math.MaxInt32 {
+		return nil, fmt.Errorf("invalid dimensions %dx%d of sparse matrix %s", rows, cols, name)
+	}
+	m := &Matrix{Name: name, Class: mxSPARSE, Dimension: []int32{int32(rows), int32(cols)}, flags: Flags{isComplex: imag != nil},
+		ir: append([]int(nil), rowIndex...), jc: append([]int(nil), colIndex...)}
+	m.value = make([]interface{}, len(real))
+	for i, x := range real {
+		m.value[i] = x
+	}
+	if imag != nil {
+		m.imag = make([]interface{}, len(imag))
+		for i, x := range imag {
+			m.imag[i] = x
+		}
+	}
+	if err := checkSparse(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func (m *Matrix) GetAtLocation(i int) interface{} {
 	// boundaries check
+	if i >= m.numel() || i >= len(m.value) {
+		return nil
+	}
+	return m.value[i]
+}
+
+// numel returns the number of elements according to the dimensions
+func (m *Matrix) numel() int {
 	max := 1
 	for _, x := range m.Dimension {
 		max *= int(x)
 	}
-	if i >= max {
-		return nil
+	return max
+}
+
+// checkedNumel returns the number of elements of an array of the given dimensions, or false if a dimension is
+// negative or the number overflows
+func checkedNumel(dims []int32) (int, bool) {
+	n := 1
+	for _, d := range dims {
+		if d < 0 || d > 0 && n > maxInt/int(d) {
+			return 0, false
+		}
+		n *= int(d)
 	}
-	return m.value[i]
+	return n, true
+}
+
+// classByName returns the numeric class matlab's class function names, and whether it is logical
+func classByName(name string) (mxClass, bool, bool) {
+	if name == "logical" {
+		return mxUINT8, true, true
+	}
+	for c := mxDOUBLE; c <= mxUINT64; c++ {
+		if c.matlabName() == name {
+			return c, false, true
+		}
+	}
+	return 0, false, false
+}
+
+// Raw returns the undecoded element if the matrix is of a class this package cannot interpret, e.g. function handles
+// and objects. Such matrices still have a name, class and, except for opaque objects, dimensions.
+func (m *Matrix) Raw() (*RawElement, bool) {
+	if len(m.value) != 1 {
+		return nil, false
+	}
+	raw, ok := m.value[0].(*RawElement)
+	return raw, ok
+}
+
+// SparseIndices returns the row index of each nonzero value of a sparse matrix, and for each column the index of its
+// first nonzero value. The last column index is the number of nonzero values.
+func (m *Matrix) SparseIndices() (rowIndex, colIndex []int) {
+	return m.ir, m.jc
+}
+
+// FieldNames returns the field names of a struct in the order they are stored
+func (m *Matrix) FieldNames() []string {
+	return m.fields
+}
+
+// IsComplex tells whether a numeric or sparse matrix has an imaginary part
+func (m *Matrix) IsComplex() bool {
+	return m.flags.isComplex
+}
+
+// IsLogical tells whether a matrix holds logical values
+func (m *Matrix) IsLogical() bool {
+	return m.flags.isLogical
+}
+
+// IsGlobal tells whether a variable was saved as a global variable
+func (m *Matrix) IsGlobal() bool {
+	return m.flags.isGlobal
+}
+
+// IsSparse tells whether a matrix is sparse
+func (m *Matrix) IsSparse() bool {
+	return m.Class == mxSPARSE
+}
+
+// ClassName returns the name matlab's class function gives the matrix, e.g. "double" or "logical"
+func (m *Matrix) ClassName() string {
+	if m.flags.isLogical {
+		return "logical"
+	}
+	if m.Class == mxSPARSE {
+		return mxDOUBLE.matlabName()
+	}
+	return m.Class.matlabName()
+}
+
+// Bytes returns the number of bytes the data of a matrix takes up in memory, which is what matlab's whos reports
+// without the overhead of the arrays within cells and structs
+func (m *Matrix) Bytes() int {
+	switch m.Class {
+	case mxCELL:
+		n := 0
+		for _, v := range m.value {
+			if c, ok := v.(*Matrix); ok {
+				n += c.Bytes()
+			}
+		}
+		return n
+	case mxSTRUCT:
+		n := 0
+		for _, v := range m.value {
+			if keys, ok := v.(map[string]*Matrix); ok {
+				for _, c := range keys {
+					n += c.Bytes()
+				}
+			}
+		}
+		return n
+	case mxSPARSE:
+		// a value and a 64 bit row index for each nonzero element and a 64 bit index for each column plus one
+		size := 8
+		if m.flags.isLogical {
+			size = 1
+		}
+		if m.flags.isComplex {
+			size *= 2
+		}
+		return len(m.ir)*(size+8) + len(m.jc)*8
+	}
+	if raw, ok := m.Raw(); ok {
+		return len(raw.Data)
+	}
+	size := m.Class.dataType().NumBytes()
+	if m.flags.isComplex {
+		size *= 2
+	}
+	return size * m.numel()
 }
 
 // IntArray is a convenience method to extract the matrix value as []int64. Warning: It panics if the matlab class
@@ -64,14 +265,37 @@ func (m *Matrix) IntArray() []int64 {
 	return res
 }
 
-// DoubleArray is a convenience method to extract the matrix value as []float64. Warning: It panics if the matlab class
-// is not Double or Single
+// DoubleArray is a convenience method to extract the matrix value as []float64. For sparse matrices only the nonzero
+// values are returned. Warning: It panics if the matlab class is not Double, Single or Sparse
 func (m *Matrix) DoubleArray() []float64 {
+	return m.doubleArray(m.value)
+}
+
+// ComplexArray is a convenience method to extract the matrix value as []complex128. The imaginary parts are zero if the
+// matrix is not complex. Warning: It panics if the matlab class is not Double, Single or Sparse
+func (m *Matrix) ComplexArray() []complex128 {
+	re := m.DoubleArray()
+	var im []float64
+	if m.flags.isComplex {
+		im = m.doubleArray(m.imag)
+	}
+	res := make([]complex128, len(re))
+	for i, r := range re {
+		if i < len(im) {
+			res[i] = complex(r, im[i])
+		} else {
+			res[i] = complex(r, 0)
+		}
+	}
+	return res
+}
+
+func (m *Matrix) doubleArray(values []interface{}) []float64 {
 	var res []float64
-	for _, e := range m.value {
+	for _, e := range values {
 		switch m.Class {
-		case mxDOUBLE:
-			res = append(res, e.(float64))
+		case mxDOUBLE, mxSPARSE:
+			res = append(res, toFloat64(e))
 		case mxSINGLE:
 			res = append(res, float64(e.(float32)))
 		default:
@@ -100,3 +324,105 @@ func (m *Matrix) String() []rune {
 func (m *Matrix) Struct() map[string]*Matrix {
 	return m.GetAtLocation(0).(map[string]*Matrix)
 }
+
+// castValues converts the values of a numeric sub element to the go type of the matrix class. Matlab may store values
+// in a smaller data type than the class when they fit, e.g. a double array holding small integers as miUINT8.
+func castValues(c mxClass, values []interface{}) []interface{} {
+	if c == mxCHAR {
+		if len(values) == 0 {
+			return values
+		}
+		if _, ok := values[0].(uint16); ok {
+			return values
+		}
+		// stored as code points, re-encode into utf16 code units
+		runes := make([]rune, len(values))
+		for i, v := range values {
+			runes[i] = rune(toInt64(v))
+		}
+		units := utf16.Encode(runes)
+		res := make([]interface{}, len(units))
+		for i, u := range units {
+			res[i] = u
+		}
+		return res
+	}
+	res := make([]interface{}, len(values))
+	for i, v := range values {
+		res[i] = castValue(c, v)
+	}
+	return res
+}
+
+func castValue(c mxClass, v interface{}) interface{} {
+	switch c {
+	case mxDOUBLE:
+		return toFloat64(v)
+	case mxSINGLE:
+		return float32(toFloat64(v))
+	case mxINT8:
+		return int8(toInt64(v))
+	case mxUINT8:
+		return uint8(toInt64(v))
+	case mxINT16:
+		return int16(toInt64(v))
+	case mxUINT16:
+		return uint16(toInt64(v))
+	case mxINT32:
+		return int32(toInt64(v))
+	case mxUINT32:
+		return uint32(toInt64(v))
+	case mxINT64:
+		return toInt64(v)
+	case mxUINT64:
+		if u, ok := v.(uint64); ok {
+			return u
+		}
+		return uint64(toInt64(v))
+	case mxCHAR:
+		return uint16(toInt64(v))
+	}
+	return v
+}
+
+func toFloat64(v interface{}) float64 {
+	switch x := v.(type) {
+	case float64:
+		return x
+	case float32:
+		return float64(x)
+	case uint64:
+		return float64(x)
+	}
+	return float64(toInt64(v))
+}
+
+func toInt64(v interface{}) int64 {
+	switch x := v.(type) {
+	case int8:
+		return int64(x)
+	case uint8:
+		return int64(x)
+	case int16:
+		return int64(x)
+	case uint16:
+		return int64(x)
+	case int32:
+		return int64(x)
+	case uint32:
+		return int64(x)
+	case int64:
+		return x
+	case uint64:
+		return int64(x)
+	case float32:
+		return int64(x)
+	case float64:
+		return int64(x)
+	case bool:
+		if x {
+			return 1
+		}
+	}
+	return 0
+}
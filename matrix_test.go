@@ -0,0 +1,63 @@
+package matlab
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatrixInfo(t *testing.T) {
+	c := &Matrix{Class: mxDOUBLE, Dimension: []int32{2, 3}, flags: Flags{isComplex: true}}
+	assert.Equal(t, "double", c.ClassName())
+	assert.Equal(t, 96, c.Bytes())
+	assert.True(t, c.IsComplex())
+
+	s := &Matrix{Class: mxSPARSE, Dimension: []int32{3, 2}, ir: []int{0, 2}, jc: []int{0, 1, 2}, flags: Flags{isLogical: true}}
+	assert.Equal(t, "logical", s.ClassName())
+	assert.Equal(t, 2*9+3*8, s.Bytes())
+	assert.True(t, s.IsSparse())
+
+	ch := &Matrix{Class: mxCHAR, Dimension: []int32{1, 5}, flags: Flags{isGlobal: true}}
+	assert.Equal(t, "char", ch.ClassName())
+	assert.Equal(t, 10, ch.Bytes())
+	assert.True(t, ch.IsGlobal())
+
+	cell := &Matrix{Class: mxCELL, Dimension: []int32{1, 2}, value: []interface{}{c, ch}}
+	assert.Equal(t, "cell", cell.ClassName())
+	assert.Equal(t, 106, cell.Bytes())
+}
+
+func TestNewMatrix(t *testing.T) {
+	m, err := NewMatrix("a", "int16", []int32{1, 3}, []float64{1, -2.4, 300}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{int16(1), int16(-2), int16(300)}, m.Value())
+	assert.Equal(t, "int16", m.ClassName())
+
+	m, err = NewMatrix("l", "logical", []int32{1, 2}, []float64{0, -3}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{uint8(0), uint8(1)}, m.Value())
+	assert.True(t, m.IsLogical())
+
+	m, err = NewMatrix("c", "single", []int32{1, 1}, []float64{1}, []float64{2})
+	assert.NoError(t, err)
+	assert.True(t, m.IsComplex())
+	assert.Equal(t, []interface{}{float32(2)}, m.ImagValue())
+
+	_, err = NewMatrix("x", "cell", []int32{1, 1}, []float64{1}, nil)
+	assert.EqualError(t, err, "cannot create a matrix of class cell, expects a numeric class or logical")
+	_, err = NewMatrix("x", "double", []int32{2, 2}, []float64{1}, nil)
+	assert.EqualError(t, err, "matrix x of dimensions [2 2] expects 4 values")
+	_, err = NewMatrix("x", "logical", []int32{1, 1}, []float64{1}, []float64{1})
+	assert.Error(t, err)
+
+	s, err := NewSparseMatrix("s", 3, 2, []int{2, 0}, []int{0, 1, 2}, []float64{5, 7}, nil)
+	assert.NoError(t, err)
+	assert.True(t, s.IsSparse())
+	assert.Equal(t, []float64{5, 7}, s.DoubleArray())
+	_, err = NewSparseMatrix("e", 0, 3, nil, []int{0, 0, 0, 0}, nil, nil)
+	assert.NoError(t, err)
+	_, err = NewSparseMatrix("s", 3, 2, []int{2, 0}, []int{1, 1, 2}, []float64{5, 7}, nil)
+	assert.Error(t, err)
+	_, err = NewSparseMatrix("s", 3, 2, []int{2, 0}, []int{0, 2, 1}, []float64{5, 7}, nil)
+	assert.Error(t, err)
+}
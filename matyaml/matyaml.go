@@ -0,0 +1,34 @@
+// Package matyaml parses validation schemas from YAML. It is a package of its own so that the matlab package doesn't
+// depend on a YAML parser.
+package matyaml
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/daniellowtw/matlab"
+	"gopkg.in/yaml.v3"
+)
+
+// ParseSchema parses a schema from YAML, or JSON as YAML is a superset of it, with the keys of matlab.ParseSchema:
+//
+//	variables:
+//	  fs: {class: double, dims: [1, 1]}
+//	  results:
+//	    class: struct
+//	    fields:
+//	      trials:
+//	        dims: [1, any]
+//	        fields:
+//	          signal: {class: cell, cells: {class: double|single, dims: [1, "100.."]}}
+func ParseSchema(data []byte) (*matlab.Schema, error) {
+	var v interface{}
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	js, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema: %v", err)
+	}
+	return matlab.ParseSchema(js)
+}
@@ -0,0 +1,74 @@
+package matyaml
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/daniellowtw/matlab"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSchema(t *testing.T) {
+	yes := true
+	expected := &matlab.Schema{Strict: true, Variables: map[string]*matlab.VarSchema{
+		"fs": {Class: "double", Dims: []matlab.Dim{matlab.ExactDim(1), matlab.ExactDim(1)}},
+		"results": {Class: "struct", Fields: map[string]*matlab.VarSchema{
+			"trials": {Optional: true, Dims: []matlab.Dim{{Min: 1, Max: 10}, matlab.AnyDim, {Min: 2, Max: -1}, {Min: 0, Max: 5}}},
+			"signal": {Complex: &yes, Cells: &matlab.VarSchema{Class: "numeric"}},
+		}},
+	}}
+
+	s, err := ParseSchema([]byte(`
+strict: true
+variables:
+  fs: {class: double, dims: [1, 1]}
+  results:
+    class: struct
+    fields:
+      trials: {optional: true, dims: [1..10, any, "2..", ..5]}
+      signal:
+        complex: true
+        cells: {class: numeric}
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, expected, s)
+
+	data, err := json.Marshal(expected)
+	assert.NoError(t, err)
+	s, err = ParseSchema(data)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, s)
+
+	for _, data := range []string{
+		`variables: [`,
+		`variables: {a: {clas: double}}`,
+		`variables: {a: {dims: [-1]}}`,
+	} {
+		_, err := ParseSchema([]byte(data))
+		assert.Error(t, err, data)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	file, err := os.Open("../testdata/varTypes.mat")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer file.Close()
+	f, err := matlab.NewFileFromReader(file)
+	assert.NoError(t, err)
+
+	s, err := ParseSchema([]byte(`
+variables:
+  x:
+    class: struct
+    fields:
+      chars: {class: char, dims: [1, "..5"]}
+  nothere: {optional: true}
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, []matlab.Violation{
+		{Path: "x.chars", Message: "dimension 2 is 11, expects ..5"},
+	}, matlab.Validate(f, s))
+}
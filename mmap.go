@@ -0,0 +1,245 @@
+package matlab
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"unsafe"
+)
+
+// MappedFile is a level 5 file mapped into memory by OpenMmap. Only the names, classes and dimensions of its variables
+// are read when it is opened. The values of uncompressed numeric variables can be used where they lie in the mapping,
+// so that large files can be accessed at random without reading them onto the heap.
+type MappedFile struct {
+	Header *Header
+
+	data  []byte
+	vars  []*MappedVar
+	unmap func([]byte) error
+}
+
+// MappedVar is a variable of a MappedFile
+type MappedVar struct {
+	Name      string
+	Dimension []int32
+
+	bo         binary.ByteOrder
+	class      mxClass
+	flags      Flags
+	elem       []byte // the top level element, including its tag
+	real, imag []byte // the values in the mapping, if they are stored as the data type of the class
+	closed     bool   // the file was closed, so the slices above point into unmapped memory
+}
+
+// newMappedFile reads the header and indexes the top level elements of a level 5 file held in data
+func newMappedFile(data []byte) (*MappedFile, error) {
+	f := &File{r: bytes.NewReader(data)}
+	if err := f.readHeader(); err != nil {
+		return nil, err
+	}
+	if f.Header.Level != "5.0" {
+		return nil, fmt.Errorf("can only map level 5 files, got a level %s file", f.Header.Level)
+	}
+	m := &MappedFile{Header: f.Header, data: data}
+	bo := f.Header.Endianess
+	for off := headerLen; off < len(data); {
+		if len(data)-off < 8 {
+			return nil, fmt.Errorf("file ends within the tag of the element at offset %d", off)
+		}
+		typ, n := DataType(bo.Uint32(data[off:])), int64(bo.Uint32(data[off+4:]))
+		if typ != DTmiMATRIX && typ != DTmiCOMPRESSED {
+			return nil, fmt.Errorf("expects top level elements to be of type %s or %s, got %s instead", DTmiMATRIX, DTmiCOMPRESSED, typ)
+		}
+		if n > int64(len(data)-off-8) {
+			return nil, fmt.Errorf("element at offset %d ends after the end of the file", off)
+		}
+		v := &MappedVar{bo: bo, elem: data[off : off+8+int(n)]}
+		if err := v.index(typ); err != nil {
+			return nil, fmt.Errorf("element at offset %d: %v", off, err)
+		}
+		m.vars = append(m.vars, v)
+		off += 8 + int(n)
+	}
+	return m, nil
+}
+
+// index reads the sub elements of a variable up to its name, and finds the real and imaginary values of uncompressed
+// numeric variables. Compressed variables are only inflated up to their name.
+func (v *MappedVar) index(typ DataType) error {
+	data := v.elem[8:]
+	br := bytes.NewReader(data)
+	var r io.Reader = br
+	if typ == DTmiCOMPRESSED {
+		cr, err := zlib.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer cr.Close()
+		if _, dt, _, err := readTag(v.bo, cr); err != nil {
+			return err
+		} else if dt != DTmiMATRIX {
+			return fmt.Errorf("expects compressed variable to hold a %s, got %s instead", DTmiMATRIX, dt)
+		}
+		r = cr
+	}
+	var err error
+	if v.flags, v.class, err = arrayFlags(v.bo, r); err != nil {
+		return err
+	}
+	if v.class != mxOPAQUE {
+		if v.Dimension, err = dimensionsArray(v.bo, r); err != nil {
+			return err
+		}
+	}
+	if v.Name, err = arrayName(v.bo, r); err != nil {
+		return err
+	}
+	if typ != DTmiMATRIX || !v.class.isNumeric() {
+		return nil
+	}
+	numel, ok := checkedNumel(v.Dimension)
+	if !ok {
+		return fmt.Errorf("invalid dimensions %v of matrix %s", v.Dimension, v.Name)
+	}
+	values := func() []byte {
+		pos := len(data) - br.Len()
+		sde, dt, p, err := readTag(v.bo, br)
+		if err != nil || sde != nil || dt != v.class.dataType() || p != numel*dt.NumBytes() || p > br.Len() {
+			return nil
+		}
+		br.Seek(int64(padTo64Bit(p)), io.SeekCurrent)
+		return data[pos+8 : pos+8+p]
+	}
+	if v.real = values(); v.real != nil && v.flags.isComplex {
+		if v.imag = values(); v.imag == nil {
+			v.real = nil
+		}
+	}
+	return nil
+}
+
+// Close unmaps the file. Slices returned by Real and Imag must not be used afterwards, and the variables of the file
+// cannot be read anymore.
+func (f *MappedFile) Close() error {
+	if f.data == nil {
+		return nil
+	}
+	for _, v := range f.vars {
+		v.closed = true
+		v.elem, v.real, v.imag = nil, nil, nil
+	}
+	data := f.data
+	f.data, f.vars = nil, nil
+	if f.unmap == nil {
+		return nil
+	}
+	return f.unmap(data)
+}
+
+// GetVarsNames returns the names of the variables in the order they appear in the file
+func (f *MappedFile) GetVarsNames() []string {
+	res := make([]string, len(f.vars))
+	for i, v := range f.vars {
+		res[i] = v.Name
+	}
+	return res
+}
+
+// Var returns the variable name
+func (f *MappedFile) Var(name string) (*MappedVar, bool) {
+	for _, v := range f.vars {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// ClassName returns the name matlab's class function gives the variable, e.g. "double" or "logical"
+func (v *MappedVar) ClassName() string {
+	return (&Matrix{Class: v.class, flags: v.flags}).ClassName()
+}
+
+// IsComplex tells whether the variable has imaginary values
+func (v *MappedVar) IsComplex() bool {
+	return v.flags.isComplex
+}
+
+// Matrix decodes the variable onto the heap, like File.GetVar does
+func (v *MappedVar) Matrix() (*Matrix, error) {
+	if v.closed {
+		return nil, fmt.Errorf("cannot read variable %s, the file is closed", v.Name)
+	}
+	el, err := newDecoder(v.bo, nil).readElement(bytes.NewReader(v.elem))
+	if err != nil {
+		return nil, err
+	}
+	m, ok := el.(*Matrix)
+	if !ok {
+		return nil, fmt.Errorf("expects variable %s to be a %s, got %s instead", v.Name, DTmiMATRIX, el.Type())
+	}
+	return m, nil
+}
+
+// Real returns the real values of an uncompressed numeric variable in column major order as a slice backed by the
+// mapping, e.g. []float64 for doubles and []uint8 for logical values. The slice must not be modified. It is not
+// available if the values are stored as a smaller data type, as matlab does for doubles that are whole numbers, if
+// they take up at most 4 bytes and are packed into their tag, if the byte order of the file is not the one of the
+// machine, or if the file is closed.
+func (v *MappedVar) Real() (interface{}, bool) {
+	return v.mapped(v.real)
+}
+
+// Imag returns the imaginary values of a complex variable like Real
+func (v *MappedVar) Imag() (interface{}, bool) {
+	return v.mapped(v.imag)
+}
+
+func (v *MappedVar) mapped(data []byte) (interface{}, bool) {
+	dt := v.class.dataType()
+	if v.closed || data == nil || v.bo != nativeOrder {
+		return nil, false
+	}
+	var p unsafe.Pointer
+	if len(data) > 0 {
+		p = unsafe.Pointer(&data[0])
+		if uintptr(p)%uintptr(dt.NumBytes()) != 0 {
+			return nil, false
+		}
+	}
+	n := len(data) / dt.NumBytes()
+	switch dt {
+	case DTmiDOUBLE:
+		return unsafe.Slice((*float64)(p), n), true
+	case DTmiSINGLE:
+		return unsafe.Slice((*float32)(p), n), true
+	case DTmiINT8:
+		return unsafe.Slice((*int8)(p), n), true
+	case DTmiUINT8:
+		return unsafe.Slice((*uint8)(p), n), true
+	case DTmiINT16:
+		return unsafe.Slice((*int16)(p), n), true
+	case DTmiUINT16:
+		return unsafe.Slice((*uint16)(p), n), true
+	case DTmiINT32:
+		return unsafe.Slice((*int32)(p), n), true
+	case DTmiUINT32:
+		return unsafe.Slice((*uint32)(p), n), true
+	case DTmiINT64:
+		return unsafe.Slice((*int64)(p), n), true
+	case DTmiUINT64:
+		return unsafe.Slice((*uint64)(p), n), true
+	}
+	return nil, false
+}
+
+// nativeOrder is the byte order of the machine
+var nativeOrder = func() binary.ByteOrder {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}()
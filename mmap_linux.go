@@ -0,0 +1,38 @@
+package matlab
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// OpenMmap maps the level 5 file at path into memory read only. Call Close to unmap it.
+func OpenMmap(path string) (*MappedFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	// the mapping stays valid after closing the file
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < headerLen {
+		return nil, fmt.Errorf("%s is too short to be a level 5 file", path)
+	}
+	if info.Size() != int64(int(info.Size())) {
+		return nil, fmt.Errorf("%s is too large to be mapped", path)
+	}
+	data, err := syscall.Mmap(int(file.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	m, err := newMappedFile(data)
+	if err != nil {
+		syscall.Munmap(data)
+		return nil, err
+	}
+	m.unmap = syscall.Munmap
+	return m, nil
+}
@@ -0,0 +1,115 @@
+package matlab
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenMmap(t *testing.T) {
+	a := &Matrix{Name: "a", Class: mxDOUBLE, Dimension: []int32{2, 3}, value: []interface{}{1.0, 2.0, 3.0, 4.0, 5.5, 6.0}}
+	b := &Matrix{Name: "b", Class: mxINT16, Dimension: []int32{1, 3}, flags: Flags{isComplex: true},
+		value: []interface{}{int16(1), int16(-2), int16(0)}, imag: []interface{}{int16(3), int16(4), int16(5)}}
+	l := &Matrix{Name: "l", Class: mxUINT8, Dimension: []int32{1, 5}, flags: Flags{isLogical: true},
+		value: []interface{}{uint8(1), uint8(0), uint8(0), uint8(1), uint8(1)}}
+	c := &Matrix{Name: "c", Class: mxCELL, Dimension: []int32{1, 1}, value: []interface{}{a}}
+	write := func(bo binary.ByteOrder) []byte {
+		var buf bytes.Buffer
+		w, err := NewFileFromWriter(&buf, &Header{Endianess: bo})
+		assert.NoError(t, err)
+		for _, m := range []*Matrix{a, b, l, c} {
+			assert.NoError(t, w.WriteElement(m))
+		}
+		return buf.Bytes()
+	}
+	path := filepath.Join(t.TempDir(), "a.mat")
+	// doubles that are whole numbers may be stored as smaller types
+	bo := binary.LittleEndian
+	flags, dims := make([]byte, 8), make([]byte, 8)
+	bo.PutUint32(flags, uint32(mxDOUBLE))
+	bo.PutUint32(dims, 1)
+	bo.PutUint32(dims[4:], 5)
+	var s []byte
+	s = append(s, packElement(bo, DTmiUINT32, flags)...)
+	s = append(s, packElement(bo, DTmiINT32, dims)...)
+	s = append(s, packElement(bo, DTmiINT8, []byte("s"))...)
+	s = append(s, packElement(bo, DTmiUINT8, []byte{1, 2, 3, 4, 5})...)
+	data := append(write(bo), packElement(bo, DTmiMATRIX, s)...)
+	z := compressedMatrix(t, &Matrix{Name: "z", Class: mxDOUBLE, Dimension: []int32{1, 1}, value: []interface{}{1.0}}, false)
+	data = append(data, z...)
+	assert.NoError(t, os.WriteFile(path, data, 0644))
+
+	f, err := OpenMmap(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "l", "c", "s", "z"}, f.GetVarsNames())
+	v, ok := f.Var("a")
+	assert.True(t, ok)
+	assert.Equal(t, "double", v.ClassName())
+	assert.Equal(t, []int32{2, 3}, v.Dimension)
+	real, ok := v.Real()
+	assert.True(t, ok)
+	assert.Equal(t, []float64{1, 2, 3, 4, 5.5, 6}, real)
+	_, ok = v.Imag()
+	assert.False(t, ok)
+
+	v, _ = f.Var("b")
+	assert.True(t, v.IsComplex())
+	real, _ = v.Real()
+	imag, _ := v.Imag()
+	assert.Equal(t, []int16{1, -2, 0}, real)
+	assert.Equal(t, []int16{3, 4, 5}, imag)
+
+	v, _ = f.Var("l")
+	assert.Equal(t, "logical", v.ClassName())
+	real, _ = v.Real()
+	assert.Equal(t, []uint8{1, 0, 0, 1, 1}, real)
+
+	for _, name := range []string{"c", "s", "z"} {
+		v, _ = f.Var(name)
+		_, ok = v.Real()
+		assert.False(t, ok, name)
+		m, err := v.Matrix()
+		assert.NoError(t, err, name)
+		assert.Equal(t, name, m.Name)
+	}
+	v, _ = f.Var("c")
+	m, _ := v.Matrix()
+	assert.Equal(t, a.value, m.value[0].(*Matrix).value)
+	v, _ = f.Var("s")
+	m, _ = v.Matrix()
+	assert.Equal(t, []interface{}{1.0, 2.0, 3.0, 4.0, 5.0}, m.value)
+	_, ok = f.Var("nothere")
+	assert.False(t, ok)
+	v, _ = f.Var("a")
+	assert.NoError(t, f.Close())
+	assert.NoError(t, f.Close())
+	// the variables point into the unmapped file
+	_, err = v.Matrix()
+	assert.EqualError(t, err, "cannot read variable a, the file is closed")
+	_, ok = v.Real()
+	assert.False(t, ok)
+
+	// values of another byte order have to be decoded
+	f, err = newMappedFile(write(binary.BigEndian))
+	assert.NoError(t, err)
+	v, _ = f.Var("a")
+	_, ok = v.Real()
+	assert.False(t, ok)
+	m, err = v.Matrix()
+	assert.NoError(t, err)
+	assert.Equal(t, a.value, m.value)
+
+	var v4 bytes.Buffer
+	_, err = NewFileFromWriter(&v4, &Header{Level: "4.0"})
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(path, append(v4.Bytes(), make([]byte, headerLen)...), 0644))
+	_, err = OpenMmap(path)
+	assert.Error(t, err)
+	_, err = newMappedFile(data[:len(data)-1])
+	assert.EqualError(t, err, fmt.Sprintf("element at offset %d ends after the end of the file", len(data)-len(z)))
+}
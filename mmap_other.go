@@ -0,0 +1,10 @@
+//go:build !linux
+
+package matlab
+
+import "fmt"
+
+// OpenMmap maps the level 5 file at path into memory. It is only supported on linux.
+func OpenMmap(path string) (*MappedFile, error) {
+	return nil, fmt.Errorf("cannot map %s, memory mapping is only supported on linux", path)
+}
@@ -0,0 +1,440 @@
+package matlab
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// NumPy .npy files start with a magic string, a version and the length of a header, which is a python dict literal
+// giving the dtype, the memory order and the shape of the array. The data follows, padded so that it starts at a
+// multiple of 64 bytes. See https://numpy.org/doc/stable/reference/generated/numpy.lib.format.html
+
+const (
+	npyMagic        = "\x93NUMPY"
+	npyAlignment    = 64
+	npyMaxHeaderLen = 1 << 20
+)
+
+var (
+	npyDescrRe   = regexp.MustCompile(`'descr':\s*'([^']*)'`)
+	npyFortranRe = regexp.MustCompile(`'fortran_order':\s*(True|False)`)
+	npyShapeRe   = regexp.MustCompile(`'shape':\s*\(([^)]*)\)`)
+)
+
+// WriteNpy writes a numeric, logical or char matrix as a .npy file in fortran order, so that the values keep the
+// column major layout of matlab. Logical matrices are stored as bool arrays. The rows of char matrices are stored as
+// unicode strings, so a 3x5 char matrix becomes an array of 3 strings of length 5. Cells, structs and sparse matrices
+// have no equivalent in numpy and give an error.
+func (m *Matrix) WriteNpy(w io.Writer) error {
+	if _, ok := m.Raw(); ok {
+		return fmt.Errorf("cannot store matrix %s of class %s in a npy file", m.Name, m.Class)
+	}
+	var descr string
+	var shape []int
+	var data []byte
+	bo := binary.LittleEndian
+	switch {
+	case m.Class == mxCHAR:
+		strs, width := charRows(m)
+		descr = fmt.Sprintf("<U%d", width)
+		shape = append([]int{int(m.Dimension[0])}, int32sToInts(m.Dimension[2:])...)
+		data = make([]byte, 4*width*len(strs))
+		for i, s := range strs {
+			for j, r := range s {
+				bo.PutUint32(data[4*(i*width+j):], uint32(r))
+			}
+		}
+	case m.Class.isNumeric():
+		size := m.Class.dataType().NumBytes()
+		descr = npyDescr(m.Class, m.flags.isLogical, size)
+		shape = int32sToInts(m.Dimension)
+		data = encodeValues(bo, m.Class, m.value)
+		if m.flags.isComplex {
+			if m.Class != mxDOUBLE && m.Class != mxSINGLE {
+				return fmt.Errorf("cannot store complex %s matrix %s in a npy file", m.Class.matlabName(), m.Name)
+			}
+			descr = fmt.Sprintf("<c%d", 2*size)
+			data = interleave(data, encodeValues(bo, m.Class, m.imag), size)
+		}
+	default:
+		return fmt.Errorf("cannot store matrix %s of class %s in a npy file", m.Name, m.Class)
+	}
+
+	dims := make([]string, len(shape))
+	for i, d := range shape {
+		dims[i] = strconv.Itoa(d)
+	}
+	shapeText := strings.Join(dims, ", ")
+	if len(shape) == 1 {
+		shapeText += ","
+	}
+	header := fmt.Sprintf("{'descr': '%s', 'fortran_order': True, 'shape': (%s), }", descr, shapeText)
+	// the header ends with a newline and is padded with spaces so that the data is aligned
+	prefixLen := len(npyMagic) + 4
+	version := []byte{1, 0}
+	if prefixLen+len(header)+1 > math.MaxUint16 {
+		prefixLen += 2
+		version = []byte{2, 0}
+	}
+	header += strings.Repeat(" ", (npyAlignment-(prefixLen+len(header)+1)%npyAlignment)%npyAlignment) + "\n"
+	buf := bytes.NewBufferString(npyMagic)
+	buf.Write(version)
+	if version[0] == 1 {
+		binary.Write(buf, bo, uint16(len(header)))
+	} else {
+		binary.Write(buf, bo, uint32(len(header)))
+	}
+	buf.WriteString(header)
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// npyDescr returns the dtype of values of class c, e.g. "<f8" for double
+func npyDescr(c mxClass, logical bool, size int) string {
+	kind := "u"
+	switch {
+	case logical:
+		return "|b1"
+	case c == mxDOUBLE || c == mxSINGLE:
+		kind = "f"
+	case c == mxINT8 || c == mxINT16 || c == mxINT32 || c == mxINT64:
+		kind = "i"
+	}
+	if size == 1 {
+		return "|" + kind + "1"
+	}
+	return fmt.Sprintf("<%s%d", kind, size)
+}
+
+// charRows splits a char matrix into the strings along its second dimension, in column major order of the other
+// dimensions. It also returns the length of the longest string, which is at least 1.
+func charRows(m *Matrix) ([][]rune, int) {
+	rows, cols := int(m.Dimension[0]), int(m.Dimension[1])
+	n := rows
+	for _, d := range m.Dimension[2:] {
+		n *= int(d)
+	}
+	res := make([][]rune, n)
+	width := 1
+	for k := 0; k < n; k++ {
+		i, page := k%rows, k/rows
+		units := make([]uint16, cols)
+		for j := range units {
+			if idx := i + rows*j + rows*cols*page; idx < len(m.value) {
+				units[j] = toUint16(m.value[idx])
+			}
+		}
+		res[k] = utf16.Decode(units)
+		if len(res[k]) > width {
+			width = len(res[k])
+		}
+	}
+	return res, width
+}
+
+func int32sToInts(values []int32) []int {
+	res := make([]int, len(values))
+	for i, v := range values {
+		res[i] = int(v)
+	}
+	return res
+}
+
+// ReadNpy reads a .npy file holding a bool, integer, floating point, complex or unicode array. One dimensional arrays
+// become row vectors. Unicode arrays become char matrices whose rows are the strings, the reverse of WriteNpy.
+func ReadNpy(r io.Reader) (*Matrix, error) {
+	prefix := make([]byte, len(npyMagic)+2)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, err
+	}
+	if string(prefix[:len(npyMagic)]) != npyMagic {
+		return nil, fmt.Errorf("not a npy file")
+	}
+	var headerLen int
+	switch prefix[len(npyMagic)] {
+	case 1:
+		var n uint16
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+			return nil, err
+		}
+		headerLen = int(n)
+	case 2, 3:
+		var n uint32
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+			return nil, err
+		}
+		if n > npyMaxHeaderLen {
+			return nil, fmt.Errorf("npy header too long: %d bytes", n)
+		}
+		headerLen = int(n)
+	default:
+		return nil, fmt.Errorf("unsupported npy version %d.%d", prefix[len(npyMagic)], prefix[len(npyMagic)+1])
+	}
+	header := make([]byte, headerLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	descr, fortranOrder, shape, err := parseNpyHeader(string(header))
+	if err != nil {
+		return nil, err
+	}
+
+	var bo binary.ByteOrder = binary.LittleEndian
+	if descr[0] == '>' {
+		bo = binary.BigEndian
+	} else if !strings.ContainsRune("<|=", rune(descr[0])) {
+		return nil, fmt.Errorf("unsupported npy dtype %s", descr)
+	}
+	kind := descr[1]
+	size, err := strconv.Atoi(descr[2:])
+	if err != nil || size <= 0 {
+		return nil, fmt.Errorf("unsupported npy dtype %s", descr)
+	}
+	n := 1
+	for _, d := range shape {
+		if d > 0 && n > maxInt/d {
+			return nil, fmt.Errorf("npy array too large")
+		}
+		n *= d
+	}
+	itemSize := size
+	if kind == 'U' {
+		itemSize = 4 * size
+	}
+	if n > 0 && itemSize > maxInt/n {
+		return nil, fmt.Errorf("npy array too large")
+	}
+	// read what is there rather than allocating what the header claims
+	data, err := ioutil.ReadAll(io.LimitReader(r, int64(n*itemSize)))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != n*itemSize {
+		return nil, fmt.Errorf("npy data truncated: expects %d bytes, got %d", n*itemSize, len(data))
+	}
+
+	m := &Matrix{}
+	if kind == 'U' {
+		strs := make([]interface{}, n)
+		for i := range strs {
+			runes := make([]rune, size)
+			for j := range runes {
+				runes[j] = rune(bo.Uint32(data[4*(i*size+j):]))
+			}
+			strs[i] = runes
+		}
+		if !fortranOrder {
+			strs = cToFortranOrder(strs, shape)
+		}
+		return charMatrix(strs, shape), nil
+	}
+
+	var class mxClass
+	switch {
+	case kind == 'b' && size == 1:
+		class, m.flags.isLogical = mxUINT8, true
+	case kind == 'f' && size == 8, kind == 'c' && size == 16:
+		class = mxDOUBLE
+	case kind == 'f' && size == 4, kind == 'c' && size == 8:
+		class = mxSINGLE
+	case kind == 'i' || kind == 'u':
+		for _, c := range []mxClass{mxINT8, mxUINT8, mxINT16, mxUINT16, mxINT32, mxUINT32, mxINT64, mxUINT64} {
+			if c.dataType().NumBytes() == size && npyDescr(c, false, size)[1] == kind {
+				class = c
+			}
+		}
+	}
+	if class == mxUNKNOWN {
+		return nil, fmt.Errorf("unsupported npy dtype %s", descr)
+	}
+	m.Class = class
+	dt := class.dataType()
+	parse := func(offset, stride int) ([]interface{}, error) {
+		values := make([]interface{}, n)
+		for i := range values {
+			v, err := parseContent(dt, bo, data[offset+i*stride:])
+			if err != nil {
+				return nil, err
+			}
+			if m.flags.isLogical && v != uint8(0) {
+				v = uint8(1)
+			}
+			values[i] = v
+		}
+		if !fortranOrder {
+			values = cToFortranOrder(values, shape)
+		}
+		return values, nil
+	}
+	if kind == 'c' {
+		m.flags.isComplex = true
+		part := dt.NumBytes()
+		if m.value, err = parse(0, 2*part); err != nil {
+			return nil, err
+		}
+		m.imag, err = parse(part, 2*part)
+	} else {
+		m.value, err = parse(0, size)
+	}
+	if err != nil {
+		return nil, err
+	}
+	m.Dimension = matlabShape(shape)
+	return m, nil
+}
+
+// parseNpyHeader returns the dtype, memory order and shape given by the header dict of a npy file
+func parseNpyHeader(header string) (descr string, fortranOrder bool, shape []int, err error) {
+	d, f, s := npyDescrRe.FindStringSubmatch(header), npyFortranRe.FindStringSubmatch(header), npyShapeRe.FindStringSubmatch(header)
+	if d == nil || f == nil || s == nil {
+		return "", false, nil, fmt.Errorf("invalid npy header %q", header)
+	}
+	if len(d[1]) < 3 {
+		return "", false, nil, fmt.Errorf("unsupported npy dtype %s", d[1])
+	}
+	for _, part := range strings.Split(s[1], ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		v, err := strconv.Atoi(part)
+		if err != nil || v < 0 || v > math.MaxInt32 {
+			return "", false, nil, fmt.Errorf("invalid npy shape (%s)", s[1])
+		}
+		shape = append(shape, v)
+	}
+	return d[1], f[1] == "True", shape, nil
+}
+
+// matlabShape returns the dimensions of a matrix holding an array of the given shape. Scalars become 1x1 and one
+// dimensional arrays row vectors.
+func matlabShape(shape []int) []int32 {
+	switch len(shape) {
+	case 0:
+		return []int32{1, 1}
+	case 1:
+		return []int32{1, int32(shape[0])}
+	}
+	dims := make([]int32, len(shape))
+	for i, d := range shape {
+		dims[i] = int32(d)
+	}
+	return dims
+}
+
+// cToFortranOrder reorders the values of an array of the given shape from row major to column major order
+func cToFortranOrder(values []interface{}, shape []int) []interface{} {
+	res := make([]interface{}, len(values))
+	index := make([]int, len(shape))
+	for k := range values {
+		// index is the position of values[k], where the last dimension varies fastest
+		pos, stride := 0, 1
+		for i, idx := range index {
+			pos += idx * stride
+			stride *= shape[i]
+		}
+		res[pos] = values[k]
+		for i := len(index) - 1; i >= 0; i-- {
+			if index[i]++; index[i] < shape[i] {
+				break
+			}
+			index[i] = 0
+		}
+	}
+	return res
+}
+
+// charMatrix builds a char matrix from strings in column major order, making the strings its rows. Trailing NULs
+// pad the strings in numpy and are removed unless a longer string needs them.
+func charMatrix(strs []interface{}, shape []int) *Matrix {
+	units := make([][]uint16, len(strs))
+	width := 0
+	for i, s := range strs {
+		runes := s.([]rune)
+		for len(runes) > 0 && runes[len(runes)-1] == 0 {
+			runes = runes[:len(runes)-1]
+		}
+		units[i] = utf16.Encode(runes)
+		if len(units[i]) > width {
+			width = len(units[i])
+		}
+	}
+	rows := 1
+	rest := shape
+	if len(shape) > 0 {
+		rows, rest = shape[0], shape[1:]
+	}
+	dims := append([]int32{int32(rows), int32(width)}, make([]int32, len(rest))...)
+	for i, d := range rest {
+		dims[i+2] = int32(d)
+	}
+	m := &Matrix{Class: mxCHAR, Dimension: dims, value: make([]interface{}, len(strs)*width)}
+	for k, u := range units {
+		i, page := k%rows, k/rows
+		for j := 0; j < width; j++ {
+			var c uint16
+			if j < len(u) {
+				c = u[j]
+			}
+			m.value[i+rows*j+rows*width*page] = c
+		}
+	}
+	return m
+}
+
+// WriteNpz writes matrices as a .npz archive like numpy's savez_compressed, holding a NAME.npy file for each
+// matrix. See WriteNpy for the matrices numpy can hold.
+func WriteNpz(w io.Writer, vars []*Matrix) error {
+	zw := zip.NewWriter(w)
+	for _, m := range vars {
+		if m.Name == "" {
+			return fmt.Errorf("cannot store a matrix without a name in a npz archive")
+		}
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: m.Name + ".npy", Method: zip.Deflate})
+		if err != nil {
+			return err
+		}
+		if err := m.WriteNpy(fw); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// ReadNpz reads the arrays of a .npz archive of the given size, named after their files without the .npy extension
+func ReadNpz(r io.ReaderAt, size int64) ([]*Matrix, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	var res []*Matrix
+	for _, f := range zr.File {
+		if !strings.HasSuffix(f.Name, ".npy") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		m, err := ReadNpy(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f.Name, err)
+		}
+		m.Name = strings.TrimSuffix(f.Name, ".npy")
+		res = append(res, m)
+	}
+	return res, nil
+}
@@ -0,0 +1,107 @@
+package matlab
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// npyFile lays out a npy file the way numpy does
+func npyFile(header string, data []byte) []byte {
+	header += strings.Repeat(" ", 63-(len(header)+10)%64) + "\n"
+	buf := bytes.NewBufferString("\x93NUMPY\x01\x00")
+	binary.Write(buf, binary.LittleEndian, uint16(len(header)))
+	buf.WriteString(header)
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+func TestWriteNpy(t *testing.T) {
+	m := &Matrix{Class: mxDOUBLE, Dimension: []int32{2, 3}, value: doubles(1, 2, 3, 4, 5, 6)}
+	var buf bytes.Buffer
+	assert.NoError(t, m.WriteNpy(&buf))
+	header := "{'descr': '<f8', 'fortran_order': True, 'shape': (2, 3), }"
+	assert.Equal(t, npyFile(header, encodeValues(binary.LittleEndian, mxDOUBLE, m.value)), buf.Bytes())
+
+	s := &Matrix{Class: mxCHAR, Dimension: []int32{1, 2}, value: castValues(mxCHAR, []interface{}{'h', 'é'})}
+	buf.Reset()
+	assert.NoError(t, s.WriteNpy(&buf))
+	assert.Equal(t, npyFile("{'descr': '<U2', 'fortran_order': True, 'shape': (1,), }", []byte("h\x00\x00\x00\xe9\x00\x00\x00")), buf.Bytes())
+
+	c := &Matrix{Class: mxINT8, Dimension: []int32{1, 1}, value: []interface{}{int8(1)}, imag: []interface{}{int8(2)}, flags: Flags{isComplex: true}}
+	assert.Error(t, c.WriteNpy(&buf))
+	assert.Error(t, (&Matrix{Class: mxCELL, Dimension: []int32{1, 1}}).WriteNpy(&buf))
+}
+
+func TestReadNpy(t *testing.T) {
+	// numpy writes arrays in C order by default
+	data := make([]byte, 12)
+	for i := 0; i < 6; i++ {
+		binary.LittleEndian.PutUint16(data[2*i:], uint16(i))
+	}
+	m, err := ReadNpy(bytes.NewReader(npyFile("{'descr': '<i2', 'fortran_order': False, 'shape': (2, 3), }", data)))
+	assert.NoError(t, err)
+	assert.Equal(t, mxINT16, m.Class)
+	assert.Equal(t, []int32{2, 3}, m.Dimension)
+	assert.Equal(t, []int64{0, 3, 1, 4, 2, 5}, m.IntArray())
+
+	m, err = ReadNpy(bytes.NewReader(npyFile("{'descr': '>c16', 'fortran_order': False, 'shape': (), }",
+		[]byte{0x3f, 0xf0, 0, 0, 0, 0, 0, 0, 0xc0, 0, 0, 0, 0, 0, 0, 0})))
+	assert.NoError(t, err)
+	assert.Equal(t, []int32{1, 1}, m.Dimension)
+	assert.Equal(t, []complex128{1 - 2i}, m.ComplexArray())
+
+	m, err = ReadNpy(bytes.NewReader(npyFile("{'descr': '|b1', 'fortran_order': False, 'shape': (3,), }", []byte{1, 0, 1})))
+	assert.NoError(t, err)
+	assert.True(t, m.IsLogical())
+	assert.Equal(t, []int32{1, 3}, m.Dimension)
+
+	m, err = ReadNpy(bytes.NewReader(npyFile("{'descr': '<U3', 'fortran_order': False, 'shape': (2,), }",
+		[]byte("a\x00\x00\x00b\x00\x00\x00\x00\x00\x00\x00x\x00\x00\x00y\x00\x00\x00z\x00\x00\x00"))))
+	assert.NoError(t, err)
+	assert.Equal(t, []int32{2, 3}, m.Dimension)
+	assert.Equal(t, "axby\x00z", string(m.String()))
+
+	for _, header := range []string{
+		"{'descr': '<f2', 'fortran_order': False, 'shape': (1,), }",
+		"{'descr': [('a', '<f8')], 'fortran_order': False, 'shape': (1,), }",
+		"{'descr': '<f8', 'fortran_order': False, 'shape': (-1,), }",
+		"{'descr': '<f8', 'fortran_order': False, 'shape': (2,), }",
+	} {
+		_, err := ReadNpy(bytes.NewReader(npyFile(header, make([]byte, 8))))
+		assert.Error(t, err, header)
+	}
+}
+
+func TestNpyRoundTrip(t *testing.T) {
+	for _, name := range []string{"varTypes", "matrices", "simpleTypes"} {
+		file, err := os.Open("testdata/" + name + ".mat")
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		defer file.Close()
+		f, err := NewFileFromReader(file)
+		assert.NoError(t, err)
+		var vars []*Matrix
+		for _, v := range f.GetVarsNames() {
+			m, _ := f.GetVar(v)
+			if m.Class == mxCHAR || m.Class.isNumeric() && (!m.flags.isComplex || m.Class == mxDOUBLE || m.Class == mxSINGLE) {
+				vars = append(vars, m)
+			}
+		}
+		var buf bytes.Buffer
+		assert.NoError(t, WriteNpz(&buf, vars))
+		res, err := ReadNpz(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		assert.NoError(t, err)
+		assert.Len(t, res, len(vars))
+		for i, m := range res {
+			expected := *vars[i]
+			expected.flags.isGlobal = false
+			assert.Equal(t, &expected, m, name+": "+m.Name)
+		}
+	}
+}
@@ -0,0 +1,857 @@
+package matlab
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Octave's text format, what its save command writes by default, lists each variable as comment lines of keywords
+// followed by the values:
+//
+//	# name: a
+//	# type: matrix
+//	# rows: 2
+//	# columns: 2
+//	 1 2
+//	 3 4
+//
+// Matrices of more than 2 dimensions give "# ndims:" and their dimensions instead of rows and columns, and then list
+// their values in column major order, one per line. Cells and structs nest variables of the same format.
+
+const (
+	octaveCellElement = "<cell-element>"
+)
+
+var octaveTimeLayouts = []string{"Mon Jan 02 15:04:05 2006 MST", "Mon Jan _2 15:04:05 2006 MST"}
+
+// readTextHeader parses the comment Octave starts text files with, e.g.
+// "# Created by Octave 6.4.0, Mon Oct 18 10:00:00 2021 UTC <user@host>"
+func (f *File) readTextHeader() error {
+	br := bufio.NewReader(f.r)
+	f.r = br
+	line, err := br.Peek(256)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return err
+	}
+	h := f.Header
+	h.Level = "text"
+	h.Endianess = binary.LittleEndian
+	first := string(line)
+	if i := strings.IndexByte(first, '\n'); i >= 0 {
+		first = first[:i]
+	}
+	if !strings.HasPrefix(first, "# Created by ") {
+		return nil
+	}
+	first = strings.TrimPrefix(first, "# Created by ")
+	i := strings.Index(first, ", ")
+	if i < 0 {
+		h.Platform = strings.TrimSpace(first)
+		return nil
+	}
+	h.Platform = first[:i]
+	date := first[i+2:]
+	if j := strings.Index(date, " <"); j >= 0 {
+		date = date[:j]
+	}
+	for _, layout := range octaveTimeLayouts {
+		if t, err := time.Parse(layout, strings.TrimSpace(date)); err == nil {
+			h.Created = t
+			break
+		}
+	}
+	return nil
+}
+
+// writeTextHeader writes the comment Octave starts text files with
+func writeTextHeader(w io.Writer, h *Header) error {
+	platform, created := h.Platform, h.Created
+	if platform == "" {
+		platform = "github.com/daniellowtw/matlab"
+	}
+	if created.IsZero() {
+		created = time.Now()
+	}
+	_, err := fmt.Fprintf(w, "# Created by %s, %s\n", platform, created.Format(octaveTimeLayouts[0]))
+	return err
+}
+
+// textReader reads the lines of an Octave text file
+type textReader struct {
+	r        *bufio.Reader
+	maxDepth int // nesting of cells and structs
+}
+
+// line returns the next line without its line break
+func (t *textReader) line() (string, error) {
+	s, err := t.r.ReadString('\n')
+	if err == io.EOF && s != "" {
+		err = nil
+	}
+	return strings.TrimRight(s, "\r\n"), err
+}
+
+// nonBlank returns the next line that isn't empty
+func (t *textReader) nonBlank() (string, error) {
+	for {
+		s, err := t.line()
+		if err != nil {
+			return "", err
+		}
+		if strings.TrimSpace(s) != "" {
+			return s, nil
+		}
+	}
+}
+
+// keyword returns the value of the next line, which has to be "# key: value"
+func (t *textReader) keyword(key string) (string, error) {
+	s, err := t.nonBlank()
+	if err != nil {
+		return "", unexpectedEOF(err)
+	}
+	if !strings.HasPrefix(s, "# "+key+":") {
+		return "", fmt.Errorf("expects keyword %s, got %q", key, s)
+	}
+	return strings.TrimSpace(strings.TrimPrefix(s, "# "+key+":")), nil
+}
+
+func (t *textReader) keywordInt(key string) (int, error) {
+	s, err := t.keyword(key)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || n > math.MaxInt32 {
+		return 0, fmt.Errorf("invalid %s %q", key, s)
+	}
+	return n, nil
+}
+
+// tokens returns the next n whitespace separated values, which may span several lines
+func (t *textReader) tokens(n int) ([]string, error) {
+	var res []string
+	for len(res) < n {
+		s, err := t.nonBlank()
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		res = append(res, strings.Fields(s)...)
+	}
+	if len(res) != n {
+		return nil, fmt.Errorf("expects %d values, got %d", n, len(res))
+	}
+	return res, nil
+}
+
+// dims reads either "# rows:" and "# columns:", or "# ndims:" followed by the dimensions. Values of matrices with rows
+// and columns are listed row by row.
+func (t *textReader) dims() (dims []int32, byRow bool, err error) {
+	s, err := t.nonBlank()
+	if err != nil {
+		return nil, false, unexpectedEOF(err)
+	}
+	if strings.HasPrefix(s, "# rows:") {
+		rows, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(s, "# rows:")))
+		if err != nil || rows < 0 || rows > math.MaxInt32 {
+			return nil, false, fmt.Errorf("invalid rows %q", s)
+		}
+		cols, err := t.keywordInt("columns")
+		if err != nil {
+			return nil, false, err
+		}
+		return []int32{int32(rows), int32(cols)}, true, nil
+	}
+	dims, err = t.ndims(s)
+	return dims, false, err
+}
+
+// ndims parses the line "# ndims: n" and reads the n dimensions that follow
+func (t *textReader) ndims(s string) ([]int32, error) {
+	if !strings.HasPrefix(s, "# ndims:") {
+		return nil, fmt.Errorf("expects dimensions, got %q", s)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(s, "# ndims:")))
+	if err != nil || n < 2 || n > 1024 {
+		return nil, fmt.Errorf("invalid ndims %q", s)
+	}
+	tokens, err := t.tokens(n)
+	if err != nil {
+		return nil, err
+	}
+	dims := make([]int32, n)
+	for i, tok := range tokens {
+		d, err := strconv.Atoi(tok)
+		if err != nil || d < 0 || d > math.MaxInt32 {
+			return nil, fmt.Errorf("invalid dimension %q", tok)
+		}
+		dims[i] = int32(d)
+	}
+	return dims, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func readAllTextMatrices(r io.Reader, maxDepth int) ([]Element, error) {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	t := &textReader{r: br, maxDepth: maxDepth}
+	var res []Element
+	for {
+		s, err := t.nonBlank()
+		if err == io.EOF {
+			return res, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(s, "# name:") {
+			// comments like the header
+			continue
+		}
+		name := strings.TrimSpace(strings.TrimPrefix(s, "# name:"))
+		m, err := t.value(name, 0)
+		if err != nil {
+			return nil, fmt.Errorf("variable %s: %v", name, err)
+		}
+		variableRead(r, name)
+		res = append(res, m)
+	}
+}
+
+// variable reads the name and the value of a variable within a cell or struct
+func (t *textReader) variable(depth int) (*Matrix, error) {
+	name, err := t.keyword("name")
+	if err != nil {
+		return nil, err
+	}
+	return t.value(name, depth)
+}
+
+// value reads the type and value of a variable whose name was read
+func (t *textReader) value(name string, depth int) (*Matrix, error) {
+	if depth > t.maxDepth {
+		return nil, fmt.Errorf("cells and structs nested too deep")
+	}
+	typ, err := t.keyword("type")
+	if err != nil {
+		return nil, err
+	}
+	m := &Matrix{Name: name, Class: mxDOUBLE, Dimension: []int32{1, 1}}
+	if strings.HasPrefix(typ, "global ") {
+		m.flags.isGlobal = true
+		typ = strings.TrimPrefix(typ, "global ")
+	}
+
+	words := strings.Fields(typ)
+	if len(words) > 1 {
+		// integer and single types start with the class, e.g. "int8 matrix" or "float complex scalar"
+		if words[0] == "float" {
+			m.Class, words = mxSINGLE, words[1:]
+		} else {
+			for c := mxINT8; c <= mxUINT64; c++ {
+				if words[0] == c.matlabName() {
+					m.Class, words = c, words[1:]
+				}
+			}
+		}
+	}
+	kind := strings.Join(words, " ")
+	byRow := false
+	switch kind {
+	case "scalar", "complex scalar", "bool":
+		m.flags.isComplex = kind == "complex scalar"
+		m.flags.isLogical = kind == "bool"
+	case "matrix", "complex matrix", "bool matrix":
+		m.flags.isComplex = kind == "complex matrix"
+		m.flags.isLogical = kind == "bool matrix"
+		if m.Dimension, byRow, err = t.dims(); err != nil {
+			return nil, err
+		}
+	case "string", "sq_string":
+		return t.chars(m)
+	case "null_matrix", "null_string", "null_sq_string":
+		m.Dimension = []int32{0, 0}
+		if kind != "null_matrix" {
+			m.Class = mxCHAR
+		}
+		m.value = []interface{}{}
+		return m, nil
+	case "range":
+		return t.rangeValues(m)
+	case "cell":
+		return t.cell(m, depth)
+	case "scalar struct", "struct":
+		return t.structure(m, kind == "scalar struct", depth)
+	case "sparse matrix", "sparse complex matrix", "sparse bool matrix":
+		m.flags.isComplex = kind == "sparse complex matrix"
+		m.flags.isLogical = kind == "sparse bool matrix"
+		return t.sparse(m)
+	default:
+		return nil, fmt.Errorf("cannot read Octave values of type %s", typ)
+	}
+	if m.flags.isLogical {
+		if m.Class != mxDOUBLE {
+			return nil, fmt.Errorf("cannot read Octave values of type %s", typ)
+		}
+		m.Class = mxUINT8
+	}
+	n := m.numel()
+	tokens, err := t.tokens(n)
+	if err != nil {
+		return nil, err
+	}
+	if byRow {
+		rows, cols := int(m.Dimension[0]), int(m.Dimension[1])
+		ordered := make([]string, n)
+		for i := 0; i < rows; i++ {
+			for j := 0; j < cols; j++ {
+				ordered[i+rows*j] = tokens[i*cols+j]
+			}
+		}
+		tokens = ordered
+	}
+	m.value = make([]interface{}, n)
+	if m.flags.isComplex {
+		m.imag = make([]interface{}, n)
+	}
+	for i, tok := range tokens {
+		switch {
+		case m.flags.isLogical:
+			m.value[i], err = parseTextBool(tok)
+		case m.flags.isComplex:
+			m.value[i], m.imag[i], err = parseTextComplex(m.Class, tok)
+		default:
+			m.value[i], err = parseTextNumber(m.Class, tok)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// parseTextNumber parses a value of class c, where floating point values may be Inf, -Inf, NaN or NA
+func parseTextNumber(c mxClass, s string) (interface{}, error) {
+	switch c {
+	case mxDOUBLE, mxSINGLE:
+		var v float64
+		switch s {
+		case "Inf":
+			v = math.Inf(1)
+		case "-Inf":
+			v = math.Inf(-1)
+		case "NaN", "NA":
+			v = math.NaN()
+		default:
+			var err error
+			if v, err = strconv.ParseFloat(s, 64); err != nil {
+				return nil, fmt.Errorf("invalid number %q", s)
+			}
+		}
+		return castValue(c, v), nil
+	case mxINT8, mxINT16, mxINT32, mxINT64:
+		v, err := strconv.ParseInt(s, 10, c.dataType().NumBytes()*8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value %q", c.matlabName(), s)
+		}
+		return castValue(c, v), nil
+	default:
+		v, err := strconv.ParseUint(s, 10, c.dataType().NumBytes()*8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value %q", c.matlabName(), s)
+		}
+		return castValue(c, v), nil
+	}
+}
+
+// parseTextBool parses a logical value, which is true for any number but 0
+func parseTextBool(s string) (interface{}, error) {
+	v, err := parseTextNumber(mxDOUBLE, s)
+	if err != nil {
+		return nil, err
+	}
+	if v.(float64) != 0 {
+		return uint8(1), nil
+	}
+	return uint8(0), nil
+}
+
+// parseTextComplex parses a complex value like (1,-2)
+func parseTextComplex(c mxClass, s string) (re, im interface{}, err error) {
+	parts := strings.Split(strings.TrimSuffix(strings.TrimPrefix(s, "("), ")"), ",")
+	if len(parts) != 2 || !strings.HasPrefix(s, "(") || !strings.HasSuffix(s, ")") {
+		return nil, nil, fmt.Errorf("invalid complex number %q", s)
+	}
+	if re, err = parseTextNumber(c, parts[0]); err != nil {
+		return nil, nil, err
+	}
+	im, err = parseTextNumber(c, parts[1])
+	return re, im, err
+}
+
+// chars reads a char matrix, whose rows follow "# length:" lines, or whose values follow "# ndims:" and the
+// dimensions. Octave strings are bytes, which are decoded as UTF-8.
+func (t *textReader) chars(m *Matrix) (*Matrix, error) {
+	m.Class = mxCHAR
+	s, err := t.nonBlank()
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if strings.HasPrefix(s, "# ndims:") {
+		if m.Dimension, err = t.ndims(s); err != nil {
+			return nil, err
+		}
+		data, err := t.bytes(m.numel())
+		if err != nil {
+			return nil, err
+		}
+		m.value = make([]interface{}, len(data))
+		for i, b := range data {
+			m.value[i] = uint16(b)
+		}
+		return m, nil
+	}
+	if !strings.HasPrefix(s, "# elements:") {
+		return nil, fmt.Errorf("expects keyword elements, got %q", s)
+	}
+	rows, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(s, "# elements:")))
+	if err != nil || rows < 0 || rows > math.MaxInt32 {
+		return nil, fmt.Errorf("invalid elements %q", s)
+	}
+	var lines [][]uint16
+	width := 0
+	for i := 0; i < rows; i++ {
+		length, err := t.keywordInt("length")
+		if err != nil {
+			return nil, err
+		}
+		data, err := t.bytes(length)
+		if err != nil {
+			return nil, err
+		}
+		var units []uint16
+		if utf8.Valid(data) {
+			units = utf16.Encode([]rune(string(data)))
+		} else {
+			units = make([]uint16, len(data))
+			for j, b := range data {
+				units[j] = uint16(b)
+			}
+		}
+		if len(units) > width {
+			width = len(units)
+		}
+		lines = append(lines, units)
+	}
+	if rows == 0 {
+		m.Dimension = []int32{0, 0}
+		m.value = []interface{}{}
+		return m, nil
+	}
+	m.Dimension = []int32{int32(rows), int32(width)}
+	m.value = make([]interface{}, rows*width)
+	for i, units := range lines {
+		for j := 0; j < width; j++ {
+			// rows of different lengths are padded with spaces
+			c := uint16(' ')
+			if j < len(units) {
+				c = units[j]
+			}
+			m.value[i+rows*j] = c
+		}
+	}
+	return m, nil
+}
+
+// bytes reads n bytes followed by a line break
+func (t *textReader) bytes(n int) ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, t.r, int64(n)); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if _, err := t.line(); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// rangeValues reads a range like 1:0.5:3, which is stored as its base, limit and increment
+func (t *textReader) rangeValues(m *Matrix) (*Matrix, error) {
+	if s, err := t.nonBlank(); err != nil {
+		return nil, unexpectedEOF(err)
+	} else if !strings.HasPrefix(s, "# base, limit, increment") {
+		return nil, fmt.Errorf("expects the base, limit and increment of a range, got %q", s)
+	}
+	tokens, err := t.tokens(3)
+	if err != nil {
+		return nil, err
+	}
+	var v [3]float64
+	for i, tok := range tokens {
+		x, err := parseTextNumber(mxDOUBLE, tok)
+		if err != nil {
+			return nil, err
+		}
+		v[i] = x.(float64)
+	}
+	base, limit, inc := v[0], v[1], v[2]
+	n := 0
+	if inc != 0 && !math.IsNaN(base+limit+inc) && (limit-base)/inc >= 0 {
+		n = int(math.Floor((limit-base)/inc*(1+1e-15))) + 1
+	}
+	if n > math.MaxInt32 {
+		return nil, fmt.Errorf("range too long")
+	}
+	m.Dimension = []int32{1, int32(n)}
+	m.value = make([]interface{}, n)
+	for i := range m.value {
+		m.value[i] = base + float64(i)*inc
+	}
+	return m, nil
+}
+
+// cell reads the elements of a cell array in column major order
+func (t *textReader) cell(m *Matrix, depth int) (*Matrix, error) {
+	m.Class = mxCELL
+	var err error
+	if m.Dimension, _, err = t.dims(); err != nil {
+		return nil, err
+	}
+	m.value = []interface{}{}
+	for i := 0; i < m.numel(); i++ {
+		c, err := t.variable(depth + 1)
+		if err != nil {
+			return nil, fmt.Errorf("cell %d: %v", i+1, err)
+		}
+		c.Name = ""
+		m.value = append(m.value, c)
+	}
+	return m, nil
+}
+
+// structure reads a struct. Scalar structs hold the value of each field, struct arrays hold a cell with the values of
+// each field.
+func (t *textReader) structure(m *Matrix, scalar bool, depth int) (*Matrix, error) {
+	m.Class = mxSTRUCT
+	var err error
+	if m.Dimension, _, err = t.dims(); err != nil {
+		return nil, err
+	}
+	n := m.numel()
+	if scalar && n != 1 {
+		return nil, fmt.Errorf("scalar struct of dimensions %s", dimString(m.Dimension))
+	}
+	numFields, err := t.keywordInt("length")
+	if err != nil {
+		return nil, err
+	}
+	elements := make([]map[string]*Matrix, 0)
+	for i := 0; i < n; i++ {
+		elements = append(elements, map[string]*Matrix{})
+	}
+	m.fields = []string{}
+	for i := 0; i < numFields; i++ {
+		v, err := t.variable(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		field := v.Name
+		m.fields = append(m.fields, field)
+		if scalar {
+			v.Name = ""
+			elements[0][field] = v
+			continue
+		}
+		if v.Class != mxCELL || len(v.value) != n {
+			return nil, fmt.Errorf("expects field %s of a struct array to be a cell with %d elements", field, n)
+		}
+		for j, c := range v.value {
+			elements[j][field] = c.(*Matrix)
+		}
+	}
+	m.value = make([]interface{}, n)
+	for i, e := range elements {
+		m.value[i] = e
+	}
+	return m, nil
+}
+
+// sparse reads the row, column and value of each nonzero element, with one based indices in column major order
+func (t *textReader) sparse(m *Matrix) (*Matrix, error) {
+	m.Class = mxSPARSE
+	nnz, err := t.keywordInt("nnz")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := t.keywordInt("rows")
+	if err != nil {
+		return nil, err
+	}
+	cols, err := t.keywordInt("columns")
+	if err != nil {
+		return nil, err
+	}
+	m.Dimension = []int32{int32(rows), int32(cols)}
+	m.jc = make([]int, cols+1)
+	m.ir, m.value = []int{}, []interface{}{}
+	if m.flags.isComplex {
+		m.imag = []interface{}{}
+	}
+	col := 0
+	for i := 0; i < nnz; i++ {
+		tokens, err := t.tokens(3)
+		if err != nil {
+			return nil, err
+		}
+		r, err1 := strconv.Atoi(tokens[0])
+		c, err2 := strconv.Atoi(tokens[1])
+		if err1 != nil || err2 != nil || r < 1 || r > rows || c < col || c > cols {
+			return nil, fmt.Errorf("invalid position (%s,%s) of a nonzero value", tokens[0], tokens[1])
+		}
+		for ; col < c; col++ {
+			m.jc[col] = i
+		}
+		m.ir = append(m.ir, r-1)
+		var re, im interface{}
+		switch {
+		case m.flags.isLogical:
+			re, err = parseTextBool(tokens[2])
+		case m.flags.isComplex:
+			re, im, err = parseTextComplex(mxDOUBLE, tokens[2])
+			m.imag = append(m.imag, im)
+		default:
+			re, err = parseTextNumber(mxDOUBLE, tokens[2])
+		}
+		if err != nil {
+			return nil, err
+		}
+		m.value = append(m.value, re)
+	}
+	for ; col <= cols; col++ {
+		m.jc[col] = nnz
+	}
+	return m, nil
+}
+
+// writeTextMatrix writes a variable in Octave's text format
+func writeTextMatrix(w io.Writer, m *Matrix) error {
+	var buf bytes.Buffer
+	if err := encodeText(&buf, m.Name, m, m.flags.isGlobal); err != nil {
+		return err
+	}
+	buf.WriteString("\n\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func encodeText(buf *bytes.Buffer, name string, m *Matrix, global bool) error {
+	if _, ok := m.Raw(); ok {
+		return fmt.Errorf("cannot write matrix %s of class %s as text", m.Name, m.Class)
+	}
+	fmt.Fprintf(buf, "# name: %s\n", name)
+	typ := func(t string) {
+		if global {
+			t = "global " + t
+		}
+		fmt.Fprintf(buf, "# type: %s\n", t)
+	}
+	dims := func() {
+		if len(m.Dimension) == 2 {
+			fmt.Fprintf(buf, "# rows: %d\n# columns: %d\n", m.Dimension[0], m.Dimension[1])
+			return
+		}
+		ndims(buf, m.Dimension)
+	}
+	n := m.numel()
+	if m.Class != mxSPARSE && len(m.value) != n || m.flags.isComplex && len(m.imag) != len(m.value) {
+		return fmt.Errorf("matrix %s has %d values but its dimensions need %d", m.Name, len(m.value), n)
+	}
+	switch m.Class {
+	case mxCELL:
+		typ("cell")
+		dims()
+		for _, v := range m.value {
+			c, ok := v.(*Matrix)
+			if !ok {
+				return fmt.Errorf("expects cells of %s to be matrices, got %T", m.Name, v)
+			}
+			if err := encodeText(buf, octaveCellElement, c, false); err != nil {
+				return err
+			}
+			buf.WriteString("\n")
+		}
+		return nil
+	case mxSTRUCT:
+		fields := m.FieldNames()
+		if n == 1 {
+			typ("scalar struct")
+		} else {
+			typ("struct")
+		}
+		ndims(buf, m.Dimension)
+		fmt.Fprintf(buf, "# length: %d\n", len(fields))
+		for _, f := range fields {
+			values := make([]interface{}, n)
+			for i, v := range m.value {
+				keys, ok := v.(map[string]*Matrix)
+				if !ok {
+					return fmt.Errorf("expects elements of struct %s to be maps, got %T", m.Name, v)
+				}
+				c := keys[f]
+				if c == nil {
+					// missing fields are written as empty arrays
+					c = &Matrix{Class: mxDOUBLE, Dimension: []int32{0, 0}}
+				}
+				values[i] = c
+			}
+			var err error
+			if n == 1 {
+				err = encodeText(buf, f, values[0].(*Matrix), false)
+			} else {
+				err = encodeText(buf, f, &Matrix{Class: mxCELL, Dimension: m.Dimension, value: values}, false)
+			}
+			if err != nil {
+				return err
+			}
+			buf.WriteString("\n\n")
+		}
+		return nil
+	case mxCHAR:
+		typ("sq_string")
+		if len(m.Dimension) != 2 {
+			ndims(buf, m.Dimension)
+			for _, v := range m.value {
+				u := toUint16(v)
+				if u > 0xff {
+					return fmt.Errorf("cannot write character %U of %s in a char array of more than 2 dimensions", u, m.Name)
+				}
+				buf.WriteByte(byte(u))
+			}
+			buf.WriteString("\n")
+			return nil
+		}
+		rows, cols := int(m.Dimension[0]), int(m.Dimension[1])
+		fmt.Fprintf(buf, "# elements: %d\n", rows)
+		for i := 0; i < rows; i++ {
+			units := make([]uint16, cols)
+			for j := range units {
+				units[j] = toUint16(m.value[i+rows*j])
+			}
+			s := string(utf16.Decode(units))
+			fmt.Fprintf(buf, "# length: %d\n%s\n", len(s), s)
+		}
+		return nil
+	case mxSPARSE:
+		kind := "sparse matrix"
+		valueClass := mxDOUBLE
+		if m.flags.isLogical {
+			kind, valueClass = "sparse bool matrix", mxUINT8
+		} else if m.flags.isComplex {
+			kind = "sparse complex matrix"
+		}
+		typ(kind)
+		if len(m.Dimension) != 2 || len(m.jc) != int(m.Dimension[1])+1 || len(m.ir) != len(m.value) {
+			return fmt.Errorf("invalid sparse matrix %s", m.Name)
+		}
+		fmt.Fprintf(buf, "# nnz: %d\n# rows: %d\n# columns: %d\n", len(m.ir), m.Dimension[0], m.Dimension[1])
+		for col := 0; col+1 < len(m.jc); col++ {
+			for i := m.jc[col]; i < m.jc[col+1] && i < len(m.ir); i++ {
+				fmt.Fprintf(buf, "%d %d %s\n", m.ir[i]+1, col+1, formatTextValue(valueClass, m.value[i], m.imag, i))
+			}
+		}
+		return nil
+	}
+	if !m.Class.isNumeric() {
+		return fmt.Errorf("cannot write matrix %s of class %s as text", m.Name, m.Class)
+	}
+
+	kind := "scalar"
+	if n != 1 {
+		kind = "matrix"
+	}
+	switch {
+	case m.flags.isLogical:
+		if kind == "scalar" {
+			kind = "bool"
+		} else {
+			kind = "bool matrix"
+		}
+	case m.flags.isComplex && m.Class != mxDOUBLE && m.Class != mxSINGLE:
+		return fmt.Errorf("cannot write complex %s matrix %s as text", m.Class.matlabName(), m.Name)
+	case m.flags.isComplex:
+		kind = "complex " + kind
+	}
+	if m.Class == mxSINGLE {
+		kind = "float " + kind
+	} else if m.Class != mxDOUBLE && !m.flags.isLogical {
+		kind = m.Class.matlabName() + " " + kind
+	}
+	typ(kind)
+	if n == 1 && !strings.HasSuffix(kind, "matrix") {
+		fmt.Fprintf(buf, "%s\n", formatTextValue(m.Class, m.value[0], m.imag, 0))
+		return nil
+	}
+	isInt := m.Class != mxDOUBLE && m.Class != mxSINGLE && !m.flags.isLogical
+	if len(m.Dimension) != 2 || isInt {
+		// integer matrices always list their values in column major order
+		ndims(buf, m.Dimension)
+		for i, v := range m.value {
+			fmt.Fprintf(buf, " %s\n", formatTextValue(m.Class, v, m.imag, i))
+		}
+		return nil
+	}
+	dims()
+	rows, cols := int(m.Dimension[0]), int(m.Dimension[1])
+	for i := 0; i < rows; i++ {
+		for j := 0; j < cols; j++ {
+			fmt.Fprintf(buf, " %s", formatTextValue(m.Class, m.value[i+rows*j], m.imag, i+rows*j))
+		}
+		buf.WriteString("\n")
+	}
+	return nil
+}
+
+func ndims(buf *bytes.Buffer, dims []int32) {
+	fmt.Fprintf(buf, "# ndims: %d\n", len(dims))
+	for _, d := range dims {
+		fmt.Fprintf(buf, " %d", d)
+	}
+	buf.WriteString("\n")
+}
+
+// formatTextValue formats value i of a matrix of class c, with its imaginary part if imag isn't nil
+func formatTextValue(c mxClass, v interface{}, imag []interface{}, i int) string {
+	format := func(v interface{}) string {
+		if c != mxDOUBLE && c != mxSINGLE {
+			return fmt.Sprint(v)
+		}
+		f := toFloat64(v)
+		if s, ok := nonFinite(f); ok {
+			return s
+		}
+		if c == mxSINGLE {
+			return strconv.FormatFloat(f, 'g', -1, 32)
+		}
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	if imag == nil {
+		return format(v)
+	}
+	return "(" + format(v) + "," + format(imag[i]) + ")"
+}
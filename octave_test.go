@@ -0,0 +1,240 @@
+package matlab
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const octaveText = `# Created by Octave 6.4.0, Mon Oct 18 10:00:00 2021 UTC <user@host>
+# name: s
+# type: scalar
+2.5
+
+
+# name: m
+# type: matrix
+# rows: 2
+# columns: 3
+ 1 2 3
+ 4 Inf NaN
+
+
+# name: n
+# type: matrix
+# ndims: 3
+ 1 2 2
+ 1
+ 2
+ 3
+ 4
+
+
+# name: z
+# type: complex scalar
+(1,-2)
+
+
+# name: str
+# type: sq_string
+# elements: 2
+# length: 3
+abc
+# length: 3
+d
+f
+
+
+# name: b
+# type: bool matrix
+# rows: 1
+# columns: 2
+ 1 0
+
+
+# name: i
+# type: global int16 matrix
+# ndims: 2
+ 2 1
+ -3
+ 7
+
+
+# name: r
+# type: range
+# base, limit, increment
+1 2 0.5
+
+
+# name: c
+# type: cell
+# rows: 1
+# columns: 2
+# name: <cell-element>
+# type: scalar
+1
+
+# name: <cell-element>
+# type: string
+# elements: 1
+# length: 2
+hi
+
+
+
+# name: st
+# type: scalar struct
+# ndims: 2
+ 1 1
+# length: 2
+# name: x
+# type: scalar
+1
+
+
+# name: y
+# type: float matrix
+# rows: 1
+# columns: 2
+ 0.5 2
+
+
+
+
+# name: sa
+# type: struct
+# ndims: 2
+ 1 2
+# length: 1
+# name: a
+# type: cell
+# rows: 1
+# columns: 2
+# name: <cell-element>
+# type: bool
+1
+
+# name: <cell-element>
+# type: uint8 scalar
+200
+
+
+
+
+
+# name: sp
+# type: sparse matrix
+# nnz: 2
+# rows: 3
+# columns: 4
+2 1 5
+1 3 6
+
+
+`
+
+func TestReadOctaveText(t *testing.T) {
+	f, err := NewFileFromReader(strings.NewReader(octaveText))
+	assert.NoError(t, err)
+	assert.Equal(t, "text", f.Header.Level)
+	assert.Equal(t, "Octave 6.4.0", f.Header.Platform)
+	assert.Equal(t, 2021, f.Header.Created.Year())
+	assert.ElementsMatch(t, []string{"s", "m", "n", "z", "str", "b", "i", "r", "c", "st", "sa", "sp"}, f.GetVarsNames())
+
+	s, _ := f.GetVar("s")
+	assert.Equal(t, []float64{2.5}, s.DoubleArray())
+	m, _ := f.GetVar("m")
+	assert.Equal(t, []int32{2, 3}, m.Dimension)
+	values := m.DoubleArray()
+	assert.Equal(t, []float64{1, 4, 2, math.Inf(1), 3}, values[:5])
+	assert.True(t, math.IsNaN(values[5]))
+	n, _ := f.GetVar("n")
+	assert.Equal(t, []int32{1, 2, 2}, n.Dimension)
+	assert.Equal(t, []float64{1, 2, 3, 4}, n.DoubleArray())
+	z, _ := f.GetVar("z")
+	assert.Equal(t, []complex128{1 - 2i}, z.ComplexArray())
+	str, _ := f.GetVar("str")
+	assert.Equal(t, []int32{2, 3}, str.Dimension)
+	assert.Equal(t, []rune("adb\ncf"), str.String())
+	b, _ := f.GetVar("b")
+	assert.Equal(t, &Matrix{Name: "b", Class: mxUINT8, Dimension: []int32{1, 2}, flags: Flags{isLogical: true}, value: []interface{}{uint8(1), uint8(0)}}, b)
+	i, _ := f.GetVar("i")
+	assert.Equal(t, &Matrix{Name: "i", Class: mxINT16, Dimension: []int32{2, 1}, flags: Flags{isGlobal: true}, value: []interface{}{int16(-3), int16(7)}}, i)
+	r, _ := f.GetVar("r")
+	assert.Equal(t, []float64{1, 1.5, 2}, r.DoubleArray())
+
+	c, _ := f.GetVar("c")
+	assert.Equal(t, mxCELL, c.Class)
+	assert.Equal(t, []float64{1}, c.GetAtLocation(0).(*Matrix).DoubleArray())
+	assert.Equal(t, []rune("hi"), c.GetAtLocation(1).(*Matrix).String())
+	st, _ := f.GetVar("st")
+	assert.Equal(t, []string{"x", "y"}, st.FieldNames())
+	assert.Equal(t, &Matrix{Class: mxSINGLE, Dimension: []int32{1, 2}, value: []interface{}{float32(0.5), float32(2)}}, st.Struct()["y"])
+	sa, _ := f.GetVar("sa")
+	assert.Equal(t, []int32{1, 2}, sa.Dimension)
+	assert.Equal(t, []interface{}{uint8(200)}, sa.GetAtLocation(1).(map[string]*Matrix)["a"].value)
+
+	sp, _ := f.GetVar("sp")
+	assert.Equal(t, &Matrix{Name: "sp", Class: mxSPARSE, Dimension: []int32{3, 4}, value: []interface{}{5.0, 6.0}, ir: []int{1, 0}, jc: []int{0, 1, 1, 2, 2}}, sp)
+}
+
+func TestReadOctaveTextErrors(t *testing.T) {
+	for _, data := range []string{
+		"# name: a\n# type: matrix\n# rows: 2\n# columns: 2\n 1 2\n",
+		"# name: a\n# type: function handle\n@sin\n",
+		"# name: a\n# type: complex scalar\n1\n",
+		"# name: a\n# type: int8 scalar\n300\n",
+		"# name: a\n# type: sparse matrix\n# nnz: 1\n# rows: 1\n# columns: 1\n2 1 1\n",
+		"# name: a\n# type: cell\n# rows: 1\n# columns: 1\n",
+		"# name: a\n# type: sq_string\n# elements: 1\n# length: 10\nab\n",
+	} {
+		f, err := NewFileFromReader(strings.NewReader(data))
+		assert.NoError(t, err)
+		f.GetVarsNames()
+		assert.Error(t, f.Err(), data)
+	}
+}
+
+func TestWriteOctaveText(t *testing.T) {
+	for _, name := range []string{"varTypes", "mixedCells", "simpleStruct"} {
+		file, err := os.Open("testdata/" + name + ".mat")
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		defer file.Close()
+		f, err := NewFileFromReader(file)
+		assert.NoError(t, err)
+
+		var buf bytes.Buffer
+		w, err := NewFileFromWriter(&buf, &Header{Level: "text"})
+		assert.NoError(t, err)
+		for _, v := range f.GetVarsNames() {
+			m, _ := f.GetVar(v)
+			assert.NoError(t, w.WriteElement(m))
+		}
+		assert.True(t, strings.HasPrefix(buf.String(), "# Created by "))
+
+		f2, err := NewFileFromReader(&buf)
+		assert.NoError(t, err)
+		assert.Equal(t, "text", f2.Header.Level)
+		assert.ElementsMatch(t, f.GetVarsNames(), f2.GetVarsNames())
+		for _, v := range f.GetVarsNames() {
+			m, _ := f.GetVar(v)
+			m2, _ := f2.GetVar(v)
+			assert.Equal(t, m, m2, name+": "+v)
+		}
+	}
+
+	var buf bytes.Buffer
+	w, err := NewFileFromWriter(&buf, &Header{Level: "text", Platform: "test"})
+	assert.NoError(t, err)
+	assert.Error(t, w.WriteElement(&Matrix{Name: "x", Class: mxINT8, Dimension: []int32{1, 1}, flags: Flags{isComplex: true},
+		value: []interface{}{int8(1)}, imag: []interface{}{int8(1)}}))
+	assert.NoError(t, w.WriteElement(&Matrix{Name: "g", Class: mxDOUBLE, Dimension: []int32{1, 2}, flags: Flags{isGlobal: true},
+		value: []interface{}{0.1, math.Inf(-1)}}))
+	assert.Contains(t, buf.String(), "# name: g\n# type: global matrix\n# rows: 1\n# columns: 2\n 0.1 -Inf\n")
+}
@@ -0,0 +1,132 @@
+package matlab
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Progress tells a ReaderOptions.Progress callback how far reading the variables got
+type Progress struct {
+	Read int64  // bytes read after the header, 0 for v7.3 files which are not read in order
+	Name string // the variable being read, empty while its name is not known
+}
+
+// progressInterval is the number of bytes after which progress is reported within a variable
+const progressInterval = 1 << 20
+
+// GetVarContext returns a variable like GetVar. If the variables have not been read yet, it reads them like
+// ReadAllContext, and reports ctx's error if ctx is done before that completes.
+func (f *File) GetVarContext(ctx context.Context, name string) (*Matrix, error) {
+	if err := f.ReadAllContext(ctx); err != nil {
+		return nil, err
+	}
+	m, ok := f.vars[name]
+	if !ok {
+		return nil, fmt.Errorf("variable %s not found", name)
+	}
+	return m, nil
+}
+
+// ReadAllContext reads all variables like ReadAll, decoding them one by one on the calling goroutine. Cancelling ctx
+// stops reading between elements, between the chunks of large elements and within the decoding of large numeric
+// arrays.
+func (f *File) ReadAllContext(ctx context.Context) error {
+	return f.readAllContext(ctx, 0)
+}
+
+// progressReader reads a file, failing once ctx is done, and reports the progress to report, which may be nil
+type progressReader struct {
+	r      io.Reader
+	ctx    context.Context
+	report func(Progress)
+	read   int64
+	next   int64 // read at which progress is reported next
+	name   string
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	if err := p.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := p.r.Read(b)
+	p.read += int64(n)
+	if p.read >= p.next {
+		p.progress()
+	}
+	return n, err
+}
+
+// Len tells the bytes left if the file can, so that lengths beyond its end still fail straight away
+func (p *progressReader) Len() int {
+	if l, ok := p.r.(interface{ Len() int }); ok {
+		return l.Len()
+	}
+	return maxInt
+}
+
+// progress reports the bytes read so far and the variable being read
+func (p *progressReader) progress() {
+	if p.report != nil {
+		p.report(Progress{Read: p.read, Name: p.name})
+	}
+	p.next = p.read + progressInterval
+}
+
+// variableRead reports that the variable name has been read, if r reports progress
+func variableRead(r io.Reader, name string) {
+	if p, ok := r.(*progressReader); ok {
+		p.name = name
+		p.progress()
+		p.name = ""
+	}
+}
+
+// readNamed reads the p bytes of a top level element like readData, reporting the name of its variable from the first
+// bytes before reading the rest. name returns the name from the first bytes, or "" if it cannot tell.
+func (d *decoder) readNamed(p int, r io.Reader, name func(bo binary.ByteOrder, head []byte) string) ([]byte, error) {
+	if d.progress == nil || d.depth > 0 {
+		return readData(p, r)
+	}
+	head, err := readData(minInt(p, 512), r)
+	if err != nil {
+		return nil, err
+	}
+	d.progress.name = name(d.bo, head)
+	d.progress.progress()
+	return appendBytes(head, p, r)
+}
+
+// matrixName returns the name of a matrix from the first bytes of its data
+func matrixName(bo binary.ByteOrder, head []byte) string {
+	r := bytes.NewBuffer(head)
+	_, class, err := arrayFlags(bo, r)
+	if err != nil {
+		return ""
+	}
+	if class != mxOPAQUE {
+		if _, err := dimensionsArray(bo, r); err != nil {
+			return ""
+		}
+	}
+	name, _ := arrayName(bo, r)
+	return name
+}
+
+// compressedName returns the name of a compressed matrix from the first bytes of a compressed element
+func compressedName(bo binary.ByteOrder, head []byte) string {
+	cr, err := zlib.NewReader(bytes.NewReader(head))
+	if err != nil {
+		return ""
+	}
+	defer cr.Close()
+	buf := make([]byte, 8+512)
+	n, _ := io.ReadFull(cr, buf)
+	if n < 8 || DataType(bo.Uint32(buf)) != DTmiMATRIX {
+		return ""
+	}
+	return matrixName(bo, buf[8:n])
+}
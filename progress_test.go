@@ -0,0 +1,100 @@
+package matlab
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadAllContext(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewFileFromWriter(&buf, nil)
+	assert.NoError(t, err)
+	big := &Matrix{Name: "big", Class: mxDOUBLE, Dimension: []int32{1, 300000}}
+	for i := 0; i < 300000; i++ {
+		big.value = append(big.value, float64(i))
+	}
+	assert.NoError(t, w.WriteElement(big))
+	small := &Matrix{Name: "small", Class: mxDOUBLE, Dimension: []int32{1, 1}, value: []interface{}{1.0}}
+	file := append(buf.Bytes(), compressedMatrix(t, small, false)...)
+
+	var progress []Progress
+	f, err := NewFileFromReaderWithOptions(bytes.NewReader(file), &ReaderOptions{Progress: func(p Progress) {
+		progress = append(progress, p)
+	}})
+	assert.NoError(t, err)
+	assert.NoError(t, f.ReadAllContext(context.Background()))
+	var names []string
+	for i, p := range progress {
+		if i > 0 {
+			assert.True(t, p.Read >= progress[i-1].Read)
+		}
+		if p.Name != "" && (len(names) == 0 || names[len(names)-1] != p.Name) {
+			names = append(names, p.Name)
+		}
+	}
+	assert.Equal(t, []string{"big", "small"}, names)
+	assert.True(t, len(progress) > 4, "reports progress within big")
+	assert.Equal(t, Progress{Read: int64(len(file) - headerLen), Name: "small"}, progress[len(progress)-1])
+	var concurrent []Progress
+	f2, err := NewFileFromReaderWithOptions(bytes.NewReader(file), &ReaderOptions{Progress: func(p Progress) {
+		concurrent = append(concurrent, p)
+	}})
+	assert.NoError(t, err)
+	assert.NoError(t, f2.ReadAll(context.Background(), &ReadAllOptions{Concurrency: 4}))
+	assert.Equal(t, progress, concurrent)
+
+	m, err := f.GetVarContext(context.Background(), "small")
+	assert.NoError(t, err)
+	assert.Equal(t, small.value, m.value)
+	_, err = f.GetVarContext(context.Background(), "nothere")
+	assert.EqualError(t, err, "variable nothere not found")
+
+	// cancelling stops within big
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var last Progress
+	f, err = NewFileFromReaderWithOptions(bytes.NewReader(file), &ReaderOptions{Progress: func(p Progress) {
+		last = p
+		if p.Read > 1<<20 {
+			cancel()
+		}
+	}})
+	assert.NoError(t, err)
+	_, err = f.GetVarContext(ctx, "small")
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, "big", last.Name)
+	assert.Equal(t, context.Canceled, f.Err())
+
+	// and within decoding large arrays
+	d := newDecoder(binary.LittleEndian, nil)
+	d.ctx = ctx
+	_, err = d.parseMulti(DTmiDOUBLE, make([]byte, 8*(parseBlock+1)), parseBlock+1)
+	assert.Equal(t, context.Canceled, err)
+
+	// other formats report their variables
+	var v4 bytes.Buffer
+	w, err = NewFileFromWriter(&v4, &Header{Level: "4.0"})
+	assert.NoError(t, err)
+	assert.NoError(t, w.WriteElement(small))
+	assert.NoError(t, w.WriteElement(&Matrix{Name: "a", Class: mxDOUBLE, Dimension: []int32{1, 1}, value: []interface{}{2.0}}))
+	for _, data := range []string{octaveText, v4.String()} {
+		names = nil
+		f, err := NewFileFromReaderWithOptions(strings.NewReader(data), &ReaderOptions{Progress: func(p Progress) {
+			if p.Name != "" {
+				names = append(names, p.Name)
+			}
+		}})
+		assert.NoError(t, err)
+		assert.NoError(t, f.ReadAllContext(context.Background()))
+		expected := f.GetVarsNames()
+		sort.Strings(expected)
+		sort.Strings(names)
+		assert.Equal(t, expected, names)
+	}
+}
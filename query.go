@@ -0,0 +1,456 @@
+package matlab
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Query returns the part of a variable a matlab expression refers to, e.g. "results.trials(3).signal{2}(1:10,:)".
+// Expressions consist of the variable name followed by field names, indices in parentheses and cell indices in braces.
+// An index is a number, a range like 2:2:end, or a colon for a whole dimension, where end may be offset like end-1.
+// The result is a new matrix named after the last variable or field name in the expression, which shares cells,
+// fields and values with the variable.
+func (f *File) Query(expr string) (*Matrix, error) {
+	p := &queryParser{expr: expr}
+	p.skipSpace()
+	name := p.ident()
+	if name == "" {
+		return nil, p.errorf("expects a variable name")
+	}
+	m, ok := f.GetVar(name)
+	if !ok {
+		if err := f.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("variable %s not found", name)
+	}
+	return m.get(p)
+}
+
+// Get returns the part of a matrix a path like ".trials(3).signal{2}(1:10,:)" refers to, with the same syntax as
+// Query. The leading dot of a field name may be left out.
+func (m *Matrix) Get(path string) (*Matrix, error) {
+	p := &queryParser{expr: path}
+	p.skipSpace()
+	res := m
+	if name := p.ident(); name != "" {
+		var err error
+		if res, err = m.field(name); err != nil {
+			return nil, p.errorf("%v", err)
+		}
+	}
+	return res.get(p)
+}
+
+// get applies the rest of the parsed expression to m
+func (m *Matrix) get(p *queryParser) (*Matrix, error) {
+	res := m
+	for {
+		p.skipSpace()
+		if p.done() {
+			return res, nil
+		}
+		var err error
+		switch c := p.expr[p.pos]; c {
+		case '.':
+			p.pos++
+			p.skipSpace()
+			name := p.ident()
+			if name == "" {
+				return nil, p.errorf("expects a field name")
+			}
+			res, err = res.field(name)
+		case '(', '{':
+			p.pos++
+			var subs []querySubscript
+			if subs, err = p.subscripts(c); err != nil {
+				return nil, err
+			}
+			if c == '(' {
+				res, err = res.index(subs)
+			} else {
+				res, err = res.cellIndex(subs)
+			}
+		default:
+			return nil, p.errorf("unexpected %q", c)
+		}
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+	}
+}
+
+// field returns the value of a field of a struct with a single element
+func (m *Matrix) field(name string) (*Matrix, error) {
+	if m.Class != mxSTRUCT {
+		return nil, fmt.Errorf("%s is a %s, not a struct", m.Name, m.ClassName())
+	}
+	if n := m.numel(); n != 1 || len(m.value) != 1 {
+		return nil, fmt.Errorf("%s is a %s struct array, index it to access field %s", m.Name, dimString(m.Dimension), name)
+	}
+	keys, _ := m.value[0].(map[string]*Matrix)
+	v, ok := keys[name]
+	if !ok || v == nil {
+		return nil, fmt.Errorf("%s has no field %s, its fields are %s", m.Name, name, strings.Join(m.fields, ", "))
+	}
+	res := *v
+	res.Name = name
+	return &res, nil
+}
+
+// cellIndex returns the single cell the subscripts refer to
+func (m *Matrix) cellIndex(subs []querySubscript) (*Matrix, error) {
+	if m.Class != mxCELL {
+		return nil, fmt.Errorf("%s is a %s, braces index cells", m.Name, m.ClassName())
+	}
+	sub, err := m.index(subs)
+	if err != nil {
+		return nil, err
+	}
+	if len(sub.value) != 1 {
+		return nil, fmt.Errorf("braces have to refer to a single cell of %s, got %d", m.Name, len(sub.value))
+	}
+	c, ok := sub.value[0].(*Matrix)
+	if !ok {
+		return nil, fmt.Errorf("expects cells of %s to be matrices, got %T", m.Name, sub.value[0])
+	}
+	res := *c
+	res.Name = m.Name
+	return &res, nil
+}
+
+// index returns the elements of a matrix the subscripts refer to. A single subscript indexes the elements in column
+// major order, more subscripts index each dimension, with the last one indexing all remaining dimensions.
+func (m *Matrix) index(subs []querySubscript) (*Matrix, error) {
+	if _, ok := m.Raw(); ok {
+		return nil, fmt.Errorf("cannot index %s of class %s", m.Name, m.Class)
+	}
+	n := m.numel()
+	if m.Class == mxSPARSE {
+		if len(m.Dimension) != 2 || len(m.jc) != int(m.Dimension[1])+1 || len(m.ir) != len(m.value) {
+			return nil, fmt.Errorf("invalid sparse matrix %s", m.Name)
+		}
+	} else if len(m.value) != n || m.flags.isComplex && len(m.imag) != n {
+		return nil, fmt.Errorf("matrix %s has %d values but its dimensions need %d", m.Name, len(m.value), n)
+	}
+	if len(subs) == 0 {
+		res := *m
+		return &res, nil
+	}
+
+	var dims []int32
+	var positions []int
+	if len(subs) == 1 {
+		idx, err := subs[0].resolve(n, 1)
+		if err != nil {
+			return nil, err
+		}
+		positions = idx
+		switch {
+		case subs[0].colon:
+			dims = []int32{int32(len(idx)), 1}
+		case len(m.Dimension) == 2 && m.Dimension[0] != 1 && m.Dimension[1] == 1:
+			// indexing column vectors gives column vectors
+			dims = []int32{int32(len(idx)), 1}
+		default:
+			dims = []int32{1, int32(len(idx))}
+		}
+	} else {
+		// sizes of the indexed dimensions, the last one spans all remaining dimensions
+		sizes := make([]int, len(subs))
+		for i := range sizes {
+			sizes[i] = 1
+			if i < len(m.Dimension) {
+				sizes[i] = int(m.Dimension[i])
+			}
+		}
+		for _, d := range m.Dimension[minInt(len(subs), len(m.Dimension)):] {
+			sizes[len(sizes)-1] *= int(d)
+		}
+		lists := make([][]int, len(subs))
+		total := 1
+		for i, s := range subs {
+			idx, err := s.resolve(sizes[i], i+1)
+			if err != nil {
+				return nil, err
+			}
+			lists[i] = idx
+			total *= len(idx)
+			dims = append(dims, int32(len(idx)))
+		}
+		for len(dims) > 2 && dims[len(dims)-1] == 1 {
+			dims = dims[:len(dims)-1]
+		}
+		positions = make([]int, 0, total)
+		counter := make([]int, len(subs))
+		for k := 0; k < total; k++ {
+			pos, stride := 0, 1
+			for i, c := range counter {
+				pos += lists[i][c] * stride
+				stride *= sizes[i]
+			}
+			positions = append(positions, pos)
+			for i := range counter {
+				if counter[i]++; counter[i] < len(lists[i]) {
+					break
+				}
+				counter[i] = 0
+			}
+		}
+	}
+	return m.subset(positions, dims), nil
+}
+
+// subset returns a matrix of the given dimensions holding the elements at the positions in column major order
+func (m *Matrix) subset(positions []int, dims []int32) *Matrix {
+	res := &Matrix{Name: m.Name, Class: m.Class, Dimension: dims, flags: m.flags, fields: m.fields}
+	if m.Class != mxSPARSE {
+		res.value = make([]interface{}, len(positions))
+		if m.flags.isComplex {
+			res.imag = make([]interface{}, len(positions))
+		}
+		for k, pos := range positions {
+			res.value[k] = m.value[pos]
+			if m.flags.isComplex {
+				res.imag[k] = m.imag[pos]
+			}
+		}
+		return res
+	}
+
+	rows, resRows := int(m.Dimension[0]), int(dims[0])
+	res.value, res.ir = []interface{}{}, []int{}
+	if m.flags.isComplex {
+		res.imag = []interface{}{}
+	}
+	res.jc = make([]int, int(dims[1])+1)
+	for k, pos := range positions {
+		r, c := pos%rows, pos/rows
+		for i := m.jc[c]; i < m.jc[c+1]; i++ {
+			if m.ir[i] != r {
+				continue
+			}
+			res.ir = append(res.ir, k%resRows)
+			res.value = append(res.value, m.value[i])
+			if m.flags.isComplex {
+				res.imag = append(res.imag, m.imag[i])
+			}
+			break
+		}
+		res.jc[k/resRows+1] = len(res.ir)
+	}
+	for c := 1; c < len(res.jc); c++ {
+		if res.jc[c] < res.jc[c-1] {
+			res.jc[c] = res.jc[c-1]
+		}
+	}
+	return res
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// querySubscript is an index within parentheses or braces: a colon, a single value or a range
+type querySubscript struct {
+	colon             bool
+	start, step, stop queryValue
+	isRange, hasStep  bool
+}
+
+// queryValue is a number that may be relative to end, the size of the indexed dimension
+type queryValue struct {
+	end    bool
+	offset int
+}
+
+func (v queryValue) resolve(size int) int {
+	if v.end {
+		return size + v.offset
+	}
+	return v.offset
+}
+
+// resolve returns the zero based indices of subscript i into a dimension of the given size
+func (s querySubscript) resolve(size, i int) ([]int, error) {
+	if s.colon {
+		res := make([]int, size)
+		for k := range res {
+			res[k] = k
+		}
+		return res, nil
+	}
+	start := s.start.resolve(size)
+	if !s.isRange {
+		if start < 1 || start > size {
+			return nil, fmt.Errorf("index %d of subscript %d is out of bounds, the dimension has %d elements", start, i, size)
+		}
+		return []int{start - 1}, nil
+	}
+	step, stop := 1, s.stop.resolve(size)
+	if s.hasStep {
+		step = s.step.resolve(size)
+	}
+	if step == 0 || step > 0 && stop < start || step < 0 && stop > start {
+		// empty ranges like 3:2
+		return []int{}, nil
+	}
+	n := (stop-start)/step + 1
+	last := start + (n-1)*step
+	for _, v := range []int{start, last} {
+		if v < 1 || v > size {
+			return nil, fmt.Errorf("index %d of subscript %d is out of bounds, the dimension has %d elements", v, i, size)
+		}
+	}
+	res := make([]int, n)
+	for k := range res {
+		res[k] = start + k*step - 1
+	}
+	return res, nil
+}
+
+// queryParser parses query expressions
+type queryParser struct {
+	expr string
+	pos  int
+}
+
+func (p *queryParser) done() bool {
+	return p.pos >= len(p.expr)
+}
+
+func (p *queryParser) skipSpace() {
+	for !p.done() && (p.expr[p.pos] == ' ' || p.expr[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *queryParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%s: %s", p.expr[:minInt(p.pos, len(p.expr))], fmt.Sprintf(format, args...))
+}
+
+// ident returns the identifier at the current position, or "" if there is none
+func (p *queryParser) ident() string {
+	start := p.pos
+	for !p.done() {
+		c := p.expr[p.pos]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || p.pos > start && (c == '_' || c >= '0' && c <= '9') {
+			p.pos++
+		} else {
+			break
+		}
+	}
+	return p.expr[start:p.pos]
+}
+
+// subscripts parses comma separated subscripts up to the bracket closing open
+func (p *queryParser) subscripts(open byte) ([]querySubscript, error) {
+	closing := byte(')')
+	if open == '{' {
+		closing = '}'
+	}
+	var res []querySubscript
+	p.skipSpace()
+	if !p.done() && p.expr[p.pos] == closing {
+		p.pos++
+		return res, nil
+	}
+	for {
+		s, err := p.subscript()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, s)
+		p.skipSpace()
+		if p.done() {
+			return nil, p.errorf("missing %q", closing)
+		}
+		switch p.expr[p.pos] {
+		case ',':
+			p.pos++
+		case closing:
+			p.pos++
+			return res, nil
+		default:
+			return nil, p.errorf("unexpected %q in subscripts", p.expr[p.pos])
+		}
+	}
+}
+
+// subscript parses a colon, a value or a range of two or three values
+func (p *queryParser) subscript() (querySubscript, error) {
+	p.skipSpace()
+	if !p.done() && p.expr[p.pos] == ':' {
+		p.pos++
+		return querySubscript{colon: true}, nil
+	}
+	var values []queryValue
+	for {
+		v, err := p.value()
+		if err != nil {
+			return querySubscript{}, err
+		}
+		values = append(values, v)
+		p.skipSpace()
+		if p.done() || p.expr[p.pos] != ':' {
+			break
+		}
+		if len(values) == 3 {
+			return querySubscript{}, p.errorf("ranges have at most 3 parts")
+		}
+		p.pos++
+	}
+	switch len(values) {
+	case 1:
+		return querySubscript{start: values[0]}, nil
+	case 2:
+		return querySubscript{start: values[0], stop: values[1], isRange: true}, nil
+	}
+	return querySubscript{start: values[0], step: values[1], stop: values[2], isRange: true, hasStep: true}, nil
+}
+
+// value parses a sum of integers and at most one end, like end-1
+func (p *queryParser) value() (queryValue, error) {
+	var v queryValue
+	sign := 1
+	for terms := 0; ; terms++ {
+		p.skipSpace()
+		if !p.done() && (p.expr[p.pos] == '-' || p.expr[p.pos] == '+') {
+			if p.expr[p.pos] == '-' {
+				sign = -sign
+			}
+			p.pos++
+			p.skipSpace()
+		}
+		start := p.pos
+		if word := p.ident(); word == "end" {
+			if v.end || sign < 0 {
+				return v, p.errorf("end can only be added once, not subtracted")
+			}
+			v.end = true
+		} else if word != "" {
+			return v, p.errorf("unexpected %q, subscripts are integers, ranges, end or colons", word)
+		} else {
+			for !p.done() && p.expr[p.pos] >= '0' && p.expr[p.pos] <= '9' {
+				p.pos++
+			}
+			n, err := strconv.Atoi(p.expr[start:p.pos])
+			if err != nil {
+				return v, p.errorf("expects an integer subscript")
+			}
+			v.offset += sign * n
+		}
+		p.skipSpace()
+		if p.done() || p.expr[p.pos] != '-' && p.expr[p.pos] != '+' {
+			return v, nil
+		}
+		sign = 1
+		if terms > 100 {
+			return v, p.errorf("subscript too long")
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package matlab
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func queryDoubles(dims []int32, values ...float64) *Matrix {
+	m := &Matrix{Class: mxDOUBLE, Dimension: dims, value: []interface{}{}}
+	for _, v := range values {
+		m.value = append(m.value, v)
+	}
+	return m
+}
+
+func TestMatrixGet(t *testing.T) {
+	// a 3x4 matrix holding 1 to 12 in column major order
+	a := queryDoubles([]int32{3, 4}, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12)
+	a.Name = "a"
+	for path, expected := range map[string]*Matrix{
+		"(2,3)":         queryDoubles([]int32{1, 1}, 8),
+		"(end)":         queryDoubles([]int32{1, 1}, 12),
+		"(end-1, end)":  queryDoubles([]int32{1, 1}, 11),
+		"(:,2)":         queryDoubles([]int32{3, 1}, 4, 5, 6),
+		"(1,:)":         queryDoubles([]int32{1, 4}, 1, 4, 7, 10),
+		"(1:2:end,2:3)": queryDoubles([]int32{2, 2}, 4, 6, 7, 9),
+		"(end:-4:1)":    queryDoubles([]int32{1, 3}, 12, 8, 4),
+		"(:)":           queryDoubles([]int32{12, 1}, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12),
+		"(3:2)":         queryDoubles([]int32{1, 0}),
+		"(2,:)(2)":      queryDoubles([]int32{1, 1}, 5),
+	} {
+		expected.Name = "a"
+		m, err := a.Get(path)
+		assert.NoError(t, err, path)
+		assert.Equal(t, expected, m, path)
+	}
+
+	// 2x2x2 with the last subscript spanning the trailing dimensions
+	b := queryDoubles([]int32{2, 2, 2}, 1, 2, 3, 4, 5, 6, 7, 8)
+	m, err := b.Get("(1,:,2)")
+	assert.NoError(t, err)
+	assert.Equal(t, queryDoubles([]int32{1, 2}, 5, 7), m)
+	m, err = b.Get("(2,end)")
+	assert.NoError(t, err)
+	assert.Equal(t, queryDoubles([]int32{1, 1}, 8), m)
+
+	// sparse 3x4 with 5 at (2,1) and 6 at (1,3)
+	sp := &Matrix{Class: mxSPARSE, Dimension: []int32{3, 4}, value: []interface{}{5.0, 6.0}, ir: []int{1, 0}, jc: []int{0, 1, 1, 2, 2}}
+	m, err = sp.Get("(1:2,[1])")
+	assert.Error(t, err)
+	m, err = sp.Get("(1:2,1:3)")
+	assert.NoError(t, err)
+	assert.Equal(t, &Matrix{Class: mxSPARSE, Dimension: []int32{2, 3}, value: []interface{}{5.0, 6.0}, ir: []int{1, 0}, jc: []int{0, 1, 1, 2}}, m)
+
+	for _, path := range []string{"(4,1)", "(0)", "(13)", "(1", "(1,2]", "{1}", ".x", "(1:end+1)", "(x)", "(end-end)"} {
+		_, err := a.Get(path)
+		assert.Error(t, err, path)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	trial := func(v float64) map[string]*Matrix {
+		return map[string]*Matrix{"signal": {Class: mxCELL, Dimension: []int32{1, 2}, value: []interface{}{
+			queryDoubles([]int32{1, 1}, v), queryDoubles([]int32{1, 4}, v, v+1, v+2, v+3),
+		}}}
+	}
+	results := &Matrix{Name: "results", Class: mxSTRUCT, Dimension: []int32{1, 1}, fields: []string{"trials"}, value: []interface{}{
+		map[string]*Matrix{"trials": {Class: mxSTRUCT, Dimension: []int32{1, 3}, fields: []string{"signal"},
+			value: []interface{}{trial(1), trial(10), trial(100)}}},
+	}}
+	f := &File{Header: &Header{}, hasReadAll: true, vars: map[string]*Matrix{"results": results}}
+
+	m, err := f.Query("results.trials(3).signal{2}(2:end)")
+	assert.NoError(t, err)
+	assert.Equal(t, &Matrix{Name: "signal", Class: mxDOUBLE, Dimension: []int32{1, 3}, value: []interface{}{101.0, 102.0, 103.0}}, m)
+	m, err = f.Query("results.trials(2:3)")
+	assert.NoError(t, err)
+	assert.Equal(t, []int32{1, 2}, m.Dimension)
+	assert.Equal(t, []string{"signal"}, m.FieldNames())
+	m, err = results.Get("trials(1).signal(1)")
+	assert.NoError(t, err)
+	assert.Equal(t, mxCELL, m.Class)
+
+	for expr, msg := range map[string]string{
+		"missing":                     "variable missing not found",
+		"results.trials.signal":       "results.trials.signal: trials is a 1x3 struct array, index it to access field signal",
+		"results.trials(4)":           "results.trials(4): index 4 of subscript 1 is out of bounds, the dimension has 3 elements",
+		"results.tirals":              "results.tirals: results has no field tirals, its fields are trials",
+		"results.trials(1).signal{:}": "results.trials(1).signal{:}: braces have to refer to a single cell of signal, got 2",
+	} {
+		_, err := f.Query(expr)
+		if assert.Error(t, err, expr) {
+			assert.Equal(t, msg, err.Error())
+		}
+	}
+
+	file, err := os.Open("testdata/simpleStruct.mat")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer file.Close()
+	f, err = NewFileFromReader(file)
+	assert.NoError(t, err)
+	m, err = f.Query("X.w")
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{1}, m.DoubleArray())
+}
@@ -0,0 +1,101 @@
+package matlab
+
+import (
+	"context"
+	"io"
+	"math"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// ReadAllOptions controls how ReadAll decodes the variables
+type ReadAllOptions struct {
+	Concurrency int // variables decoded at once, runtime.GOMAXPROCS(0) if 0 or negative
+}
+
+// ReadAll reads all variables of the file, like the first call of GetVar does. The variables of level 5 files are
+// decompressed and decoded on up to opts.Concurrency goroutines while the file is read on, which speeds up files with
+// many compressed variables. The variables and the error are the same as when reading them one by one: the error is
+// the first one in the file and the limits of ReaderOptions apply in file order. Other formats are read one by one.
+//
+// Reading stops with ctx's error once ctx is done. As the reader cannot go back, the file reports that error from
+// then on. ReadAll returns the error of an earlier read without reading again. opts may be nil.
+func (f *File) ReadAll(ctx context.Context, opts *ReadAllOptions) error {
+	workers := runtime.GOMAXPROCS(0)
+	if opts != nil && opts.Concurrency > 0 {
+		workers = opts.Concurrency
+	}
+	return f.readAllContext(ctx, workers)
+}
+
+// readAllConcurrently reads the elements like readAllElements and decodes them on the given number of goroutines.
+// Reading and checking the limits stays in file order, so the elements and the first error in the file are the same
+// as when reading them one by one. Elements after a failed one are not decoded.
+func (d *decoder) readAllConcurrently(r io.Reader, workers int) ([]Element, error) {
+	type result struct {
+		el  Element
+		err error
+	}
+	type job struct {
+		i      int64
+		decode func() (Element, error)
+		res    *result
+	}
+	var (
+		results []*result
+		failed  int64 = math.MaxInt64 // index of the first element that failed to decode
+		wg      sync.WaitGroup
+		jobs    = make(chan job, workers)
+	)
+	for n := 0; n < workers; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if j.i > atomic.LoadInt64(&failed) {
+					continue
+				}
+				if j.res.err = d.ctx.Err(); j.res.err == nil {
+					j.res.el, j.res.err = j.decode()
+				}
+				if j.res.err != nil {
+					for {
+						first := atomic.LoadInt64(&failed)
+						if j.i >= first || atomic.CompareAndSwapInt64(&failed, first, j.i) {
+							break
+						}
+					}
+				}
+			}
+		}()
+	}
+	var err error
+	for atomic.LoadInt64(&failed) == math.MaxInt64 {
+		if err = d.ctx.Err(); err != nil {
+			break
+		}
+		var decode func() (Element, error)
+		if decode, err = d.scanElement(r); err != nil {
+			if err.Error() == "EOF" {
+				err = nil
+			}
+			break
+		}
+		d.scanned()
+		res := &result{}
+		jobs <- job{i: int64(len(results)), decode: decode, res: res}
+		results = append(results, res)
+	}
+	close(jobs)
+	wg.Wait()
+
+	var elements []Element
+	for _, res := range results {
+		if res.err != nil {
+			return nil, res.err
+		}
+		elements = append(elements, res.el)
+	}
+	return elements, err
+}
@@ -0,0 +1,88 @@
+package matlab
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadAll(t *testing.T) {
+	for _, name := range []string{"varTypes.mat", "compressedTypes.mat", "matrices.mat", "v73.mat"} {
+		data, err := os.ReadFile("testdata/" + name)
+		assert.NoError(t, err)
+		expected, err := NewFileFromReader(bytes.NewReader(data))
+		assert.NoError(t, err)
+		assert.NoError(t, expected.Err(), name)
+		for _, n := range []int{0, 1, 4} {
+			f, err := NewFileFromReader(bytes.NewReader(data))
+			assert.NoError(t, err)
+			assert.NoError(t, f.ReadAll(context.Background(), &ReadAllOptions{Concurrency: n}), name)
+			assert.Equal(t, expected.vars, f.vars, name)
+			assert.Equal(t, expected.raw, f.raw, name)
+		}
+	}
+
+	// the first error in the file is reported, whichever element is decoded first
+	var header bytes.Buffer
+	_, err := NewFileFromWriter(&header, nil)
+	assert.NoError(t, err)
+	file := header.Bytes()
+	for i := 0; i < 20; i++ {
+		m := &Matrix{Name: string(rune('a' + i)), Class: mxDOUBLE, Dimension: []int32{1, 1000}}
+		for j := 0; j < 1000; j++ {
+			m.value = append(m.value, float64(i*j))
+		}
+		file = append(file, compressedMatrix(t, m, i == 12 || i == 17)...)
+	}
+	for _, test := range []struct {
+		opts *ReaderOptions
+		err  string
+	}{
+		{nil, "invalid checksum"},
+		{&ReaderOptions{MaxTotalBytes: 10 * 8100}, "file holds more than the limit"},
+	} {
+		f, err := NewFileFromReaderWithOptions(bytes.NewReader(file), test.opts)
+		assert.NoError(t, err)
+		expected := f.Err()
+		if assert.Error(t, expected) {
+			assert.Contains(t, expected.Error(), test.err)
+		}
+		for i := 0; i < 20; i++ {
+			f, err := NewFileFromReaderWithOptions(bytes.NewReader(file), test.opts)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, f.ReadAll(context.Background(), &ReadAllOptions{Concurrency: 8}))
+			assert.Equal(t, expected, f.Err())
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	f, err := NewFileFromReader(bytes.NewReader(file))
+	assert.NoError(t, err)
+	assert.Equal(t, context.Canceled, f.ReadAll(ctx, nil))
+	assert.Equal(t, context.Canceled, f.Err())
+	assert.Nil(t, f.GetVarsNames())
+}
+
+// compressedMatrix returns a little endian compressed element holding m, with a bad checksum if corrupt
+func compressedMatrix(t *testing.T, m *Matrix, corrupt bool) []byte {
+	bo := binary.LittleEndian
+	data, err := encodeMatrix(bo, m)
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write(packElement(bo, DTmiMATRIX, data))
+	w.Close()
+	if corrupt {
+		buf.Bytes()[buf.Len()-1] ^= 1
+	}
+	tag := make([]byte, 8)
+	bo.PutUint32(tag, uint32(DTmiCOMPRESSED))
+	bo.PutUint32(tag[4:], uint32(buf.Len()))
+	return append(tag, buf.Bytes()...)
+}
@@ -0,0 +1,292 @@
+package matlab
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Schema states the variables a file has to hold. It can be built in go or parsed from JSON with ParseSchema, and from
+// YAML with the matyaml package:
+//
+//	{"variables": {
+//	  "fs": {"class": "double", "dims": [1, 1]},
+//	  "results": {"class": "struct", "fields": {
+//	    "trials": {"dims": [1, "any"], "fields": {
+//	      "signal": {"class": "cell", "cells": {"class": "double|single", "dims": [1, "100.."]}}}}}}}}
+type Schema struct {
+	Variables map[string]*VarSchema `json:"variables"`
+	Strict    bool                  `json:"strict,omitempty"` // variables not in the schema are violations
+}
+
+// VarSchema states the class, size and contents of a variable, field or cell. Zero values allow anything.
+type VarSchema struct {
+	Optional bool                  `json:"optional,omitempty"` // the variable or field may be missing
+	Class    string                `json:"class,omitempty"`    // class name like double or logical, alternatives separated by |, numeric for any numeric class
+	Complex  *bool                 `json:"complex,omitempty"`  // whether values have to be complex or real
+	Sparse   *bool                 `json:"sparse,omitempty"`   // whether values have to be sparse or full
+	Dims     []Dim                 `json:"dims,omitempty"`     // size of each dimension, where missing dimensions are 1
+	Fields   map[string]*VarSchema `json:"fields,omitempty"`   // fields of every element of a struct
+	Cells    *VarSchema            `json:"cells,omitempty"`    // every element of a cell
+}
+
+// Dim is the allowed size of a dimension, from Min to Max. A negative Max allows any size from Min. In JSON and YAML it
+// is a number for an exact size, a range like "1..10", "2.." or "..5", or "any".
+type Dim struct {
+	Min, Max int
+}
+
+// AnyDim allows any size
+var AnyDim = Dim{Min: 0, Max: -1}
+
+// ExactDim allows the size n
+func ExactDim(n int) Dim {
+	return Dim{Min: n, Max: n}
+}
+
+func (d Dim) allows(n int) bool {
+	return n >= d.Min && (d.Max < 0 || n <= d.Max)
+}
+
+// String returns the notation of JSON and YAML schemas
+func (d Dim) String() string {
+	switch {
+	case d.Min == d.Max:
+		return strconv.Itoa(d.Min)
+	case d.Min <= 0 && d.Max < 0:
+		return "any"
+	case d.Max < 0:
+		return fmt.Sprintf("%d..", d.Min)
+	case d.Min <= 0:
+		return fmt.Sprintf("..%d", d.Max)
+	}
+	return fmt.Sprintf("%d..%d", d.Min, d.Max)
+}
+
+// MarshalJSON implements json.Marshaler
+func (d Dim) MarshalJSON() ([]byte, error) {
+	if d.Min == d.Max {
+		return json.Marshal(d.Min)
+	}
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (d *Dim) UnmarshalJSON(data []byte) error {
+	var n int
+	if err := json.Unmarshal(data, &n); err == nil {
+		if n < 0 {
+			return fmt.Errorf("invalid dimension %d", n)
+		}
+		*d = ExactDim(n)
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("invalid dimension %s, expects a number, a range or any", data)
+	}
+	if s == "any" {
+		*d = AnyDim
+		return nil
+	}
+	parts := strings.Split(s, "..")
+	if len(parts) > 2 {
+		return fmt.Errorf("invalid dimension %q", s)
+	}
+	res := Dim{Max: -1}
+	for i, p := range parts {
+		if p == "" && len(parts) == 2 {
+			continue
+		}
+		v, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil || v < 0 {
+			return fmt.Errorf("invalid dimension %q", s)
+		}
+		if i == 0 {
+			res.Min = v
+		}
+		if i == 1 || len(parts) == 1 {
+			res.Max = v
+		}
+	}
+	if res.Max >= 0 && res.Max < res.Min {
+		return fmt.Errorf("invalid dimension %q", s)
+	}
+	*d = res
+	return nil
+}
+
+// ParseSchema parses a schema from JSON. Unknown keys are errors, to catch misspelt constraints.
+func ParseSchema(data []byte) (*Schema, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.DisallowUnknownFields()
+	var s Schema
+	if err := d.Decode(&s); err != nil {
+		return nil, fmt.Errorf("invalid schema: %v", err)
+	}
+	return &s, nil
+}
+
+// Violation is a part of a file that doesn't match a schema. Path locates it like the expressions of Query, e.g.
+// results.trials(3).signal{2}.
+type Violation struct {
+	Path    string
+	Message string
+}
+
+func (v Violation) String() string {
+	if v.Path == "" {
+		return v.Message
+	}
+	return v.Path + ": " + v.Message
+}
+
+// Validate checks the variables of a file against a schema and returns all violations, sorted by variable name. A file
+// that cannot be read gives a single violation without a path.
+func Validate(f *File, s *Schema) []Violation {
+	names := f.GetVarsNames()
+	if err := f.Err(); err != nil {
+		return []Violation{{Message: fmt.Sprintf("cannot read file: %v", err)}}
+	}
+	var res []Violation
+	expected := make([]string, 0, len(s.Variables))
+	for name := range s.Variables {
+		expected = append(expected, name)
+	}
+	sort.Strings(expected)
+	for _, name := range expected {
+		m, ok := f.GetVar(name)
+		if !ok {
+			if !s.Variables[name].Optional {
+				res = append(res, Violation{Path: name, Message: "missing variable"})
+			}
+			continue
+		}
+		res = append(res, s.Variables[name].Validate(m)...)
+	}
+	if s.Strict {
+		sort.Strings(names)
+		for _, name := range names {
+			if _, ok := s.Variables[name]; !ok {
+				res = append(res, Violation{Path: name, Message: "unexpected variable"})
+			}
+		}
+	}
+	return res
+}
+
+// Validate checks a matrix against the schema and returns all violations, with paths starting at the name of the
+// matrix
+func (s *VarSchema) Validate(m *Matrix) []Violation {
+	return s.validate(m.Name, m, nil)
+}
+
+func (s *VarSchema) validate(path string, m *Matrix, res []Violation) []Violation {
+	if s == nil {
+		return res
+	}
+	violation := func(format string, args ...interface{}) {
+		res = append(res, Violation{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+	if s.Class != "" && !classMatches(m, s.Class) {
+		violation("expects class %s, got %s", s.Class, m.ClassName())
+		// the contents of other classes would give more confusing violations
+		return res
+	}
+	if s.Complex != nil && *s.Complex != m.IsComplex() {
+		if *s.Complex {
+			violation("expects complex values")
+		} else {
+			violation("expects real values")
+		}
+	}
+	if s.Sparse != nil && *s.Sparse != m.IsSparse() {
+		if *s.Sparse {
+			violation("expects a sparse matrix")
+		} else {
+			violation("expects a full matrix")
+		}
+	}
+	if s.Dims != nil {
+		n := len(s.Dims)
+		if len(m.Dimension) > n {
+			n = len(m.Dimension)
+		}
+		for i := 0; i < n; i++ {
+			size, allowed := 1, ExactDim(1)
+			if i < len(m.Dimension) {
+				size = int(m.Dimension[i])
+			}
+			if i < len(s.Dims) {
+				allowed = s.Dims[i]
+			}
+			if !allowed.allows(size) {
+				violation("dimension %d is %d, expects %s", i+1, size, allowed)
+			}
+		}
+	}
+	if s.Fields != nil {
+		res = s.validateFields(path, m, res)
+	}
+	if s.Cells != nil {
+		if m.Class != mxCELL {
+			violation("expects a cell, got %s", m.ClassName())
+			return res
+		}
+		for i, v := range m.value {
+			c, ok := v.(*Matrix)
+			if !ok {
+				violation("cell %d is not a matrix", i+1)
+				continue
+			}
+			res = s.Cells.validate(fmt.Sprintf("%s{%d}", path, i+1), c, res)
+		}
+	}
+	return res
+}
+
+// validateFields checks the fields of every element of a struct
+func (s *VarSchema) validateFields(path string, m *Matrix, res []Violation) []Violation {
+	if m.Class != mxSTRUCT {
+		return append(res, Violation{Path: path, Message: fmt.Sprintf("expects a struct, got %s", m.ClassName())})
+	}
+	names := make([]string, 0, len(s.Fields))
+	for name := range s.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, v := range m.value {
+		element := path
+		if len(m.value) != 1 {
+			element = fmt.Sprintf("%s(%d)", path, i+1)
+		}
+		keys, _ := v.(map[string]*Matrix)
+		for _, name := range names {
+			field, ok := keys[name]
+			if !ok || field == nil {
+				if !s.Fields[name].Optional {
+					res = append(res, Violation{Path: element + "." + name, Message: "missing field"})
+				}
+				continue
+			}
+			res = s.Fields[name].validate(element+"."+name, field, res)
+		}
+	}
+	return res
+}
+
+// classMatches tells whether the class of m is one of the | separated alternatives
+func classMatches(m *Matrix, classes string) bool {
+	name := m.ClassName()
+	for _, c := range strings.Split(classes, "|") {
+		c = strings.TrimSpace(c)
+		numeric := (m.Class.isNumeric() || m.IsSparse()) && !m.flags.isLogical
+		if c == name || c == "numeric" && numeric {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package matlab
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSchema(t *testing.T) {
+	yes := true
+	expected := &Schema{Strict: true, Variables: map[string]*VarSchema{
+		"fs": {Class: "double", Dims: []Dim{ExactDim(1), ExactDim(1)}},
+		"results": {Class: "struct", Fields: map[string]*VarSchema{
+			"trials": {Optional: true, Dims: []Dim{{Min: 1, Max: 10}, AnyDim, {Min: 2, Max: -1}, {Min: 0, Max: 5}}},
+			"signal": {Complex: &yes, Cells: &VarSchema{Class: "numeric"}},
+		}},
+	}}
+
+	s, err := ParseSchema([]byte(`{
+  "strict": true,
+  "variables": {
+    "fs": {"class": "double", "dims": [1, 1]},
+    "results": {
+      "class": "struct",
+      "fields": {
+        "trials": {"optional": true, "dims": ["1..10", "any", "2..", "..5"]},
+        "signal": {"complex": true, "cells": {"class": "numeric"}}
+      }
+    }
+  }
+}`))
+	assert.NoError(t, err)
+	assert.Equal(t, expected, s)
+
+	data, err := json.Marshal(expected)
+	assert.NoError(t, err)
+	s, err = ParseSchema(data)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, s)
+
+	for _, data := range []string{
+		`{"variables": {"a": {"clas": "double"}}}`,
+		`{"variables": {"a": {"dims": [-1]}}}`,
+		`{"variables": {"a": {"dims": ["3..2"]}}}`,
+		`{"variables": {"a": {"dims": ["1..2..3"]}}}`,
+		`{"variables": {"a": {"dims": [true]}}}`,
+		`{"variables": [`,
+	} {
+		_, err := ParseSchema([]byte(data))
+		assert.Error(t, err, data)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	file, err := os.Open("testdata/varTypes.mat")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer file.Close()
+	f, err := NewFileFromReader(file)
+	assert.NoError(t, err)
+
+	s, err := ParseSchema([]byte(`{"variables": {
+  "x": {
+    "class": "struct",
+    "dims": [1, 1],
+    "fields": {
+      "int8row": {"class": "int8|uint8", "dims": [1, 3]},
+      "chars": {"class": "char", "dims": [1, "..5"]},
+      "strcell": {"class": "cell", "cells": {"class": "char"}},
+      "bools": {"class": "numeric"},
+      "missing": {},
+      "maybe": {"optional": true}
+    }
+  },
+  "z": {
+    "fields": {
+      "arr3d": {"dims": [3, 3]},
+      "arr4d": {"class": "numeric", "complex": true, "dims": ["any", "any", "any", "any"]}
+    }
+  },
+  "sample": {"class": "cell", "cells": {"class": "struct"}},
+  "nothere": {},
+  "maybe": {"optional": true}
+}}`))
+	assert.NoError(t, err)
+	var violations []string
+	for _, v := range Validate(f, s) {
+		violations = append(violations, v.String())
+	}
+	assert.Equal(t, []string{
+		"nothere: missing variable",
+		"sample{2}: expects class struct, got double",
+		"x.bools: expects class numeric, got logical",
+		"x.chars: dimension 2 is 11, expects ..5",
+		"x.missing: missing field",
+		"z.arr3d: dimension 3 is 3, expects 1",
+		"z.arr4d: expects complex values",
+	}, violations)
+
+	s.Strict = true
+	s.Variables = map[string]*VarSchema{"x": {}, "y": {}, "z": {}}
+	assert.Equal(t, []Violation{{Path: "sample", Message: "unexpected variable"}}, Validate(f, s))
+
+	// struct arrays give a path per element
+	a := &Matrix{Name: "a", Class: mxSTRUCT, Dimension: []int32{1, 2}, fields: []string{"v"}, value: []interface{}{
+		map[string]*Matrix{"v": queryDoubles([]int32{1, 1}, 1)},
+		map[string]*Matrix{"v": {Class: mxCHAR, Dimension: []int32{1, 1}, value: []interface{}{uint16('a')}}},
+	}}
+	no := false
+	assert.Equal(t, []Violation{
+		{Path: "a(2).v", Message: "expects class double, got char"},
+	}, (&VarSchema{Sparse: &no, Fields: map[string]*VarSchema{"v": {Class: "double"}}}).Validate(a))
+	assert.Equal(t, []Violation{{Path: "a", Message: "expects a cell, got struct"}}, (&VarSchema{Cells: &VarSchema{}}).Validate(a))
+
+	f, err = NewFileFromReader(strings.NewReader("# name: a\n# type: matrix\n# rows: 2\n# columns: 2\n 1 2\n"))
+	assert.NoError(t, err)
+	violations = nil
+	for _, v := range Validate(f, s) {
+		violations = append(violations, v.String())
+	}
+	assert.Len(t, violations, 1)
+	assert.True(t, strings.HasPrefix(violations[0], "cannot read file: "))
+}
@@ -0,0 +1,207 @@
+package matlab
+
+import (
+	"compress/zlib"
+	"fmt"
+	"io"
+	"math"
+)
+
+// VarOptions controls how CreateVar writes a variable
+type VarOptions struct {
+	Compress bool // compress the variable, which needs the file's writer to be an io.WriteSeeker
+}
+
+// VarWriter writes the values of a variable created with CreateVar
+type VarWriter struct {
+	f       *File
+	w       io.Writer      // the file's writer, or the compressor of a compressed variable
+	zw      *zlib.Writer   // the compressor, if the variable is compressed
+	ws      io.WriteSeeker // the file's writer when compressing, to patch the length
+	start   int64          // position of the compressed element's tag
+	class   mxClass
+	logical bool
+	dims    []int32
+	numel   int
+	written int
+	buf     []byte
+	err     error
+}
+
+// CreateVar starts writing a variable of a numeric class like "double" or "logical" and the given dimensions to a
+// level 5 file, so that arrays larger than memory can be written. The values are then pushed in column major order
+// with Write and WriteColumns, and Close finishes the variable. Nothing else can be written to the file until then.
+// As the length of an element is stored in 32 bits, a variable can hold up to 4 GB. opts may be nil.
+//
+// If writing the variable fails, or it is closed before all its values are written, the file ends within the
+// variable and nothing more can be written to it.
+func (f *File) CreateVar(name, class string, dims []int32, opts *VarOptions) (*VarWriter, error) {
+	if f.w == nil {
+		return nil, fmt.Errorf("file was not created for writing")
+	}
+	if f.Header.Level != "5.0" {
+		return nil, fmt.Errorf("can only stream variables to level 5 files, got level %s", f.Header.Level)
+	}
+	if f.stream != nil {
+		return nil, fmt.Errorf("variable is still being written")
+	}
+	if f.writeErr != nil {
+		return nil, fmt.Errorf("cannot write to the file after writing a variable failed: %v", f.writeErr)
+	}
+	c, logical, ok := classByName(class)
+	if !ok {
+		return nil, fmt.Errorf("cannot stream values of class %s, expects a numeric class or logical", class)
+	}
+	numel, ok := checkedNumel(dims)
+	if !ok || len(dims) < 2 {
+		return nil, fmt.Errorf("invalid dimensions %v of variable %s", dims, name)
+	}
+	m := &Matrix{Name: name, Class: c, Dimension: dims, flags: Flags{isLogical: logical}}
+	header, err := encodeMatrix(f.Header.Endianess, m)
+	if err != nil {
+		return nil, err
+	}
+	// encodeMatrix ends with the tag of the empty values, which is written with the size of the values instead
+	header = header[:len(header)-8]
+	size := int64(numel) * int64(c.dataType().NumBytes())
+	length := int64(len(header)) + 8 + int64(padTo64Bit(int(size)))
+	if length > math.MaxUint32 {
+		return nil, fmt.Errorf("variable %s of %d bytes does not fit into a level 5 element", name, length)
+	}
+	bo := f.Header.Endianess
+	tags := make([]byte, 16)
+	bo.PutUint32(tags, uint32(DTmiMATRIX))
+	bo.PutUint32(tags[4:], uint32(length))
+	bo.PutUint32(tags[8:], uint32(c.dataType()))
+	bo.PutUint32(tags[12:], uint32(size))
+
+	v := &VarWriter{f: f, w: f.w, class: c, logical: logical, dims: dims, numel: numel}
+	if opts != nil && opts.Compress {
+		ws, ok := f.w.(io.WriteSeeker)
+		if !ok {
+			return nil, fmt.Errorf("can only write compressed variables to an io.WriteSeeker")
+		}
+		if v.start, err = ws.Seek(0, io.SeekCurrent); err != nil {
+			return nil, err
+		}
+		// the length is patched when the variable is closed
+		tag := make([]byte, 8)
+		bo.PutUint32(tag, uint32(DTmiCOMPRESSED))
+		if _, err := ws.Write(tag); err != nil {
+			f.writeErr = err
+			return nil, err
+		}
+		v.ws, v.zw = ws, zlib.NewWriter(ws)
+		v.w = v.zw
+	}
+	for _, p := range [][]byte{tags[:8], header, tags[8:]} {
+		if _, err := v.w.Write(p); err != nil {
+			f.writeErr = err
+			return nil, err
+		}
+	}
+	f.stream = v
+	return v, nil
+}
+
+// Write writes the next values of the variable, converted to its class like castValue does
+func (v *VarWriter) Write(p []float64) error {
+	if v.err != nil {
+		return v.err
+	}
+	if len(p) > v.numel-v.written {
+		return fmt.Errorf("cannot write %d more values to a variable of %d values", len(p), v.numel-v.written)
+	}
+	bo := v.f.Header.Endianess
+	size := v.class.dataType().NumBytes()
+	if cap(v.buf) < size*len(p) {
+		v.buf = make([]byte, size*len(p))
+	}
+	buf := v.buf[:size*len(p)]
+	for i, x := range p {
+		b := buf[i*size : (i+1)*size]
+		switch {
+		case v.class == mxDOUBLE:
+			bo.PutUint64(b, math.Float64bits(x))
+		case v.logical:
+			b[0] = 0
+			if x != 0 {
+				b[0] = 1
+			}
+		default:
+			putValue(bo, b, castValue(v.class, x))
+		}
+	}
+	if _, err := v.w.Write(buf); err != nil {
+		v.err = err
+		v.f.writeErr = err
+		return err
+	}
+	v.written += len(p)
+	return nil
+}
+
+// WriteColumns writes the next columns of the variable, which have to hold as many values as its first dimension
+func (v *VarWriter) WriteColumns(cols [][]float64) error {
+	for i, c := range cols {
+		if len(c) != int(v.dims[0]) {
+			return fmt.Errorf("column %d has %d values, expects %d", i+1, len(c), v.dims[0])
+		}
+	}
+	for _, c := range cols {
+		if err := v.Write(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close finishes the variable, which has to have all its values written. If it fails, nothing more can be written to
+// the file.
+func (v *VarWriter) Close() error {
+	if v.f.stream != v {
+		return fmt.Errorf("variable is closed")
+	}
+	v.f.stream = nil
+	if v.err != nil {
+		return v.err
+	}
+	if err := v.close(); err != nil {
+		v.f.writeErr = err
+		return err
+	}
+	return nil
+}
+
+func (v *VarWriter) close() error {
+	if v.written != v.numel {
+		return fmt.Errorf("closing a variable of %d values after writing %d", v.numel, v.written)
+	}
+	size := v.numel * v.class.dataType().NumBytes()
+	if _, err := v.w.Write(make([]byte, padTo64Bit(size)-size)); err != nil {
+		return err
+	}
+	if v.zw == nil {
+		return nil
+	}
+	if err := v.zw.Close(); err != nil {
+		return err
+	}
+	end, err := v.ws.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if end-v.start-8 > math.MaxUint32 {
+		return fmt.Errorf("compressed variable of %d bytes does not fit into a level 5 element", end-v.start-8)
+	}
+	length := make([]byte, 4)
+	v.f.Header.Endianess.PutUint32(length, uint32(end-v.start-8))
+	if _, err := v.ws.Seek(v.start+4, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := v.ws.Write(length); err != nil {
+		return err
+	}
+	_, err = v.ws.Seek(end, io.SeekStart)
+	return err
+}
@@ -0,0 +1,124 @@
+package matlab
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateVar(t *testing.T) {
+	a := &Matrix{Name: "a", Class: mxDOUBLE, Dimension: []int32{2, 3}, value: []interface{}{1.0, 2.0, 3.0, 4.0, 5.5, 6.0}}
+	b := &Matrix{Name: "b", Class: mxINT16, Dimension: []int32{1, 5},
+		value: []interface{}{int16(1), int16(-2), int16(3), int16(0), int16(7)}}
+	l := &Matrix{Name: "l", Class: mxUINT8, Dimension: []int32{1, 5}, flags: Flags{isLogical: true},
+		value: []interface{}{uint8(1), uint8(0), uint8(1), uint8(1), uint8(0)}}
+	var expected bytes.Buffer
+	w, err := NewFileFromWriter(&expected, &Header{})
+	assert.NoError(t, err)
+	for _, m := range []*Matrix{a, b, l} {
+		assert.NoError(t, w.WriteElement(m))
+	}
+
+	// streaming gives the same elements
+	stream := func(w *File, opts *VarOptions) {
+		v, err := w.CreateVar("a", "double", []int32{2, 3}, opts)
+		assert.NoError(t, err)
+		assert.EqualError(t, w.WriteElement(b), "variable is still being written")
+		_, err = w.CreateVar("b", "int16", []int32{1, 5}, opts)
+		assert.EqualError(t, err, "variable is still being written")
+		assert.EqualError(t, v.WriteColumns([][]float64{{1, 2}, {3}}), "column 2 has 1 values, expects 2")
+		assert.NoError(t, v.WriteColumns([][]float64{{1, 2}, {3, 4}}))
+		assert.NoError(t, v.Write([]float64{5.5, 6}))
+		assert.EqualError(t, v.Write([]float64{7}), "cannot write 1 more values to a variable of 0 values")
+		assert.NoError(t, v.Close())
+		assert.EqualError(t, v.Close(), "variable is closed")
+
+		v, err = w.CreateVar("b", "int16", []int32{1, 5}, opts)
+		assert.NoError(t, err)
+		assert.NoError(t, v.Write([]float64{1, -2}))
+		assert.NoError(t, v.Write([]float64{3, 0, 7}))
+		assert.NoError(t, v.Close())
+		v, err = w.CreateVar("l", "logical", []int32{1, 5}, opts)
+		assert.NoError(t, err)
+		assert.NoError(t, v.Write([]float64{1, 0, 2, -1, 0}))
+		assert.NoError(t, v.Close())
+	}
+	var buf bytes.Buffer
+	w, err = NewFileFromWriter(&buf, &Header{})
+	assert.NoError(t, err)
+	stream(w, nil)
+	assert.Equal(t, expected.Bytes(), buf.Bytes())
+
+	out, err := ioutil.TempFile("", "stream")
+	assert.NoError(t, err)
+	defer os.Remove(out.Name())
+	w, err = NewFileFromWriter(out, &Header{})
+	assert.NoError(t, err)
+	stream(w, &VarOptions{Compress: true})
+	assert.NoError(t, w.WriteElement(&Matrix{Name: "c", Class: mxCHAR, Dimension: []int32{1, 2}, value: []interface{}{uint16('h'), uint16('i')}}))
+	assert.NoError(t, out.Close())
+	data, err := ioutil.ReadFile(out.Name())
+	assert.NoError(t, err)
+	f, err := NewFileFromReader(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.NoError(t, f.Err())
+	for _, m := range []*Matrix{a, b, l} {
+		read, ok := f.GetVar(m.Name)
+		if assert.True(t, ok, m.Name) {
+			assert.Equal(t, m.value, read.value, m.Name)
+			assert.Equal(t, m.ClassName(), read.ClassName(), m.Name)
+		}
+	}
+	assert.Len(t, f.GetVarsNames(), 4)
+
+	w, err = NewFileFromWriter(&buf, &Header{})
+	assert.NoError(t, err)
+	_, err = w.CreateVar("a", "double", []int32{1, 1}, &VarOptions{Compress: true})
+	assert.EqualError(t, err, "can only write compressed variables to an io.WriteSeeker")
+	_, err = w.CreateVar("a", "cell", []int32{1, 1}, nil)
+	assert.EqualError(t, err, "cannot stream values of class cell, expects a numeric class or logical")
+	_, err = w.CreateVar("a", "double", []int32{1 << 20, 1 << 10}, nil)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "does not fit into a level 5 element")
+	}
+	v, err := w.CreateVar("a", "double", []int32{1, 2}, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, v.Write([]float64{1}))
+	assert.EqualError(t, v.Close(), "closing a variable of 2 values after writing 1")
+	// the file ends within the variable
+	assert.EqualError(t, w.WriteElement(a), "cannot write to the file after writing a variable failed: closing a variable of 2 values after writing 1")
+	_, err = w.CreateVar("b", "double", []int32{1, 1}, nil)
+	assert.Error(t, err)
+
+	fw := &failingWriter{n: 300}
+	w, err = NewFileFromWriter(fw, &Header{})
+	assert.NoError(t, err)
+	v, err = w.CreateVar("a", "double", []int32{1, 100}, nil)
+	assert.NoError(t, err)
+	assert.EqualError(t, v.Write(make([]float64, 100)), "disk full")
+	assert.EqualError(t, v.Close(), "disk full")
+	assert.EqualError(t, w.WriteElement(a), "cannot write to the file after writing a variable failed: disk full")
+	_, err = w.CreateVar("b", "double", []int32{1, 1}, nil)
+	assert.EqualError(t, err, "cannot write to the file after writing a variable failed: disk full")
+	w, err = NewFileFromWriter(&buf, &Header{Level: "4.0"})
+	assert.NoError(t, err)
+	_, err = w.CreateVar("a", "double", []int32{1, 1}, nil)
+	assert.EqualError(t, err, "can only stream variables to level 5 files, got level 4.0")
+}
+
+// failingWriter fails once n bytes are written
+type failingWriter struct {
+	n int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		return 0, fmt.Errorf("disk full")
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
@@ -0,0 +1,577 @@
+//go:build ignore
+
+// This program writes dense.mat, a v7.3 file laid out the way libhdf5 writes files with the 1.8 format
+// (H5Pset_libver_bounds with H5F_LIBVER_V18), which is what h5py gives with libver="v108": a version 2 superblock,
+// version 2 object headers with checksums, and groups that keep more than 8 links in a fractal heap indexed by a
+// version 2 B-tree of link name hashes. The root group holds
+//
+//	x1 ... x7  scalar doubles with compact layouts
+//	vec        a 1x5 int32 row with a contiguous layout, whose attribute is in a continuation chunk
+//	chunky     a 20x30 double matrix in 16x16 chunks, shuffled and deflated
+//	s          a struct with the fields f01 ... f60, which spread over two heap blocks and three B-tree nodes
+//
+// Run it from the testdata directory with go run gendense.go
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+const (
+	undef     = ^uint64(0)
+	userBlock = 512
+	nodeSize  = 512 // of the v2 B-tree nodes, as libhdf5 uses for link name indices
+	blockSize = 512 // starting block size of the link fractal heaps
+	heapIDLen = 7   // a byte for version and type, 4 for the offset and 2 for the length
+)
+
+// timestamp of the objects that track times
+const timestamp = 1792324800
+
+var le = binary.LittleEndian
+
+// file collects the HDF5 data. Addresses are relative to the superblock, which comes first.
+type file struct {
+	buf []byte
+}
+
+func (f *file) alloc(n int) uint64 {
+	addr := uint64(len(f.buf))
+	f.buf = append(f.buf, make([]byte, n)...)
+	return addr
+}
+
+func (f *file) put(addr uint64, b []byte) {
+	copy(f.buf[addr:], b)
+}
+
+func (f *file) write(b []byte) uint64 {
+	addr := f.alloc(len(b))
+	f.put(addr, b)
+	return addr
+}
+
+// enc builds little endian structures
+type enc struct {
+	bytes.Buffer
+}
+
+func (e *enc) u8(v uint8)   { e.WriteByte(v) }
+func (e *enc) u16(v uint16) { binary.Write(e, le, v) }
+func (e *enc) u32(v uint32) { binary.Write(e, le, v) }
+func (e *enc) u64(v uint64) { binary.Write(e, le, v) }
+
+// checksum appends the lookup3 checksum of everything written so far
+func (e *enc) checksum() {
+	e.u32(lookup3(e.Bytes()))
+}
+
+// lookup3 is Bob Jenkins' hashlittle with an initial value of 0, which HDF5 uses for checksums and link name hashes
+func lookup3(k []byte) uint32 {
+	rot := bits.RotateLeft32
+	a := 0xdeadbeef + uint32(len(k))
+	b, c := a, a
+	for len(k) > 12 {
+		a += le.Uint32(k)
+		b += le.Uint32(k[4:])
+		c += le.Uint32(k[8:])
+		a -= c
+		a ^= rot(c, 4)
+		c += b
+		b -= a
+		b ^= rot(a, 6)
+		a += c
+		c -= b
+		c ^= rot(b, 8)
+		b += a
+		a -= c
+		a ^= rot(c, 16)
+		c += b
+		b -= a
+		b ^= rot(a, 19)
+		a += c
+		c -= b
+		c ^= rot(b, 4)
+		b += a
+		k = k[12:]
+	}
+	if len(k) == 0 {
+		return c
+	}
+	var tail [12]byte
+	copy(tail[:], k)
+	a += le.Uint32(tail[:])
+	b += le.Uint32(tail[4:])
+	c += le.Uint32(tail[8:])
+	c ^= b
+	c -= rot(b, 14)
+	a ^= c
+	a -= rot(c, 11)
+	b ^= a
+	b -= rot(a, 25)
+	c ^= b
+	c -= rot(b, 16)
+	a ^= c
+	a -= rot(c, 4)
+	b ^= a
+	b -= rot(a, 14)
+	c ^= b
+	c -= rot(b, 24)
+	return c
+}
+
+type msg struct {
+	typ   uint8
+	flags uint8
+	data  []byte
+}
+
+func messages(e *enc, msgs []msg) {
+	for _, m := range msgs {
+		e.u8(m.typ)
+		e.u16(uint16(len(m.data)))
+		e.u8(m.flags)
+		e.Write(m.data)
+	}
+}
+
+// object writes a version 2 object header. The low bits of flags give the size of the chunk size field, 0x20 adds
+// times.
+func (f *file) object(flags uint8, msgs []msg) uint64 {
+	var body enc
+	messages(&body, msgs)
+	e := &enc{}
+	e.WriteString("OHDR")
+	e.u8(2)
+	e.u8(flags)
+	if flags&0x20 != 0 {
+		for i := 0; i < 4; i++ {
+			e.u32(timestamp)
+		}
+	}
+	switch flags & 0x03 {
+	case 0:
+		e.u8(uint8(body.Len()))
+	case 1:
+		e.u16(uint16(body.Len()))
+	case 2:
+		e.u32(uint32(body.Len()))
+	}
+	e.Write(body.Bytes())
+	e.checksum()
+	return f.write(e.Bytes())
+}
+
+// continuation writes an OCHK chunk and returns the continuation message pointing to it
+func (f *file) continuation(msgs []msg) msg {
+	e := &enc{}
+	e.WriteString("OCHK")
+	messages(e, msgs)
+	e.checksum()
+	addr := f.write(e.Bytes())
+	var m enc
+	m.u64(addr)
+	m.u64(uint64(e.Len()))
+	return msg{typ: 0x10, data: m.Bytes()}
+}
+
+func dataspace(dims ...uint64) msg {
+	e := &enc{}
+	e.u8(2)
+	e.u8(uint8(len(dims)))
+	e.u8(0)
+	if len(dims) == 0 {
+		e.u8(0) // scalar
+	} else {
+		e.u8(1) // simple
+	}
+	for _, d := range dims {
+		e.u64(d)
+	}
+	return msg{typ: 0x01, data: e.Bytes()}
+}
+
+func doubleType() []byte {
+	e := &enc{}
+	e.Write([]byte{0x11, 0x20, 0x3f, 0x00})
+	e.u32(8)
+	e.u16(0)  // bit offset
+	e.u16(64) // precision
+	e.Write([]byte{52, 11, 0, 52})
+	e.u32(1023)
+	return e.Bytes()
+}
+
+func int32Type() []byte {
+	e := &enc{}
+	e.Write([]byte{0x10, 0x08, 0x00, 0x00})
+	e.u32(4)
+	e.u16(0)
+	e.u16(32)
+	return e.Bytes()
+}
+
+func datatype(t []byte) msg {
+	return msg{typ: 0x03, flags: 0x01, data: t}
+}
+
+// fillValue is a version 3 fill value message with the given allocation time, written if set
+func fillValue(allocTime uint8) msg {
+	return msg{typ: 0x05, flags: 0x01, data: []byte{3, allocTime | 2<<2}}
+}
+
+// classAttribute is the MATLAB_class attribute as a version 3 attribute message with a fixed length string
+func classAttribute(class string) msg {
+	name := "MATLAB_class\x00"
+	typ := &enc{}
+	typ.Write([]byte{0x13, 0x00, 0x00, 0x00})
+	typ.u32(uint32(len(class)))
+	space := dataspace().data
+	e := &enc{}
+	e.u8(3)
+	e.u8(0)
+	e.u16(uint16(len(name)))
+	e.u16(uint16(typ.Len()))
+	e.u16(uint16(len(space)))
+	e.u8(0) // ASCII
+	e.WriteString(name)
+	e.Write(typ.Bytes())
+	e.Write(space)
+	e.WriteString(class)
+	return msg{typ: 0x0C, data: e.Bytes()}
+}
+
+// compactDouble writes a scalar double with a compact layout
+func (f *file) compactDouble(v float64) uint64 {
+	layout := &enc{}
+	layout.Write([]byte{3, 0})
+	layout.u16(8)
+	layout.u64(math.Float64bits(v))
+	return f.object(0, []msg{
+		dataspace(1, 1),
+		datatype(doubleType()),
+		fillValue(1),
+		{typ: 0x08, data: layout.Bytes()},
+		classAttribute("double"),
+	})
+}
+
+// contiguousInt32 writes a row of int32 values with a contiguous layout. The attribute goes into a continuation
+// chunk, as libhdf5 does when attributes are added once the header is full.
+func (f *file) contiguousInt32(values []int32) uint64 {
+	data := &enc{}
+	for _, v := range values {
+		data.u32(uint32(v))
+	}
+	addr := f.write(data.Bytes())
+	layout := &enc{}
+	layout.Write([]byte{3, 1})
+	layout.u64(addr)
+	layout.u64(uint64(data.Len()))
+	cont := f.continuation([]msg{classAttribute("int32")})
+	return f.object(0x20, []msg{
+		dataspace(uint64(len(values)), 1),
+		datatype(int32Type()),
+		fillValue(2),
+		{typ: 0x08, data: layout.Bytes()},
+		cont,
+	})
+}
+
+// chunkedDouble writes a matrix of doubles with the given HDF5 dimensions in chunks that are shuffled and deflated
+func (f *file) chunkedDouble(dims, chunk [2]uint64, value func(i uint64) float64) uint64 {
+	type entry struct {
+		size    uint32
+		offsets [2]uint64
+		addr    uint64
+	}
+	var entries []entry
+	for r := uint64(0); r < dims[0]; r += chunk[0] {
+		for c := uint64(0); c < dims[1]; c += chunk[1] {
+			n := chunk[0] * chunk[1]
+			raw := make([]byte, 8*n)
+			for i := uint64(0); i < chunk[0]; i++ {
+				for j := uint64(0); j < chunk[1]; j++ {
+					if r+i < dims[0] && c+j < dims[1] {
+						le.PutUint64(raw[8*(i*chunk[1]+j):], math.Float64bits(value((r+i)*dims[1]+c+j)))
+					}
+				}
+			}
+			shuffled := make([]byte, len(raw))
+			for b := uint64(0); b < 8; b++ {
+				for i := uint64(0); i < n; i++ {
+					shuffled[b*n+i] = raw[i*8+b]
+				}
+			}
+			var z bytes.Buffer
+			zw, _ := zlib.NewWriterLevel(&z, 4)
+			zw.Write(shuffled)
+			zw.Close()
+			entries = append(entries, entry{uint32(z.Len()), [2]uint64{r, c}, f.write(z.Bytes())})
+		}
+	}
+
+	// a version 1 B-tree leaf with room for 64 chunks, as libhdf5 allocates them
+	key := func(e *enc, size uint32, offsets [2]uint64) {
+		e.u32(size)
+		e.u32(0) // filter mask
+		e.u64(offsets[0])
+		e.u64(offsets[1])
+		e.u64(0)
+	}
+	tree := &enc{}
+	tree.WriteString("TREE")
+	tree.u8(1)
+	tree.u8(0)
+	tree.u16(uint16(len(entries)))
+	tree.u64(undef)
+	tree.u64(undef)
+	for _, en := range entries {
+		key(tree, en.size, en.offsets)
+		tree.u64(en.addr)
+	}
+	key(tree, 0, [2]uint64{(dims[0] + chunk[0] - 1) / chunk[0] * chunk[0], 0})
+	btree := f.alloc(24 + 64*40 + 32)
+	f.put(btree, tree.Bytes())
+
+	pline := &enc{}
+	pline.u8(2)
+	pline.u8(2)
+	for _, flt := range [][2]uint16{{2, 8}, {1, 4}} { // shuffle by the element size, deflate at level 4
+		pline.u16(flt[0])
+		pline.u16(1) // optional
+		pline.u16(1)
+		pline.u32(uint32(flt[1]))
+	}
+	layout := &enc{}
+	layout.Write([]byte{3, 2, 3})
+	layout.u64(btree)
+	layout.u32(uint32(chunk[0]))
+	layout.u32(uint32(chunk[1]))
+	layout.u32(8)
+	return f.object(0x02, []msg{
+		dataspace(dims[0], dims[1]),
+		datatype(doubleType()),
+		fillValue(3),
+		{typ: 0x0B, flags: 0x01, data: pline.Bytes()},
+		{typ: 0x08, data: layout.Bytes()},
+		classAttribute("double"),
+	})
+}
+
+type link struct {
+	name string
+	addr uint64
+}
+
+// linkMessage encodes a hard link as a version 1 link message
+func linkMessage(l link) []byte {
+	e := &enc{}
+	e.u8(1)
+	e.u8(0)
+	e.u8(uint8(len(l.name)))
+	e.WriteString(l.name)
+	e.u64(l.addr)
+	return e.Bytes()
+}
+
+// group writes a group that stores its links densely, with the given attributes
+func (f *file) group(links []link, attrs ...msg) uint64 {
+	heap, index := f.denseLinks(links)
+	info := &enc{}
+	info.u8(0)
+	info.u8(0)
+	info.u64(heap)
+	info.u64(index)
+	msgs := []msg{{typ: 0x02, data: info.Bytes()}, {typ: 0x0A, data: []byte{0, 0}}}
+	return f.object(0, append(msgs, attrs...))
+}
+
+// denseLinks stores the links in a fractal heap and indexes them by the hashes of their names in a v2 B-tree
+func (f *file) denseLinks(links []link) (heap, index uint64) {
+	const headerLen = 4 + 1 + 8 + 4 + 4 // of a direct block, the last 4 bytes are its checksum
+	heap = f.alloc(146)
+
+	// fill the direct blocks in turn
+	type record struct {
+		hash uint32
+		id   []byte
+	}
+	var blocks [][]byte
+	var records []record
+	for _, l := range links {
+		obj := linkMessage(l)
+		if len(blocks) == 0 || len(blocks[len(blocks)-1])+len(obj) > blockSize {
+			blocks = append(blocks, make([]byte, headerLen, blockSize))
+		}
+		b := &blocks[len(blocks)-1]
+		id := &enc{}
+		id.u8(0)
+		id.u32(uint32((len(blocks)-1)*blockSize + len(*b)))
+		id.u16(uint16(len(obj)))
+		records = append(records, record{lookup3([]byte(l.name)), id.Bytes()})
+		*b = append(*b, obj...)
+	}
+	var addrs []uint64
+	free := 0
+	for i, b := range blocks {
+		free += blockSize - len(b)
+		b = b[:blockSize]
+		copy(b, "FHDB")
+		b[4] = 0
+		le.PutUint64(b[5:], heap)
+		le.PutUint32(b[13:], uint32(i*blockSize))
+		le.PutUint32(b[17:], lookup3(b))
+		addrs = append(addrs, f.write(b))
+	}
+	root, rows, space := addrs[0], uint16(0), uint64(blockSize)
+	if len(blocks) > 1 {
+		// a root indirect block with a row of 4 direct blocks
+		e := &enc{}
+		e.WriteString("FHIB")
+		e.u8(0)
+		e.u64(heap)
+		e.u32(0)
+		for i := 0; i < 4; i++ {
+			if i < len(addrs) {
+				e.u64(addrs[i])
+			} else {
+				e.u64(undef)
+			}
+		}
+		e.checksum()
+		root, rows, space = f.write(e.Bytes()), 1, 4*blockSize
+	}
+
+	h := &enc{}
+	h.WriteString("FRHP")
+	h.u8(0)
+	h.u16(heapIDLen)
+	h.u16(0)
+	h.u8(0x02) // direct blocks are checksummed
+	h.u32(4096)
+	h.u64(0)     // next huge object id
+	h.u64(undef) // huge object B-tree
+	h.u64(uint64(free))
+	h.u64(undef) // free space manager
+	h.u64(space)
+	h.u64(uint64(len(blocks) * blockSize))
+	h.u64(uint64(len(blocks) * blockSize)) // direct block allocation iterator
+	h.u64(uint64(len(links)))
+	for i := 0; i < 4; i++ {
+		h.u64(0) // size and number of huge and tiny objects
+	}
+	h.u16(4)
+	h.u64(blockSize)
+	h.u64(64 * 1024)
+	h.u16(32)
+	h.u16(1)
+	h.u64(root)
+	h.u16(rows)
+	h.checksum()
+	f.put(heap, h.Bytes())
+
+	sort.Slice(records, func(i, j int) bool { return records[i].hash < records[j].hash })
+	for i := 1; i < len(records); i++ {
+		if records[i].hash == records[i-1].hash {
+			panic("link name hashes collide")
+		}
+	}
+	const recordSize = 4 + heapIDLen
+	node := func(sig string, recs []record, children func(e *enc)) uint64 {
+		e := &enc{}
+		e.WriteString(sig)
+		e.u8(0)
+		e.u8(5)
+		for _, r := range recs {
+			e.u32(r.hash)
+			e.Write(r.id)
+		}
+		children(e)
+		e.checksum()
+		addr := f.alloc(nodeSize)
+		f.put(addr, e.Bytes())
+		return addr
+	}
+	leaf := func(recs []record) uint64 {
+		return node("BTLF", recs, func(*enc) {})
+	}
+	maxLeaf := (nodeSize - 10) / recordSize
+	var rootNode uint64
+	var rootRecords, depth int
+	if len(records) <= maxLeaf {
+		rootNode, rootRecords = leaf(records), len(records)
+	} else {
+		// split into two leaves around the middle record, as libhdf5 does when the root leaf overflows
+		mid := len(records) / 2
+		left, right := leaf(records[:mid]), leaf(records[mid+1:])
+		rootNode = node("BTIN", records[mid:mid+1], func(e *enc) {
+			e.u64(left)
+			e.u8(uint8(mid))
+			e.u64(right)
+			e.u8(uint8(len(records) - mid - 1))
+		})
+		rootRecords, depth = 1, 1
+	}
+	b := &enc{}
+	b.WriteString("BTHD")
+	b.u8(0)
+	b.u8(5)
+	b.u32(nodeSize)
+	b.u16(recordSize)
+	b.u16(uint16(depth))
+	b.u8(100)
+	b.u8(40)
+	b.u64(rootNode)
+	b.u16(uint16(rootRecords))
+	b.u64(uint64(len(records)))
+	b.checksum()
+	index = f.write(b.Bytes())
+	return heap, index
+}
+
+func main() {
+	f := &file{}
+	super := f.alloc(48)
+
+	var root []link
+	for i := 1; i <= 7; i++ {
+		root = append(root, link{fmt.Sprintf("x%d", i), f.compactDouble(1.5 * float64(i))})
+	}
+	root = append(root, link{"vec", f.contiguousInt32([]int32{-2, -1, 0, 1, 2})})
+	// a 20x30 matrix is stored as 30x20 in HDF5, so that its values are in column major order
+	root = append(root, link{"chunky", f.chunkedDouble([2]uint64{30, 20}, [2]uint64{16, 16}, func(i uint64) float64 {
+		return float64(i) / 4
+	})})
+	var fields []link
+	for i := 1; i <= 60; i++ {
+		fields = append(fields, link{fmt.Sprintf("f%02d", i), f.compactDouble(float64(i))})
+	}
+	root = append(root, link{"s", f.group(fields, classAttribute("struct"))})
+	rootAddr := f.group(root)
+
+	s := &enc{}
+	s.WriteString("\x89HDF\r\n\x1a\n")
+	s.Write([]byte{2, 8, 8, 0})
+	s.u64(0)     // base address
+	s.u64(undef) // superblock extension
+	s.u64(uint64(len(f.buf)))
+	s.u64(rootAddr)
+	s.checksum()
+	f.put(super, s.Bytes())
+
+	header := make([]byte, userBlock)
+	text := fmt.Sprintf("%-116s", "MATLAB 7.3 MAT-file, Platform: GLNXA64, Created on: Sun Oct 18 12:00:00 2026 HDF5 schema 1.00 .")
+	copy(header, text)
+	copy(header[124:], []byte{0x00, 0x02, 'I', 'M'})
+	if err := ioutil.WriteFile("dense.mat", append(header, f.buf...), 0644); err != nil {
+		panic(err)
+	}
+}
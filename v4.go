@@ -0,0 +1,429 @@
+package matlab
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// Level 4 .mat files have no file header. Each matrix starts with a 20 byte header of five int32 values: the MOPT type,
+// the number of rows and columns, whether there is an imaginary part and the length of the name including the
+// terminating NUL. The MOPT type is a decimal number where M is the machine format, O is always 0, P is the precision
+// of the data and T is the matrix type.
+
+// Machine formats (M) of level 4 files
+const (
+	v4IEEELittleEndian = iota
+	v4IEEEBigEndian
+	v4VAXDFloat
+	v4VAXGFloat
+	v4Cray
+)
+
+// Precisions (P) of level 4 data
+const (
+	v4Double = iota
+	v4Single
+	v4Int32
+	v4Int16
+	v4Uint16
+	v4Uint8
+)
+
+// Matrix types (T) of level 4 files
+const (
+	v4Numeric = iota
+	v4Text
+	v4Sparse
+)
+
+const v4HeaderLen = 20
+
+// mopt is the decoded type of a level 4 matrix
+type mopt struct {
+	m, o, p, t int
+}
+
+func (t mopt) byteOrder() binary.ByteOrder {
+	if t.m == v4IEEEBigEndian {
+		return binary.BigEndian
+	}
+	// VAX machines store integers as little endian
+	return binary.LittleEndian
+}
+
+// size returns the number of bytes of a single value of the precision
+func (t mopt) size() int {
+	switch t.p {
+	case v4Double:
+		return 8
+	case v4Single, v4Int32:
+		return 4
+	case v4Int16, v4Uint16:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// parseMOPT decodes the first 4 bytes of a level 4 matrix header. The byte order isn't known yet, so both are tried
+// and the one yielding a valid type wins. Level 5 files start with text that never decodes to a valid type.
+func parseMOPT(buf []byte) (mopt, bool) {
+	for _, bo := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		v := bo.Uint32(buf)
+		if v >= 5000 {
+			continue
+		}
+		t := mopt{m: int(v / 1000), o: int(v / 100 % 10), p: int(v / 10 % 10), t: int(v % 10)}
+		if t.o != 0 || t.p > v4Uint8 || t.t > v4Sparse {
+			continue
+		}
+		if t.byteOrder() != bo {
+			continue
+		}
+		return t, true
+	}
+	return mopt{}, false
+}
+
+func (f *File) readV4Header(t mopt) error {
+	h := f.Header
+	h.Level = "4.0"
+	h.Endianess = t.byteOrder()
+	switch t.m {
+	case v4IEEELittleEndian:
+		h.Platform = "IEEE little endian"
+	case v4IEEEBigEndian:
+		h.Platform = "IEEE big endian"
+	case v4VAXDFloat:
+		h.Platform = "VAX D-float"
+	case v4VAXGFloat:
+		h.Platform = "VAX G-float"
+	default:
+		return fmt.Errorf("cannot read level 4 files of machine format %d", t.m)
+	}
+	return nil
+}
+
+func readAllV4Matrices(r io.Reader, opts *ReaderOptions) ([]Element, error) {
+	d := newDecoder(binary.LittleEndian, opts)
+	var res []Element
+	for {
+		m, err := d.readV4Matrix(r)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		variableRead(r, m.Name)
+		res = append(res, m)
+	}
+	return res, nil
+}
+
+// readV4Matrix reads the next matrix within the limits of the decoder
+func (d *decoder) readV4Matrix(r io.Reader) (*Matrix, error) {
+	buf, err := readAllBytes(v4HeaderLen, r)
+	if err != nil {
+		return nil, err
+	}
+	t, ok := parseMOPT(buf)
+	if !ok {
+		return nil, fmt.Errorf("invalid level 4 matrix type: % x", buf[:4])
+	}
+	if t.m > v4VAXGFloat {
+		return nil, fmt.Errorf("cannot read level 4 matrices of machine format %d", t.m)
+	}
+	bo := t.byteOrder()
+	rows, cols := int(int32(bo.Uint32(buf[4:]))), int(int32(bo.Uint32(buf[8:])))
+	imagf, nameLen := bo.Uint32(buf[12:]) != 0, int(int32(bo.Uint32(buf[16:])))
+	if rows < 0 || cols < 0 || nameLen < 0 || rows > 0 && cols > maxInt/8/rows {
+		return nil, fmt.Errorf("invalid level 4 matrix header")
+	}
+	size := int64(nameLen) + int64(rows*cols*t.size())
+	if imagf {
+		size += int64(rows * cols * t.size())
+	}
+	if size > int64(maxInt) {
+		return nil, fmt.Errorf("level 4 matrix of %d bytes is too large", size)
+	}
+	if err := d.reserve(int(size)); err != nil {
+		return nil, err
+	}
+
+	name, err := readAllBytes(nameLen, r)
+	if err != nil {
+		return nil, err
+	}
+	for i, c := range name {
+		if c == 0 {
+			name = name[:i]
+			break
+		}
+	}
+	real, err := readV4Data(t, r, rows*cols)
+	if err != nil {
+		return nil, err
+	}
+	var imag []float64
+	if imagf {
+		if imag, err = readV4Data(t, r, rows*cols); err != nil {
+			return nil, err
+		}
+	}
+
+	m := &Matrix{
+		Name:      string(name),
+		Class:     mxDOUBLE,
+		Dimension: []int32{int32(rows), int32(cols)},
+	}
+	switch t.t {
+	case v4Numeric:
+		m.value = float64Values(real)
+		if imagf {
+			m.flags.isComplex = true
+			m.imag = float64Values(imag)
+		}
+	case v4Text:
+		m.Class = mxCHAR
+		m.value = castValues(mxCHAR, float64Values(real))
+	case v4Sparse:
+		if err := m.fromV4Sparse(d, real, rows, cols); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// readV4Data reads n values of the precision of t as float64
+func readV4Data(t mopt, r io.Reader, n int) ([]float64, error) {
+	size := t.size()
+	buf, err := readAllBytes(n*size, r)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	bo := t.byteOrder()
+	res := make([]float64, n)
+	for i := range res {
+		b := buf[i*size : (i+1)*size]
+		switch t.p {
+		case v4Double:
+			switch t.m {
+			case v4VAXDFloat:
+				res[i] = vaxDFloat(b)
+			case v4VAXGFloat:
+				res[i] = vaxGFloat(b)
+			default:
+				res[i] = math.Float64frombits(bo.Uint64(b))
+			}
+		case v4Single:
+			if t.m == v4VAXDFloat || t.m == v4VAXGFloat {
+				res[i] = vaxFFloat(b)
+			} else {
+				res[i] = float64(math.Float32frombits(bo.Uint32(b)))
+			}
+		case v4Int32:
+			res[i] = float64(int32(bo.Uint32(b)))
+		case v4Int16:
+			res[i] = float64(int16(bo.Uint16(b)))
+		case v4Uint16:
+			res[i] = float64(bo.Uint16(b))
+		case v4Uint8:
+			res[i] = float64(b[0])
+		}
+	}
+	return res, nil
+}
+
+// vaxWords joins the little endian 16 bit words of a VAX float, which are stored most significant word first
+func vaxWords(b []byte) uint64 {
+	var res uint64
+	for i := 0; i < len(b); i += 2 {
+		res = res<<16 | uint64(binary.LittleEndian.Uint16(b[i:]))
+	}
+	return res
+}
+
+// vaxFloat decodes a VAX float with the given number of exponent and fraction bits. The value is 0.1f * 2^(e-bias),
+// where the leading 1 of the fraction is hidden.
+func vaxFloat(bits uint64, expBits, fracBits uint, bias int) float64 {
+	exp := int(bits >> fracBits & (1<<expBits - 1))
+	if exp == 0 {
+		// zero, or a reserved operand if the sign is set
+		return 0
+	}
+	frac := float64(bits&(1<<fracBits-1))/float64(uint64(1)<<fracBits) + 1
+	v := math.Ldexp(frac/2, exp-bias)
+	if bits>>(expBits+fracBits)&1 == 1 {
+		return -v
+	}
+	return v
+}
+
+func vaxFFloat(b []byte) float64 {
+	return vaxFloat(vaxWords(b[:4]), 8, 23, 128)
+}
+
+func vaxDFloat(b []byte) float64 {
+	return vaxFloat(vaxWords(b[:8]), 8, 55, 128)
+}
+
+func vaxGFloat(b []byte) float64 {
+	return vaxFloat(vaxWords(b[:8]), 11, 52, 1024)
+}
+
+// fromV4Sparse fills m from a level 4 sparse matrix. It is stored as a rows x 3 (or x 4 when complex) matrix of 1
+// based row indices, column indices and values. The last row holds the dimensions of the sparse matrix, whose column
+// indices are checked against the size of the matrix and the limits of the decoder as they are not in the file.
+func (m *Matrix) fromV4Sparse(d *decoder, data []float64, rows, cols int) error {
+	if rows < 1 || cols != 3 && cols != 4 {
+		return fmt.Errorf("invalid level 4 sparse matrix of size %dx%d", rows, cols)
+	}
+	col := func(j int) []float64 {
+		return data[j*rows : (j+1)*rows]
+	}
+	is, js, re := col(0), col(1), col(2)
+	for _, n := range []float64{is[rows-1], js[rows-1]} {
+		if !(n >= 0 && n < math.MaxInt32) || n != math.Trunc(n) {
+			return fmt.Errorf("invalid level 4 sparse matrix of size %vx%v", is[rows-1], js[rows-1])
+		}
+	}
+	if err := d.checkSize(8 * (int(js[rows-1]) + 1)); err != nil {
+		return err
+	}
+	// the column indices are not stored, so they are limited by the values that are
+	if err := checkExpansion(8*(int64(js[rows-1])+1), 8*int64(len(data))); err != nil {
+		return fmt.Errorf("level 4 sparse matrix %s: %v", m.Name, err)
+	}
+	m.Class = mxSPARSE
+	m.Dimension = []int32{int32(is[rows-1]), int32(js[rows-1])}
+	nnz := rows - 1
+	order := make([]int, nnz)
+	for k := range order {
+		order[k] = k
+		if is[k] < 1 || is[k] > float64(m.Dimension[0]) || js[k] < 1 || js[k] > float64(m.Dimension[1]) {
+			return fmt.Errorf("invalid level 4 sparse matrix, index (%v,%v) is out of bounds", is[k], js[k])
+		}
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		if js[order[a]] != js[order[b]] {
+			return js[order[a]] < js[order[b]]
+		}
+		return is[order[a]] < is[order[b]]
+	})
+	m.ir = make([]int, nnz)
+	m.jc = make([]int, m.Dimension[1]+1)
+	m.value = make([]interface{}, nnz)
+	if cols == 4 {
+		m.flags.isComplex = true
+		m.imag = make([]interface{}, nnz)
+	}
+	for k, o := range order {
+		m.ir[k] = int(is[o]) - 1
+		m.jc[int(js[o])]++
+		m.value[k] = re[o]
+		if cols == 4 {
+			m.imag[k] = col(3)[o]
+		}
+	}
+	for j := 1; j < len(m.jc); j++ {
+		m.jc[j] += m.jc[j-1]
+	}
+	return nil
+}
+
+func float64Values(data []float64) []interface{} {
+	res := make([]interface{}, len(data))
+	for i, v := range data {
+		res[i] = v
+	}
+	return res
+}
+
+// writeV4Matrix writes m as a level 4 matrix. Level 4 files only hold 2 dimensional numeric, character and sparse
+// matrices. Doubles, singles and the integer classes the format knows keep their precision, everything else is
+// written as double.
+func writeV4Matrix(w io.Writer, bo binary.ByteOrder, m *Matrix) error {
+	if len(m.Dimension) != 2 {
+		return fmt.Errorf("cannot write %d dimensional matrix %s to a level 4 file", len(m.Dimension), m.Name)
+	}
+	t := mopt{p: v4Double}
+	if bo == binary.BigEndian {
+		t.m = v4IEEEBigEndian
+	}
+	rows, cols := int(m.Dimension[0]), int(m.Dimension[1])
+	var real, imag []interface{}
+	class := mxDOUBLE
+	switch m.Class {
+	case mxDOUBLE, mxSINGLE, mxINT32, mxINT16, mxUINT16, mxUINT8, mxINT8, mxUINT32, mxINT64, mxUINT64:
+		switch m.Class {
+		case mxSINGLE:
+			t.p, class = v4Single, mxSINGLE
+		case mxINT32:
+			t.p, class = v4Int32, mxINT32
+		case mxINT16:
+			t.p, class = v4Int16, mxINT16
+		case mxUINT16:
+			t.p, class = v4Uint16, mxUINT16
+		case mxUINT8:
+			t.p, class = v4Uint8, mxUINT8
+		}
+		real = m.value
+		if m.flags.isComplex {
+			imag = m.imag
+		}
+	case mxCHAR:
+		t.t = v4Text
+		real = m.value
+	case mxSPARSE:
+		t.t = v4Sparse
+		rows, cols = len(m.value)+1, 3
+		if m.flags.isComplex {
+			cols = 4
+		}
+		real = make([]interface{}, rows*cols)
+		for j := 0; j < len(m.jc)-1; j++ {
+			for k := m.jc[j]; k < m.jc[j+1]; k++ {
+				real[k] = float64(m.ir[k] + 1)
+				real[rows+k] = float64(j + 1)
+				real[2*rows+k] = m.value[k]
+				if cols == 4 {
+					real[3*rows+k] = m.imag[k]
+				}
+			}
+		}
+		real[rows-1] = float64(m.Dimension[0])
+		real[2*rows-1] = float64(m.Dimension[1])
+		real[3*rows-1] = 0.0
+		if cols == 4 {
+			real[4*rows-1] = 0.0
+		}
+	default:
+		return fmt.Errorf("cannot write matrix %s of class %s to a level 4 file", m.Name, m.Class)
+	}
+
+	header := make([]byte, v4HeaderLen)
+	bo.PutUint32(header, uint32(t.m*1000+t.o*100+t.p*10+t.t))
+	bo.PutUint32(header[4:], uint32(rows))
+	bo.PutUint32(header[8:], uint32(cols))
+	if imag != nil {
+		bo.PutUint32(header[12:], 1)
+	}
+	bo.PutUint32(header[16:], uint32(len(m.Name)+1))
+	for _, b := range [][]byte{header, append([]byte(m.Name), 0), encodeValues(bo, class, real)} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	if imag != nil {
+		_, err := w.Write(encodeValues(bo, class, imag))
+		return err
+	}
+	return nil
+}
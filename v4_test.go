@@ -0,0 +1,131 @@
+package matlab
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// v4Matrix builds a level 4 matrix with the given type, dimensions and raw data
+func v4Matrix(bo binary.ByteOrder, typ, rows, cols, imagf int, name string, data []byte) []byte {
+	buf := make([]byte, v4HeaderLen)
+	for i, v := range []int{typ, rows, cols, imagf, len(name) + 1} {
+		bo.PutUint32(buf[4*i:], uint32(v))
+	}
+	buf = append(buf, name...)
+	return append(append(buf, 0), data...)
+}
+
+func TestReadV4(t *testing.T) {
+	var data []byte
+	for _, v := range []float64{1, 2, 3, 4, 0.5, 0, 0, -0.5} {
+		data = binary.LittleEndian.AppendUint64(data, math.Float64bits(v))
+	}
+	var file []byte
+	file = append(file, v4Matrix(binary.LittleEndian, 0, 2, 2, 1, "a", data)...)
+	f, err := NewFileFromReader(bytes.NewReader(file))
+	assert.NoError(t, err)
+	assert.Equal(t, "4.0", f.Header.Level)
+	assert.Equal(t, binary.LittleEndian, f.Header.Endianess)
+	a, ok := f.GetVar("a")
+	assert.True(t, ok)
+	assert.Equal(t, []int32{2, 2}, a.Dimension)
+	assert.Equal(t, []complex128{1 + 0.5i, 2, 3, 4 - 0.5i}, a.ComplexArray())
+
+	// big endian text stored as uint8
+	f, err = NewFileFromReader(bytes.NewReader(v4Matrix(binary.BigEndian, 1051, 1, 2, 0, "s", []byte("hi"))))
+	assert.NoError(t, err)
+	assert.Equal(t, binary.BigEndian, f.Header.Endianess)
+	s, _ := f.GetVar("s")
+	assert.Equal(t, []rune("hi"), s.String())
+
+	// VAX D-float and G-float hold 1.0 and -2.5
+	for typ, values := range map[int][]byte{
+		2000: {0x80, 0x40, 0, 0, 0, 0, 0, 0, 0x20, 0xc1, 0, 0, 0, 0, 0, 0},
+		3000: {0x10, 0x40, 0, 0, 0, 0, 0, 0, 0x24, 0xc0, 0, 0, 0, 0, 0, 0},
+	} {
+		f, err = NewFileFromReader(bytes.NewReader(v4Matrix(binary.LittleEndian, typ, 1, 2, 0, "v", values)))
+		assert.NoError(t, err)
+		v, _ := f.GetVar("v")
+		assert.Equal(t, []float64{1, -2.5}, v.DoubleArray())
+	}
+
+	// 3x4 sparse matrix with nonzero elements at (2,1) and (1,3), the last row holds the dimensions
+	data = nil
+	for _, v := range []float64{2, 1, 3, 1, 3, 4, 5, 6, 0} {
+		data = binary.LittleEndian.AppendUint64(data, math.Float64bits(v))
+	}
+	f, err = NewFileFromReader(bytes.NewReader(v4Matrix(binary.LittleEndian, 2, 3, 3, 0, "sp", data)))
+	assert.NoError(t, err)
+	sp, _ := f.GetVar("sp")
+	assert.Equal(t, mxSPARSE, sp.Class)
+	assert.Equal(t, []int32{3, 4}, sp.Dimension)
+	assert.Equal(t, []float64{5, 6}, sp.DoubleArray())
+	ir, jc := sp.SparseIndices()
+	assert.Equal(t, []int{1, 0}, ir)
+	assert.Equal(t, []int{0, 1, 1, 2, 2}, jc)
+}
+
+func TestReadV4Limits(t *testing.T) {
+	sparse := func(rows, cols float64) []byte {
+		var data []byte
+		for _, v := range []float64{1, rows, 1, cols, 5, 0} {
+			data = binary.LittleEndian.AppendUint64(data, math.Float64bits(v))
+		}
+		return v4Matrix(binary.LittleEndian, 2, 2, 3, 0, "sp", data)
+	}
+	for _, test := range []struct {
+		data []byte
+		opts *ReaderOptions
+		err  string
+	}{
+		{sparse(-1, 5), nil, "invalid level 4 sparse matrix of size -1x5"},
+		{sparse(3, math.NaN()), nil, "invalid level 4 sparse matrix of size 3xNaN"},
+		{sparse(3, 1.5), nil, "invalid level 4 sparse matrix of size 3x1.5"},
+		// the column indices of 2e9 columns are not in the file
+		{sparse(3, 2e9), &ReaderOptions{MaxElementSize: 1 << 20}, "exceeds the limit of 1048576 bytes"},
+		{sparse(3, 2e9), nil, "level 4 sparse matrix sp: matrix of 48 bytes would take up 16000000008 bytes in memory"},
+		{v4Matrix(binary.LittleEndian, 0, 1000, 1000, 0, "a", nil), &ReaderOptions{MaxElementSize: 1 << 20},
+			"exceeds the limit of 1048576 bytes"},
+		{append(sparse(3, 5), sparse(3, 5)...), &ReaderOptions{MaxTotalBytes: 100}, "more than the limit of 100 bytes"},
+	} {
+		f, err := NewFileFromReaderWithOptions(bytes.NewReader(test.data), test.opts)
+		assert.NoError(t, err)
+		f.GetVarsNames()
+		if assert.Error(t, f.Err(), test.err) {
+			assert.Contains(t, f.Err().Error(), test.err)
+		}
+	}
+}
+
+func TestWriteV4(t *testing.T) {
+	vars := []*Matrix{
+		{Name: "d", Class: mxDOUBLE, Dimension: []int32{1, 2}, flags: Flags{isComplex: true}, value: []interface{}{1.0, 2.0}, imag: []interface{}{3.0, 4.0}},
+		{Name: "i", Class: mxINT16, Dimension: []int32{2, 1}, value: []interface{}{int16(-1), int16(7)}},
+		{Name: "c", Class: mxCHAR, Dimension: []int32{1, 3}, value: []interface{}{uint16('a'), uint16('b'), uint16('c')}},
+		{Name: "sp", Class: mxSPARSE, Dimension: []int32{3, 4}, value: []interface{}{5.0, 6.0}, ir: []int{1, 0}, jc: []int{0, 1, 1, 2, 2}},
+	}
+	for _, bo := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		var buf bytes.Buffer
+		w, err := NewFileFromWriter(&buf, &Header{Level: "4.0", Endianess: bo})
+		assert.NoError(t, err)
+		for _, v := range vars {
+			assert.NoError(t, w.WriteElement(v))
+		}
+		assert.Error(t, w.WriteElement(&Matrix{Name: "x", Class: mxDOUBLE, Dimension: []int32{1, 1, 1}, value: []interface{}{1.0}}))
+
+		f, err := NewFileFromReader(&buf)
+		assert.NoError(t, err)
+		d, _ := f.GetVar("d")
+		assert.Equal(t, vars[0], d)
+		i, _ := f.GetVar("i")
+		assert.Equal(t, []float64{-1, 7}, i.DoubleArray())
+		c, _ := f.GetVar("c")
+		assert.Equal(t, vars[2], c)
+		sp, _ := f.GetVar("sp")
+		assert.Equal(t, vars[3], sp)
+	}
+}
@@ -0,0 +1,724 @@
+package matlab
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strings"
+)
+
+// Matlab v7.3 files are HDF5 files with a 512 byte user block holding the usual 128 byte header. Each variable is a
+// dataset or group in the root group, and the MATLAB_class attribute tells the class of the variable. Numeric and
+// character data is stored with the dimensions reversed, so the data is in matlab's column major order. Cells are
+// datasets of references to objects in the "#refs#" group and structs are groups with a member for each field.
+
+// v73UserBlockLen is the position of the HDF5 superblock
+const v73UserBlockLen = 512
+
+// h5ClassNames maps the MATLAB_class attribute to the class of the matrix
+var h5ClassNames = map[string]mxClass{
+	"double":          mxDOUBLE,
+	"single":          mxSINGLE,
+	"int8":            mxINT8,
+	"uint8":           mxUINT8,
+	"int16":           mxINT16,
+	"uint16":          mxUINT16,
+	"int32":           mxINT32,
+	"uint32":          mxUINT32,
+	"int64":           mxINT64,
+	"uint64":          mxUINT64,
+	"char":            mxCHAR,
+	"logical":         mxUINT8,
+	"cell":            mxCELL,
+	"struct":          mxSTRUCT,
+	"function_handle": mxFUNCTION,
+}
+
+// openV73 opens the HDF5 part of a v7.3 file. Readers that support random access are used directly, anything else is
+// read into memory.
+func (f *File) openV73() (err error) {
+	if ra, ok := f.r.(io.ReaderAt); ok {
+		sig := make([]byte, len(h5Signature))
+		if _, err := ra.ReadAt(sig, v73UserBlockLen); err == nil && bytes.Equal(sig, h5Signature) {
+			f.h5, err = openH5(ra)
+			return err
+		}
+	}
+	rest, err := ioutil.ReadAll(f.r)
+	if err != nil {
+		return err
+	}
+	// the header has already been read, put the rest back at its position in the file
+	f.h5, err = openH5(bytes.NewReader(append(make([]byte, headerLen), rest...)))
+	return err
+}
+
+func (f *File) readAllV73(p *progressReader) ([]Element, error) {
+	if f.h5 == nil {
+		if err := f.openV73(); err != nil {
+			return nil, err
+		}
+	}
+	f.h5.maxDepth, f.h5.opts, f.h5.total = f.opts.maxDepth(), &f.opts, 0
+	root, err := f.h5.readObject(f.h5.root)
+	if err != nil {
+		return nil, err
+	}
+	links, err := f.h5.links(root)
+	if err != nil {
+		return nil, err
+	}
+	var res []Element
+	for _, l := range links {
+		// "#refs#" holds the contents of cells and "#subsystem#" the data of objects
+		if strings.HasPrefix(l.name, "#") {
+			continue
+		}
+		if err := p.ctx.Err(); err != nil {
+			return nil, err
+		}
+		m, err := f.h5.readMatrix(l.addr, l.name, 0)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read variable %s: %v", l.name, err)
+		}
+		variableRead(p, l.name)
+		res = append(res, m)
+	}
+	return res, nil
+}
+
+// readMatrix converts the object at addr into a matrix. Limiting how deeply cells and structs may be nested guards
+// against reference cycles.
+func (f *h5File) readMatrix(addr uint64, name string, depth int) (*Matrix, error) {
+	if depth > f.maxDepth {
+		return nil, fmt.Errorf("cells and structs are nested too deeply")
+	}
+	o, err := f.readObject(addr)
+	if err != nil {
+		return nil, err
+	}
+	m := &Matrix{Name: name}
+	className := ""
+	if a, ok := o.attrs["MATLAB_class"]; ok {
+		className = a.String()
+	}
+	if a, ok := o.attrs["MATLAB_global"]; ok && a.Uint() != 0 {
+		m.flags.isGlobal = true
+	}
+	class, known := h5ClassNames[className]
+	if className == "logical" {
+		m.flags.isLogical = true
+	}
+
+	if o.isGroup() {
+		if _, ok := o.attrs["MATLAB_sparse"]; ok {
+			return m, f.readSparse(m, o, class)
+		}
+		if className == "struct" || className == "" {
+			return m, f.readStruct(m, o, depth)
+		}
+		// objects and function handles
+		m.Class = mxOPAQUE
+		if known {
+			m.Class = class
+		}
+		m.Dimension = []int32{1, 1}
+		return m, nil
+	}
+	if !o.isDataset() {
+		return nil, fmt.Errorf("expects HDF5 object at %d to be a group or dataset", addr)
+	}
+	ds, err := f.readDataset(o)
+	if err != nil {
+		return nil, err
+	}
+	if className != "" && !known {
+		// objects are datasets of references into the subsystem
+		m.Class = mxOPAQUE
+		m.Dimension = ds.matlabDims()
+		return m, nil
+	}
+	if !known {
+		// not written by matlab, go by the HDF5 datatype
+		if class, err = ds.typ.matlabClass(); err != nil {
+			return nil, err
+		}
+	}
+	m.Class = class
+
+	if a, ok := o.attrs["MATLAB_empty"]; ok && a.Uint() != 0 {
+		// empty arrays hold their dimensions as data
+		for i := 0; i < int(h5Numel(ds.dims)); i++ {
+			m.Dimension = append(m.Dimension, int32(decodeUint(ds.element(i), ds.typ.bigEndian)))
+		}
+		if len(m.Dimension) < 2 {
+			m.Dimension = []int32{0, 0}
+		}
+		if class == mxSTRUCT {
+			m.value = nil
+		}
+		return m, nil
+	}
+	m.Dimension = ds.matlabDims()
+
+	switch class {
+	case mxCELL:
+		if ds.typ.class != h5Reference {
+			return nil, fmt.Errorf("expects cell to hold references")
+		}
+		for i := 0; i < int(h5Numel(ds.dims)); i++ {
+			c, err := f.readMatrix(decodeUint(ds.element(i), false), "", depth+1)
+			if err != nil {
+				return nil, err
+			}
+			m.value = append(m.value, c)
+		}
+	case mxSTRUCT:
+		return nil, fmt.Errorf("expects struct to be a group")
+	default:
+		if err := ds.numericValues(m); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// matlabDims reverses the dimensions of the dataset into matlab's order. Scalars are 1x1 and vectors are columns.
+func (ds *h5Dataset) matlabDims() []int32 {
+	res := make([]int32, len(ds.dims))
+	for i, d := range ds.dims {
+		res[len(ds.dims)-1-i] = int32(d)
+	}
+	for len(res) < 2 {
+		res = append(res, 1)
+	}
+	return res
+}
+
+// matlabClass returns the class that best holds values of the datatype
+func (t *h5Type) matlabClass() (mxClass, error) {
+	switch t.class {
+	case h5Float:
+		if t.size == 4 {
+			return mxSINGLE, nil
+		}
+		return mxDOUBLE, nil
+	case h5FixedPoint:
+		classes := map[int][2]mxClass{1: {mxUINT8, mxINT8}, 2: {mxUINT16, mxINT16}, 4: {mxUINT32, mxINT32}, 8: {mxUINT64, mxINT64}}
+		if c, ok := classes[t.size]; ok {
+			if t.signed {
+				return c[1], nil
+			}
+			return c[0], nil
+		}
+	case h5String:
+		return mxCHAR, nil
+	case h5Compound:
+		if re, _, ok := t.complexParts(); ok {
+			return re.typ.matlabClass()
+		}
+	case h5Reference:
+		return mxCELL, nil
+	}
+	return mxUNKNOWN, fmt.Errorf("cannot convert HDF5 datatype class %d of size %d", t.class, t.size)
+}
+
+// complexParts returns the real and imaginary members of a compound type holding complex numbers
+func (t *h5Type) complexParts() (re, im h5Member, ok bool) {
+	if t.class != h5Compound || len(t.members) != 2 {
+		return re, im, false
+	}
+	for _, m := range t.members {
+		switch m.name {
+		case "real":
+			re = m
+		case "imag":
+			im = m
+		default:
+			return re, im, false
+		}
+	}
+	return re, im, re.typ != nil && im.typ != nil
+}
+
+// numericValues decodes the data of a numeric, logical or character dataset as values of the matrix class
+func (ds *h5Dataset) numericValues(m *Matrix) error {
+	n := int(h5Numel(ds.dims))
+	typ := ds.typ
+	if re, im, ok := typ.complexParts(); ok {
+		m.flags.isComplex = true
+		m.value, m.imag = make([]interface{}, n), make([]interface{}, n)
+		for i := 0; i < n; i++ {
+			el := ds.element(i)
+			r, err := decodeH5Value(re.typ, el[re.offset:])
+			if err != nil {
+				return err
+			}
+			v, err := decodeH5Value(im.typ, el[im.offset:])
+			if err != nil {
+				return err
+			}
+			m.value[i], m.imag[i] = castValue(m.Class, r), castValue(m.Class, v)
+		}
+		return nil
+	}
+	if typ.class == h5String {
+		// fixed length strings, e.g. written by other tools, become a column of rows
+		m.Class = mxCHAR
+		rows := make([][]rune, n)
+		width := 0
+		for i := range rows {
+			rows[i] = []rune(strings.TrimRight(string(ds.element(i)), "\x00 "))
+			if len(rows[i]) > width {
+				width = len(rows[i])
+			}
+		}
+		m.Dimension = []int32{int32(n), int32(width)}
+		m.value = make([]interface{}, n*width)
+		for j := 0; j < width; j++ {
+			for i, r := range rows {
+				c := ' '
+				if j < len(r) {
+					c = r[j]
+				}
+				m.value[j*n+i] = uint16(c)
+			}
+		}
+		return nil
+	}
+	m.value = make([]interface{}, n)
+	for i := range m.value {
+		v, err := decodeH5Value(typ, ds.element(i))
+		if err != nil {
+			return err
+		}
+		m.value[i] = castValue(m.Class, v)
+	}
+	return nil
+}
+
+// decodeH5Value decodes a single integer or floating point value
+func decodeH5Value(t *h5Type, b []byte) (interface{}, error) {
+	if len(b) < t.size {
+		return nil, fmt.Errorf("truncated HDF5 value")
+	}
+	b = b[:t.size]
+	bo := t.byteOrder()
+	switch t.class {
+	case h5Float:
+		switch t.size {
+		case 4:
+			return math.Float32frombits(bo.Uint32(b)), nil
+		case 8:
+			return math.Float64frombits(bo.Uint64(b)), nil
+		}
+	case h5FixedPoint:
+		v := decodeUint(b, t.bigEndian)
+		if !t.signed {
+			return v, nil
+		}
+		// sign extend
+		shift := uint(64 - 8*t.size)
+		return int64(v<<shift) >> shift, nil
+	}
+	return nil, fmt.Errorf("cannot decode HDF5 datatype class %d of size %d", t.class, t.size)
+}
+
+// readStruct reads a struct group. Scalar structs have a member for each field. Struct arrays have a dataset of
+// references for each field, with one reference per element.
+func (f *h5File) readStruct(m *Matrix, o *h5Object, depth int) error {
+	m.Class = mxSTRUCT
+	links, err := f.links(o)
+	if err != nil {
+		return err
+	}
+	members := map[string]uint64{}
+	for _, l := range links {
+		members[l.name] = l.addr
+	}
+	if a, ok := o.attrs["MATLAB_fields"]; ok {
+		if m.fields, err = f.attributeStrings(a); err != nil {
+			return err
+		}
+	} else {
+		for _, l := range links {
+			m.fields = append(m.fields, l.name)
+		}
+	}
+
+	// Find out whether this is a struct array by looking at the first field
+	var array *h5Dataset
+	if len(m.fields) > 0 {
+		addr, ok := members[m.fields[0]]
+		if !ok {
+			return fmt.Errorf("struct field %s not found", m.fields[0])
+		}
+		child, err := f.readObject(addr)
+		if err != nil {
+			return err
+		}
+		if _, hasClass := child.attrs["MATLAB_class"]; !hasClass && child.isDataset() {
+			if ds, err := f.readDataset(child); err != nil {
+				return err
+			} else if ds.typ.class == h5Reference {
+				array = ds
+			}
+		}
+	}
+
+	if array == nil {
+		m.Dimension = []int32{1, 1}
+		keys := map[string]*Matrix{}
+		for _, field := range m.fields {
+			addr, ok := members[field]
+			if !ok {
+				return fmt.Errorf("struct field %s not found", field)
+			}
+			c, err := f.readMatrix(addr, "", depth+1)
+			if err != nil {
+				return err
+			}
+			keys[field] = c
+		}
+		m.value = []interface{}{keys}
+		return nil
+	}
+
+	m.Dimension = array.matlabDims()
+	n := int(h5Numel(array.dims))
+	elements := make([]map[string]*Matrix, n)
+	for i := range elements {
+		elements[i] = map[string]*Matrix{}
+	}
+	for _, field := range m.fields {
+		addr, ok := members[field]
+		if !ok {
+			return fmt.Errorf("struct field %s not found", field)
+		}
+		child, err := f.readObject(addr)
+		if err != nil {
+			return err
+		}
+		ds, err := f.readDataset(child)
+		if err != nil {
+			return err
+		}
+		if ds.typ.class != h5Reference || int(h5Numel(ds.dims)) != n {
+			return fmt.Errorf("expects struct array field %s to hold %d references", field, n)
+		}
+		for i := 0; i < n; i++ {
+			c, err := f.readMatrix(decodeUint(ds.element(i), false), "", depth+1)
+			if err != nil {
+				return err
+			}
+			elements[i][field] = c
+		}
+	}
+	for _, e := range elements {
+		m.value = append(m.value, e)
+	}
+	return nil
+}
+
+// readSparse reads a sparse group. The MATLAB_sparse attribute holds the number of rows, and the group holds the
+// nonzero values in "data" along with the "ir" and "jc" indices as in level 5 files.
+func (f *h5File) readSparse(m *Matrix, o *h5Object, class mxClass) error {
+	m.Class = mxSPARSE
+	links, err := f.links(o)
+	if err != nil {
+		return err
+	}
+	datasets := map[string]*h5Dataset{}
+	for _, l := range links {
+		child, err := f.readObject(l.addr)
+		if err != nil {
+			return err
+		}
+		if datasets[l.name], err = f.readDataset(child); err != nil {
+			return err
+		}
+	}
+	indices := func(name string) ([]int, error) {
+		ds, ok := datasets[name]
+		if !ok {
+			return nil, nil
+		}
+		res := make([]int, h5Numel(ds.dims))
+		for i := range res {
+			v, err := decodeH5Value(ds.typ, ds.element(i))
+			if err != nil {
+				return nil, err
+			}
+			res[i] = int(toInt64(v))
+		}
+		return res, nil
+	}
+	if m.ir, err = indices("ir"); err != nil {
+		return err
+	}
+	if m.jc, err = indices("jc"); err != nil {
+		return err
+	}
+	if len(m.jc) == 0 {
+		return fmt.Errorf("sparse matrix has no column indices")
+	}
+	nnz := m.jc[len(m.jc)-1]
+	if nnz < 0 || nnz > len(m.ir) {
+		return fmt.Errorf("invalid sparse matrix, %d nonzero elements but %d row indices", nnz, len(m.ir))
+	}
+	m.ir = m.ir[:nnz]
+	m.Dimension = []int32{int32(o.attrs["MATLAB_sparse"].Uint()), int32(len(m.jc) - 1)}
+	if data, ok := datasets["data"]; ok {
+		values := &Matrix{Class: mxDOUBLE}
+		if class == mxUINT8 {
+			values.Class = mxUINT8
+		}
+		if err := data.numericValues(values); err != nil {
+			return err
+		}
+		if len(values.value) < nnz {
+			return fmt.Errorf("invalid sparse matrix, expects %d values", nnz)
+		}
+		m.value = values.value[:nnz]
+		if values.flags.isComplex {
+			m.flags.isComplex = true
+			m.imag = values.imag[:nnz]
+		}
+	}
+	return checkSparse(m)
+}
+
+// v73Writer writes variables as HDF5 objects. Cells and struct arrays refer to objects in the "#refs#" group, which
+// is written along with the root group when the file is closed.
+type v73Writer struct {
+	*h5Writer
+	vars []h5Link
+	refs []h5Link
+}
+
+// writeVar writes a top level variable
+func (w *v73Writer) writeVar(m *Matrix) error {
+	if !isValidName(m.Name) {
+		return fmt.Errorf("invalid variable name %q", m.Name)
+	}
+	addr, err := w.writeMatrix(m)
+	if err != nil {
+		return err
+	}
+	w.vars = append(w.vars, h5Link{name: m.Name, addr: addr})
+	return w.err
+}
+
+// close writes the "#refs#" and root groups and then the superblock
+func (w *v73Writer) close() error {
+	if len(w.refs) > 0 {
+		addr, _, _ := w.writeGroup(w.refs, nil)
+		w.vars = append(w.vars, h5Link{name: "#refs#", addr: addr})
+	}
+	root, btree, heap := w.writeGroup(w.vars, nil)
+	return w.h5Writer.close(root, btree, heap)
+}
+
+// writeRef writes a matrix into the "#refs#" group and returns the object reference to it
+func (w *v73Writer) writeRef(m *Matrix) ([]byte, error) {
+	addr, err := w.writeMatrix(m)
+	if err != nil {
+		return nil, err
+	}
+	// name the objects a, b, ..., z, ba, bb...
+	n := len(w.refs)
+	name := ""
+	for {
+		name = string(rune('a'+n%26)) + name
+		if n /= 26; n == 0 {
+			break
+		}
+	}
+	w.refs = append(w.refs, h5Link{name: name, addr: addr})
+	ref := make([]byte, 8)
+	binary.LittleEndian.PutUint64(ref, addr)
+	return ref, nil
+}
+
+// h5ClassName returns the MATLAB_class attribute of a matrix
+func h5ClassName(m *Matrix) (string, error) {
+	name := m.ClassName()
+	if c, ok := h5ClassNames[name]; !ok || c == mxFUNCTION {
+		return "", fmt.Errorf("cannot write matrix %s of class %s to a v7.3 file", m.Name, m.Class)
+	}
+	return name, nil
+}
+
+// h5DataType returns the datatype values of the class are stored as
+func (c mxClass) h5DataType() *h5Type {
+	switch c {
+	case mxDOUBLE:
+		return h5Float64
+	case mxSINGLE:
+		return h5Float32
+	case mxINT8, mxINT16, mxINT32, mxINT64:
+		return &h5Type{class: h5FixedPoint, size: c.dataType().NumBytes(), signed: true}
+	default:
+		return &h5Type{class: h5FixedPoint, size: c.dataType().NumBytes()}
+	}
+}
+
+// h5Dims reverses the dimensions of a matrix into HDF5's order
+func h5Dims(dims []int32) []uint64 {
+	res := make([]uint64, len(dims))
+	for i, d := range dims {
+		res[len(dims)-1-i] = uint64(d)
+	}
+	return res
+}
+
+// writeMatrix writes a matrix as a dataset or group and returns the address of its object header
+func (w *v73Writer) writeMatrix(m *Matrix) (uint64, error) {
+	if _, ok := m.Raw(); ok {
+		return 0, fmt.Errorf("cannot write raw matrix %s to a v7.3 file", m.Name)
+	}
+	className, err := h5ClassName(m)
+	if err != nil {
+		return 0, err
+	}
+	attrs := []h5Message{stringAttribute("MATLAB_class", className)}
+	if m.flags.isGlobal {
+		attrs = append(attrs, uintAttribute("MATLAB_global", h5Uint8, 1))
+	}
+	if m.Class == mxSPARSE {
+		return w.writeSparse(m, attrs)
+	}
+	if m.Class == mxSTRUCT && len(m.FieldNames()) > 0 {
+		attrs = append(attrs, w.varStringsAttribute("MATLAB_fields", m.FieldNames()))
+	}
+
+	if m.numel() == 0 {
+		// empty arrays store their dimensions as data
+		data := make([]byte, 8*len(m.Dimension))
+		for i, d := range m.Dimension {
+			binary.LittleEndian.PutUint64(data[8*i:], uint64(d))
+		}
+		attrs = append(attrs, uintAttribute("MATLAB_empty", h5Uint8, 1))
+		return w.writeDataset(h5Uint64, []uint64{uint64(len(m.Dimension))}, data, attrs), nil
+	}
+	if len(m.value) < m.numel() {
+		return 0, fmt.Errorf("matrix %s has %d values, expects %d", m.Name, len(m.value), m.numel())
+	}
+
+	switch m.Class {
+	case mxCELL:
+		data := make([]byte, 0, 8*len(m.value))
+		for _, v := range m.value {
+			c, ok := v.(*Matrix)
+			if !ok {
+				return 0, fmt.Errorf("expects cells of %s to be matrices, got %T", m.Name, v)
+			}
+			ref, err := w.writeRef(c)
+			if err != nil {
+				return 0, err
+			}
+			data = append(data, ref...)
+		}
+		return w.writeDataset(h5ObjectRef, h5Dims(m.Dimension), data, attrs), nil
+	case mxSTRUCT:
+		return w.writeStruct(m, attrs)
+	case mxCHAR, mxDOUBLE, mxSINGLE, mxINT8, mxUINT8, mxINT16, mxUINT16, mxINT32, mxUINT32, mxINT64, mxUINT64:
+		if m.Class == mxCHAR {
+			attrs = append(attrs, uintAttribute("MATLAB_int_decode", h5Int32, 2))
+		}
+		typ, data := m.Class.h5DataType(), encodeValues(binary.LittleEndian, m.Class, m.value)
+		if m.flags.isComplex {
+			typ, data = complexType(typ), interleave(data, encodeValues(binary.LittleEndian, m.Class, m.imag), typ.size)
+		}
+		return w.writeDataset(typ, h5Dims(m.Dimension), data, attrs), nil
+	default:
+		return 0, fmt.Errorf("cannot write matrix %s of class %s to a v7.3 file", m.Name, m.Class)
+	}
+}
+
+// interleave merges the real and imaginary parts of complex values
+func interleave(re, im []byte, size int) []byte {
+	res := make([]byte, 0, len(re)+len(im))
+	for i := 0; i+size <= len(re) && i+size <= len(im); i += size {
+		res = append(res, re[i:i+size]...)
+		res = append(res, im[i:i+size]...)
+	}
+	return res
+}
+
+// writeStruct writes a struct as a group. Scalar structs hold their fields directly, struct arrays hold a dataset of
+// references for each field.
+func (w *v73Writer) writeStruct(m *Matrix, attrs []h5Message) (uint64, error) {
+	fields := m.FieldNames()
+	elements := make([]map[string]*Matrix, len(m.value))
+	for i, v := range m.value {
+		keys, ok := v.(map[string]*Matrix)
+		if !ok {
+			return 0, fmt.Errorf("expects elements of struct %s to be maps, got %T", m.Name, v)
+		}
+		elements[i] = keys
+	}
+	field := func(keys map[string]*Matrix, name string) *Matrix {
+		if c := keys[name]; c != nil {
+			return c
+		}
+		// missing fields are written as empty arrays
+		return &Matrix{Class: mxDOUBLE, Dimension: []int32{0, 0}}
+	}
+	var links []h5Link
+	for _, name := range fields {
+		if m.numel() == 1 {
+			addr, err := w.writeMatrix(field(elements[0], name))
+			if err != nil {
+				return 0, err
+			}
+			links = append(links, h5Link{name: name, addr: addr})
+			continue
+		}
+		data := make([]byte, 0, 8*len(elements))
+		for _, keys := range elements {
+			ref, err := w.writeRef(field(keys, name))
+			if err != nil {
+				return 0, err
+			}
+			data = append(data, ref...)
+		}
+		links = append(links, h5Link{name: name, addr: w.writeDataset(h5ObjectRef, h5Dims(m.Dimension), data, nil)})
+	}
+	addr, _, _ := w.writeGroup(links, attrs)
+	return addr, nil
+}
+
+// writeSparse writes a sparse matrix as a group holding the nonzero values and the indices of the level 5 format
+func (w *v73Writer) writeSparse(m *Matrix, attrs []h5Message) (uint64, error) {
+	if len(m.Dimension) != 2 {
+		return 0, fmt.Errorf("expects sparse matrix %s to have 2 dimensions", m.Name)
+	}
+	attrs = append(attrs, uintAttribute("MATLAB_sparse", h5Uint64, uint64(m.Dimension[0])))
+	indices := func(values []int) []byte {
+		data := make([]byte, 8*len(values))
+		for i, v := range values {
+			binary.LittleEndian.PutUint64(data[8*i:], uint64(v))
+		}
+		return data
+	}
+	links := []h5Link{{name: "jc", addr: w.writeDataset(h5Uint64, []uint64{uint64(len(m.jc))}, indices(m.jc), nil)}}
+	if len(m.ir) > 0 {
+		valueClass := mxDOUBLE
+		if m.flags.isLogical {
+			valueClass = mxUINT8
+		}
+		typ, data := valueClass.h5DataType(), encodeValues(binary.LittleEndian, valueClass, m.value)
+		if m.flags.isComplex {
+			typ, data = complexType(typ), interleave(data, encodeValues(binary.LittleEndian, valueClass, m.imag), typ.size)
+		}
+		links = append(links,
+			h5Link{name: "ir", addr: w.writeDataset(h5Uint64, []uint64{uint64(len(m.ir))}, indices(m.ir), nil)},
+			h5Link{name: "data", addr: w.writeDataset(typ, []uint64{uint64(len(m.ir))}, data, nil)})
+	}
+	addr, _, _ := w.writeGroup(links, attrs)
+	return addr, nil
+}
@@ -0,0 +1,301 @@
+package matlab
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testdata/v73.mat holds the variables of varTypes.mat, mixedCells.mat and simpleStruct.mat along with a chunked
+// matrix and a global logical matrix. It was written by an early version of the v7.3 writer of this package, hence the
+// zero creation time in its header, in the layout matlab uses: a version 0 superblock, version 1 object headers and
+// symbol table groups. It is not a file saved by matlab.
+func TestReadV73(t *testing.T) {
+	file, err := os.Open("testdata/v73.mat")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer file.Close()
+	f, err := NewFileFromReader(file)
+	assert.NoError(t, err)
+	assert.Equal(t, "7.3", f.Header.Level)
+	assert.ElementsMatch(t, []string{"sample", "x", "y", "z", "Z", "X", "chunked", "g"}, f.GetVarsNames())
+
+	for _, name := range []string{"varTypes", "mixedCells", "simpleStruct"} {
+		file, err := os.Open("testdata/" + name + ".mat")
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		defer file.Close()
+		v5, err := NewFileFromReader(file)
+		assert.NoError(t, err)
+		for _, v := range v5.GetVarsNames() {
+			expected, _ := v5.GetVar(v)
+			m, ok := f.GetVar(v)
+			assert.True(t, ok, v)
+			assert.Equal(t, expected, m, name+": "+v)
+		}
+	}
+
+	m, _ := f.GetVar("chunked")
+	assert.Equal(t, []int32{1000, 200}, m.Dimension)
+	values := m.DoubleArray()
+	assert.Len(t, values, 200000)
+	for i, v := range values {
+		if v != float64(i%7) {
+			t.Fatalf("expects element %d to be %v, got %v", i, float64(i%7), v)
+		}
+	}
+
+	m, _ = f.GetVar("g")
+	assert.Equal(t, mxUINT8, m.Class)
+	assert.True(t, m.flags.isLogical)
+	assert.True(t, m.flags.isGlobal)
+	assert.Equal(t, []interface{}{uint8(1), uint8(0), uint8(0), uint8(1)}, m.value)
+}
+
+func TestReadV73WithoutReaderAt(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/v73.mat")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	// hide the ReadAt method of the bytes.Reader
+	f, err := NewFileFromReader(struct{ *bytes.Buffer }{bytes.NewBuffer(data)})
+	assert.NoError(t, err)
+	m, ok := f.GetVar("chunked")
+	assert.True(t, ok)
+	assert.Equal(t, 200000, len(m.DoubleArray()))
+}
+
+// testdata/dense.mat is written by testdata/gendense.go in the layout libhdf5 uses for the 1.8 file format, with
+// version 2 object headers and groups whose links are kept in fractal heaps indexed by version 2 B-trees. The layout
+// follows the HDF5 file format specification, but the file is not written by libhdf5 or h5py.
+func TestReadV73DenseLinks(t *testing.T) {
+	file, err := os.Open("testdata/dense.mat")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer file.Close()
+	f, err := NewFileFromReader(file)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Err())
+	assert.ElementsMatch(t, []string{"x1", "x2", "x3", "x4", "x5", "x6", "x7", "vec", "chunky", "s"}, f.GetVarsNames())
+
+	m, _ := f.GetVar("x3")
+	assert.Equal(t, &Matrix{Name: "x3", Class: mxDOUBLE, Dimension: []int32{1, 1}, value: []interface{}{4.5}}, m)
+
+	// the class attribute is in a continuation chunk
+	m, _ = f.GetVar("vec")
+	assert.Equal(t, "int32", m.ClassName())
+	assert.Equal(t, []int32{1, 5}, m.Dimension)
+	assert.Equal(t, []int64{-2, -1, 0, 1, 2}, m.IntArray())
+
+	// shuffled and deflated chunks, some of which extend past the matrix
+	m, _ = f.GetVar("chunky")
+	assert.Equal(t, []int32{20, 30}, m.Dimension)
+	values := m.DoubleArray()
+	if assert.Len(t, values, 600) {
+		for i, v := range values {
+			if v != float64(i)/4 {
+				t.Fatalf("expects element %d to be %v, got %v", i, float64(i)/4, v)
+			}
+		}
+	}
+
+	// the links of the struct spread over two heap blocks and three B-tree nodes
+	m, _ = f.GetVar("s")
+	assert.Equal(t, "struct", m.ClassName())
+	fields := m.Struct()
+	assert.Len(t, fields, 60)
+	for i := 1; i <= 60; i++ {
+		name := fmt.Sprintf("f%02d", i)
+		if assert.Contains(t, fields, name) {
+			assert.Equal(t, []float64{float64(i)}, fields[name].DoubleArray(), name)
+		}
+	}
+}
+
+func TestUnshuffle(t *testing.T) {
+	// the bytes of three 4 byte elements are stored byte by byte, followed by a trailing byte
+	shuffled := []byte{1, 5, 9, 2, 6, 10, 3, 7, 11, 4, 8, 12, 13}
+	assert.Equal(t, []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13}, unshuffle(shuffled, 4))
+	assert.Equal(t, shuffled, unshuffle(shuffled, 1))
+}
+
+func TestReadV73Limits(t *testing.T) {
+	out, err := ioutil.TempFile("", "v73")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.Remove(out.Name())
+	w, err := NewFileFromWriter(out, &Header{Level: "7.3"})
+	assert.NoError(t, err)
+	values := make([]interface{}, 15)
+	for i := range values {
+		values[i] = float64(i)
+	}
+	assert.NoError(t, w.WriteElement(&Matrix{Name: "a", Class: mxDOUBLE, Dimension: []int32{3, 5}, value: values}))
+	assert.NoError(t, w.Close())
+	assert.NoError(t, out.Close())
+	data, err := ioutil.ReadFile(out.Name())
+	assert.NoError(t, err)
+
+	for _, test := range []struct {
+		opts *ReaderOptions
+		err  string
+	}{
+		{&ReaderOptions{MaxElementSize: 120, MaxTotalBytes: 120}, ""},
+		{&ReaderOptions{MaxElementSize: 100}, "HDF5 dataset of 120 bytes exceeds the limit of 100 bytes"},
+		{&ReaderOptions{MaxTotalBytes: 100}, "more than the limit of 100 bytes"},
+	} {
+		f, err := NewFileFromReaderWithOptions(bytes.NewReader(data), test.opts)
+		assert.NoError(t, err)
+		f.GetVarsNames()
+		if test.err == "" {
+			assert.NoError(t, f.Err())
+		} else if assert.Error(t, f.Err()) {
+			assert.Contains(t, f.Err().Error(), test.err)
+		}
+	}
+
+	// a dataspace of 1e9 x 3 doubles in a file of a few kilobytes
+	space := encodeDataspace([]uint64{5, 3})
+	i := bytes.Index(data, space)
+	if !assert.True(t, i > 0) {
+		return
+	}
+	hostile := append([]byte(nil), data...)
+	copy(hostile[i:], encodeDataspace([]uint64{1e9, 3}))
+	for _, r := range []io.Reader{bytes.NewReader(hostile), struct{ *bytes.Buffer }{bytes.NewBuffer(hostile)}} {
+		f, err := NewFileFromReader(r)
+		assert.NoError(t, err)
+		f.GetVarsNames()
+		assert.EqualError(t, f.Err(), "cannot read variable a: HDF5 dataset of 24000000000 bytes is larger than the file can hold")
+	}
+	copy(hostile[i:], encodeDataspace([]uint64{1 << 32, 1 << 32}))
+	f, err := NewFileFromReader(bytes.NewReader(hostile))
+	assert.NoError(t, err)
+	f.GetVarsNames()
+	assert.Error(t, f.Err())
+}
+
+func TestReadV73InvalidSparse(t *testing.T) {
+	out, err := ioutil.TempFile("", "v73")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.Remove(out.Name())
+	w, err := NewFileFromWriter(out, &Header{Level: "7.3"})
+	assert.NoError(t, err)
+	assert.NoError(t, w.WriteElement(&Matrix{Name: "sp", Class: mxSPARSE, Dimension: []int32{3, 2},
+		value: []interface{}{1.0, 2.0}, ir: []int{0, 2}, jc: []int{0, 1, 2}}))
+	assert.NoError(t, w.Close())
+	assert.NoError(t, out.Close())
+	data, err := ioutil.ReadFile(out.Name())
+	assert.NoError(t, err)
+
+	indices := func(jc ...int64) []byte {
+		var buf []byte
+		for _, v := range jc {
+			buf = binary.LittleEndian.AppendUint64(buf, uint64(v))
+		}
+		return buf
+	}
+	i := bytes.Index(data, indices(0, 1, 2))
+	if !assert.True(t, i > 0) {
+		return
+	}
+	// a negative column index that the other indices don't give away
+	copy(data[i:], indices(0, -5, 2))
+	f, err := NewFileFromReader(bytes.NewReader(data))
+	assert.NoError(t, err)
+	f.GetVarsNames()
+	assert.EqualError(t, f.Err(), "cannot read variable sp: invalid sparse matrix sp, column indices must not decrease")
+}
+
+func TestWriteV73(t *testing.T) {
+	out, err := ioutil.TempFile("", "v73")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+	w, err := NewFileFromWriter(out, &Header{Level: "7.3", Platform: "GLNXA64"})
+	assert.NoError(t, err)
+
+	var expected []*Matrix
+	for _, name := range []string{"varTypes", "mixedCells", "simpleStruct"} {
+		file, err := os.Open("testdata/" + name + ".mat")
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		defer file.Close()
+		f, err := NewFileFromReader(file)
+		assert.NoError(t, err)
+		for _, v := range f.GetVarsNames() {
+			m, _ := f.GetVar(v)
+			expected = append(expected, m)
+		}
+	}
+	scalar := func(v float64) *Matrix {
+		return &Matrix{Class: mxDOUBLE, Dimension: []int32{1, 1}, value: []interface{}{v}}
+	}
+	large := &Matrix{Name: "large", Class: mxINT32, Dimension: []int32{700, 300, 3}}
+	for i := 0; i < large.numel(); i++ {
+		large.value = append(large.value, int32(i))
+	}
+	complexSingle := &Matrix{Name: "complexSingle", Class: mxSINGLE, Dimension: []int32{1, 2},
+		value: []interface{}{float32(1), float32(2)}, imag: []interface{}{float32(-1), float32(0.5)}}
+	complexSingle.flags.isComplex = true
+	sparse := &Matrix{Name: "sparse", Class: mxSPARSE, Dimension: []int32{3, 2},
+		value: []interface{}{1.0, 2.0}, ir: []int{0, 2}, jc: []int{0, 1, 2}}
+	structArray := &Matrix{Name: "structArray", Class: mxSTRUCT, Dimension: []int32{1, 2}, fields: []string{"b", "a"},
+		value: []interface{}{
+			map[string]*Matrix{"a": scalar(1), "b": scalar(2)},
+			map[string]*Matrix{"a": scalar(3), "b": scalar(4)},
+		}}
+	expected = append(expected, large, complexSingle, sparse, structArray,
+		&Matrix{Name: "empty", Class: mxCHAR, Dimension: []int32{0, 5}},
+		&Matrix{Name: "emptyCell", Class: mxCELL, Dimension: []int32{0, 0}},
+	)
+	for _, m := range expected {
+		assert.NoError(t, w.WriteElement(m), m.Name)
+	}
+	assert.NoError(t, w.Close())
+	assert.Error(t, w.WriteElement(scalar(1)))
+
+	_, err = out.Seek(0, 0)
+	assert.NoError(t, err)
+	f, err := NewFileFromReader(out)
+	assert.NoError(t, err)
+	assert.Equal(t, "7.3", f.Header.Level)
+	assert.Equal(t, len(expected), len(f.GetVarsNames()))
+	for _, e := range expected {
+		m, ok := f.GetVar(e.Name)
+		assert.True(t, ok, e.Name)
+		assert.Equal(t, e, m, e.Name)
+	}
+}
+
+func TestWriteV73Errors(t *testing.T) {
+	_, err := NewFileFromWriter(&bytes.Buffer{}, &Header{Level: "7.3"})
+	assert.Error(t, err)
+
+	out, err := ioutil.TempFile("", "v73")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+	w, err := NewFileFromWriter(out, &Header{Level: "7.3"})
+	assert.NoError(t, err)
+	assert.Error(t, w.WriteElement(&Matrix{Name: "1x", Class: mxDOUBLE, Dimension: []int32{1, 1}, value: []interface{}{1.0}}))
+	assert.Error(t, w.WriteElement(&Matrix{Name: "short", Class: mxDOUBLE, Dimension: []int32{2, 2}, value: []interface{}{1.0}}))
+	assert.Error(t, w.WriteElement(&RawElement{typ: DTmiMATRIX}))
+}
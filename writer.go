@@ -0,0 +1,335 @@
+package matlab
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"runtime"
+	"time"
+)
+
+// NewFileFromWriter creates a file that writes to w and writes the header straight away. If h is nil, a little endian
+// level 5 header created now is used. Level 4 files, which have no header, are written when h.Level is "4.0". v7.3
+// files are written when h.Level is "7.3", which needs w to be an io.WriteSeeker and the file to be closed. Octave
+// text files are written when h.Level is "text".
+func NewFileFromWriter(w io.Writer, h *Header) (f *File, err error) {
+	if h == nil {
+		h = &Header{Platform: runtime.GOOS, Created: time.Now()}
+	}
+	if h.Level == "" {
+		h.Level = "5.0"
+	}
+	if h.Endianess == nil {
+		h.Endianess = binary.LittleEndian
+	}
+	f = &File{Header: h, w: w, vars: map[string]*Matrix{}}
+	if h.Level != "7.3" {
+		err = writeHeader(w, h)
+		return
+	}
+	ws, ok := w.(io.WriteSeeker)
+	if !ok {
+		return nil, fmt.Errorf("can only write v7.3 files to an io.WriteSeeker")
+	}
+	if h.Endianess != binary.LittleEndian {
+		return nil, fmt.Errorf("can only write little endian v7.3 files")
+	}
+	start, err := ws.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	if err = writeHeader(w, h); err != nil {
+		return nil, err
+	}
+	f.h5w = &v73Writer{h5Writer: newH5Writer(ws, start+v73UserBlockLen)}
+	return f, f.h5w.err
+}
+
+// Close finishes writing a v7.3 file. It does nothing for other files.
+func (f *File) Close() error {
+	if f.h5w == nil {
+		return nil
+	}
+	w := f.h5w
+	f.h5w = nil
+	return w.close()
+}
+
+func writeHeader(w io.Writer, h *Header) error {
+	if h.Level == "4.0" {
+		return nil
+	}
+	if h.Level == "text" {
+		return writeTextHeader(w, h)
+	}
+	if h.Level != "5.0" && h.Level != "7.3" {
+		return fmt.Errorf("can only write matlab level 4, 5 or 7.3 files or Octave text files")
+	}
+	text := h.String()
+	version := uint16(0x0100)
+	if h.Level == "7.3" {
+		text += " HDF5 schema 1.00 ."
+		version = 0x0200
+	}
+	if len(text) > headerTextLen {
+		return fmt.Errorf("header text is too long: %d bytes", len(text))
+	}
+	buf := make([]byte, headerLen)
+	copy(buf, text)
+	for i := len(text); i < headerTextLen; i++ {
+		buf[i] = ' '
+	}
+	// the subsystem data offset is left as zeros. Then comes the version followed by the endian indicator, which reads
+	// as "MI" in the byte order of the file.
+	h.Endianess.PutUint16(buf[headerTextLen+headerSubsystemOffsetLen:], version)
+	h.Endianess.PutUint16(buf[headerTextLen+headerSubsystemOffsetLen+2:], 'M'<<8|'I')
+	if h.Level == "7.3" {
+		// the HDF5 superblock follows the user block
+		buf = append(buf, make([]byte, v73UserBlockLen-headerLen)...)
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+// WriteElement writes a single element to a file's writer. Matrices are written as variables, raw elements are
+// written back as they were read.
+func (f *File) WriteElement(e Element) error {
+	if f.w == nil {
+		return fmt.Errorf("file was not created for writing")
+	}
+	if f.stream != nil {
+		return fmt.Errorf("variable is still being written")
+	}
+	if f.writeErr != nil {
+		return fmt.Errorf("cannot write to the file after writing a variable failed: %v", f.writeErr)
+	}
+	bo := f.Header.Endianess
+	if f.Header.Level == "7.3" {
+		m, ok := e.(*Matrix)
+		if !ok {
+			return fmt.Errorf("cannot write element of type %s to a v7.3 file", e.Type())
+		}
+		if f.h5w == nil {
+			return fmt.Errorf("file is closed")
+		}
+		return f.h5w.writeVar(m)
+	}
+	if f.Header.Level == "4.0" {
+		m, ok := e.(*Matrix)
+		if !ok {
+			return fmt.Errorf("cannot write element of type %s to a level 4 file", e.Type())
+		}
+		return writeV4Matrix(f.w, bo, m)
+	}
+	if f.Header.Level == "text" {
+		m, ok := e.(*Matrix)
+		if !ok {
+			return fmt.Errorf("cannot write element of type %s to an Octave text file", e.Type())
+		}
+		return writeTextMatrix(f.w, m)
+	}
+	var buf []byte
+	switch el := e.(type) {
+	case *Matrix:
+		data, err := encodeMatrix(bo, el)
+		if err != nil {
+			return err
+		}
+		buf = packElement(bo, DTmiMATRIX, data)
+	case *RawElement:
+		if el.bo != bo {
+			return fmt.Errorf("cannot write raw element with a different byte order than the file")
+		}
+		buf = el.bytes()
+	default:
+		return fmt.Errorf("cannot write element of type %s at the top level", e.Type())
+	}
+	_, err := f.w.Write(buf)
+	return err
+}
+
+// encodeMatrix returns the data of the miMATRIX element for m, without its tag
+func encodeMatrix(bo binary.ByteOrder, m *Matrix) ([]byte, error) {
+	if raw, ok := m.Raw(); ok {
+		if raw.bo != bo {
+			return nil, fmt.Errorf("cannot write raw matrix %s with a different byte order than the file", m.Name)
+		}
+		if m.Class != mxOPAQUE {
+			// the name may have been changed since it was read
+			if name, err := readMatrixName(bo, bytes.NewReader(raw.Data)); err != nil {
+				return nil, err
+			} else if name != m.Name {
+				return renameMatrix(bo, raw.Data, m.Name)
+			}
+		}
+		return raw.Data, nil
+	}
+
+	var buf bytes.Buffer
+	flags := make([]byte, 8)
+	word := uint32(m.Class)
+	if m.flags.isLogical {
+		word |= flagLogical
+	}
+	if m.flags.isGlobal {
+		word |= flagGlobal
+	}
+	if m.flags.isComplex {
+		word |= flagComplex
+	}
+	bo.PutUint32(flags, word)
+	if m.Class == mxSPARSE {
+		// the maximum number of nonzero elements
+		bo.PutUint32(flags[4:], uint32(len(m.ir)))
+	}
+	buf.Write(packElement(bo, DTmiUINT32, flags))
+
+	dims := make([]byte, 4*len(m.Dimension))
+	for i, d := range m.Dimension {
+		bo.PutUint32(dims[4*i:], uint32(d))
+	}
+	buf.Write(packElement(bo, DTmiINT32, dims))
+	buf.Write(packElement(bo, DTmiINT8, []byte(m.Name)))
+
+	switch m.Class {
+	case mxCELL:
+		for _, v := range m.value {
+			c, ok := v.(*Matrix)
+			if !ok {
+				return nil, fmt.Errorf("expects cells of %s to be matrices, got %T", m.Name, v)
+			}
+			data, err := encodeMatrix(bo, c)
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(packElement(bo, DTmiMATRIX, data))
+		}
+	case mxSTRUCT:
+		fields := m.FieldNames()
+		maxLength := 1
+		for _, f := range fields {
+			if len(f)+1 > maxLength {
+				maxLength = len(f) + 1
+			}
+		}
+		length := make([]byte, 4)
+		bo.PutUint32(length, uint32(maxLength))
+		buf.Write(packElement(bo, DTmiINT32, length))
+		names := make([]byte, maxLength*len(fields))
+		for i, f := range fields {
+			copy(names[i*maxLength:], f)
+		}
+		buf.Write(packElement(bo, DTmiINT8, names))
+		for _, v := range m.value {
+			keys, ok := v.(map[string]*Matrix)
+			if !ok {
+				return nil, fmt.Errorf("expects elements of struct %s to be maps, got %T", m.Name, v)
+			}
+			for _, f := range fields {
+				c := keys[f]
+				if c == nil {
+					// missing fields are written as empty arrays
+					c = &Matrix{Class: mxDOUBLE, Dimension: []int32{0, 0}}
+				}
+				data, err := encodeMatrix(bo, c)
+				if err != nil {
+					return nil, err
+				}
+				buf.Write(packElement(bo, DTmiMATRIX, data))
+			}
+		}
+	case mxCHAR, mxDOUBLE, mxSINGLE, mxINT8, mxUINT8, mxINT16, mxUINT16, mxINT32, mxUINT32, mxINT64, mxUINT64:
+		dt := m.Class.dataType()
+		buf.Write(packElement(bo, dt, encodeValues(bo, m.Class, m.value)))
+		if m.flags.isComplex {
+			buf.Write(packElement(bo, dt, encodeValues(bo, m.Class, m.imag)))
+		}
+	case mxSPARSE:
+		for _, indices := range [][]int{m.ir, m.jc} {
+			data := make([]byte, 4*len(indices))
+			for i, v := range indices {
+				bo.PutUint32(data[4*i:], uint32(v))
+			}
+			buf.Write(packElement(bo, DTmiINT32, data))
+		}
+		valueClass := mxDOUBLE
+		if m.flags.isLogical {
+			valueClass = mxUINT8
+		}
+		buf.Write(packElement(bo, valueClass.dataType(), encodeValues(bo, valueClass, m.value)))
+		if m.flags.isComplex {
+			buf.Write(packElement(bo, valueClass.dataType(), encodeValues(bo, valueClass, m.imag)))
+		}
+	default:
+		return nil, fmt.Errorf("cannot write matrix %s of class %s", m.Name, m.Class)
+	}
+	return buf.Bytes(), nil
+}
+
+// dataType returns the data type values of the class are stored as
+func (c mxClass) dataType() DataType {
+	switch c {
+	case mxCHAR:
+		return DTmiUINT16
+	case mxDOUBLE:
+		return DTmiDOUBLE
+	case mxSINGLE:
+		return DTmiSINGLE
+	case mxINT8:
+		return DTmiINT8
+	case mxUINT8:
+		return DTmiUINT8
+	case mxINT16:
+		return DTmiINT16
+	case mxUINT16:
+		return DTmiUINT16
+	case mxINT32:
+		return DTmiINT32
+	case mxUINT32:
+		return DTmiUINT32
+	case mxINT64:
+		return DTmiINT64
+	case mxUINT64:
+		return DTmiUINT64
+	default:
+		return DataTypeUnknown
+	}
+}
+
+// encodeValues packs the values of a numeric or character matrix as the data type of its class
+func encodeValues(bo binary.ByteOrder, c mxClass, values []interface{}) []byte {
+	size := c.dataType().NumBytes()
+	buf := make([]byte, size*len(values))
+	for i, v := range values {
+		putValue(bo, buf[i*size:(i+1)*size], castValue(c, v))
+	}
+	return buf
+}
+
+// putValue encodes a value of the go type of a class into b
+func putValue(bo binary.ByteOrder, b []byte, v interface{}) {
+	switch x := v.(type) {
+	case float64:
+		bo.PutUint64(b, math.Float64bits(x))
+	case float32:
+		bo.PutUint32(b, math.Float32bits(x))
+	case int8:
+		b[0] = byte(x)
+	case uint8:
+		b[0] = x
+	case int16:
+		bo.PutUint16(b, uint16(x))
+	case uint16:
+		bo.PutUint16(b, x)
+	case int32:
+		bo.PutUint32(b, uint32(x))
+	case uint32:
+		bo.PutUint32(b, x)
+	case int64:
+		bo.PutUint64(b, uint64(x))
+	case uint64:
+		bo.PutUint64(b, x)
+	}
+}
@@ -0,0 +1,81 @@
+package matlab
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteRoundTrip(t *testing.T) {
+	for _, name := range []string{"varTypes", "mixedCells", "simpleStruct"} {
+		file, err := os.Open("testdata/" + name + ".mat")
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		defer file.Close()
+		f, err := NewFileFromReader(file)
+		assert.NoError(t, err)
+
+		var buf bytes.Buffer
+		w, err := NewFileFromWriter(&buf, nil)
+		assert.NoError(t, err)
+		for _, v := range f.GetVarsNames() {
+			m, _ := f.GetVar(v)
+			assert.NoError(t, w.WriteElement(m))
+		}
+
+		f2, err := NewFileFromReader(&buf)
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, f.GetVarsNames(), f2.GetVarsNames())
+		for _, v := range f.GetVarsNames() {
+			m, _ := f.GetVar(v)
+			m2, _ := f2.GetVar(v)
+			assert.Equal(t, m, m2, name+": "+v)
+		}
+	}
+}
+
+func TestRawElements(t *testing.T) {
+	bo := binary.LittleEndian
+	var buf bytes.Buffer
+	w, err := NewFileFromWriter(&buf, nil)
+	assert.NoError(t, err)
+	// a function handle, which this package cannot decode
+	fn, err := encodeMatrix(bo, &Matrix{Name: "fn", Class: mxUINT8, Dimension: []int32{1, 3}, value: []interface{}{uint8(1), uint8(2), uint8(3)}})
+	assert.NoError(t, err)
+	fn[8] = byte(mxFUNCTION)
+	buf.Write(packElement(bo, DTmiMATRIX, fn))
+	// an element of unknown data type
+	unknown := packElement(bo, DataType(99), []byte("opaque bytes"))
+	buf.Write(unknown)
+	assert.NoError(t, w.WriteElement(&Matrix{Name: "x", Class: mxDOUBLE, Dimension: []int32{1, 1}, value: []interface{}{1.0}}))
+
+	f, err := NewFileFromReader(&buf)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"fn", "x"}, f.GetVarsNames())
+	m, _ := f.GetVar("fn")
+	assert.Equal(t, mxFUNCTION, m.Class)
+	assert.Equal(t, []int32{1, 3}, m.Dimension)
+	raw, ok := m.Raw()
+	assert.True(t, ok)
+	assert.Equal(t, fn, raw.Data)
+	assert.Len(t, f.RawElements(), 1)
+	assert.Equal(t, DataType(99), f.RawElements()[0].Type())
+
+	// raw elements are written back unchanged, renamed matrices get a new name
+	var out bytes.Buffer
+	w, err = NewFileFromWriter(&out, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, w.WriteElement(f.RawElements()[0]))
+	assert.NoError(t, w.WriteElement(m))
+	assert.Equal(t, unknown, out.Bytes()[headerLen:headerLen+len(unknown)])
+	assert.Equal(t, packElement(bo, DTmiMATRIX, fn), out.Bytes()[headerLen+len(unknown):])
+	m.Name = "handle"
+	assert.NoError(t, w.WriteElement(m))
+	f, err = NewFileFromReader(&out)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"fn", "handle"}, f.GetVarsNames())
+}